@@ -0,0 +1,236 @@
+// Package bitbucket is client of Bitbucket Cloud REST API 2.0. It provides
+// pull requests of bitbucket.org, which implement review services of the
+// stash package, so they can be reviewed with ash the same way as pull
+// requests of Stash.
+package bitbucket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/op/go-logging"
+	"github.com/seletskiy/ash/stash"
+)
+
+// logger is logger of the package, its output and levels are set up by
+// application with go-logging module "bitbucket".
+var logger = logging.MustGetLogger("bitbucket")
+
+// DefaultURL is URL of Bitbucket Cloud API.
+const DefaultURL = "https://api.bitbucket.org/2.0"
+
+// pageLen is number of values requested per page, it is the maximum which
+// is allowed for all paged resources.
+const pageLen = 50
+
+// Client is client of Bitbucket Cloud API. Requests are authenticated
+// either by OAuth access token, if it is set, or by user name and app
+// password.
+type Client struct {
+	URL      string
+	User     string
+	Password string
+	Token    string
+	HTTP     *http.Client
+}
+
+type pagedReply struct {
+	Next   string
+	Values json.RawMessage
+}
+
+// account is user as it is returned by API.
+type account struct {
+	DisplayName string `json:"display_name"`
+	Nickname    string
+	Username    string
+	AccountId   string `json:"account_id"`
+}
+
+// GetName returns name which identifies user, nickname is used, because
+// usernames are not returned anymore for privacy reasons.
+func (user account) GetName() string {
+	if user.Username != "" {
+		return user.Username
+	}
+
+	if user.Nickname != "" {
+		return user.Nickname
+	}
+
+	return user.AccountId
+}
+
+type content struct {
+	Raw string `json:"raw"`
+}
+
+// PullRequest returns pull request of repository in given workspace.
+func (client *Client) PullRequest(
+	workspace string, repo string, id int64,
+) *PullRequest {
+	return &PullRequest{
+		client:    client,
+		Workspace: workspace,
+		Repo:      repo,
+		Id:        id,
+	}
+}
+
+func (client *Client) getURL(path string, query url.Values) string {
+	if strings.HasPrefix(path, "http://") ||
+		strings.HasPrefix(path, "https://") {
+		return path
+	}
+
+	base := client.URL
+	if base == "" {
+		base = DefaultURL
+	}
+
+	result := strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+	if len(query) > 0 {
+		result += "?" + query.Encode()
+	}
+
+	return result
+}
+
+// do sends request to API and returns body of successful response. Non-2xx
+// responses are returned as stash.StatusError, so they are handled by
+// application the same way as errors of Stash.
+func (client *Client) do(
+	method string, path string, query url.Values, payload interface{},
+) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequest(method, client.getURL(path, query), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	if client.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+client.Token)
+	} else if client.User != "" {
+		request.SetBasicAuth(client.User, client.Password)
+	}
+
+	httpClient := client.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	logger.Debug("%s %s", method, request.URL)
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil, stash.StatusError{
+			Status: response.StatusCode,
+			Body:   []byte(getErrorMessage(data)),
+		}
+	}
+
+	return data, nil
+}
+
+// getErrorMessage returns message of API error response, or the response
+// itself, if it is not in the format of API error.
+func getErrorMessage(data []byte) string {
+	response := struct {
+		Error struct {
+			Message string
+			Detail  string
+		}
+	}{}
+
+	err := json.Unmarshal(data, &response)
+	if err != nil || response.Error.Message == "" {
+		return strings.TrimSpace(string(data))
+	}
+
+	if response.Error.Detail != "" {
+		return response.Error.Message + ": " + response.Error.Detail
+	}
+
+	return response.Error.Message
+}
+
+func (client *Client) get(
+	path string, query url.Values, result interface{},
+) error {
+	data, err := client.do("GET", path, query, nil)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, result)
+}
+
+// getPaged retrieves pages of given resource following their next links,
+// until limit of values is reached or there are no more pages. Zero limit
+// means that all pages are retrieved.
+func (client *Client) getPaged(
+	path string, query url.Values, limit int,
+	callback func(values json.RawMessage) (int, error),
+) error {
+	if query == nil {
+		query = url.Values{}
+	}
+
+	query.Set("pagelen", fmt.Sprint(pageLen))
+
+	count := 0
+	for path != "" {
+		reply := pagedReply{}
+
+		err := client.get(path, query, &reply)
+		if err != nil {
+			return err
+		}
+
+		received, err := callback(reply.Values)
+		if err != nil {
+			return err
+		}
+
+		count += received
+		if limit > 0 && count >= limit {
+			return nil
+		}
+
+		// next link already contains all query parameters
+		path = reply.Next
+		query = nil
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package bitbucket
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/seletskiy/godiff"
+)
+
+// Matches hunk header of unified diff, spans are optional and default to
+// one line.
+var reHunkHeader = regexp.MustCompile(
+	`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`,
+)
+
+// diffParser reads unified diff in git format, which is returned by
+// Bitbucket Cloud, into diffs of Stash format, which are rendered in
+// review file.
+type diffParser struct {
+	diffs []*godiff.Diff
+
+	diff    *godiff.Diff
+	hunk    *godiff.Hunk
+	segment *godiff.Segment
+
+	// next line numbers and number of lines left in current hunk
+	source      int64
+	destination int64
+	sourceLeft  int64
+	destLeft    int64
+}
+
+// parseDiff parses unified diff of several files.
+func parseDiff(data string) ([]*godiff.Diff, error) {
+	parser := diffParser{}
+
+	for number, line := range strings.Split(data, "\n") {
+		err := parser.parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse diff at line %d: %s",
+				number+1, err)
+		}
+	}
+
+	return parser.diffs, nil
+}
+
+func (parser *diffParser) parseLine(line string) error {
+	if parser.hunk != nil {
+		return parser.parseHunkLine(line)
+	}
+
+	switch {
+	case strings.HasPrefix(line, "diff --git "):
+		source, destination := parseGitPaths(
+			strings.TrimPrefix(line, "diff --git "),
+		)
+
+		parser.diff = &godiff.Diff{}
+		parser.diff.Source.ToString = source
+		parser.diff.Destination.ToString = destination
+		parser.diffs = append(parser.diffs, parser.diff)
+
+		return nil
+
+	case parser.diff == nil:
+		return nil
+
+	case strings.HasPrefix(line, "new file mode "):
+		parser.diff.Source.ToString = ""
+
+	case strings.HasPrefix(line, "deleted file mode "):
+		parser.diff.Destination.ToString = ""
+
+	case strings.HasPrefix(line, "rename from "):
+		parser.diff.Source.ToString = strings.TrimPrefix(line, "rename from ")
+
+	case strings.HasPrefix(line, "rename to "):
+		parser.diff.Destination.ToString = strings.TrimPrefix(line, "rename to ")
+
+	case strings.HasPrefix(line, "Binary files "):
+		parser.diff.Binary = true
+
+	case strings.HasPrefix(line, "--- "):
+		parser.diff.Source.ToString = parseFilePath(line[4:], "a/")
+
+	case strings.HasPrefix(line, "+++ "):
+		parser.diff.Destination.ToString = parseFilePath(line[4:], "b/")
+
+	case strings.HasPrefix(line, "@@ "):
+		return parser.parseHunkHeader(line)
+	}
+
+	return nil
+}
+
+func (parser *diffParser) parseHunkHeader(line string) error {
+	matches := reHunkHeader.FindStringSubmatch(line)
+	if matches == nil {
+		return fmt.Errorf("invalid hunk header: %q", line)
+	}
+
+	numbers := make([]int64, 4)
+	for i, match := range matches[1:] {
+		numbers[i] = 1
+		if match == "" {
+			continue
+		}
+
+		number, err := strconv.ParseInt(match, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		numbers[i] = number
+	}
+
+	parser.hunk = &godiff.Hunk{
+		SourceLine:      numbers[0],
+		SourceSpan:      numbers[1],
+		DestinationLine: numbers[2],
+		DestinationSpan: numbers[3],
+	}
+
+	parser.diff.Hunks = append(parser.diff.Hunks, parser.hunk)
+	parser.segment = nil
+
+	parser.source, parser.sourceLeft = numbers[0], numbers[1]
+	parser.destination, parser.destLeft = numbers[2], numbers[3]
+
+	// empty hunk of removed or added file
+	if parser.sourceLeft == 0 && parser.destLeft == 0 {
+		parser.hunk = nil
+	}
+
+	return nil
+}
+
+func (parser *diffParser) parseHunkLine(line string) error {
+	if strings.HasPrefix(line, `\`) {
+		// '\ No newline at end of file'
+		return nil
+	}
+
+	// trailing spaces of empty context lines can be stripped in transfer
+	if line == "" {
+		line = " "
+	}
+
+	diffLine := &godiff.Line{
+		Source:      parser.source,
+		Destination: parser.destination,
+		Line:        line[1:],
+	}
+
+	var segmentType string
+	switch line[0] {
+	case ' ':
+		segmentType = godiff.SegmentTypeContext
+		parser.source++
+		parser.destination++
+		parser.sourceLeft--
+		parser.destLeft--
+	case '-':
+		segmentType = godiff.SegmentTypeRemoved
+		parser.source++
+		parser.sourceLeft--
+	case '+':
+		segmentType = godiff.SegmentTypeAdded
+		parser.destination++
+		parser.destLeft--
+	default:
+		return fmt.Errorf("unexpected line in hunk: %q", line)
+	}
+
+	if parser.segment == nil || parser.segment.Type != segmentType {
+		parser.segment = &godiff.Segment{Type: segmentType}
+		parser.hunk.Segments = append(parser.hunk.Segments, parser.segment)
+	}
+
+	parser.segment.Lines = append(parser.segment.Lines, diffLine)
+
+	if parser.sourceLeft <= 0 && parser.destLeft <= 0 {
+		parser.hunk = nil
+		parser.segment = nil
+	}
+
+	return nil
+}
+
+// parseGitPaths returns source and destination paths of 'diff --git' header.
+// Paths can contain spaces, so header is split in the middle, when both
+// paths are the same, which is the most common case.
+func parseGitPaths(paths string) (string, string) {
+	middle := len(paths) / 2
+	if len(paths)%2 == 1 && paths[middle] == ' ' &&
+		strings.HasPrefix(paths, "a/") &&
+		strings.HasPrefix(paths[middle+1:], "b/") &&
+		paths[2:middle] == paths[middle+3:] {
+		return paths[2:middle], paths[middle+3:]
+	}
+
+	separator := strings.LastIndex(paths, " b/")
+	if separator < 0 {
+		return "", ""
+	}
+
+	return strings.TrimPrefix(paths[:separator], "a/"), paths[separator+3:]
+}
+
+// parseFilePath returns path of '---' or '+++' line, which is empty for
+// /dev/null.
+func parseFilePath(path string, prefix string) string {
+	// git appends tab to paths containing spaces
+	path = strings.TrimSuffix(path, "\t")
+
+	if path == "/dev/null" {
+		return ""
+	}
+
+	return strings.TrimPrefix(path, prefix)
+}
@@ -0,0 +1,205 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/seletskiy/godiff"
+)
+
+const testDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@
+ package main
+-var a = 1
++var a = 2
++var b = 3
+
+diff --git a/new file.txt b/new file.txt
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/new file.txt
+@@ -0,0 +1 @@
++hello
+diff --git a/old.go b/renamed.go
+similarity index 100%
+rename from old.go
+rename to renamed.go
+diff --git a/logo.png b/logo.png
+deleted file mode 100644
+Binary files a/logo.png and /dev/null differ
+`
+
+type testLine struct {
+	Type        string
+	Source      int64
+	Destination int64
+	Line        string
+}
+
+func getTestLines(diff *godiff.Diff) []testLine {
+	lines := []testLine{}
+	for _, hunk := range diff.Hunks {
+		for _, segment := range hunk.Segments {
+			for _, line := range segment.Lines {
+				lines = append(lines, testLine{
+					segment.Type, line.Source, line.Destination, line.Line,
+				})
+			}
+		}
+	}
+
+	return lines
+}
+
+func TestParseDiff(t *testing.T) {
+	diffs, err := parseDiff(testDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := [][2]string{}
+	for _, diff := range diffs {
+		paths = append(paths,
+			[2]string{diff.Source.ToString, diff.Destination.ToString},
+		)
+	}
+
+	expectedPaths := [][2]string{
+		{"main.go", "main.go"},
+		{"", "new file.txt"},
+		{"old.go", "renamed.go"},
+		{"logo.png", ""},
+	}
+
+	if !reflect.DeepEqual(expectedPaths, paths) {
+		t.Fatalf("unexpected paths\n%#v\n%#v", expectedPaths, paths)
+	}
+
+	expectedLines := []testLine{
+		{godiff.SegmentTypeContext, 1, 1, "package main"},
+		{godiff.SegmentTypeRemoved, 2, 2, "var a = 1"},
+		{godiff.SegmentTypeAdded, 3, 2, "var a = 2"},
+		{godiff.SegmentTypeAdded, 3, 3, "var b = 3"},
+		{godiff.SegmentTypeContext, 3, 4, ""},
+	}
+
+	lines := getTestLines(diffs[0])
+	if !reflect.DeepEqual(expectedLines, lines) {
+		t.Fatalf("unexpected lines\n%#v\n%#v", expectedLines, lines)
+	}
+
+	lines = getTestLines(diffs[1])
+	if len(lines) != 1 || lines[0].Destination != 1 {
+		t.Fatalf("unexpected lines of new file: %#v", lines)
+	}
+
+	if len(diffs[2].Hunks) != 0 || !diffs[3].Binary {
+		t.Fatalf("unexpected diffs of renamed or binary file")
+	}
+}
+
+func TestAttachComments(t *testing.T) {
+	diffs, err := parseDiff(testDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comments := []comment{}
+	err = json.Unmarshal([]byte(`[
+		{"id": 1, "content": {"raw": "added"},
+			"inline": {"path": "main.go", "from": null, "to": 3}},
+		{"id": 2, "content": {"raw": "removed"},
+			"inline": {"path": "main.go", "from": 2, "to": null}},
+		{"id": 3, "content": {"raw": "reply"}, "parent": {"id": 1}},
+		{"id": 4, "content": {"raw": "file"},
+			"inline": {"path": "main.go"}},
+		{"id": 5, "content": {"raw": "outdated"},
+			"inline": {"path": "main.go", "from": null, "to": 100}},
+		{"id": 6, "content": {"raw": ""}, "deleted": true,
+			"inline": {"path": "main.go", "from": null, "to": 1}},
+		{"id": 7, "content": {"raw": "general"}},
+		{"id": 8, "content": {"raw": "older commit"},
+			"inline": {"path": "main.go", "from": null, "to": 3,
+				"outdated": true}},
+		{"id": 9, "content": {"raw": "reverted"},
+			"user": {"display_name": "John"},
+			"inline": {"path": "reverted.go", "from": null, "to": 1}}
+	]`), &comments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notes := attachComments(diffs, comments, true)
+
+	anchors := map[int64]godiff.CommentAnchor{}
+	for _, hunk := range diffs[0].Hunks {
+		for _, segment := range hunk.Segments {
+			for _, line := range segment.Lines {
+				for _, comment := range line.Comments {
+					anchors[comment.Id] = comment.Anchor
+				}
+			}
+		}
+	}
+
+	expected := map[int64]godiff.CommentAnchor{
+		1: {Path: "main.go", SrcPath: "main.go", Line: 3,
+			LineType: godiff.SegmentTypeAdded},
+		2: {Path: "main.go", SrcPath: "main.go", Line: 2,
+			LineType: godiff.SegmentTypeRemoved},
+	}
+
+	if !reflect.DeepEqual(expected, anchors) {
+		t.Fatalf("unexpected line comments\n%#v\n%#v", expected, anchors)
+	}
+
+	if len(diffs[0].LineComments) != 2 ||
+		len(diffs[0].LineComments[0].Comments) != 1 ||
+		diffs[0].LineComments[0].Comments[0].Text != "reply" {
+		t.Fatalf("reply is not attached to its parent")
+	}
+
+	files := []int64{}
+	for _, comment := range diffs[0].FileComments {
+		files = append(files, comment.Id)
+	}
+
+	if !reflect.DeepEqual([]int64{4, 5, 8}, files) {
+		t.Fatalf("unexpected file comments: %v", files)
+	}
+
+	if len(notes) != 1 || len(notes[0].FileComments) != 1 ||
+		notes[0].FileComments[0].Id != 9 ||
+		notes[0].Note != "John commented on reverted.go, "+
+			"which is not changed anymore:" {
+		t.Fatalf("comment to missing file is not kept: %#v", notes)
+	}
+}
+
+func TestAttachCommentsToCommitsDiff(t *testing.T) {
+	diffs, err := parseDiff(testDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comments := []comment{}
+	err = json.Unmarshal([]byte(`[
+		{"id": 1, "content": {"raw": "added"},
+			"inline": {"path": "main.go", "from": null, "to": 3}}
+	]`), &comments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attachComments(diffs, comments, false)
+
+	if len(diffs[0].LineComments) != 0 ||
+		len(diffs[0].FileComments) != 1 {
+		t.Fatalf("comment is not added as file comment")
+	}
+}
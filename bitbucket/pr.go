@@ -0,0 +1,400 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// ErrReopenUnsupported is returned on attempt to reopen pull request,
+// because declined pull requests can not be reopened in Bitbucket Cloud.
+var ErrReopenUnsupported = errors.New(
+	"declined pull requests can not be reopened in Bitbucket Cloud",
+)
+
+// Matches author of commit in the form of 'Name <email>'.
+var reCommitAuthor = regexp.MustCompile(`^(.*?)\s*<([^>]*)>$`)
+
+// PullRequest is pull request of Bitbucket Cloud repository.
+type PullRequest struct {
+	client *Client
+
+	Workspace string
+	Repo      string
+	Id        int64
+}
+
+var (
+	_ stash.PullRequestService = (*PullRequest)(nil)
+	_ stash.CommentService     = (*PullRequest)(nil)
+)
+
+type pullRequestInfo struct {
+	Id          int64
+	Title       string
+	Description string
+	State       string
+	CreatedOn   string `json:"created_on"`
+	UpdatedOn   string `json:"updated_on"`
+
+	Author account
+
+	Source struct {
+		Branch struct {
+			Name string
+		}
+		Commit struct {
+			Hash string
+		}
+		Repository struct {
+			FullName string `json:"full_name"`
+		}
+	}
+
+	Destination struct {
+		Branch struct {
+			Name string
+		}
+		Commit struct {
+			Hash string
+		}
+	}
+
+	CommentCount int64 `json:"comment_count"`
+	TaskCount    int64 `json:"task_count"`
+
+	Participants []struct {
+		User     account
+		Role     string
+		Approved bool
+		State    string
+	}
+
+	Links struct {
+		Html struct {
+			Href string
+		}
+	}
+}
+
+func (pr *PullRequest) getPath(resource ...string) string {
+	return strings.Join(append(
+		[]string{
+			"repositories", pr.Workspace, pr.Repo,
+			"pullrequests", fmt.Sprint(pr.Id),
+		},
+		resource...,
+	), "/")
+}
+
+func (pr *PullRequest) getRepoPath(resource ...string) string {
+	return strings.Join(append(
+		[]string{"repositories", pr.Workspace, pr.Repo},
+		resource...,
+	), "/")
+}
+
+func (pr *PullRequest) getInfo() (*pullRequestInfo, error) {
+	info := pullRequestInfo{}
+
+	err := pr.client.get(pr.getPath(), nil, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// GetInfo returns info of pull request converted to the form of Stash pull
+// request, so it can be shown by the same templates.
+func (pr *PullRequest) GetInfo() (*stash.PullRequestInfo, error) {
+	info, err := pr.getInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	result := stash.PullRequestInfo{
+		Id:          info.Id,
+		Title:       info.Title,
+		Description: info.Description,
+		State:       info.State,
+		CreatedDate: stash.ParseTimestamp(time.RFC3339Nano, info.CreatedOn),
+		UpdatedDate: stash.ParseTimestamp(time.RFC3339Nano, info.UpdatedOn),
+	}
+
+	result.FromRef.Id = "refs/heads/" + info.Source.Branch.Name
+	result.FromRef.DisplayId = info.Source.Branch.Name
+	result.FromRef.LatestCommit = info.Source.Commit.Hash
+	result.FromRef.Repository.Slug = pr.Repo
+	result.FromRef.Repository.Project.Key = pr.Workspace
+	result.ToRef.DisplayId = info.Destination.Branch.Name
+
+	result.Author.User.Name = info.Author.GetName()
+	result.Author.User.DisplayName = info.Author.DisplayName
+
+	result.Properties.CommentCount = info.CommentCount
+	result.Properties.OpenTaskCount = info.TaskCount
+
+	for _, participant := range info.Participants {
+		if participant.Role != "REVIEWER" && !participant.Approved {
+			continue
+		}
+
+		status := stash.ParticipantUnapproved
+		switch {
+		case participant.Approved:
+			status = stash.ParticipantApproved
+		case participant.State == "changes_requested":
+			status = stash.ParticipantNeedsWork
+		}
+
+		reviewer := struct {
+			Approved           bool
+			Status             string
+			LastReviewedCommit string
+			User               struct {
+				Name        string
+				DisplayName string
+			}
+		}{
+			Approved: participant.Approved,
+			Status:   status,
+		}
+
+		reviewer.User.Name = participant.User.GetName()
+		reviewer.User.DisplayName = participant.User.DisplayName
+
+		result.Reviewers = append(result.Reviewers, reviewer)
+	}
+
+	if info.Links.Html.Href != "" {
+		result.Links.Self = append(result.Links.Self, struct {
+			Href string
+		}{info.Links.Html.Href})
+	}
+
+	return &result, nil
+}
+
+// GetCommits returns commits of pull request, newest go first.
+func (pr *PullRequest) GetCommits(limit int, all bool) ([]stash.Commit, error) {
+	if all {
+		limit = 0
+	}
+
+	result := []stash.Commit{}
+
+	err := pr.client.getPaged(pr.getPath("commits"), nil, limit,
+		func(values json.RawMessage) (int, error) {
+			page := []struct {
+				Hash    string
+				Message string
+				Date    string
+				Author  struct {
+					Raw  string
+					User account
+				}
+				Parents []struct {
+					Hash string
+				}
+			}{}
+
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return 0, err
+			}
+
+			for _, value := range page {
+				if limit > 0 && len(result) >= limit {
+					break
+				}
+
+				commit := stash.Commit{
+					Id:              value.Hash,
+					DisplayId:       stash.ShortHash(value.Hash),
+					AuthorTimestamp: stash.ParseTimestamp(time.RFC3339Nano, value.Date),
+					Message:         strings.TrimSuffix(value.Message, "\n"),
+				}
+
+				commit.Author.Name = value.Author.Raw
+				if matches := reCommitAuthor.FindStringSubmatch(
+					value.Author.Raw,
+				); matches != nil {
+					commit.Author.Name = matches[1]
+					commit.Author.EmailAddress = matches[2]
+				}
+
+				for _, parent := range value.Parents {
+					commit.Parents = append(commit.Parents, struct {
+						Id string
+					}{parent.Hash})
+				}
+
+				result = append(result, commit)
+			}
+
+			return len(page), nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("successfully got commits list from Bitbucket")
+
+	return result, nil
+}
+
+// GetFiles returns files changed in pull request or in the commits
+// specified in options.
+func (pr *PullRequest) GetFiles(
+	options stash.DiffOptions,
+) (stash.ReviewFiles, error) {
+	path := pr.getPath("diffstat")
+	if options.UntilId != "" {
+		path = pr.getRepoPath("diffstat", getCommitRange(options))
+	}
+
+	files := stash.ReviewFiles{}
+
+	err := pr.client.getPaged(path, nil, 0,
+		func(values json.RawMessage) (int, error) {
+			page := []struct {
+				Status string
+				Old    *struct {
+					Path string
+				}
+				New *struct {
+					Path string
+				}
+			}{}
+
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return 0, err
+			}
+
+			for _, value := range page {
+				file := stash.ReviewFile{
+					Type:       "FILE",
+					ChangeType: stash.GetChangeType(value.Status, changeTypes),
+				}
+
+				if value.Old != nil {
+					file.SrcPath = value.Old.Path
+				}
+
+				if value.New != nil {
+					file.DstPath = value.New.Path
+				}
+
+				files = append(files, file)
+			}
+
+			return len(page), nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("successfully got files list from Bitbucket")
+
+	return files, nil
+}
+
+// changeTypes maps statuses of files in diffstat to change types, which are
+// used by Stash.
+var changeTypes = map[string]string{
+	"added":   "ADD",
+	"removed": "DELETE",
+	"renamed": "MOVE",
+}
+
+// getCommitRange returns spec of diff between commits specified in
+// options. Bitbucket expects newer commit first.
+func getCommitRange(options stash.DiffOptions) string {
+	return options.UntilId + ".." + options.SinceId
+}
+
+// GetFileSize returns size of file at given commit. Empty path means that
+// file does not exist, so its size is zero.
+func (pr *PullRequest) GetFileSize(path string, commit string) (int64, error) {
+	if path == "" {
+		return 0, nil
+	}
+
+	result := struct {
+		Size int64
+	}{}
+
+	err := pr.client.get(
+		pr.getRepoPath("src", commit, path),
+		url.Values{"format": {"meta"}},
+		&result,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Size, nil
+}
+
+func (pr *PullRequest) post(resource string, payload interface{}) error {
+	_, err := pr.client.do("POST", pr.getPath(resource), nil, payload)
+
+	return err
+}
+
+func (pr *PullRequest) Approve() error {
+	return pr.post("approve", nil)
+}
+
+func (pr *PullRequest) Unapprove() error {
+	_, err := pr.client.do("DELETE", pr.getPath("approve"), nil, nil)
+
+	return err
+}
+
+// NeedsWork requests changes in pull request.
+func (pr *PullRequest) NeedsWork() error {
+	return pr.post("request-changes", nil)
+}
+
+// Decline declines pull request, reason is posted as general comment
+// afterwards, because Bitbucket Cloud does not store it with the pull
+// request; it is not left if declining fails.
+func (pr *PullRequest) Decline(reason string) error {
+	err := pr.post("decline", nil)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	err = pr.post("comments", map[string]interface{}{
+		"content": content{reason},
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"pull request is declined, but reason is not posted: %s", err,
+		)
+	}
+
+	return nil
+}
+
+func (pr *PullRequest) Reopen() error {
+	return ErrReopenUnsupported
+}
+
+// Merge merges pull request with default merge strategy of repository.
+func (pr *PullRequest) Merge() error {
+	return pr.post("merge", nil)
+}
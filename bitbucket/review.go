@@ -0,0 +1,563 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+const commentPreviewLen = 40
+
+const (
+	taskResolved   = "RESOLVED"
+	taskUnresolved = "UNRESOLVED"
+)
+
+// comment is comment of pull request as it is returned by API. Inline
+// comments have path and line number in source or destination file, file
+// comments have only path. Outdated comments are anchored to lines of
+// older commits of pull request.
+type comment struct {
+	Id      int64
+	Content content
+	User    account
+	Deleted bool
+
+	Inline *struct {
+		Path     string
+		From     *int64
+		To       *int64
+		Outdated bool
+	}
+
+	Parent *struct {
+		Id int64
+	}
+}
+
+func (value comment) toComment() *godiff.Comment {
+	result := &godiff.Comment{
+		Id:   value.Id,
+		Text: value.Content.Raw,
+	}
+
+	result.Author.Name = value.User.GetName()
+	result.Author.DisplayName = value.User.DisplayName
+
+	return result
+}
+
+// getChangeset returns diff of pull request or of the commits specified in
+// options, with all comments attached to diffs they belong to. Comments to
+// files, which are not in the diff, are returned as separate notes.
+func (pr *PullRequest) getChangeset(
+	options stash.DiffOptions,
+) (godiff.Changeset, []*godiff.Diff, error) {
+	result := godiff.Changeset{}
+
+	path := pr.getPath("diff")
+	query := url.Values{}
+	if options.UntilId != "" {
+		path = pr.getRepoPath("diff", getCommitRange(options))
+		query.Set("topic", "false")
+
+		result.FromHash = options.SinceId
+		result.ToHash = options.UntilId
+	}
+
+	if options.ContextLines >= 0 {
+		query.Set("context", fmt.Sprint(options.ContextLines))
+	}
+
+	if options.IgnoreWhitespaces {
+		query.Set("ignore_whitespace", "true")
+	}
+
+	data, err := pr.client.do("GET", path, query, nil)
+	if err != nil {
+		return result, nil, err
+	}
+
+	result.Diffs, err = parseDiff(string(data))
+	if err != nil {
+		return result, nil, err
+	}
+
+	comments, err := pr.getComments()
+	if err != nil {
+		return result, nil, err
+	}
+
+	notes := attachComments(result.Diffs, comments, options.UntilId == "")
+
+	return result, notes, nil
+}
+
+func (pr *PullRequest) getComments() ([]comment, error) {
+	result := []comment{}
+
+	err := pr.client.getPaged(pr.getPath("comments"), nil, 0,
+		func(values json.RawMessage) (int, error) {
+			page := []comment{}
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return 0, err
+			}
+
+			result = append(result, page...)
+
+			return len(page), nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// getThreads returns comments by their ids, replies are added to their
+// parent comments.
+func getThreads(comments []comment) map[int64]*godiff.Comment {
+	threads := map[int64]*godiff.Comment{}
+	for _, value := range comments {
+		if value.Deleted {
+			continue
+		}
+
+		threads[value.Id] = value.toComment()
+	}
+
+	for _, value := range comments {
+		if value.Parent == nil {
+			continue
+		}
+
+		reply, ok := threads[value.Id]
+		if !ok {
+			continue
+		}
+
+		if parent, ok := threads[value.Parent.Id]; ok {
+			parent.Comments = append(parent.Comments, reply)
+		}
+	}
+
+	return threads
+}
+
+// attachComments adds inline comments to lines of diffs they are anchored
+// to and file comments to diffs of their files. Outdated comments, as well
+// as all comments, when diff is not the diff of pull request, can be
+// anchored to lines which are changed since then, so they are added as file
+// comments. Comments to files, which are not in the diff anymore, are
+// returned as notes, so discussion is not lost.
+func attachComments(
+	diffs []*godiff.Diff, comments []comment, current bool,
+) []*godiff.Diff {
+	threads := getThreads(comments)
+
+	notes := []*godiff.Diff{}
+	for _, value := range comments {
+		result, ok := threads[value.Id]
+		if !ok || value.Parent != nil || value.Inline == nil {
+			continue
+		}
+
+		result.Anchor.Path = value.Inline.Path
+
+		diff := findDiff(diffs, value.Inline.Path)
+		if diff == nil {
+			notes = append(notes, &godiff.Diff{
+				Note: fmt.Sprintf(
+					"%s commented on %s, which is not changed anymore:",
+					value.User.DisplayName, value.Inline.Path,
+				),
+				FileComments: godiff.CommentsTree{result},
+			})
+
+			continue
+		}
+
+		result.Anchor.SrcPath = diff.Source.ToString
+
+		var segment *godiff.Segment
+		var line *godiff.Line
+		if current && !value.Inline.Outdated {
+			segment, line = findLine(diff, value.Inline.From, value.Inline.To)
+		}
+
+		if line == nil {
+			diff.FileComments = append(diff.FileComments, result)
+			continue
+		}
+
+		result.Anchor.LineType = segment.Type
+		result.Anchor.Line = line.Destination
+		if segment.Type == godiff.SegmentTypeRemoved {
+			result.Anchor.Line = line.Source
+		}
+
+		line.Comments = append(line.Comments, result)
+		diff.LineComments = append(diff.LineComments, result)
+	}
+
+	return notes
+}
+
+func findDiff(diffs []*godiff.Diff, path string) *godiff.Diff {
+	for _, diff := range diffs {
+		if diff.Destination.ToString == path || diff.Source.ToString == path {
+			return diff
+		}
+	}
+
+	return nil
+}
+
+// findLine returns line which comment is anchored to. Comments to added and
+// context lines are anchored to destination line, comments to removed
+// lines are anchored to source line only.
+func findLine(
+	diff *godiff.Diff, from *int64, to *int64,
+) (*godiff.Segment, *godiff.Line) {
+	if from == nil && to == nil {
+		return nil, nil
+	}
+
+	for _, hunk := range diff.Hunks {
+		for _, segment := range hunk.Segments {
+			for _, line := range segment.Lines {
+				removed := segment.Type == godiff.SegmentTypeRemoved
+
+				switch {
+				case to != nil && !removed && line.Destination == *to:
+					return segment, line
+				case to == nil && removed && line.Source == *from:
+					return segment, line
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// GetReview returns review of single file of pull request.
+func (pr *PullRequest) GetReview(
+	path string, options stash.DiffOptions,
+) (*stash.Review, error) {
+	changeset, _, err := pr.getChangeset(options)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []*godiff.Diff{}
+	if diff := findDiff(changeset.Diffs, path); diff != nil {
+		diffs = append(diffs, diff)
+	}
+
+	changeset.Diffs = diffs
+	changeset.Path = path
+
+	logger.Debug("successfully got review from Bitbucket")
+
+	return &stash.Review{
+		Changeset:  changeset,
+		IsOverview: false,
+	}, nil
+}
+
+// GetFullReview joins diffs of all files in pull request into the single
+// review, separating them by headers with file names.
+func (pr *PullRequest) GetFullReview(
+	options stash.DiffOptions,
+) (*stash.Review, error) {
+	files, err := pr.GetFiles(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return pr.getMultiFileReview(
+		files.Exclude(options.Exclude), options, true,
+	)
+}
+
+// GetFilesReview returns review of specified files, paths can be glob
+// patterns.
+func (pr *PullRequest) GetFilesReview(
+	paths []string, options stash.DiffOptions,
+) (*stash.Review, error) {
+	if !stash.IsMultiFilePaths(paths) {
+		return pr.GetReview(paths[0], options)
+	}
+
+	files, err := pr.GetFiles(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return pr.getMultiFileReview(
+		files.Select(paths, options.Exclude), options, false,
+	)
+}
+
+// getMultiFileReview retrieves diff of pull request once and picks diffs of
+// given files from it. Comments to files, which are not changed anymore, are
+// added to the end of review of all files.
+func (pr *PullRequest) getMultiFileReview(
+	files stash.ReviewFiles, options stash.DiffOptions, all bool,
+) (*stash.Review, error) {
+	changeset, notes, err := pr.getChangeset(options)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := changeset.Diffs
+	changeset.Diffs = nil
+
+	for _, file := range files {
+		path := file.GetPath()
+
+		changeset.Diffs = append(changeset.Diffs, &godiff.Diff{
+			Note: stash.FormatFileMarker(path, file.ChangeType),
+		})
+
+		if diff := findDiff(diffs, path); diff != nil {
+			changeset.Diffs = append(changeset.Diffs, diff)
+		}
+	}
+
+	if all {
+		changeset.Diffs = append(changeset.Diffs, notes...)
+	}
+
+	logger.Debug(
+		"successfully got review of %d files from Bitbucket", len(files),
+	)
+
+	return &stash.Review{
+		Changeset:   changeset,
+		IsOverview:  false,
+		IsMultiFile: true,
+	}, nil
+}
+
+// GetActivities returns overview of pull request with general comments,
+// newest go first.
+func (pr *PullRequest) GetActivities(limit string) (*stash.Review, error) {
+	comments, err := pr.getComments()
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := strconv.Atoi(limit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid activities limit: %q", limit)
+	}
+
+	threads := getThreads(comments)
+
+	result := godiff.Changeset{}
+	for _, value := range comments {
+		thread, ok := threads[value.Id]
+		if !ok || value.Parent != nil || value.Inline != nil {
+			continue
+		}
+
+		result.Diffs = append([]*godiff.Diff{{
+			Note: fmt.Sprintf(
+				"%s commented on pull request:", value.User.DisplayName,
+			),
+			FileComments: godiff.CommentsTree{thread},
+		}}, result.Diffs...)
+	}
+
+	if count > 0 && len(result.Diffs) > count {
+		result.Diffs = result.Diffs[:count]
+	}
+
+	logger.Debug("successfully got review from Bitbucket")
+
+	return &stash.Review{
+		Changeset:  result,
+		IsOverview: true,
+	}, nil
+}
+
+// GetTasks returns tasks of all comments of pull request.
+func (pr *PullRequest) GetTasks() ([]*stash.Task, error) {
+	result := []*stash.Task{}
+
+	err := pr.client.getPaged(pr.getPath("tasks"), nil, 0,
+		func(values json.RawMessage) (int, error) {
+			page := []struct {
+				Id      int64
+				Content content
+				State   string
+				Comment *struct {
+					Id int64
+				}
+			}{}
+
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return 0, err
+			}
+
+			for _, value := range page {
+				task := &stash.Task{
+					Id:    value.Id,
+					Text:  value.Content.Raw,
+					State: stash.TaskOpen,
+				}
+
+				if value.State == taskResolved {
+					task.State = stash.TaskResolved
+				}
+
+				if value.Comment != nil {
+					task.Anchor.Id = value.Comment.Id
+				}
+
+				result = append(result, task)
+			}
+
+			return len(page), nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ApplyChange posts change made in review file to pull request.
+func (pr *PullRequest) ApplyChange(change stash.ReviewChange) error {
+	switch c := change.(type) {
+	case stash.ReplyAdded:
+		logger.Info("replying to <%d>: <%s>", c.Parent.Id,
+			c.Comment.Short(commentPreviewLen))
+		return pr.addComment(c.Comment, getCommentPayload(c))
+	case stash.LineCommentAdded:
+		logger.Info("commenting (L%d): <%s>",
+			c.Comment.Anchor.Line,
+			c.Comment.Short(commentPreviewLen))
+		return pr.addComment(c.Comment, getCommentPayload(c))
+	case stash.CommentRemoved:
+		logger.Info("wasting comment: <%d>", c.Comment.Id)
+		_, err := pr.client.do("DELETE",
+			pr.getPath("comments", fmt.Sprint(c.Comment.Id)), nil, nil,
+		)
+		return err
+	case stash.CommentModified:
+		logger.Info("modifying comment <%d>: <%s>",
+			c.Comment.Id, c.Comment.Short(commentPreviewLen))
+		_, err := pr.client.do("PUT",
+			pr.getPath("comments", fmt.Sprint(c.Comment.Id)), nil,
+			getCommentPayload(c),
+		)
+		return err
+	case stash.ReviewCommentAdded:
+		logger.Info("adding review level comment: <%s>",
+			c.Comment.Short(commentPreviewLen))
+		return pr.addComment(c.Comment, getCommentPayload(c))
+	case stash.FileCommentAdded:
+		logger.Info("adding file level comment (%s): <%s>",
+			c.Comment.Anchor.Path,
+			c.Comment.Short(commentPreviewLen))
+		return pr.addComment(c.Comment, getCommentPayload(c))
+	case stash.TaskAdded:
+		logger.Info("adding task to <%d>: <%s>", c.Comment.Id, c.Text)
+		return pr.post("tasks", map[string]interface{}{
+			"content": content{c.Text},
+			"comment": map[string]interface{}{"id": c.Comment.Id},
+		})
+	case stash.TaskStateChanged:
+		logger.Info("changing task <%d> state to %s", c.Task.Id, c.State)
+		state := taskUnresolved
+		if c.State == stash.TaskResolved {
+			state = taskResolved
+		}
+
+		_, err := pr.client.do("PUT",
+			pr.getPath("tasks", fmt.Sprint(c.Task.Id)), nil,
+			map[string]interface{}{"state": state},
+		)
+		return err
+	default:
+		logger.Warning("unexpected <change> argument: %#v", change)
+	}
+
+	return nil
+}
+
+func (pr *PullRequest) addComment(
+	target *godiff.Comment, payload map[string]interface{},
+) error {
+	data, err := pr.client.do("POST", pr.getPath("comments"), nil, payload)
+	if err != nil {
+		return err
+	}
+
+	result := comment{}
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("comment added: <%d>", result.Id)
+
+	// tasks can be added to the new comment afterwards, so id is needed
+	target.Id = result.Id
+
+	return nil
+}
+
+// getCommentPayload returns body of request which adds or modifies comment.
+// Comments to removed lines are anchored to source line, all other line
+// comments are anchored to destination line.
+func getCommentPayload(change stash.ReviewChange) map[string]interface{} {
+	switch c := change.(type) {
+	case stash.ReplyAdded:
+		return map[string]interface{}{
+			"content": content{c.Comment.Text},
+			"parent":  map[string]interface{}{"id": c.Parent.Id},
+		}
+	case stash.LineCommentAdded:
+		inline := map[string]interface{}{
+			"path": stash.GetAnchorPath(c.Comment.Anchor),
+		}
+
+		if c.Comment.Anchor.LineType == godiff.SegmentTypeRemoved {
+			inline["from"] = c.Comment.Anchor.Line
+		} else {
+			inline["to"] = c.Comment.Anchor.Line
+		}
+
+		return map[string]interface{}{
+			"content": content{c.Comment.Text},
+			"inline":  inline,
+		}
+	case stash.FileCommentAdded:
+		return map[string]interface{}{
+			"content": content{c.Comment.Text},
+			"inline": map[string]interface{}{
+				"path": stash.GetAnchorPath(c.Comment.Anchor),
+			},
+		}
+	case stash.ReviewCommentAdded:
+		return map[string]interface{}{
+			"content": content{c.Comment.Text},
+		}
+	case stash.CommentModified:
+		return map[string]interface{}{
+			"content": content{c.Comment.Text},
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+func TestGetCommentPayload(t *testing.T) {
+	added := &godiff.Comment{Text: "added line"}
+	added.Anchor.Path = "main.go"
+	added.Anchor.Line = 3
+	added.Anchor.LineType = godiff.SegmentTypeAdded
+
+	removed := &godiff.Comment{Text: "removed line"}
+	removed.Anchor.SrcPath = "deleted.go"
+	removed.Anchor.Line = 2
+	removed.Anchor.LineType = godiff.SegmentTypeRemoved
+
+	file := &godiff.Comment{Text: "file"}
+	file.Anchor.Path = "main.go"
+
+	tests := []struct {
+		change   stash.ReviewChange
+		expected string
+	}{
+		{
+			stash.LineCommentAdded{Comment: added},
+			`{"content":{"raw":"added line"},` +
+				`"inline":{"path":"main.go","to":3}}`,
+		},
+		{
+			stash.LineCommentAdded{Comment: removed},
+			`{"content":{"raw":"removed line"},` +
+				`"inline":{"from":2,"path":"deleted.go"}}`,
+		},
+		{
+			stash.FileCommentAdded{Comment: file},
+			`{"content":{"raw":"file"},"inline":{"path":"main.go"}}`,
+		},
+		{
+			stash.ReplyAdded{
+				Comment: &godiff.Comment{Text: "reply"},
+				Parent:  &godiff.Comment{Id: 5},
+			},
+			`{"content":{"raw":"reply"},"parent":{"id":5}}`,
+		},
+		{
+			stash.ReviewCommentAdded{Comment: &godiff.Comment{Text: "overall"}},
+			`{"content":{"raw":"overall"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		actual, err := json.Marshal(getCommentPayload(test.change))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(actual) != test.expected {
+			t.Fatalf("unexpected payload\n%s\n%s", test.expected, actual)
+		}
+	}
+}
+
+func TestApplyChange(t *testing.T) {
+	requests := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			body, _ := ioutil.ReadAll(request.Body)
+			requests = append(requests,
+				request.Method+" "+request.URL.Path+" "+string(body),
+			)
+
+			if user, pass, _ := request.BasicAuth(); user != "john" ||
+				pass != "secret" {
+				writer.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			writer.Write([]byte(`{"id": 42}`))
+		},
+	))
+	defer server.Close()
+
+	client := &Client{URL: server.URL, User: "john", Password: "secret"}
+	pr := client.PullRequest("team", "repo", 7)
+
+	comment := &godiff.Comment{Text: "hello"}
+	comment.Anchor.Path = "main.go"
+	comment.Anchor.Line = 1
+	comment.Anchor.LineType = godiff.SegmentTypeContext
+
+	changes := []stash.ReviewChange{
+		stash.LineCommentAdded{Comment: comment},
+		stash.TaskAdded{Comment: comment, Text: "fix it"},
+		stash.TaskStateChanged{
+			Task:  &stash.Task{Id: 3},
+			State: stash.TaskResolved,
+		},
+		stash.CommentRemoved{Comment: &godiff.Comment{Id: 9}},
+	}
+
+	for _, change := range changes {
+		err := pr.ApplyChange(change)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if comment.Id != 42 {
+		t.Fatalf("id of added comment is not set: %d", comment.Id)
+	}
+
+	path := "/repositories/team/repo/pullrequests/7/"
+	expected := []string{
+		"POST " + path + "comments " +
+			`{"content":{"raw":"hello"},"inline":{"path":"main.go","to":1}}`,
+		"POST " + path + "tasks " +
+			`{"comment":{"id":42},"content":{"raw":"fix it"}}`,
+		"PUT " + path + "tasks/3 " + `{"state":"RESOLVED"}`,
+		"DELETE " + path + "comments/9 ",
+	}
+
+	if !reflect.DeepEqual(expected, requests) {
+		t.Fatalf("unexpected requests\n%#v\n%#v", expected, requests)
+	}
+}
+
+func TestDeclinePostsReasonAfterDeclining(t *testing.T) {
+	requests := []string{}
+	declined := false
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			requests = append(requests, request.Method+" "+request.URL.Path)
+
+			if !declined {
+				writer.WriteHeader(http.StatusConflict)
+				return
+			}
+
+			writer.Write([]byte(`{"id": 42}`))
+		},
+	))
+	defer server.Close()
+
+	client := &Client{URL: server.URL, User: "john", Password: "secret"}
+	pr := client.PullRequest("team", "repo", 7)
+
+	if pr.Decline("not needed") == nil {
+		t.Fatal("error is expected for failed declining")
+	}
+
+	declined = true
+
+	err := pr.Decline("not needed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/repositories/team/repo/pullrequests/7/"
+	expected := []string{
+		"POST " + path + "decline",
+		"POST " + path + "decline",
+		"POST " + path + "comments",
+	}
+
+	if !reflect.DeepEqual(expected, requests) {
+		t.Fatalf("unexpected requests\n%#v\n%#v", expected, requests)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusForbidden)
+			writer.Write([]byte(
+				`{"type": "error", "error": {"message": "Access denied"}}`,
+			))
+		},
+	))
+	defer server.Close()
+
+	client := &Client{URL: server.URL, Token: "token"}
+
+	err := client.PullRequest("team", "repo", 1).Approve()
+
+	statusErr, ok := err.(stash.StatusError)
+	if !ok || statusErr.Status != http.StatusForbidden ||
+		statusErr.Error() != "Access denied" {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+}
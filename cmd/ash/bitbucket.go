@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/seletskiy/ash/bitbucket"
+)
+
+// bitbucketHost is host of Bitbucket Cloud, which credentials of user are
+// stored for.
+const bitbucketHost = "https://bitbucket.org/"
+
+var reBitbucketURL = regexp.MustCompile(
+	`^https?://bitbucket\.org/([^/]+)/([^/]+)/pull-requests/(\d+)`,
+)
+
+// bitbucketUnsupported are commands and flags of pull request, which are
+// available only for Stash.
+var bitbucketUnsupported = []string{
+	"ls", "show", "diffstat", "export", "commits", "edit", "reviewers",
+	"sync", "apply-suggestions", "delete", "watch", "unwatch", "reopen",
+	"web", "--web", "--commit", "--label",
+}
+
+// bitbucketMode runs command of Bitbucket Cloud pull request given by URL.
+func bitbucketMode(args map[string]interface{}, matches []string) {
+	client, err := getBitbucketClient(args)
+	if err != nil {
+		fmt.Printf("%s.\n", err.Error())
+		os.Exit(exitAuth)
+	}
+
+	id, err := strconv.ParseInt(matches[3], 10, 64)
+	if err != nil {
+		fmt.Printf("Invalid pull request id: %s.\n", matches[3])
+		os.Exit(exitUsage)
+	}
+
+	pr := client.PullRequest(matches[1], matches[2], id)
+
+	target := reviewTarget{
+		service:  pr,
+		comments: pr,
+		project:  filepath.Join("bitbucket.org", pr.Workspace),
+		repo:     pr.Repo,
+		id:       pr.Id,
+		user:     client.User,
+	}
+
+	serviceMode(
+		args, target, "Bitbucket Cloud pull requests", bitbucketUnsupported,
+	)
+}
+
+// getBitbucketClient returns client of Bitbucket Cloud, which is
+// authenticated by OAuth token, if --token is given, or by user and app
+// password, which are looked up the same way as Stash credentials.
+func getBitbucketClient(
+	args map[string]interface{},
+) (*bitbucket.Client, error) {
+	httpClient, err := getHTTPClient(args)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &bitbucket.Client{
+		URL:  bitbucket.DefaultURL,
+		HTTP: httpClient,
+	}
+
+	if args["--token"] != nil {
+		client.Token = args["--token"].(string)
+		return client, nil
+	}
+
+	client.User, err = getUser(args, bitbucketHost)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Password, err = getPassword(args, bitbucketHost, client.User)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// colorNames are names, which can be used in theme instead of SGR codes.
+var colorNames = map[string]string{
+	"bold":      "1",
+	"dim":       "2",
+	"underline": "4",
+	"black":     "30",
+	"red":       "31",
+	"green":     "32",
+	"yellow":    "33",
+	"blue":      "34",
+	"magenta":   "35",
+	"cyan":      "36",
+	"white":     "37",
+	"gray":      "90",
+}
+
+// colorTheme maps elements of output to SGR parameters of their colors.
+type colorTheme map[string]string
+
+var defaultColorTheme = colorTheme{
+	"header":     "1",
+	"hunk":       "36",
+	"added":      "32",
+	"removed":    "31",
+	"comment":    "33",
+	"ignored":    "90",
+	"branch":     "35",
+	"unreviewed": "1",
+	"open":       "32",
+	"merged":     "34",
+	"declined":   "31",
+}
+
+// colors are used to color output of commands, they are set up by cmd line
+// args in main.
+var colors = colorPalette{theme: defaultColorTheme}
+
+type colorPalette struct {
+	enabled bool
+	theme   colorTheme
+}
+
+// paint colors text as specified element of output, text is returned as is
+// if colors are disabled or element has no color.
+func (palette colorPalette) paint(element string, text string) string {
+	code := palette.theme[element]
+	if !palette.enabled || code == "" || text == "" {
+		return text
+	}
+
+	return "\x1b[" + code + "m" + text + ansiReset
+}
+
+// reHunkHeader matches header of hunk with line counts of source and
+// destination, which are 1 if omitted.
+var reHunkHeader = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// diffPainter colors lines of review in unified format by their kind. Lines
+// of hunks are told apart by line counts of hunk header, not by their
+// prefix, because removed line can look like file header, e.g. '--- x'.
+type diffPainter struct {
+	palette colorPalette
+
+	// numbers of source and destination lines left in current hunk
+	source      int
+	destination int
+}
+
+func (painter *diffPainter) paint(line string) string {
+	palette := painter.palette
+
+	switch {
+	case strings.HasPrefix(line, "###"):
+		return palette.paint("ignored", line)
+	case strings.HasPrefix(line, "#"):
+		return palette.paint("comment", line)
+	case painter.source > 0 || painter.destination > 0:
+		return painter.paintHunkLine(line)
+	case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+		return palette.paint("header", line)
+	case strings.HasPrefix(line, "@@"):
+		painter.source, painter.destination = getHunkLineCounts(line)
+		return palette.paint("hunk", line)
+	}
+
+	return line
+}
+
+func (painter *diffPainter) paintHunkLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+"):
+		painter.destination--
+		return painter.palette.paint("added", line)
+	case strings.HasPrefix(line, "-"):
+		painter.source--
+		return painter.palette.paint("removed", line)
+	case strings.HasPrefix(line, "\\"):
+		return line
+	}
+
+	painter.source--
+	painter.destination--
+
+	return line
+}
+
+// getHunkLineCounts returns numbers of source and destination lines of hunk
+// by its header.
+func getHunkLineCounts(header string) (int, int) {
+	matches := reHunkHeader.FindStringSubmatch(header)
+	if matches == nil {
+		return 0, 0
+	}
+
+	counts := []int{1, 1}
+	for i, value := range matches[1:] {
+		if value != "" {
+			counts[i], _ = strconv.Atoi(value)
+		}
+	}
+
+	return counts[0], counts[1]
+}
+
+// coloredRenderer colors review rendered in unified format.
+type coloredRenderer struct {
+	stash.ReviewRenderer
+}
+
+func (renderer coloredRenderer) Render(review *stash.Review, writer io.Writer) error {
+	buffer := &bytes.Buffer{}
+
+	err := renderer.ReviewRenderer.Render(review, buffer)
+	if err != nil {
+		return err
+	}
+
+	painter := diffPainter{palette: colors}
+
+	lines := strings.Split(buffer.String(), "\n")
+	for i, line := range lines {
+		lines[i] = painter.paint(line)
+	}
+
+	_, err = io.WriteString(writer, strings.Join(lines, "\n"))
+
+	return err
+}
+
+// parseColorTheme parses theme in 'element=color,...' form, where color is
+// SGR parameters or names of colors joined by '+', e.g. 'added=bold+green'.
+// Elements which are not specified keep default colors.
+func parseColorTheme(spec string) (colorTheme, error) {
+	theme := colorTheme{}
+	for element, code := range defaultColorTheme {
+		theme[element] = code
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("'element=color' expected, got %q", item)
+		}
+
+		element := strings.TrimSpace(parts[0])
+		if _, ok := defaultColorTheme[element]; !ok {
+			return nil, fmt.Errorf("unknown element %q", element)
+		}
+
+		codes := []string{}
+		for _, name := range strings.Split(strings.TrimSpace(parts[1]), "+") {
+			code, ok := colorNames[name]
+			if !ok {
+				if strings.Trim(name, "0123456789;") != "" {
+					return nil, fmt.Errorf("unknown color %q", name)
+				}
+
+				code = name
+			}
+
+			codes = append(codes, code)
+		}
+
+		theme[element] = strings.Join(codes, ";")
+	}
+
+	return theme, nil
+}
+
+// isTerminal returns true if file is a terminal, not a pipe or a file.
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// isColorEnabled returns true if output to file should be colored
+// according to --color and --no-color.
+func isColorEnabled(args map[string]interface{}, file *os.File) bool {
+	when := args["--color"].(string)
+	if args["--no-color"].(bool) {
+		when = colorNever
+	}
+
+	switch when {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	case colorAuto:
+		return isTerminal(file) && os.Getenv("NO_COLOR") == ""
+	default:
+		fmt.Println("--color should be one of: auto, always, never.")
+		os.Exit(exitUsage)
+	}
+
+	return false
+}
+
+func setupColors(args map[string]interface{}) {
+	colors.enabled = isColorEnabled(args, os.Stdout)
+
+	if args["--color-theme"] != nil {
+		theme, err := parseColorTheme(args["--color-theme"].(string))
+		if err != nil {
+			fmt.Printf("--color-theme is invalid: %s.\n", err.Error())
+			os.Exit(exitUsage)
+		}
+
+		colors.theme = theme
+	}
+}
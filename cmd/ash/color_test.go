@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseColorThemeOverridesDefaults(t *testing.T) {
+	theme, err := parseColorTheme("added=bold+green, branch=38;5;208")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if theme["added"] != "1;32" {
+		t.Fatalf("unexpected added color: %q", theme["added"])
+	}
+
+	if theme["branch"] != "38;5;208" {
+		t.Fatalf("unexpected branch color: %q", theme["branch"])
+	}
+
+	if theme["removed"] != defaultColorTheme["removed"] {
+		t.Fatalf("unexpected removed color: %q", theme["removed"])
+	}
+}
+
+func TestParseColorThemeRejectsUnknownNames(t *testing.T) {
+	for _, spec := range []string{"added", "title=red", "added=pink"} {
+		_, err := parseColorTheme(spec)
+		if err == nil {
+			t.Fatalf("error expected for %q", spec)
+		}
+	}
+}
+
+func TestDiffPainterPaint(t *testing.T) {
+	palette := colorPalette{enabled: true, theme: defaultColorTheme}
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"--- a/main.go", "\x1b[1m--- a/main.go" + ansiReset},
+		{"+++ b/main.go", "\x1b[1m+++ b/main.go" + ansiReset},
+		{"@@ -1,2 +1,3 @@", "\x1b[36m@@ -1,2 +1,3 @@" + ansiReset},
+		{" context", " context"},
+		{"--- removed", "\x1b[31m--- removed" + ansiReset},
+		{"# comment", "\x1b[33m# comment" + ansiReset},
+		{"### {{{ folded", "\x1b[90m### {{{ folded" + ansiReset},
+		{"+++ added", "\x1b[32m+++ added" + ansiReset},
+		{"+added", "\x1b[32m+added" + ansiReset},
+		{"--- a/next.go", "\x1b[1m--- a/next.go" + ansiReset},
+	}
+
+	painter := diffPainter{palette: palette}
+	for _, test := range tests {
+		actual := painter.paint(test.line)
+		if actual != test.expected {
+			t.Fatalf(
+				"unexpected colored line: %q, expected %q",
+				actual, test.expected,
+			)
+		}
+	}
+
+	painter = diffPainter{}
+	if painter.paint("+added") != "+added" {
+		t.Fatal("line is colored when colors are disabled")
+	}
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bndr/gopencils"
+	"github.com/seletskiy/ash/stash"
+)
+
+// Completion scripts call 'ash complete -- <words>' with words typed after
+// 'ash' up to the one under cursor, and offer printed lines as candidates.
+const bashCompletion = `# generated by 'ash completion bash'
+_ash() {
+    local IFS=$'\n'
+    COMPREPLY=($(ash complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+
+complete -o default -F _ash ash
+`
+
+const zshCompletion = `#compdef ash
+# generated by 'ash completion zsh'
+_ash() {
+    local -a candidates
+    candidates=("${(@f)$(ash complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+
+    if [[ -n "${candidates[1]}" ]]; then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+
+if [[ "$funcstack[1]" = "_ash" ]]; then
+    _ash "$@"
+else
+    compdef _ash ash
+fi
+`
+
+const fishCompletion = `# generated by 'ash completion fish'
+function __ash_complete
+    set -l words (commandline -opc) (commandline -ct)
+    ash complete -- $words[2..-1] 2>/dev/null
+end
+
+complete -c ash -a '(__ash_complete)'
+`
+
+// completionCacheTTL is how long listed projects, repos and pull requests
+// are reused by completion, so it does not wait for Stash on every tab.
+const completionCacheTTL = 5 * time.Minute
+
+// completionPageSize is number of items listed per request for completion.
+const completionPageSize = 100
+
+var completionCachePath = os.Getenv("HOME") + "/.local/share/ash/completion"
+
+var (
+	topCommands = []string{
+		"auth", "config", "doctor", "completion", "integration", "inbox",
+		"tui", "review", "push", "ls-projects",
+	}
+
+	projectCommands = []string{"ls-repos"}
+
+	repoCommands = []string{"ls-reviews", "search", "stats", "create"}
+
+	pullRequestCommands = []string{
+		"review", "ls", "show", "show-diff", "diffstat", "export", "commits",
+		"edit", "reviewers", "approve", "unapprove", "needs-work", "decline",
+		"reopen", "merge", "watch", "unwatch", "delete", "sync",
+		"apply-suggestions", "web",
+	}
+
+	// commandArgs are fixed arguments of commands
+	commandArgs = map[string][]string{
+		"auth":        {"login", "logout"},
+		"config":      {"get", "set"},
+		"completion":  {"bash", "zsh", "fish"},
+		"integration": {"vim"},
+		"inbox":       {"reviewer", "author", "all"},
+		"ls-reviews":  {"open", "merged", "declined"},
+		"reviewers":   {"ls", "add", "rm"},
+	}
+)
+
+// completionSource lists things, which slugs are completed from.
+type completionSource interface {
+	ListProjects() ([]string, error)
+	ListRepos(project string) ([]string, error)
+	ListPullRequests(project string, repo string) ([]string, error)
+}
+
+func completionMode(args map[string]interface{}) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		if !args[shell].(bool) {
+			continue
+		}
+
+		fmt.Print(map[string]string{
+			"bash": bashCompletion,
+			"zsh":  zshCompletion,
+			"fish": fishCompletion,
+		}[shell])
+	}
+}
+
+// completeMode prints candidates for the last of given words. Nothing is
+// printed on errors, so shell falls back to its default completion.
+func completeMode(args map[string]interface{}) {
+	var source completionSource
+
+	api, err := getCompletionAPI(args)
+	if err != nil {
+		logger.Debug("slugs are not completed: %s", err.Error())
+	} else {
+		source = cachedCompletionSource{
+			source: apiCompletionSource{api},
+			dir: filepath.Join(
+				completionCachePath, getHostName(api.URL),
+			),
+			ttl: completionCacheTTL,
+		}
+	}
+
+	defaultProject := ""
+	if args["--project"] != nil {
+		defaultProject = strings.Split(args["--project"].(string), "/")[0]
+	}
+
+	for _, candidate := range getCompletions(
+		args["<word>"].([]string), source, defaultProject,
+	) {
+		fmt.Println(candidate)
+	}
+}
+
+// getCompletionAPI returns API client if Stash can be queried without any
+// prompts, which would break completion.
+func getCompletionAPI(args map[string]interface{}) (stash.Api, error) {
+	if args["--url"] == nil {
+		return stash.Api{}, fmt.Errorf("--url is not specified")
+	}
+
+	base, err := getBaseURL(args["--url"].(string), args["--scheme"].(string))
+	if err != nil {
+		return stash.Api{}, err
+	}
+
+	user, err := getUser(args, base)
+	if err != nil {
+		return stash.Api{}, err
+	}
+
+	pass, err := getStoredPassword(args, base, user)
+	if err != nil {
+		return stash.Api{}, err
+	}
+
+	if pass == "" {
+		return stash.Api{}, fmt.Errorf("password is not stored")
+	}
+
+	client, err := getHTTPClient(args)
+	if err != nil {
+		return stash.Api{}, err
+	}
+
+	return stash.Api{
+		URL:    base,
+		Auth:   gopencils.BasicAuth{Username: user, Password: pass},
+		Client: client,
+	}, nil
+}
+
+// getCompletions returns candidates for the last word, which is being
+// typed. Options and their values are not completed. Slugs are not
+// completed if source is nil.
+func getCompletions(
+	words []string, source completionSource, defaultProject string,
+) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+
+	current := words[len(words)-1]
+	if strings.HasPrefix(current, "-") {
+		return nil
+	}
+
+	positional := []string{}
+	for _, word := range words[:len(words)-1] {
+		if !strings.HasPrefix(word, "-") {
+			positional = append(positional, word)
+		}
+	}
+
+	candidates := []string{}
+
+	switch len(positional) {
+	case 0:
+		candidates = append(candidates, topCommands...)
+		if source != nil {
+			candidates = append(candidates,
+				getSlugCompletions(current, source, defaultProject)...,
+			)
+		}
+	case 1:
+		command := positional[0]
+		if args, ok := commandArgs[command]; ok {
+			candidates = args
+			break
+		}
+
+		if isStringInSlice(command, topCommands) {
+			break
+		}
+
+		candidates = getSlugCommands(command, defaultProject)
+	case 2:
+		candidates = commandArgs[positional[1]]
+	}
+
+	result := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			result = append(result, candidate)
+		}
+	}
+
+	return result
+}
+
+// getSlugCommands returns commands which can follow the slug. Shorthand
+// slugs are ambiguous if default project is given, e.g. 'repo/1' is pull
+// request and 'proj/repo' is repo.
+func getSlugCommands(slug string, defaultProject string) []string {
+	if reStashURL.MatchString(slug) {
+		return pullRequestCommands
+	}
+
+	commands := []string{}
+
+	switch strings.Count(slug, "/") {
+	case 0:
+		commands = append(commands, projectCommands...)
+		if defaultProject != "" {
+			commands = append(commands, repoCommands...)
+		}
+	case 1:
+		commands = append(commands, repoCommands...)
+		if defaultProject != "" {
+			commands = append(commands, pullRequestCommands...)
+		}
+	case 2:
+		commands = append(commands, pullRequestCommands...)
+	}
+
+	return commands
+}
+
+// getSlugCompletions lists projects, repos or open pull requests depending
+// on how many parts of the slug are already typed.
+func getSlugCompletions(
+	prefix string, source completionSource, defaultProject string,
+) []string {
+	parts := strings.Split(prefix, "/")
+
+	result := []string{}
+
+	add := func(prefix string, names []string, err error) {
+		if err != nil {
+			logger.Debug("can not list completions: %s", err.Error())
+			return
+		}
+
+		for _, name := range names {
+			result = append(result, prefix+name)
+		}
+	}
+
+	switch len(parts) {
+	case 1:
+		projects, err := source.ListProjects()
+		add("", projects, err)
+
+		if defaultProject != "" {
+			repos, err := source.ListRepos(defaultProject)
+			add("", repos, err)
+		}
+	case 2:
+		repos, err := source.ListRepos(parts[0])
+		add(parts[0]+"/", repos, err)
+
+		if defaultProject != "" && parts[0] != "" {
+			pullRequests, err := source.ListPullRequests(defaultProject, parts[0])
+			add(parts[0]+"/", pullRequests, err)
+		}
+	case 3:
+		pullRequests, err := source.ListPullRequests(parts[0], parts[1])
+		add(parts[0]+"/"+parts[1]+"/", pullRequests, err)
+	}
+
+	return result
+}
+
+func isStringInSlice(value string, values []string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apiCompletionSource lists things from Stash.
+type apiCompletionSource struct {
+	api stash.Api
+}
+
+func (source apiCompletionSource) ListProjects() ([]string, error) {
+	projects, err := source.api.ListProjects("", completionPageSize, true)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, project := range projects {
+		names = append(names, project.Key)
+	}
+
+	return names, nil
+}
+
+func (source apiCompletionSource) ListRepos(project string) ([]string, error) {
+	if project == "" {
+		return nil, nil
+	}
+
+	repos, err := stash.Project{Api: &source.api, Name: getProjectPath(project)}.ListRepos(
+		completionPageSize, true,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, repo := range repos {
+		names = append(names, repo.Slug)
+	}
+
+	return names, nil
+}
+
+func (source apiCompletionSource) ListPullRequests(
+	project string, repo string,
+) ([]string, error) {
+	if project == "" || repo == "" {
+		return nil, nil
+	}
+
+	stashRepo := stash.Project{Api: &source.api, Name: getProjectPath(project)}.GetRepo(repo)
+
+	pullRequests, err := stashRepo.ListPullRequest(
+		"open", completionPageSize, true,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, pullRequest := range pullRequests {
+		ids = append(ids, strconv.FormatInt(pullRequest.Id, 10))
+	}
+
+	return ids, nil
+}
+
+// cachedCompletionSource keeps listed names in files for ttl, so repeated
+// completions do not query Stash.
+type cachedCompletionSource struct {
+	source completionSource
+	dir    string
+	ttl    time.Duration
+}
+
+func (cache cachedCompletionSource) ListProjects() ([]string, error) {
+	return cache.get("projects", cache.source.ListProjects)
+}
+
+func (cache cachedCompletionSource) ListRepos(project string) ([]string, error) {
+	return cache.get(
+		filepath.Join("repos", project),
+		func() ([]string, error) { return cache.source.ListRepos(project) },
+	)
+}
+
+func (cache cachedCompletionSource) ListPullRequests(
+	project string, repo string,
+) ([]string, error) {
+	return cache.get(
+		filepath.Join("pull-requests", project, repo),
+		func() ([]string, error) {
+			return cache.source.ListPullRequests(project, repo)
+		},
+	)
+}
+
+func (cache cachedCompletionSource) get(
+	key string, list func() ([]string, error),
+) ([]string, error) {
+	// keys are typed by user, so they should not escape cache dir
+	if strings.Contains(key, "..") {
+		return list()
+	}
+
+	path := filepath.Join(cache.dir, key)
+
+	info, err := os.Stat(path)
+	if err == nil && !info.IsDir() && time.Since(info.ModTime()) < cache.ttl {
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			return strings.Fields(string(data)), nil
+		}
+	}
+
+	names, err := list()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(
+			path, []byte(strings.Join(names, "\n")+"\n"), 0600,
+		)
+	}
+
+	if err != nil {
+		logger.Warning("can not cache completions: %s", err.Error())
+	}
+
+	return names, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeCompletionSource struct {
+	calls int
+}
+
+func (source *fakeCompletionSource) ListProjects() ([]string, error) {
+	source.calls++
+	return []string{"CORE", "OPS"}, nil
+}
+
+func (source *fakeCompletionSource) ListRepos(project string) ([]string, error) {
+	source.calls++
+	return map[string][]string{
+		"CORE": {"api", "web"},
+		"OPS":  {"deploy"},
+	}[project], nil
+}
+
+func (source *fakeCompletionSource) ListPullRequests(
+	project string, repo string,
+) ([]string, error) {
+	source.calls++
+	if project == "CORE" && repo == "api" {
+		return []string{"12", "15"}, nil
+	}
+
+	return nil, nil
+}
+
+func TestGetCompletions(t *testing.T) {
+	source := &fakeCompletionSource{}
+
+	tests := []struct {
+		words          []string
+		defaultProject string
+		expected       []string
+	}{
+		{[]string{"in"}, "", []string{"integration", "inbox"}},
+		{[]string{"C"}, "", []string{"CORE"}},
+		{[]string{"CORE/"}, "", []string{"CORE/api", "CORE/web"}},
+		{[]string{"CORE/api/1"}, "", []string{"CORE/api/12", "CORE/api/15"}},
+		{[]string{"a"}, "CORE", []string{"auth", "api"}},
+		{[]string{"api/"}, "CORE", []string{"api/12", "api/15"}},
+		{[]string{"CORE/api/12", "ap"}, "", []string{"approve", "apply-suggestions"}},
+		{[]string{"--debug=1", "CORE/api", "ls"}, "", []string{"ls-reviews"}},
+		{[]string{"CORE/api", "ls-reviews", "-d", "m"}, "", []string{"merged"}},
+		{[]string{"completion", ""}, "", []string{"bash", "zsh", "fish"}},
+		{[]string{"doctor", ""}, "", []string{}},
+		{[]string{"--pr"}, "", nil},
+	}
+
+	for _, test := range tests {
+		actual := getCompletions(test.words, source, test.defaultProject)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf(
+				"unexpected completions of %q: %q, expected %q",
+				test.words, actual, test.expected,
+			)
+		}
+	}
+}
+
+func TestCachedCompletionSourceReusesListedNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ash-completion")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	source := &fakeCompletionSource{}
+	cache := cachedCompletionSource{source: source, dir: dir, ttl: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		repos, err := cache.ListRepos("CORE")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(repos, []string{"api", "web"}) {
+			t.Fatalf("unexpected repos: %q", repos)
+		}
+	}
+
+	if source.calls != 1 {
+		t.Fatalf("source is called %d times, expected once", source.calls)
+	}
+
+	cache.ttl = 0
+	cache.ListRepos("CORE")
+
+	if source.calls != 2 {
+		t.Fatal("expired cache is used")
+	}
+}
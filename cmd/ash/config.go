@@ -0,0 +1,610 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	configCommandPrefix = "command."
+
+	localConfigName = ".ashrc"
+)
+
+var reConfigSection = regexp.MustCompile(`^\[([^\]]+)\]$`)
+
+// configOptionAliases maps short options to their long forms, so they are
+// treated as the same option when config layers are merged.
+var configOptionAliases = map[string]string{
+	"-u": "--user",
+	"-p": "--pass",
+	"-i": "--interactive",
+	"-w": "--ignore-whitespace",
+	"-o": "--output",
+}
+
+// configEnvFlags maps environment variables to the cmd line flags they set.
+// Order is preserved to keep resulting cmd line stable.
+var configEnvFlags = [][2]string{
+	{"ASH_HOST", "--url"},
+	{"ASH_USER", "--user"},
+	{"ASH_PASS", "--pass"},
+	{"ASH_EDITOR", "-e"},
+}
+
+var reConfigKeyValue = regexp.MustCompile(`^([A-Za-z][\w-]*)\s*=\s*(.*)$`)
+
+var reConfigKey = regexp.MustCompile(`^[A-Za-z][\w-]*$`)
+
+// configKeyFlags maps keys of structured config to the cmd line flags, keys
+// which are not listed here are mapped to the long flags with same name.
+var configKeyFlags = map[string]string{
+	"host":   "--url",
+	"editor": "-e",
+}
+
+// configNegatedFlags maps keys of structured config to the flags which
+// turn feature off, so 'color = false' is the same as '--no-color'.
+var configNegatedFlags = map[string]string{
+	"color": "--no-color",
+}
+
+type config struct {
+	// args which are applied regardless of profile
+	global []string
+
+	profiles map[string][]string
+
+	// args which are applied only if specified command is run
+	commands map[string][]string
+}
+
+// parseConfig parses config file, which consists of cmd line args, one per
+// line, optionally grouped into profiles by '[name]' section headers.
+//
+// Structured format, where every line is 'key = value' is also supported,
+// in that format '[command.<name>]' sections set defaults for the command.
+func parseConfig(data string) config {
+	result := config{
+		global:   []string{},
+		profiles: map[string][]string{},
+		commands: map[string][]string{},
+	}
+
+	structured := isStructuredConfig(data)
+
+	section := ""
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if structured && strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if matches := reConfigSection.FindStringSubmatch(line); matches != nil {
+			section = strings.TrimSpace(matches[1])
+			if strings.HasPrefix(section, configCommandPrefix) {
+				result.commands[strings.TrimPrefix(section, configCommandPrefix)] =
+					[]string{}
+			} else {
+				result.profiles[section] = []string{}
+			}
+
+			continue
+		}
+
+		args := []string{line}
+		if structured {
+			var err error
+			args, err = parseConfigKeyValue(line)
+			if err != nil {
+				logger.Warning("invalid config line '%s': %s", line, err)
+				continue
+			}
+		}
+
+		switch {
+		case section == "":
+			result.global = append(result.global, args...)
+		case strings.HasPrefix(section, configCommandPrefix):
+			command := strings.TrimPrefix(section, configCommandPrefix)
+			result.commands[command] = append(result.commands[command], args...)
+		default:
+			result.profiles[section] = append(result.profiles[section], args...)
+		}
+	}
+
+	return result
+}
+
+func isStructuredConfig(data string) bool {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") ||
+			reConfigSection.MatchString(line) {
+			continue
+		}
+
+		return reConfigKeyValue.MatchString(line)
+	}
+
+	return false
+}
+
+// validateConfig returns lines of structured config which can not be
+// parsed. Legacy config lines are not validated, they are passed to docopt.
+func validateConfig(data string) []string {
+	invalid := []string{}
+	if !isStructuredConfig(data) {
+		return invalid
+	}
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") ||
+			reConfigSection.MatchString(line) {
+			continue
+		}
+
+		if _, err := parseConfigKeyValue(line); err != nil {
+			invalid = append(invalid, fmt.Sprintf("'%s'", line))
+		}
+	}
+
+	return invalid
+}
+
+// parseConfigKeyValue converts 'key = value' line to the cmd line args.
+// Boolean values turn flags on and off.
+func parseConfigKeyValue(line string) ([]string, error) {
+	matches := reConfigKeyValue.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, fmt.Errorf("'key = value' expected")
+	}
+
+	key := matches[1]
+	value := strings.TrimSpace(matches[2])
+
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, err
+		}
+
+		value = unquoted
+	case strings.HasPrefix(value, `'`):
+		if len(value) < 2 || !strings.HasSuffix(value, `'`) {
+			return nil, fmt.Errorf("unterminated string")
+		}
+
+		value = value[1 : len(value)-1]
+	case value == "true":
+		if _, ok := configNegatedFlags[key]; ok {
+			return []string{}, nil
+		}
+
+		return []string{getConfigKeyFlag(key)}, nil
+	case value == "false":
+		if flag, ok := configNegatedFlags[key]; ok {
+			return []string{flag}, nil
+		}
+
+		return []string{}, nil
+	}
+
+	flag := getConfigKeyFlag(key)
+	if !strings.HasPrefix(flag, "--") {
+		return []string{flag, value}, nil
+	}
+
+	return []string{flag + "=" + value}, nil
+}
+
+func getConfigKeyFlag(key string) string {
+	if flag, ok := configKeyFlags[key]; ok {
+		return flag
+	}
+
+	return "--" + key
+}
+
+// getArgs returns config args for the given profile. If profile is not
+// specified, it is inferred by matching --url of profiles against Stash
+// URLs found in the cmd line.
+func (conf config) getArgs(profile string, cmdLine []string) []string {
+	if profile == "" {
+		profile = conf.findProfileByURL(cmdLine)
+	}
+
+	args := append([]string{}, conf.global...)
+
+	if profile != "" {
+		if _, ok := conf.profiles[profile]; !ok {
+			logger.Warning("profile '%s' is not found in config", profile)
+		} else {
+			logger.Debug("using config profile '%s'", profile)
+		}
+
+		args = overrideArgs(args, conf.profiles[profile])
+	}
+
+	for _, arg := range cmdLine {
+		if commandArgs, ok := conf.commands[arg]; ok {
+			args = overrideArgs(args, commandArgs)
+		}
+	}
+
+	return args
+}
+
+// findProfileByURL returns name of profile, which --url is the host of
+// Stash URL from cmd line. Profiles are matched in order of their names,
+// so the same profile is chosen if several ones have the same --url.
+func (conf config) findProfileByURL(cmdLine []string) string {
+	names := []string{}
+	for name := range conf.profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, arg := range cmdLine {
+		host := ""
+		if matches := reStashURL.FindStringSubmatch(arg); matches != nil {
+			host = matches[1]
+		} else if reBitbucketURL.MatchString(arg) {
+			host = bitbucketHost
+		} else if matches := reGerritURL.FindStringSubmatch(arg); matches != nil {
+			host = matches[1]
+		}
+
+		if host == "" {
+			continue
+		}
+
+		for _, name := range names {
+			profileURL := getArgValue(conf.profiles[name], "--url")
+			if profileURL == "" {
+				continue
+			}
+
+			if getHostPath(profileURL) == getHostPath(host) {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
+
+func (conf config) getSectionArgs(section string) []string {
+	switch {
+	case section == "":
+		return conf.global
+	case strings.HasPrefix(section, configCommandPrefix):
+		return conf.commands[strings.TrimPrefix(section, configCommandPrefix)]
+	default:
+		return conf.profiles[section]
+	}
+}
+
+// splitConfigKey splits key like 'work.url' onto section and key itself.
+func splitConfigKey(fullKey string) (string, string) {
+	index := strings.LastIndex(fullKey, ".")
+	if index < 0 {
+		return "", fullKey
+	}
+
+	return fullKey[:index], fullKey[index+1:]
+}
+
+// getConfigValue returns value of the key in specified section of config.
+// Flags without values are reported as 'true'.
+func getConfigValue(data string, section string, key string) (string, bool) {
+	args := parseConfig(data).getSectionArgs(section)
+
+	name := getOptionName(getConfigKeyFlag(key))
+
+	value := ""
+	found := false
+	for i, arg := range args {
+		if negated, ok := configNegatedFlags[key]; ok && arg == negated {
+			value = "false"
+			found = true
+			continue
+		}
+
+		if getOptionName(arg) != name {
+			continue
+		}
+
+		found = true
+
+		switch {
+		case strings.Contains(arg, "="):
+			value = strings.SplitN(arg, "=", 2)[1]
+		case i+1 < len(args) && !strings.HasPrefix(args[i+1], "-"):
+			value = args[i+1]
+		default:
+			value = "true"
+		}
+	}
+
+	return value, found
+}
+
+// setConfigValue replaces value of the key in specified section of config
+// or adds it to the end of section. Format of the config (legacy or
+// structured) as well as comments and unrelated lines are kept intact.
+func setConfigValue(
+	data string, section string, key string, value string,
+) (string, error) {
+	if !reConfigKey.MatchString(key) {
+		return "", fmt.Errorf("invalid key '%s'", key)
+	}
+
+	structured := isStructuredConfig(data) || strings.TrimSpace(data) == ""
+
+	line := key + " = " + formatConfigValue(value)
+
+	newLines := []string{line}
+	if !structured {
+		args, err := parseConfigKeyValue(line)
+		if err != nil {
+			return "", err
+		}
+
+		newLines = formatLegacyConfigArgs(args)
+	}
+
+	names := map[string]bool{getOptionName(getConfigKeyFlag(key)): true}
+	if negated, ok := configNegatedFlags[key]; ok {
+		names[negated] = true
+	}
+
+	lines := []string{}
+	if strings.TrimSpace(data) != "" {
+		lines = strings.Split(strings.TrimRight(data, "\n"), "\n")
+	}
+
+	start, end, found := findConfigSection(lines, section)
+	if !found {
+		lines = append(lines, "", "["+section+"]")
+		start, end = len(lines), len(lines)
+	}
+
+	body := []string{}
+	insertAt := -1
+	for i := start; i < end; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+
+		matched := false
+		if structured {
+			matches := reConfigKeyValue.FindStringSubmatch(trimmed)
+			matched = matches != nil &&
+				names[getOptionName(getConfigKeyFlag(matches[1]))]
+		} else {
+			matched = strings.HasPrefix(trimmed, "-") &&
+				names[getOptionName(trimmed)]
+
+			// value of the option is written on the next line
+			if matched && !strings.Contains(trimmed, "=") && i+1 < end {
+				next := strings.TrimSpace(lines[i+1])
+				if next != "" && !strings.HasPrefix(next, "-") {
+					i++
+				}
+			}
+		}
+
+		if !matched {
+			body = append(body, lines[i])
+			continue
+		}
+
+		if insertAt < 0 {
+			insertAt = len(body)
+		}
+	}
+
+	if insertAt < 0 {
+		insertAt = len(body)
+		for insertAt > 0 && strings.TrimSpace(body[insertAt-1]) == "" {
+			insertAt--
+		}
+	}
+
+	result := append([]string{}, lines[:start]...)
+	result = append(result, body[:insertAt]...)
+	result = append(result, newLines...)
+	result = append(result, body[insertAt:]...)
+	result = append(result, lines[end:]...)
+
+	return strings.Join(result, "\n") + "\n", nil
+}
+
+// findConfigSection returns range of lines, which belong to the given
+// section, header excluded. Empty section name means global section.
+func findConfigSection(lines []string, section string) (int, int, bool) {
+	start := -1
+	if section == "" {
+		start = 0
+	}
+
+	for i, line := range lines {
+		matches := reConfigSection.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+
+		if start >= 0 {
+			return start, i, true
+		}
+
+		if strings.TrimSpace(matches[1]) == section {
+			start = i + 1
+		}
+	}
+
+	if start < 0 {
+		return 0, 0, false
+	}
+
+	return start, len(lines), true
+}
+
+func formatConfigValue(value string) string {
+	if value == "true" || value == "false" {
+		return value
+	}
+
+	if _, err := strconv.Atoi(value); err == nil {
+		return value
+	}
+
+	return strconv.Quote(value)
+}
+
+// formatLegacyConfigArgs formats args in the legacy config style, where
+// values are written on the separate indented lines.
+func formatLegacyConfigArgs(args []string) []string {
+	lines := []string{}
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "-") && strings.Contains(arg, "="):
+			parts := strings.SplitN(arg, "=", 2)
+			lines = append(lines, parts[0], "  "+parts[1])
+		case strings.HasPrefix(arg, "-"):
+			lines = append(lines, arg)
+		default:
+			lines = append(lines, "  "+arg)
+		}
+	}
+
+	return lines
+}
+
+// writeConfig atomically replaces config file, so it will not be left
+// half-written if ash is interrupted.
+func writeConfig(path string, data string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+
+	err = ioutil.WriteFile(tmpPath, []byte(data), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// getHostPath returns host of URL along with context path, so Stash
+// instances served under the same host can be distinguished.
+func getHostPath(stashURL string) string {
+	if index := strings.Index(stashURL, "://"); index >= 0 {
+		stashURL = stashURL[index+3:]
+	}
+
+	return strings.TrimSuffix(stashURL, "/")
+}
+
+// getArgValue returns value of the long flag given either as '--flag=value'
+// or as '--flag value' (which are on separate lines in config).
+func getArgValue(args []string, flag string) string {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, flag+"=") {
+			return strings.TrimPrefix(arg, flag+"=")
+		}
+
+		if arg == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return ""
+}
+
+// getEnvArgs returns cmd line args which are set through environment
+// variables, e.g. in CI jobs.
+func getEnvArgs() []string {
+	args := []string{}
+	for _, env := range configEnvFlags {
+		value := os.Getenv(env[0])
+		if value == "" {
+			continue
+		}
+
+		args = append(args, env[1], value)
+	}
+
+	return args
+}
+
+// overrideArgs appends overrides to the config args, removing options which
+// are specified in both, because docopt does not allow options to repeat.
+//
+// Config args consist of options only, so every arg that is not an option
+// is considered to be a value of the preceding option.
+func overrideArgs(args []string, overrides []string) []string {
+	overridden := map[string]bool{}
+	for _, arg := range overrides {
+		if strings.HasPrefix(arg, "-") {
+			overridden[getOptionName(arg)] = true
+		}
+	}
+
+	result := []string{}
+
+	skip := false
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			skip = overridden[getOptionName(arg)]
+		}
+
+		if !skip {
+			result = append(result, arg)
+		}
+	}
+
+	return append(result, overrides...)
+}
+
+func getOptionName(arg string) string {
+	name := strings.SplitN(arg, "=", 2)[0]
+	if alias, ok := configOptionAliases[name]; ok {
+		return alias
+	}
+
+	return name
+}
+
+// findLocalConfig walks up from the given directory looking for the
+// project-local config, like git does for the '.git' directory.
+func findLocalConfig(dir string) string {
+	for {
+		path := filepath.Join(dir, localConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+
+		dir = parent
+	}
+}
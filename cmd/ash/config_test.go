@@ -0,0 +1,210 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigGetArgs(t *testing.T) {
+	conf := parseConfig(`
+-e
+  vim
+
+[work]
+--url
+  https://stash.work.local/
+--user
+  john
+
+[oss]
+--url=http://stash.oss.local
+
+[work-bot]
+--url=https://stash.work.local/
+--user=bot
+
+[tools]
+--url=https://stash.work.local/tools/
+
+[cloud]
+--url=https://bitbucket.org
+--user=jdoe
+`)
+
+	tests := []struct {
+		profile  string
+		cmdLine  []string
+		expected []string
+	}{
+		{
+			"",
+			[]string{"repo/1", "review"},
+			[]string{"-e", "vim"},
+		},
+		{
+			"oss",
+			[]string{"repo/1", "review"},
+			[]string{"-e", "vim", "--url=http://stash.oss.local"},
+		},
+		{
+			"",
+			[]string{
+				"https://stash.work.local/projects/P/repos/r/pull-requests/1",
+			},
+			[]string{
+				"-e", "vim",
+				"--url", "https://stash.work.local/", "--user", "john",
+			},
+		},
+		{
+			"",
+			[]string{
+				"https://stash.work.local/tools/projects/P/repos/r/pull-requests/1",
+			},
+			[]string{
+				"-e", "vim", "--url=https://stash.work.local/tools/",
+			},
+		},
+		{
+			"",
+			[]string{
+				"https://bitbucket.org/team/r/pull-requests/1",
+			},
+			[]string{
+				"-e", "vim", "--url=https://bitbucket.org", "--user=jdoe",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		actual := conf.getArgs(test.profile, test.cmdLine)
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("unexpected args\n%#v\n%#v", test.expected, actual)
+		}
+	}
+}
+
+func TestStructuredConfigGetArgs(t *testing.T) {
+	conf := parseConfig(`
+# structured config
+host = "https://stash.local/"
+editor = vim
+color = false
+
+[work]
+project = 'PROJ'
+
+[command.ls-reviews]
+limit = 100
+`)
+
+	tests := []struct {
+		profile  string
+		cmdLine  []string
+		expected []string
+	}{
+		{
+			"",
+			[]string{"repo/1", "review"},
+			[]string{"--url=https://stash.local/", "-e", "vim", "--no-color"},
+		},
+		{
+			"work",
+			[]string{"repo", "ls-reviews"},
+			[]string{
+				"--url=https://stash.local/", "-e", "vim", "--no-color",
+				"--project=PROJ", "--limit=100",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		actual := conf.getArgs(test.profile, test.cmdLine)
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("unexpected args\n%#v\n%#v", test.expected, actual)
+		}
+	}
+}
+
+func TestParseConfigKeyValueUnescapesNewLines(t *testing.T) {
+	args, err := parseConfigKeyValue(
+		`pass = "!gpg:-----BEGIN PGP MESSAGE-----\n\nhQEMA\n"`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"--pass=!gpg:-----BEGIN PGP MESSAGE-----\n\nhQEMA\n"}
+	if !reflect.DeepEqual(expected, args) {
+		t.Fatalf("unexpected args\n%#v\n%#v", expected, args)
+	}
+}
+
+func TestOverrideArgs(t *testing.T) {
+	actual := overrideArgs(
+		[]string{"--url", "http://a/", "-u", "john", "--no-color", "-e", "vim"},
+		[]string{"--user=bob", "--url", "http://b/", "repo/1", "review"},
+	)
+
+	expected := []string{
+		"--no-color", "-e", "vim",
+		"--user=bob", "--url", "http://b/", "repo/1", "review",
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("unexpected args\n%#v\n%#v", expected, actual)
+	}
+}
+
+func TestSetConfigValue(t *testing.T) {
+	tests := []struct {
+		data     string
+		key      string
+		value    string
+		expected string
+	}{
+		{
+			"",
+			"url", "http://stash/",
+			"url = \"http://stash/\"\n",
+		},
+		{
+			"# comment\nhost = 'http://old/'\neditor = vim\n\n[work]\nuser = john\n",
+			"url", "http://new/",
+			"# comment\nurl = \"http://new/\"\neditor = vim\n\n[work]\nuser = john\n",
+		},
+		{
+			"editor = vim\n",
+			"command.ls-reviews.limit", "100",
+			"editor = vim\n\n[command.ls-reviews]\nlimit = 100\n",
+		},
+		{
+			"--user\n  john\n\n--url\n  http://old/\n\n[oss]\n--user\n  bob\n",
+			"url", "http://new/",
+			"--user\n  john\n\n--url\n  http://new/\n\n[oss]\n--user\n  bob\n",
+		},
+		{
+			"--user\n  john\n\n[oss]\n--user\n  bob\n",
+			"oss.color", "false",
+			"--user\n  john\n\n[oss]\n--user\n  bob\n--no-color\n",
+		},
+	}
+
+	for _, test := range tests {
+		section, key := splitConfigKey(test.key)
+
+		actual, err := setConfigValue(test.data, section, key, test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual != test.expected {
+			t.Fatalf("unexpected config\n%q\n%q", test.expected, actual)
+		}
+
+		value, ok := getConfigValue(actual, section, key)
+		if !ok || value != test.value {
+			t.Fatalf("unexpected value of %s: %q", test.key, value)
+		}
+	}
+}
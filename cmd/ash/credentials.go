@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const keychainService = "ash"
+
+// Password with this prefix is decrypted by gpg; it is followed by either
+// ASCII armored message or path to the encrypted file.
+const gpgPasswordPrefix = "!gpg:"
+
+var errKeychainUnavailable = errors.New(
+	"system keychain is not supported on " + runtime.GOOS,
+)
+
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// getUser returns user specified in cmd line args and config or, if it is
+// not specified, login from ~/.netrc entry for the given Stash host.
+func getUser(args map[string]interface{}, host string) (string, error) {
+	if args["--user"] != nil {
+		return args["--user"].(string), nil
+	}
+
+	entry := getNetrcEntry(host)
+	if entry != nil && entry.login != "" {
+		logger.Debug("user is taken from netrc")
+		return entry.login, nil
+	}
+
+	return "", errors.New("--user should be specified")
+}
+
+// getPassword looks for password of the user on the given Stash host in
+// the system keychain first, then in the output of --pass-cmd, then in the
+// cmd line args and config (optionally encrypted by gpg) and finally in
+// ~/.netrc.
+func getPassword(
+	args map[string]interface{}, host string, user string,
+) (string, error) {
+	pass, err := getStoredPassword(args, host, user)
+	if err != nil || pass != "" {
+		return pass, err
+	}
+
+	pass, err = promptPassword(
+		fmt.Sprintf("Password for %s at %s: ", user, getHostName(host)),
+	)
+	if err != nil {
+		logger.Debug("can not prompt for password: %s", err.Error())
+		return "", errors.New("--pass should be specified")
+	}
+
+	return pass, nil
+}
+
+// getLazyPassword returns function, which gets password on the first call
+// only. Stash asks for credentials only if there is no valid session, so
+// user is not prompted for password otherwise.
+func getLazyPassword(
+	args map[string]interface{}, host string, user string,
+) func() (string, error) {
+	var once sync.Once
+	var pass string
+
+	return func() (string, error) {
+		once.Do(func() {
+			var err error
+
+			pass, err = getPassword(args, host, user)
+			if err != nil {
+				fmt.Printf("%s.\n", err.Error())
+				os.Exit(exitAuth)
+			}
+		})
+
+		return pass, nil
+	}
+}
+
+// getStoredPassword returns password from keychain, args or netrc without
+// prompting for it; empty password is returned if it is not found.
+func getStoredPassword(
+	args map[string]interface{}, host string, user string,
+) (string, error) {
+	pass, err := getKeychainPassword(host, user)
+	if err == nil && pass != "" {
+		if args["--pass"] != nil || args["--pass-cmd"] != nil {
+			logger.Info(
+				"password is taken from system keychain instead of " +
+					"--pass and --pass-cmd, see 'auth logout'",
+			)
+		} else {
+			logger.Debug("password is taken from system keychain")
+		}
+
+		return pass, nil
+	}
+
+	if err != nil {
+		logger.Debug("can not get password from keychain: %s", err.Error())
+	}
+
+	if args["--pass-cmd"] != nil {
+		return getCmdPassword(args["--pass-cmd"].(string))
+	}
+
+	if args["--pass"] != nil {
+		pass := args["--pass"].(string)
+		if strings.HasPrefix(pass, gpgPasswordPrefix) {
+			return getGPGPassword(strings.TrimPrefix(pass, gpgPasswordPrefix))
+		}
+
+		return pass, nil
+	}
+
+	entry := getNetrcEntry(host)
+	if entry != nil && entry.login == user && entry.password != "" {
+		logger.Debug("password is taken from netrc")
+		return entry.password, nil
+	}
+
+	return "", nil
+}
+
+// promptPassword asks for password on the terminal with echo turned off.
+func promptPassword(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+
+	defer tty.Close()
+
+	err = setTerminalEcho(tty, false)
+	if err != nil {
+		return "", err
+	}
+
+	defer setTerminalEcho(tty, true)
+
+	fmt.Fprint(tty, prompt)
+
+	pass, err := bufio.NewReader(tty).ReadString('\n')
+
+	fmt.Fprintln(tty)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(pass, "\r\n"), nil
+}
+
+func setTerminalEcho(tty *os.File, enabled bool) error {
+	mode := "-echo"
+	if enabled {
+		mode = "echo"
+	}
+
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = tty
+
+	return cmd.Run()
+}
+
+// getCmdPassword runs given shell command and uses first line of it's
+// output as password, like 'pass show' prints it.
+func getCmdPassword(command string) (string, error) {
+	logger.Debug("running password command: %s", command)
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = os.Stdin
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf(
+			"--pass-cmd failed: %s: %s",
+			err.Error(), strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	pass := strings.SplitN(string(output), "\n", 2)[0]
+	if pass == "" {
+		return "", errors.New("--pass-cmd returned empty password")
+	}
+
+	return pass, nil
+}
+
+// getGPGPassword decrypts password, which is given either as ASCII armored
+// PGP message or as path to the encrypted file. gpg-agent is responsible
+// for asking passphrase.
+func getGPGPassword(encrypted string) (string, error) {
+	cmd := exec.Command("gpg", "--quiet", "--decrypt")
+
+	if strings.HasPrefix(encrypted, "-----BEGIN PGP MESSAGE-----") {
+		cmd.Stdin = strings.NewReader(encrypted)
+	} else {
+		path := encrypted
+		if strings.HasPrefix(path, "~/") {
+			path = os.Getenv("HOME") + path[1:]
+		}
+
+		logger.Debug("decrypting password from %s", path)
+
+		cmd.Args = append(cmd.Args, path)
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf(
+			"can not decrypt password: %s: %s",
+			err.Error(), strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	pass := strings.SplitN(string(output), "\n", 2)[0]
+	if pass == "" {
+		return "", errors.New("decrypted password is empty")
+	}
+
+	return pass, nil
+}
+
+func getNetrcEntry(host string) *netrcEntry {
+	netrcPath := os.Getenv("NETRC")
+	if netrcPath == "" {
+		netrcPath = os.Getenv("HOME") + "/.netrc"
+	}
+
+	data, err := ioutil.ReadFile(netrcPath)
+	if err != nil {
+		logger.Debug("can not read netrc: %s", err.Error())
+		return nil
+	}
+
+	entries := parseNetrc(string(data))
+
+	var fallback *netrcEntry
+	for i, entry := range entries {
+		switch entry.machine {
+		case getHostName(host), strings.Split(getHostName(host), ":")[0]:
+			return &entries[i]
+		case "":
+			fallback = &entries[i]
+		}
+	}
+
+	return fallback
+}
+
+// parseNetrc parses netrc file contents. Entry with empty machine
+// corresponds to the 'default' entry. Macros are not supported.
+func parseNetrc(data string) []netrcEntry {
+	entries := []netrcEntry{}
+
+	tokens := strings.Fields(data)
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			if i+1 < len(tokens) {
+				i++
+				entries = append(entries, netrcEntry{machine: tokens[i]})
+			}
+		case "default":
+			entries = append(entries, netrcEntry{})
+		case "login", "password", "account":
+			if i+1 >= len(tokens) || len(entries) == 0 {
+				continue
+			}
+
+			i++
+			entry := &entries[len(entries)-1]
+			switch tokens[i-1] {
+			case "login":
+				entry.login = tokens[i]
+			case "password":
+				entry.password = tokens[i]
+			}
+		}
+	}
+
+	return entries
+}
+
+func getKeychainPassword(host string, user string) (string, error) {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command(
+			"security", "find-generic-password",
+			"-s", getKeychainServiceName(host), "-a", user, "-w",
+		)
+	case "linux", "freebsd", "openbsd":
+		cmd = exec.Command(
+			"secret-tool", "lookup",
+			"service", keychainService, "host", getHostName(host), "user", user,
+		)
+	case "windows":
+		return readWindowsCredential(getKeychainTargetName(host, user))
+	default:
+		return "", errKeychainUnavailable
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
+func setKeychainPassword(host string, user string, pass string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		// command is read by security from stdin, so password is not
+		// visible in process list
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf(
+			"add-generic-password -U -s %s -a %s -w %s\n",
+			quoteSecurityArg(getKeychainServiceName(host)),
+			quoteSecurityArg(user),
+			quoteSecurityArg(pass),
+		))
+	case "linux", "freebsd", "openbsd":
+		cmd = exec.Command(
+			"secret-tool", "store",
+			"--label", getKeychainServiceName(host)+" "+user,
+			"service", keychainService, "host", getHostName(host), "user", user,
+		)
+		cmd.Stdin = strings.NewReader(pass)
+	case "windows":
+		return writeWindowsCredential(
+			getKeychainTargetName(host, user), user, pass,
+		)
+	default:
+		return errKeychainUnavailable
+	}
+
+	return runKeychainCmd(cmd)
+}
+
+func deleteKeychainPassword(host string, user string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command(
+			"security", "delete-generic-password",
+			"-s", getKeychainServiceName(host), "-a", user,
+		)
+	case "linux", "freebsd", "openbsd":
+		cmd = exec.Command(
+			"secret-tool", "clear",
+			"service", keychainService, "host", getHostName(host), "user", user,
+		)
+	case "windows":
+		return deleteWindowsCredential(getKeychainTargetName(host, user))
+	default:
+		return errKeychainUnavailable
+	}
+
+	return runKeychainCmd(cmd)
+}
+
+func runKeychainCmd(cmd *exec.Cmd) error {
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf(
+			"%s: %s", err.Error(), strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	return nil
+}
+
+func getKeychainServiceName(host string) string {
+	return keychainService + ":" + getHostName(host)
+}
+
+// getKeychainTargetName returns name of Windows credential, which is unique
+// per host and user, since Credential Manager identifies credentials only by
+// target name.
+func getKeychainTargetName(host string, user string) string {
+	return getKeychainServiceName(host) + ":" + user
+}
+
+// quoteSecurityArg quotes argument of command, which is read by macOS
+// 'security -i' from stdin.
+func quoteSecurityArg(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+func getHostName(host string) string {
+	hostURL, err := url.Parse(host)
+	if err != nil || hostURL.Host == "" {
+		return host
+	}
+
+	return hostURL.Host
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+func readWindowsCredential(target string) (string, error) {
+	return "", errKeychainUnavailable
+}
+
+func writeWindowsCredential(target string, user string, pass string) error {
+	return errKeychainUnavailable
+}
+
+func deleteWindowsCredential(target string) error {
+	return errKeychainUnavailable
+}
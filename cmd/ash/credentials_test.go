@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	data := `
+machine stash.local
+    login john
+    password secret
+
+machine other.local login jane password other
+default login anonymous password guest
+`
+
+	expected := []netrcEntry{
+		{machine: "stash.local", login: "john", password: "secret"},
+		{machine: "other.local", login: "jane", password: "other"},
+		{login: "anonymous", password: "guest"},
+	}
+
+	actual := parseNetrc(data)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("unexpected netrc entries\n%#v\n%#v", expected, actual)
+	}
+}
+
+func TestQuoteSecurityArg(t *testing.T) {
+	actual := quoteSecurityArg(`pa"ss\word`)
+	expected := `"pa\"ss\\word"`
+
+	if actual != expected {
+		t.Fatalf("unexpected quoted arg: %s", actual)
+	}
+}
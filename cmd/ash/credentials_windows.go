@@ -0,0 +1,122 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+// windowsCredential is CREDENTIALW structure of Windows Credential Manager.
+type windowsCredential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// readWindowsCredential returns password of generic credential with given
+// target name from Windows Credential Manager.
+func readWindowsCredential(target string) (string, error) {
+	targetName, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return "", err
+	}
+
+	var credential *windowsCredential
+
+	ok, _, err := procCredReadW.Call(
+		uintptr(unsafe.Pointer(targetName)),
+		credTypeGeneric,
+		0,
+		uintptr(unsafe.Pointer(&credential)),
+	)
+	if ok == 0 {
+		return "", err
+	}
+
+	defer procCredFree.Call(uintptr(unsafe.Pointer(credential)))
+
+	size := credential.CredentialBlobSize
+	if size == 0 {
+		return "", nil
+	}
+
+	blob := (*[1 << 20]byte)(unsafe.Pointer(credential.CredentialBlob))
+
+	return string(blob[:size:size]), nil
+}
+
+// writeWindowsCredential stores password as generic credential with given
+// target name, replacing existing one.
+func writeWindowsCredential(target string, user string, pass string) error {
+	targetName, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+
+	userName, err := syscall.UTF16PtrFromString(user)
+	if err != nil {
+		return err
+	}
+
+	credential := windowsCredential{
+		Type:               credTypeGeneric,
+		TargetName:         targetName,
+		CredentialBlobSize: uint32(len(pass)),
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+
+	if len(pass) > 0 {
+		blob := []byte(pass)
+		credential.CredentialBlob = &blob[0]
+	}
+
+	ok, _, err := procCredWriteW.Call(
+		uintptr(unsafe.Pointer(&credential)), 0,
+	)
+	if ok == 0 {
+		return err
+	}
+
+	return nil
+}
+
+func deleteWindowsCredential(target string) error {
+	targetName, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := procCredDelete.Call(
+		uintptr(unsafe.Pointer(targetName)), credTypeGeneric, 0,
+	)
+	if ok == 0 {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// dateLayout is Go layout of dates printed by ash, which is set by
+// --date-format. Every place which prints dates has its own default layout,
+// which is used if it is empty.
+var dateLayout = ""
+
+// strftimeLayouts maps strftime conversions to Go layout.
+var strftimeLayouts = map[byte]string{
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'B': "January",
+	'd': "02",
+	'e': "_2",
+	'F': "2006-01-02",
+	'H': "15",
+	'I': "03",
+	'm': "01",
+	'M': "04",
+	'p': "PM",
+	'R': "15:04",
+	'S': "05",
+	'T': "15:04:05",
+	'y': "06",
+	'Y': "2006",
+	'z': "-0700",
+	'Z': "MST",
+	'%': "%",
+}
+
+func setupDateFormat(args map[string]interface{}) {
+	if args["--date-format"] == nil {
+		return
+	}
+
+	layout, err := getDateLayout(args["--date-format"].(string))
+	if err != nil {
+		fmt.Printf("--date-format is invalid: %s.\n", err.Error())
+		os.Exit(exitUsage)
+	}
+
+	dateLayout = layout
+	stash.TimestampLayout = layout
+}
+
+// getDateLayout returns Go layout for given date format, which is either
+// strftime format, if it contains '%', or Go layout itself.
+func getDateLayout(format string) (string, error) {
+	if !strings.Contains(format, "%") {
+		return format, nil
+	}
+
+	layout := &strings.Builder{}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			layout.WriteByte(format[i])
+			continue
+		}
+
+		if i == len(format)-1 {
+			return "", fmt.Errorf("'%%' at the end of '%s'", format)
+		}
+
+		i++
+
+		conversion, ok := strftimeLayouts[format[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported conversion '%%%c'", format[i])
+		}
+
+		layout.WriteString(conversion)
+	}
+
+	return layout.String(), nil
+}
+
+// formatTime formats time by layout set in --date-format or by given one.
+func formatTime(t time.Time, defaultLayout string) string {
+	if dateLayout != "" {
+		return t.Format(dateLayout)
+	}
+
+	return t.Format(defaultLayout)
+}
+
+// formatRelativeTime returns how long ago t was in short form, e.g.
+// '2h ago' or '3d ago'.
+func formatRelativeTime(t time.Time, now time.Time) string {
+	elapsed := now.Sub(t)
+
+	day := 24 * time.Hour
+
+	switch {
+	case elapsed < time.Minute:
+		return "now"
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm ago", elapsed/time.Minute)
+	case elapsed < day:
+		return fmt.Sprintf("%dh ago", elapsed/time.Hour)
+	case elapsed < 7*day:
+		return fmt.Sprintf("%dd ago", elapsed/day)
+	case elapsed < 30*day:
+		return fmt.Sprintf("%dw ago", elapsed/(7*day))
+	case elapsed < 365*day:
+		return fmt.Sprintf("%dmo ago", elapsed/(30*day))
+	default:
+		return fmt.Sprintf("%dy ago", elapsed/(365*day))
+	}
+}
+
+// formatDate returns date relative to now or in --date-format, which is
+// ISO 8601 by default, if absolute is set.
+func formatDate(u stash.UnixTimestamp, absolute bool) string {
+	if absolute {
+		return formatTime(u.AsTime(), time.RFC3339)
+	}
+
+	return formatRelativeTime(u.AsTime(), time.Now())
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDateLayout(t *testing.T) {
+	date := time.Date(2016, 3, 1, 9, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"%Y-%m-%d %H:%M", "2016-03-01 09:05"},
+		{"%d %b %Y, %I:%M %p", "01 Mar 2016, 09:05 AM"},
+		{"%F %T %%", "2016-03-01 09:05:00 %"},
+		{"02.01.2006 15:04", "01.03.2016 09:05"},
+	}
+
+	for _, test := range tests {
+		layout, err := getDateLayout(test.format)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", test.format, err)
+		}
+
+		actual := date.Format(layout)
+		if actual != test.expected {
+			t.Errorf(
+				"unexpected date formatted by %q: %q, expected %q",
+				test.format, actual, test.expected,
+			)
+		}
+	}
+}
+
+func TestGetDateLayoutRejectsUnsupportedConversions(t *testing.T) {
+	for _, format := range []string{"%Y-%q", "%Y-%"} {
+		_, err := getDateLayout(format)
+		if err == nil {
+			t.Errorf("error is expected for %q", format)
+		}
+	}
+}
+
+func TestFormatRelativeTime(t *testing.T) {
+	now := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		ago      time.Duration
+		expected string
+	}{
+		{30 * time.Second, "now"},
+		{5 * time.Minute, "5m ago"},
+		{2*time.Hour + 59*time.Minute, "2h ago"},
+		{3 * 24 * time.Hour, "3d ago"},
+		{15 * 24 * time.Hour, "2w ago"},
+		{65 * 24 * time.Hour, "2mo ago"},
+		{800 * 24 * time.Hour, "2y ago"},
+	}
+
+	for _, test := range tests {
+		actual := formatRelativeTime(now.Add(-test.ago), now)
+		if actual != test.expected {
+			t.Errorf(
+				"unexpected relative time for %s: %q, expected %q",
+				test.ago, actual, test.expected,
+			)
+		}
+	}
+}
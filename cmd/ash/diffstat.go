@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+const (
+	// diffStatWidth is width of histogram, if output is not terminal
+	diffStatWidth = 80
+
+	// diffStatMinGraphWidth is min number of columns for histogram, long
+	// names are truncated to keep it
+	diffStatMinGraphWidth = 10
+
+	// diffStatMinNameWidth is min number of columns for truncated names,
+	// histogram exceeds requested width if it is too small to fit both
+	diffStatMinNameWidth = 10
+)
+
+// showDiffStat prints changed files of pull request with histogram of
+// added and removed lines like 'git diff --stat' does.
+func showDiffStat(pr stash.PullRequest, excludes []string) {
+	files, err := pr.GetFiles(stash.DiffOptions{})
+	if err != nil {
+		logger.Critical("error accessing Stash: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	files = files.Exclude(excludes)
+
+	changeset, err := pr.GetDiff()
+	if err != nil {
+		logger.Critical("can not count changed lines: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	files.CountLines(changeset)
+
+	width := diffStatWidth
+	if isTerminal(os.Stdout) {
+		width = getTerminalWidth()
+	}
+
+	fmt.Print(formatDiffStat(files, width))
+}
+
+// formatDiffStat formats histogram of changed lines, which fits given
+// width. Histogram is scaled down if changes do not fit.
+func formatDiffStat(files stash.ReviewFiles, width int) string {
+	names := make([]string, len(files))
+	counts := make([]string, len(files))
+
+	nameWidth, countWidth, maxChanges := 0, 0, 0
+	added, removed := 0, 0
+
+	for i, file := range files {
+		names[i] = file.GetPath()
+		if file.SrcPath != "" && file.DstPath != "" &&
+			file.SrcPath != file.DstPath {
+			names[i] = file.SrcPath + " => " + file.DstPath
+		}
+
+		counts[i] = fmt.Sprint(file.Added + file.Removed)
+		if file.Binary {
+			counts[i] = "Bin"
+		}
+
+		if displayWidth(names[i]) > nameWidth {
+			nameWidth = displayWidth(names[i])
+		}
+
+		if len(counts[i]) > countWidth {
+			countWidth = len(counts[i])
+		}
+
+		if file.Added+file.Removed > maxChanges {
+			maxChanges = file.Added + file.Removed
+		}
+
+		added += file.Added
+		removed += file.Removed
+	}
+
+	// ' name | count graph'
+	graphWidth := width - nameWidth - countWidth - 5
+	if graphWidth < diffStatMinGraphWidth {
+		minNameWidth := diffStatMinNameWidth
+		if nameWidth < minNameWidth {
+			minNameWidth = nameWidth
+		}
+
+		nameWidth -= diffStatMinGraphWidth - graphWidth
+		if nameWidth < minNameWidth {
+			nameWidth = minNameWidth
+		}
+
+		graphWidth = diffStatMinGraphWidth
+	}
+
+	buffer := &bytes.Buffer{}
+	for i, file := range files {
+		name := names[i]
+		if displayWidth(name) > nameWidth {
+			name = truncateFromStart(name, nameWidth)
+		}
+
+		graph := ""
+		if !file.Binary {
+			plus := scaleDiffStat(file.Added, maxChanges, graphWidth)
+			minus := scaleDiffStat(file.Removed, maxChanges, graphWidth)
+
+			graph = colors.paint("added", strings.Repeat("+", plus)) +
+				colors.paint("removed", strings.Repeat("-", minus))
+		}
+
+		line := fmt.Sprintf(" %s%s | %*s %s",
+			name, strings.Repeat(" ", nameWidth-displayWidth(name)),
+			countWidth, counts[i], graph,
+		)
+
+		buffer.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+
+	fmt.Fprintf(buffer,
+		" %d file%s changed, %d insertion%s(+), %d deletion%s(-)\n",
+		len(files), plural(len(files)),
+		added, plural(added),
+		removed, plural(removed),
+	)
+
+	return buffer.String()
+}
+
+// scaleDiffStat returns length of histogram bar for number of changed
+// lines, changed lines are never shown as empty bar.
+func scaleDiffStat(lines int, maxChanges int, graphWidth int) int {
+	if maxChanges <= graphWidth || lines == 0 {
+		return lines
+	}
+
+	scaled := (lines*graphWidth + maxChanges/2) / maxChanges
+	if scaled == 0 {
+		return 1
+	}
+
+	return scaled
+}
+
+// truncateFromStart truncates beginning of text to fit width, so the most
+// specific part of path is kept.
+func truncateFromStart(text string, width int) string {
+	runes := []rune(text)
+	for len(runes) > 0 && displayWidth(string(runes))+1 > width {
+		runes = runes[1:]
+	}
+
+	return "…" + string(runes)
+}
+
+func plural(count int) string {
+	if count == 1 {
+		return ""
+	}
+
+	return "s"
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestFormatDiffStat(t *testing.T) {
+	files := stash.ReviewFiles{
+		{DstPath: "main.go", Added: 3, Removed: 2},
+		{SrcPath: "old.go", DstPath: "new.go", Added: 1},
+		{DstPath: "logo.png", Binary: true},
+	}
+
+	expected := "" +
+		" main.go          |   5 +++--\n" +
+		" old.go => new.go |   1 +\n" +
+		" logo.png         | Bin\n" +
+		" 3 files changed, 4 insertions(+), 2 deletions(-)\n"
+
+	actual := formatDiffStat(files, 80)
+	if actual != expected {
+		t.Fatalf("unexpected diffstat:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestFormatDiffStatScalesGraph(t *testing.T) {
+	files := stash.ReviewFiles{
+		{DstPath: "a/very/long/path/to/generated/file.go", Added: 200},
+		{DstPath: "b.go", Removed: 1},
+	}
+
+	expected := "" +
+		" …path/to/generated/file.go | 200 ++++++++++\n" +
+		" b.go                       |   1 -\n" +
+		" 2 files changed, 200 insertions(+), 1 deletion(-)\n"
+
+	actual := formatDiffStat(files, 44)
+	if actual != expected {
+		t.Fatalf("unexpected diffstat:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestFormatDiffStatNarrowWidth(t *testing.T) {
+	files := stash.ReviewFiles{
+		{DstPath: "a/very/long/path/to/generated/file.go", Added: 2},
+		{DstPath: "b.go", Removed: 1},
+	}
+
+	expected := "" +
+		" …d/file.go | 2 ++\n" +
+		" b.go       | 1 -\n" +
+		" 2 files changed, 2 insertions(+), 1 deletion(-)\n"
+
+	actual := formatDiffStat(files, 10)
+	if actual != expected {
+		t.Fatalf("unexpected diffstat:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
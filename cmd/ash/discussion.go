@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// discussionCounts shows how much of discussion in pull request is left to
+// be settled.
+type discussionCounts struct {
+	openTasks         int
+	unresolvedThreads int
+}
+
+func (counts discussionCounts) String() string {
+	return fmt.Sprintf(
+		"%d tasks %d threads", counts.openTasks, counts.unresolvedThreads,
+	)
+}
+
+// getDiscussionCounts returns counts of open tasks and unresolved threads
+// of pull request, or '?' if they can not be retrieved.
+func getDiscussionCounts(pr stash.PullRequest, activitiesLimit int) string {
+	tasks, err := pr.GetTasks()
+	if err == nil {
+		var events []stash.PullRequestEvent
+
+		events, err = pr.GetEvents(activitiesLimit)
+		if err == nil {
+			return countDiscussion(events, tasks).String()
+		}
+	}
+
+	logger.Warning(
+		"can not count tasks and threads of %d: %s", pr.Id, err.Error(),
+	)
+
+	return "?"
+}
+
+// countDiscussion counts open tasks and unresolved comment threads. Thread
+// is resolved if it has tasks and all of them are resolved, like folded
+// threads in review file.
+func countDiscussion(
+	events []stash.PullRequestEvent, tasks []*stash.Task,
+) discussionCounts {
+	counts := discussionCounts{}
+
+	tasksByComment := map[int64][]*stash.Task{}
+	for _, task := range tasks {
+		if task.State == stash.TaskOpen {
+			counts.openTasks++
+		}
+
+		tasksByComment[task.Anchor.Id] = append(
+			tasksByComment[task.Anchor.Id], task,
+		)
+	}
+
+	deleted := map[int64]bool{}
+	for _, event := range events {
+		if event.Action == "COMMENTED" && event.CommentAction == "DELETED" {
+			deleted[event.Comment.Id] = true
+		}
+	}
+
+	for _, event := range events {
+		if event.Action != "COMMENTED" || event.CommentAction != "ADDED" {
+			continue
+		}
+
+		if deleted[event.Comment.Id] {
+			continue
+		}
+
+		if !isResolvedComment(event.Comment, tasksByComment) {
+			counts.unresolvedThreads++
+		}
+	}
+
+	return counts
+}
+
+// isResolvedComment returns true if comment with its replies has tasks and
+// all of them are resolved.
+func isResolvedComment(
+	comment stash.EventComment, tasksByComment map[int64][]*stash.Task,
+) bool {
+	found := false
+
+	var walk func(comment stash.EventComment) bool
+	walk = func(comment stash.EventComment) bool {
+		for _, task := range tasksByComment[comment.Id] {
+			if task.State != stash.TaskResolved {
+				return false
+			}
+
+			found = true
+		}
+
+		for _, reply := range comment.Comments {
+			if !walk(reply) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return walk(comment) && found
+}
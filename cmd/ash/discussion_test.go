@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestCountDiscussion(t *testing.T) {
+	events := []stash.PullRequestEvent{}
+	err := json.Unmarshal([]byte(`[
+		{"action": "COMMENTED", "commentAction": "DELETED",
+			"comment": {"id": 4}},
+		{"action": "COMMENTED", "commentAction": "ADDED",
+			"comment": {"id": 4}},
+		{"action": "COMMENTED", "commentAction": "ADDED",
+			"comment": {"id": 3}},
+		{"action": "COMMENTED", "commentAction": "ADDED",
+			"comment": {"id": 1, "comments": [{"id": 2}]}},
+		{"action": "APPROVED"}
+	]`), &events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTask := func(comment int64, state string) *stash.Task {
+		task := &stash.Task{State: state}
+		task.Anchor.Id = comment
+		return task
+	}
+
+	// thread 1 has all tasks resolved, thread 3 has no tasks
+	counts := countDiscussion(events, []*stash.Task{
+		newTask(1, stash.TaskResolved),
+		newTask(2, stash.TaskResolved),
+	})
+
+	if counts.openTasks != 0 || counts.unresolvedThreads != 1 {
+		t.Fatalf("unexpected counts: %+v", counts)
+	}
+
+	counts = countDiscussion(events, []*stash.Task{
+		newTask(2, stash.TaskOpen),
+		newTask(3, stash.TaskResolved),
+	})
+
+	if counts.openTasks != 1 || counts.unresolvedThreads != 1 {
+		t.Fatalf("unexpected counts: %+v", counts)
+	}
+}
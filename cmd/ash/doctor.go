@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bndr/gopencils"
+	"github.com/seletskiy/ash/stash"
+)
+
+// doctor runs checks one by one and prints their results, so user can
+// find out which part of the setup is broken.
+type doctor struct {
+	args   map[string]interface{}
+	writer *tableWriter
+	failed bool
+}
+
+// doctorMode validates config, connectivity and credentials. Checks which
+// depend on the failed one are not run.
+func doctorMode(args map[string]interface{}) {
+	doc := &doctor{
+		args:   args,
+		writer: newTableWriter(os.Stdout),
+	}
+
+	doc.run()
+
+	doc.writer.Flush()
+
+	if doc.failed {
+		os.Exit(exitFailure)
+	}
+}
+
+func (doc *doctor) run() {
+	doc.checkConfig()
+
+	host, ok := doc.checkURL()
+	if !ok {
+		return
+	}
+
+	if !doc.checkDNS(host) {
+		return
+	}
+
+	client, err := getHTTPClient(doc.args)
+	if !doc.report("transport", "", err,
+		"check --proxy, --timeout, --ca-cert and --client-cert options",
+	) {
+		return
+	}
+
+	api := stash.Api{URL: host, Client: client}
+
+	if !doc.checkServer(api) {
+		return
+	}
+
+	api.Auth, ok = doc.checkCredentials(host)
+	if !ok {
+		return
+	}
+
+	if !doc.checkAuth(api) {
+		return
+	}
+
+	doc.checkProject(api)
+}
+
+// report prints result of the check and returns true if check is passed.
+func (doc *doctor) report(check, result string, err error, hint string) bool {
+	if err == nil {
+		fmt.Fprintf(doc.writer, "ok\t%s\t%s\n", check, result)
+		return true
+	}
+
+	doc.failed = true
+
+	fmt.Fprintf(doc.writer, "FAIL\t%s\t%s\n", check, err.Error())
+	if hint != "" {
+		fmt.Fprintf(doc.writer, "\t\thint: %s\n", hint)
+	}
+
+	return false
+}
+
+func (doc *doctor) checkConfig() {
+	paths := []string{configPath}
+	if cwd, err := os.Getwd(); err == nil {
+		if localPath := findLocalConfig(cwd); localPath != "" {
+			paths = append(paths, localPath)
+		}
+	}
+
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			doc.report("config", path+" is not found (optional)", nil, "")
+			continue
+		}
+
+		if err == nil {
+			invalid := validateConfig(string(data))
+			if len(invalid) > 0 {
+				err = fmt.Errorf(
+					"%s: invalid lines: %s", path, strings.Join(invalid, ", "),
+				)
+			}
+		}
+
+		doc.report("config", path, err,
+			"lines should be either cmd line args or 'key = value' pairs",
+		)
+	}
+}
+
+func (doc *doctor) checkURL() (string, bool) {
+	if doc.args["--url"] == nil {
+		doc.report("url", "", errors.New("--url is not specified"),
+			"set --url in ashrc or ASH_HOST env var",
+		)
+
+		return "", false
+	}
+
+	host, err := getBaseURL(
+		doc.args["--url"].(string), doc.args["--scheme"].(string),
+	)
+	if err == nil {
+		var hostURL *url.URL
+		hostURL, err = url.Parse(host)
+		if err == nil && hostURL.Host == "" {
+			err = fmt.Errorf("no host in '%s'", host)
+		}
+	}
+
+	return host, doc.report("url", host, err,
+		"--url should look like https://stash.local/ or stash.local:7990",
+	)
+}
+
+func (doc *doctor) checkDNS(host string) bool {
+	hostURL, _ := url.Parse(host)
+
+	hostName := hostURL.Host
+	if splitHost, _, err := net.SplitHostPort(hostName); err == nil {
+		hostName = splitHost
+	}
+
+	addrs, err := net.LookupHost(hostName)
+
+	return doc.report("dns", strings.Join(addrs, ", "), err,
+		"check host name in --url",
+	)
+}
+
+func (doc *doctor) checkServer(api stash.Api) bool {
+	properties := stash.ServerInfo{}
+
+	_, err := doc.get(api, "api/1.0/application-properties", &properties)
+	if err == nil && properties.Version == "" {
+		err = errors.New("server did not report its version")
+	}
+
+	hint := "check that --url points to Stash"
+
+	switch {
+	case err != nil && strings.Contains(err.Error(), "x509:"):
+		hint = "specify CA bundle via --ca-cert or use --insecure"
+	case err == nil:
+		err = properties.CheckVersion()
+		hint = "ask administrator to upgrade Stash to " +
+			stash.MinServerVersion + " or newer"
+	}
+
+	return doc.report("server",
+		fmt.Sprintf("%s %s", properties.DisplayName, properties.Version),
+		err, hint,
+	)
+}
+
+func (doc *doctor) checkCredentials(host string) (gopencils.BasicAuth, bool) {
+	auth := gopencils.BasicAuth{}
+
+	user, err := getUser(doc.args, host)
+	if !doc.report("user", user, err, "set --user in ashrc or ~/.netrc") {
+		return auth, false
+	}
+
+	pass, err := getPassword(doc.args, host, user)
+	if !doc.report("password", "found", err,
+		"store password via 'ash auth login' or set --pass-cmd",
+	) {
+		return auth, false
+	}
+
+	return gopencils.BasicAuth{Username: user, Password: pass}, true
+}
+
+func (doc *doctor) checkAuth(api stash.Api) bool {
+	status, err := doc.get(api, "api/1.0/users/"+api.Auth.Username, nil)
+
+	hint := ""
+	if status == http.StatusUnauthorized {
+		hint = "check user and password; too many failed attempts " +
+			"can lead to CAPTCHA, login via web-interface to reset it"
+	}
+
+	return doc.report("auth", "authenticated as "+api.Auth.Username,
+		err, hint,
+	)
+}
+
+func (doc *doctor) checkProject(api stash.Api) {
+	if doc.args["--project"] == nil {
+		doc.report("project", "--project is not specified (optional)", nil, "")
+		return
+	}
+
+	project := strings.Split(doc.args["--project"].(string), "/")[0]
+
+	path := "api/1.0/projects/" + project + "/repos?limit=1"
+	if strings.HasPrefix(project, "~") {
+		path = "api/1.0/users/" + project[1:] + "/repos?limit=1"
+	}
+
+	status, err := doc.get(api, path, nil)
+
+	hint := ""
+	switch status {
+	case http.StatusNotFound:
+		hint = "check project key in --project"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		hint = "ask project administrator for read permission"
+	}
+
+	doc.report("project", "can read repos of "+project, err, hint)
+}
+
+// get requests Stash REST API directly, bypassing session cookies, and
+// returns status code of the response.
+func (doc *doctor) get(
+	api stash.Api, path string, result interface{},
+) (int, error) {
+	request, err := http.NewRequest("GET", api.URL+"/rest/"+path, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if api.Auth.Username != "" {
+		request.SetBasicAuth(api.Auth.Username, api.Auth.Password)
+	}
+
+	response, err := api.GetClient().Do(request)
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return response.StatusCode, stash.UnexpectedStatusCode(response.StatusCode)
+	}
+
+	if result == nil {
+		return response.StatusCode, nil
+	}
+
+	return response.StatusCode, json.NewDecoder(response.Body).Decode(result)
+}
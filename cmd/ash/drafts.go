@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var draftsPath = os.Getenv("HOME") + "/.local/share/ash/drafts"
+
+const draftInterval = 5 * time.Second
+
+// maxDraftNameLen is max length of draft name, which is kept below
+// NAME_MAX of file systems along with extension of draft.
+const maxDraftNameLen = 200
+
+// draft periodically copies review file, which is edited in editor, into
+// drafts dir, so comments are not lost if editor or terminal is killed.
+type draft struct {
+	source string
+	path   string
+
+	// saved is content of the last snapshot; draft is not written until
+	// review file is changed, so previous draft is not overwritten by
+	// untouched review.
+	saved []byte
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// getDraftPath returns path of draft for the review of given files of pull
+// request, overview or all files. Drafts of many files are named by hash of
+// their paths, which do not fit into file name.
+func getDraftPath(target reviewTarget, paths []string, reviewAll bool) string {
+	name := "overview"
+	switch {
+	case reviewAll:
+		name = "all"
+	case len(paths) > 0:
+		name = url.PathEscape(strings.Join(paths, ","))
+		if len(name) > maxDraftNameLen {
+			hash := sha1.Sum([]byte(strings.Join(paths, "\n")))
+			name = "files-" + hex.EncodeToString(hash[:])
+		}
+	}
+
+	return filepath.Join(
+		draftsPath, target.project, target.repo,
+		strconv.FormatInt(target.id, 10), name+".diff",
+	)
+}
+
+func startDraft(source string, path string) *draft {
+	saved, err := ioutil.ReadFile(source)
+	if err != nil {
+		logger.Warning("can not autosave drafts: %s", err.Error())
+		return nil
+	}
+
+	reviewDraft := &draft{
+		source: source,
+		path:   path,
+		saved:  saved,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go reviewDraft.run()
+
+	return reviewDraft
+}
+
+func (reviewDraft *draft) run() {
+	defer close(reviewDraft.done)
+
+	ticker := time.NewTicker(draftInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reviewDraft.save()
+		case <-reviewDraft.stop:
+			reviewDraft.save()
+			return
+		}
+	}
+}
+
+func (reviewDraft *draft) save() {
+	data, err := ioutil.ReadFile(reviewDraft.source)
+	if err != nil {
+		logger.Warning("can not read review to save draft: %s", err.Error())
+		return
+	}
+
+	if bytes.Equal(data, reviewDraft.saved) {
+		return
+	}
+
+	err = writeDraft(reviewDraft.path, data)
+	if err != nil {
+		logger.Warning("can not save draft: %s", err.Error())
+		return
+	}
+
+	reviewDraft.saved = data
+
+	logger.Debug("draft saved to %s", reviewDraft.path)
+}
+
+// Stop makes final snapshot of review file and stops autosaving.
+func (reviewDraft *draft) Stop() {
+	if reviewDraft == nil {
+		return
+	}
+
+	close(reviewDraft.stop)
+	<-reviewDraft.done
+}
+
+// Remove removes draft after review is successfully applied.
+func (reviewDraft *draft) Remove() {
+	if reviewDraft == nil {
+		return
+	}
+
+	removeDraft(reviewDraft.path)
+}
+
+func removeDraft(path string) {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("can not remove draft: %s", err.Error())
+	}
+}
+
+func writeDraft(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), ".draft.")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Chmod(0600)
+	}
+
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// isDraftPath returns whether given path, which can be relative or start
+// with ~/, points to the draft.
+func isDraftPath(path string, draftPath string) bool {
+	if strings.HasPrefix(path, "~/") {
+		path = os.Getenv("HOME") + path[1:]
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	draftPath, err = filepath.Abs(draftPath)
+	if err != nil {
+		return false
+	}
+
+	return path == draftPath
+}
+
+// warnAboutDraft tells user that there is unfinished review left from
+// previous run.
+func warnAboutDraft(path string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	logger.Warning(
+		"draft of unfinished review is found in %s; "+
+			"apply it with --input=%s", path, path,
+	)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsDraftPath(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	draftPath := filepath.Join(cwd, "drafts", "all.diff")
+
+	for _, path := range []string{
+		draftPath, "drafts/all.diff", "./drafts/../drafts/all.diff",
+	} {
+		if !isDraftPath(path, draftPath) {
+			t.Errorf("%s is expected to be path of draft", path)
+		}
+	}
+
+	if isDraftPath("all.diff", draftPath) {
+		t.Errorf("all.diff is not expected to be path of draft")
+	}
+
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", cwd)
+
+	if !isDraftPath("~/drafts/all.diff", draftPath) {
+		t.Errorf("path starting with ~/ is not expanded")
+	}
+}
+
+func TestGetDraftPathOfManyFiles(t *testing.T) {
+	target := reviewTarget{project: "proj", repo: "repo", id: 1}
+
+	paths := []string{}
+	for len(strings.Join(paths, ",")) <= maxDraftNameLen {
+		paths = append(paths, "src/very/long/path/to/the/changed/file.go")
+	}
+
+	name := filepath.Base(getDraftPath(target, paths, false))
+	if len(name) > maxDraftNameLen || !strings.HasPrefix(name, "files-") {
+		t.Fatalf("unexpected name of draft: %s", name)
+	}
+
+	changed := filepath.Base(getDraftPath(target, paths[1:], false))
+	if changed == name {
+		t.Fatalf("drafts of different files have the same name: %s", name)
+	}
+
+	name = filepath.Base(getDraftPath(target, []string{"a.go", "b.go"}, false))
+	if name != "a.go%2Cb.go.diff" {
+		t.Fatalf("unexpected name of draft: %s", name)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// editorArgsTemplates are arguments for opening file at specified line in
+// known editors.
+var editorArgsTemplates = map[string]string{
+	"vi":          "+{line} {file}",
+	"vim":         "+{line} {file}",
+	"gvim":        "+{line} {file}",
+	"nvim":        "+{line} {file}",
+	"emacs":       "+{line} {file}",
+	"emacsclient": "+{line} {file}",
+	"nano":        "+{line} {file}",
+	"micro":       "+{line} {file}",
+	"kak":         "+{line} {file}",
+	"hx":          "{file}:{line}",
+	"subl":        "{file}:{line}",
+	"code":        "--wait --goto {file}:{line}",
+}
+
+// getEditorArgs returns arguments to open file in editor at given line.
+// Template is looked up by editor name if not specified. If there is no
+// template or line is unknown, only file is passed.
+func getEditorArgs(
+	editor string, template string, file string, line int,
+) []string {
+	if template == "" {
+		template = editorArgsTemplates[filepath.Base(editor)]
+	}
+
+	if template == "" || line == 0 {
+		return []string{file}
+	}
+
+	args := []string{}
+	hasFile := false
+
+	for _, arg := range strings.Fields(template) {
+		if strings.Contains(arg, "{file}") {
+			hasFile = true
+		}
+
+		arg = strings.Replace(arg, "{file}", file, -1)
+		arg = strings.Replace(arg, "{line}", strconv.Itoa(line), -1)
+
+		args = append(args, arg)
+	}
+
+	if !hasFile {
+		args = append(args, file)
+	}
+
+	return args
+}
+
+// getFirstHunkLine returns number of the line of first hunk header in the
+// review file or 0 if review has no hunks.
+func getFirstHunkLine(path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.HasPrefix(scanner.Text(), "@@ ") {
+			return line
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+var reEmojiShortcode = regexp.MustCompile(`:([a-z0-9_+-]+):`)
+
+// emojiShortcodes are most used shortcodes, named like in GitHub and Slack.
+var emojiShortcodes = map[string]string{
+	"+1":                    "👍",
+	"thumbsup":              "👍",
+	"-1":                    "👎",
+	"thumbsdown":            "👎",
+	"ok_hand":               "👌",
+	"clap":                  "👏",
+	"pray":                  "🙏",
+	"muscle":                "💪",
+	"wave":                  "👋",
+	"raised_hands":          "🙌",
+	"point_up":              "☝️",
+	"point_down":            "👇",
+	"eyes":                  "👀",
+	"smile":                 "😄",
+	"smiley":                "😃",
+	"grinning":              "😀",
+	"laughing":              "😆",
+	"joy":                   "😂",
+	"sweat_smile":           "😅",
+	"wink":                  "😉",
+	"blush":                 "😊",
+	"slightly_smiling_face": "🙂",
+	"upside_down_face":      "🙃",
+	"heart_eyes":            "😍",
+	"sunglasses":            "😎",
+	"thinking":              "🤔",
+	"neutral_face":          "😐",
+	"expressionless":        "😑",
+	"unamused":              "😒",
+	"roll_eyes":             "🙄",
+	"confused":              "😕",
+	"worried":               "😟",
+	"cry":                   "😢",
+	"sob":                   "😭",
+	"scream":                "😱",
+	"angry":                 "😠",
+	"rage":                  "😡",
+	"facepalm":              "🤦",
+	"shrug":                 "🤷",
+	"see_no_evil":           "🙈",
+	"heart":                 "❤️",
+	"broken_heart":          "💔",
+	"fire":                  "🔥",
+	"sparkles":              "✨",
+	"star":                  "⭐",
+	"zap":                   "⚡",
+	"boom":                  "💥",
+	"tada":                  "🎉",
+	"rocket":                "🚀",
+	"100":                   "💯",
+	"bulb":                  "💡",
+	"bug":                   "🐛",
+	"wrench":                "🔧",
+	"hammer":                "🔨",
+	"lock":                  "🔒",
+	"key":                   "🔑",
+	"memo":                  "📝",
+	"books":                 "📚",
+	"package":               "📦",
+	"mag":                   "🔍",
+	"link":                  "🔗",
+	"pushpin":               "📌",
+	"construction":          "🚧",
+	"warning":               "⚠️",
+	"no_entry":              "⛔",
+	"x":                     "❌",
+	"heavy_check_mark":      "✔️",
+	"white_check_mark":      "✅",
+	"question":              "❓",
+	"exclamation":           "❗",
+	"recycle":               "♻️",
+	"hourglass":             "⌛",
+	"coffee":                "☕",
+	"beers":                 "🍻",
+	"cake":                  "🍰",
+	"poop":                  "💩",
+	"hankey":                "💩",
+	"skull":                 "💀",
+	"ghost":                 "👻",
+	"robot":                 "🤖",
+	"trophy":                "🏆",
+	"checkered_flag":        "🏁",
+}
+
+// expandEmoji replaces known emoji shortcodes with unicode emoji. Code is
+// left as is, because shortcode-like strings are common there.
+func expandEmoji(text string) string {
+	lines := strings.Split(text, "\n")
+
+	inCode := false
+	for i, line := range lines {
+		if reMarkdownFence.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+
+		if inCode {
+			continue
+		}
+
+		lines[i] = expandLineEmoji(line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func expandLineEmoji(line string) string {
+	// code spans are split out, so only odd parts are code
+	parts := strings.Split(line, "`")
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = reEmojiShortcode.ReplaceAllStringFunc(parts[i],
+			func(shortcode string) string {
+				emoji, ok := emojiShortcodes[strings.Trim(shortcode, ":")]
+				if !ok {
+					return shortcode
+				}
+
+				return emoji
+			})
+	}
+
+	return strings.Join(parts, "`")
+}
+
+// expandChangesEmoji expands emoji shortcodes in texts of new and modified
+// comments and of new tasks.
+func expandChangesEmoji(changes []stash.ReviewChange) {
+	for i, change := range changes {
+		if task, ok := change.(stash.TaskAdded); ok {
+			task.Text = expandEmoji(task.Text)
+			changes[i] = task
+			continue
+		}
+
+		comment := stash.GetChangeComment(change)
+		if comment != nil {
+			comment.Text = expandEmoji(comment.Text)
+		}
+	}
+}
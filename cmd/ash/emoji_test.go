@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExpandEmoji(t *testing.T) {
+	text := expandEmoji(
+		"LGTM :+1: :unknown:\n`:+1:` is code\n```\nfoo := map[string]int{\"a\":1}\n:x:\n```",
+	)
+
+	expected := "LGTM 👍 :unknown:\n`:+1:` is code\n```\nfoo := map[string]int{\"a\":1}\n:x:\n```"
+	if text != expected {
+		t.Fatalf("unexpected text:\n%s", text)
+	}
+}
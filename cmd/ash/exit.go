@@ -0,0 +1,56 @@
+package main
+
+import "github.com/seletskiy/ash/stash"
+
+// Exit codes of ash, so scripts can branch on outcome of command without
+// parsing its output.
+const (
+	// exitOK is returned when command is successfully completed.
+	exitOK = 0
+
+	// exitUsage is returned when command line or config is invalid.
+	exitUsage = 1
+
+	// exitNoChanges is returned when there is nothing to do: review or
+	// text is not changed, or user has canceled the action.
+	exitNoChanges = 2
+
+	// exitPartialApply is returned when some of review changes or queued
+	// reviews are not applied.
+	exitPartialApply = 3
+
+	// exitAuth is returned when Stash rejects credentials or has not
+	// granted permission for the action.
+	exitAuth = 4
+
+	// exitNotFound is returned when pull request, file or other requested
+	// thing is not found.
+	exitNotFound = 5
+
+	// exitFailure is returned on other errors, e.g. when Stash is not
+	// available or returns unexpected error.
+	exitFailure = 6
+)
+
+// getErrorExitCode returns exit code for the error, which request to Stash
+// has failed with; status code of Stash response is used to distinguish auth
+// failures. Other errors, e.g. of local files, should exit with exitFailure.
+func getErrorExitCode(err error) int {
+	status := 0
+
+	switch err := err.(type) {
+	case stash.UnexpectedStatusCode:
+		status = int(err)
+	case stash.StatusError:
+		status = err.Status
+	}
+
+	switch status {
+	case 401, 403:
+		return exitAuth
+	case 404:
+		return exitNotFound
+	default:
+		return exitFailure
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestGetErrorExitCode(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{stash.UnexpectedStatusCode(401), exitAuth},
+		{stash.UnexpectedStatusCode(403), exitAuth},
+		{stash.StatusError{Status: 401, Body: []byte("unauthorized")}, exitAuth},
+		{stash.StatusError{Status: 404, Body: []byte("no such repo")}, exitNotFound},
+		{stash.UnexpectedStatusCode(500), exitFailure},
+		{errors.New("connection refused"), exitFailure},
+	}
+
+	for _, test := range tests {
+		actual := getErrorExitCode(test.err)
+		if actual != test.expected {
+			t.Errorf(
+				"unexpected exit code for %q: %d, expected %d",
+				test.err, actual, test.expected,
+			)
+		}
+	}
+}
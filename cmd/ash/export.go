@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+var htmlExportTpl = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>#{{.Info.Id}} {{.Info.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+.meta td { padding: 0 1em 0 0; }
+.description, .comment .text { white-space: pre-wrap; }
+.file { margin: 2em 0; border: 1px solid #ccc; }
+.file h2 { margin: 0; padding: .5em; font-size: 1em; background: #f4f4f4; }
+.diff { border-collapse: collapse; width: 100%; font-family: monospace; }
+.diff td { padding: 0 .5em; vertical-align: top; white-space: pre-wrap; }
+.diff .number { color: #999; text-align: right; width: 1%; }
+.diff .hunk td { color: #777; background: #f0f4ff; }
+.diff .added td { background: #e6ffed; }
+.diff .removed td { background: #ffeef0; }
+.thread { margin: .5em 2em; font-family: sans-serif; }
+.comment { border-left: 3px solid #ccd; padding: .3em .8em; margin: .3em 0; }
+.comment .author { font-weight: bold; }
+.comment .date { color: #777; font-size: .9em; }
+.reply { margin-left: 1.5em; }
+</style>
+</head>
+<body>
+<h1>#{{.Info.Id}} {{.Info.Title}}</h1>
+<table class="meta">
+<tr><td>Author</td><td>{{.Info.Author.User.DisplayName}} ({{.Info.Author.User.Name}})</td></tr>
+<tr><td>Branches</td><td>{{.Info.FromRef.DisplayId}} → {{.Info.ToRef.DisplayId}}</td></tr>
+<tr><td>State</td><td>{{.Info.State}}</td></tr>
+<tr><td>Created</td><td>{{.Info.CreatedDate}}</td></tr>
+<tr><td>Updated</td><td>{{.Info.UpdatedDate}}</td></tr>
+</table>
+{{if .Info.Description}}<div class="description">{{.Info.Description}}</div>{{end}}
+{{range .Files}}
+<div class="file">
+<h2>{{.Header}}</h2>
+{{if .Note}}<pre>{{.Note}}</pre>{{end}}
+{{if .Binary}}<p>binary file</p>{{end}}
+{{if .Comments}}<div class="thread">{{template "comments" .Comments}}</div>{{end}}
+{{if .Lines}}
+<table class="diff">
+{{range .Lines}}
+{{if .Hunk}}<tr class="hunk"><td colspan="3">{{.Hunk}}</td></tr>
+{{else}}<tr class="{{.Kind}}"><td class="number">{{.Source}}</td><td class="number">{{.Destination}}</td><td>{{.Text}}</td></tr>{{end}}
+{{if .Comments}}<tr><td colspan="3"><div class="thread">{{template "comments" .Comments}}</div></td></tr>{{end}}
+{{end}}
+</table>
+{{end}}
+</div>
+{{end}}
+</body>
+</html>
+{{define "comments"}}{{range .}}<div class="comment">
+<span class="author">{{.Author}}</span> <span class="date">{{.Date}}</span>
+<div class="text">{{.Text}}</div>
+{{if .Replies}}<div class="reply">{{template "comments" .Replies}}</div>{{end}}
+</div>
+{{end}}{{end}}
+`))
+
+// htmlRenderer renders review as standalone HTML page with diff and inline
+// comment threads, which can be archived or shared with people who have no
+// access to Stash.
+type htmlRenderer struct {
+	info stash.PullRequestInfo
+}
+
+type htmlFile struct {
+	Header   string
+	Note     string
+	Binary   bool
+	Comments []htmlComment
+	Lines    []htmlLine
+}
+
+type htmlLine struct {
+	// header of hunk, other fields are empty if it is set
+	Hunk string
+
+	Kind        string
+	Source      string
+	Destination string
+	Text        string
+	Comments    []htmlComment
+}
+
+type htmlComment struct {
+	Author  string
+	Date    string
+	Text    string
+	Replies []htmlComment
+}
+
+func (renderer htmlRenderer) Render(review *stash.Review, writer io.Writer) error {
+	files := []htmlFile{}
+
+	for _, diff := range review.Changeset.Diffs {
+		file := htmlFile{
+			Header:   getDiffHeader(diff),
+			Binary:   diff.Binary,
+			Comments: getHTMLComments(diff.FileComments),
+		}
+
+		// multi-file review has file names in notes, they are headers here
+		if !stash.IsFileMarker(diff.Note) {
+			file.Note = diff.Note
+		}
+
+		for _, hunk := range diff.Hunks {
+			file.Lines = append(file.Lines, htmlLine{
+				Hunk: fmt.Sprintf("@@ -%d,%d +%d,%d @@",
+					hunk.SourceLine, hunk.SourceSpan,
+					hunk.DestinationLine, hunk.DestinationSpan,
+				),
+			})
+
+			for _, segment := range hunk.Segments {
+				for _, line := range segment.Lines {
+					file.Lines = append(file.Lines,
+						getHTMLLine(segment.Type, line),
+					)
+				}
+			}
+		}
+
+		files = append(files, file)
+	}
+
+	return htmlExportTpl.Execute(writer, struct {
+		Info  stash.PullRequestInfo
+		Files []htmlFile
+	}{renderer.info, files})
+}
+
+func getHTMLLine(kind string, line *godiff.Line) htmlLine {
+	result := htmlLine{
+		Text:     line.Line,
+		Comments: getHTMLComments(line.Comments),
+	}
+
+	switch kind {
+	case godiff.SegmentTypeAdded:
+		result.Kind = "added"
+		result.Destination = fmt.Sprint(line.Destination)
+	case godiff.SegmentTypeRemoved:
+		result.Kind = "removed"
+		result.Source = fmt.Sprint(line.Source)
+	default:
+		result.Kind = "context"
+		result.Source = fmt.Sprint(line.Source)
+		result.Destination = fmt.Sprint(line.Destination)
+	}
+
+	return result
+}
+
+func getHTMLComments(comments godiff.CommentsTree) []htmlComment {
+	result := []htmlComment{}
+	for _, comment := range comments {
+		result = append(result, htmlComment{
+			Author:  comment.Author.DisplayName,
+			Date:    stash.UnixTimestamp(comment.CreatedDate).String(),
+			Text:    comment.Text,
+			Replies: getHTMLComments(comment.Comments),
+		})
+	}
+
+	return result
+}
+
+// exportReview writes review of pull request with comments as html, or
+// its activity as markdown report, to the output file, or to stdout if
+// output is not specified.
+func exportReview(
+	pr stash.PullRequest, paths []string, diff stash.DiffOptions, format string,
+	output string,
+) {
+	// --format defaults to table for listings, which means html here
+	switch format {
+	case "html", formatTable:
+		format = "html"
+	case "md":
+	default:
+		fmt.Println("--format of export should be html or md.")
+		os.Exit(exitUsage)
+	}
+
+	info, err := pr.GetInfo()
+	if err != nil {
+		logger.Critical("error obtaining pull request info: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	var render func(io.Writer) error
+	if format == "md" {
+		render = getMarkdownReport(pr, *info)
+	} else {
+		render = getHTMLReview(pr, *info, paths, diff)
+	}
+
+	writer := os.Stdout
+	if output != "" && output != "-" {
+		writer, err = os.Create(output)
+		if err != nil {
+			logger.Critical("can not create %s: %s", output, err.Error())
+			os.Exit(exitFailure)
+		}
+
+		defer writer.Close()
+	}
+
+	err = render(writer)
+	if err != nil {
+		logger.Critical("can not export review: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	if writer != os.Stdout {
+		printInfo("Review exported to %s", output)
+	}
+}
+
+// getHTMLReview gets review of pull request and returns function, which
+// renders it as html.
+func getHTMLReview(
+	pr stash.PullRequest, info stash.PullRequestInfo, paths []string, diff stash.DiffOptions,
+) func(io.Writer) error {
+	var review *stash.Review
+	var err error
+	if len(paths) == 0 {
+		review, err = pr.GetFullReview(diff)
+	} else {
+		review, err = pr.GetFilesReview(paths, diff)
+	}
+
+	if err != nil {
+		logger.Critical("can not get diff: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	if review == nil {
+		fmt.Fprintln(os.Stderr, "Pull request not found.")
+		os.Exit(exitNotFound)
+	}
+
+	return func(writer io.Writer) error {
+		return htmlRenderer{info}.Render(review, writer)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+func TestHTMLRendererRendersDiffWithThreads(t *testing.T) {
+	reply := &godiff.Comment{Text: "fixed"}
+	reply.Author.DisplayName = "Alice"
+
+	comment := &godiff.Comment{
+		Text: "use <b> here", Comments: godiff.CommentsTree{reply},
+	}
+	comment.Author.DisplayName = "Bob"
+
+	diff := &godiff.Diff{}
+	diff.Destination.ToString = "main.go"
+	diff.Hunks = []*godiff.Hunk{{
+		SourceLine: 1, SourceSpan: 1, DestinationLine: 1, DestinationSpan: 1,
+		Segments: []*godiff.Segment{
+			{
+				Type:  godiff.SegmentTypeRemoved,
+				Lines: []*godiff.Line{{Source: 1, Line: "a < b"}},
+			},
+			{
+				Type: godiff.SegmentTypeAdded,
+				Lines: []*godiff.Line{{
+					Destination: 1, Line: "a > b",
+					Comments: godiff.CommentsTree{comment},
+				}},
+			},
+		},
+	}}
+
+	info := stash.PullRequestInfo{Id: 12, Title: "Fix comparison"}
+
+	output := &bytes.Buffer{}
+	err := htmlRenderer{info}.Render(
+		&stash.Review{Changeset: godiff.Changeset{Diffs: []*godiff.Diff{diff}}},
+		output,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"<title>#12 Fix comparison</title>",
+		"<h2>main.go</h2>",
+		"@@ -1,1 &#43;1,1 @@",
+		`<tr class="removed"><td class="number">1</td><td class="number"></td><td>a &lt; b</td></tr>`,
+		`<tr class="added"><td class="number"></td><td class="number">1</td><td>a &gt; b</td></tr>`,
+		`<span class="author">Bob</span>`,
+		`<div class="text">use &lt;b&gt; here</div>`,
+		`<div class="reply"><div class="comment">`,
+		`<span class="author">Alice</span>`,
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("%q is not found in:\n%s", expected, output)
+		}
+	}
+}
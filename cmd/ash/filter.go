@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// pullRequestFilter narrows listed pull requests down. Target branch is
+// passed to Stash, while author and reviewer are matched client-side,
+// because Stash does not filter pull requests of repo by them.
+type pullRequestFilter struct {
+	author   string
+	reviewer string
+	target   string
+}
+
+// getPullRequestFilter returns filter given by args, author or reviewer
+// 'me' is the authenticated user.
+func getPullRequestFilter(
+	args map[string]interface{}, user string,
+) pullRequestFilter {
+	filter := pullRequestFilter{}
+
+	if args["--author"] != nil {
+		filter.author = resolveUserName(args["--author"].(string), user)
+	}
+
+	if args["--reviewer"] != nil {
+		filter.reviewer = resolveUserName(args["--reviewer"].(string), user)
+	}
+
+	if args["--target"] != nil {
+		filter.target = args["--target"].(string)
+	}
+
+	return filter
+}
+
+// resolveUserName returns name of the authenticated user instead of 'me'.
+func resolveUserName(name string, user string) string {
+	if name != "me" {
+		return name
+	}
+
+	if user == "" {
+		fmt.Println("--user should be given to filter PRs by 'me'.")
+		os.Exit(exitUsage)
+	}
+
+	return user
+}
+
+// isClientSide returns true if pull requests are matched after they are
+// listed, so all pages should be retrieved to not miss any.
+func (filter pullRequestFilter) isClientSide() bool {
+	return filter.author != "" || filter.reviewer != ""
+}
+
+func (filter pullRequestFilter) match(pr stash.PullRequest) bool {
+	if filter.author != "" &&
+		!strings.EqualFold(pr.Author.User.Name, filter.author) {
+		return false
+	}
+
+	if filter.reviewer == "" {
+		return true
+	}
+
+	for _, reviewer := range pr.Reviewers {
+		if strings.EqualFold(reviewer.User.Name, filter.reviewer) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func filterPullRequests(
+	pullRequests []stash.PullRequest, filter pullRequestFilter,
+) []stash.PullRequest {
+	result := []stash.PullRequest{}
+	for _, pr := range pullRequests {
+		if filter.match(pr) {
+			result = append(result, pr)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestPullRequestFilterMatch(t *testing.T) {
+	pr := stash.PullRequest{}
+	pr.Author.User.Name = "alice"
+	pr.Reviewers = make([]struct {
+		Approved           bool
+		Status             string
+		LastReviewedCommit string
+		User               struct {
+			Name string
+		}
+	}, 1)
+	pr.Reviewers[0].User.Name = "bob"
+
+	tests := []struct {
+		filter   pullRequestFilter
+		expected bool
+	}{
+		{pullRequestFilter{}, true},
+		{pullRequestFilter{author: "Alice"}, true},
+		{pullRequestFilter{author: "bob"}, false},
+		{pullRequestFilter{reviewer: "bob"}, true},
+		{pullRequestFilter{reviewer: "alice"}, false},
+		{pullRequestFilter{author: "alice", reviewer: "bob"}, true},
+		{pullRequestFilter{target: "master"}, true},
+	}
+
+	for _, test := range tests {
+		actual := test.filter.match(pr)
+		if actual != test.expected {
+			t.Errorf(
+				"unexpected match by %+v: %v, expected %v",
+				test.filter, actual, test.expected,
+			)
+		}
+	}
+}
+
+func TestResolveUserName(t *testing.T) {
+	if name := resolveUserName("me", "alice"); name != "alice" {
+		t.Fatalf("'me' is not resolved to the authenticated user: %s", name)
+	}
+
+	if name := resolveUserName("bob", "alice"); name != "bob" {
+		t.Fatalf("user name is changed: %s", name)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	formatTable = "table"
+	formatTSV   = "tsv"
+	formatCSV   = "csv"
+)
+
+// listFormat describes how items are printed by listing commands. Table is
+// aligned for humans, tsv and csv are for spreadsheets and scripts, and Go
+// template lets to build custom one-liners.
+type listFormat struct {
+	format string
+
+	// columns to print in tsv and csv formats; default columns of the
+	// listing are printed if not specified
+	columns []string
+
+	// template which is executed for every item, like in 'docker ps'
+	template *template.Template
+}
+
+var listTemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"pad": func(width int, value interface{}) string {
+		return fmt.Sprintf("%-*v", width, value)
+	},
+}
+
+// listColumns are functions, which return value of every column for the
+// item with given index.
+type listColumns map[string]func(index int) string
+
+func (format listFormat) isTable() bool {
+	return format.format == formatTable
+}
+
+// printRecords prints count of items in tsv or csv format with header or
+// using template.
+func (format listFormat) printRecords(
+	writer io.Writer, count int, item func(index int) interface{},
+	columns listColumns, defaults []string,
+) error {
+	if format.template != nil {
+		for index := 0; index < count; index++ {
+			err := format.template.Execute(writer, item(index))
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintln(writer)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	selected := format.columns
+	if len(selected) == 0 {
+		selected = defaults
+	}
+
+	for _, column := range selected {
+		if _, ok := columns[column]; !ok {
+			return fmt.Errorf(
+				"unknown column %q, available columns: %s",
+				column, strings.Join(columns.names(), ", "),
+			)
+		}
+	}
+
+	records := [][]string{selected}
+	for index := 0; index < count; index++ {
+		record := []string{}
+		for _, column := range selected {
+			record = append(record, columns[column](index))
+		}
+
+		records = append(records, record)
+	}
+
+	if format.format == formatCSV {
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.WriteAll(records)
+
+		return csvWriter.Error()
+	}
+
+	for _, record := range records {
+		for i, value := range record {
+			record[i] = sanitizeTSVValue(value)
+		}
+
+		_, err := fmt.Fprintln(writer, strings.Join(record, "\t"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// usesColumn returns whether column is printed in tsv or csv format, or
+// whether template refers to the field of item, which the column is for.
+func (format listFormat) usesColumn(column string, field string) bool {
+	if format.template != nil {
+		return strings.Contains(format.format, "."+field)
+	}
+
+	for _, selected := range format.columns {
+		if selected == column {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (columns listColumns) names() []string {
+	names := []string{}
+	for name := range columns {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// sanitizeTSVValue replaces tabs and line breaks, which can not be escaped
+// in tsv, by spaces.
+func sanitizeTSVValue(value string) string {
+	return strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ").
+		Replace(value)
+}
+
+func getListFormat(args map[string]interface{}) listFormat {
+	format := listFormat{format: args["--format"].(string)}
+
+	switch {
+	case strings.Contains(format.format, "{{"):
+		tpl, err := template.New("format").Funcs(listTemplateFuncs).Parse(
+			format.format,
+		)
+		if err != nil {
+			fmt.Printf("--format is not valid template: %s\n", err.Error())
+			os.Exit(exitUsage)
+		}
+
+		format.template = tpl
+	case format.format == formatTable, format.format == formatTSV,
+		format.format == formatCSV:
+	default:
+		fmt.Println("--format should be one of: table, tsv, csv or template.")
+		os.Exit(exitUsage)
+	}
+
+	if args["--columns"] != nil {
+		for _, column := range strings.Split(args["--columns"].(string), ",") {
+			column = strings.TrimSpace(column)
+			if column != "" {
+				format.columns = append(format.columns, column)
+			}
+		}
+	}
+
+	return format
+}
+
+// printListRecords prints records of listing or exits if they can not be
+// printed.
+func printListRecords(
+	format listFormat, count int, item func(index int) interface{},
+	columns listColumns, defaults []string,
+) {
+	err := format.printRecords(os.Stdout, count, item, columns, defaults)
+	if err != nil {
+		logger.Critical("can not print list: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+}
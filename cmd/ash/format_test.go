@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestListFormatPrintRecords(t *testing.T) {
+	titles := []string{"Fix\tbuild", "Add \"quotes\", commas"}
+
+	columns := listColumns{
+		"id":    func(i int) string { return []string{"1", "2"}[i] },
+		"title": func(i int) string { return titles[i] },
+	}
+
+	buffer := &bytes.Buffer{}
+	err := listFormat{format: formatTSV}.printRecords(
+		buffer, len(titles), nil, columns, []string{"id", "title"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "id\ttitle\n1\tFix build\n2\tAdd \"quotes\", commas\n"
+	if buffer.String() != expected {
+		t.Fatalf("unexpected tsv:\n%s", buffer)
+	}
+
+	buffer.Reset()
+	err = listFormat{format: formatCSV, columns: []string{"title"}}.printRecords(
+		buffer, len(titles), nil, columns, []string{"id", "title"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "title\nFix\tbuild\n\"Add \"\"quotes\"\", commas\"\n"
+	if buffer.String() != expected {
+		t.Fatalf("unexpected csv:\n%s", buffer)
+	}
+
+	err = listFormat{format: formatCSV, columns: []string{"size"}}.printRecords(
+		buffer, len(titles), nil, columns, nil,
+	)
+	if err == nil {
+		t.Fatalf("unknown column is not reported")
+	}
+}
+
+func TestListFormatTemplate(t *testing.T) {
+	items := []stash.Commit{{DisplayId: "abc"}, {DisplayId: "def"}}
+	items[0].Author.Name = "john"
+	items[1].Author.Name = "jane"
+
+	args := map[string]interface{}{
+		"--format":  "{{.DisplayId}} {{upper .Author.Name}}",
+		"--columns": nil,
+	}
+
+	buffer := &bytes.Buffer{}
+	err := getListFormat(args).printRecords(
+		buffer, len(items), func(i int) interface{} { return items[i] },
+		nil, nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buffer.String() != "abc JOHN\ndef JANE\n" {
+		t.Fatalf("unexpected output:\n%s", buffer)
+	}
+}
+
+func TestListFormatUsesColumn(t *testing.T) {
+	tests := []struct {
+		args     map[string]interface{}
+		expected bool
+	}{
+		{map[string]interface{}{"--format": "csv", "--columns": nil}, false},
+		{map[string]interface{}{"--format": "csv", "--columns": "path,added"}, true},
+		{map[string]interface{}{"--format": "{{.DstPath}}", "--columns": nil}, false},
+		{map[string]interface{}{"--format": "{{.Added}}", "--columns": nil}, true},
+	}
+
+	for _, test := range tests {
+		actual := getListFormat(test.args).usesColumn("added", "Added")
+		if actual != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/seletskiy/ash/gerrit"
+)
+
+// reGerritURL matches URL of change in web interface of Gerrit, either with
+// project, e.g. https://review.example.com/c/infra/tools/+/42, or without
+// it, e.g. https://review.example.com/#/c/42/.
+var reGerritURL = regexp.MustCompile(
+	`^(https?://.+?)/(?:#/)?c/(?:(.+)/\+/)?(\d+)(?:/\d+)?/?$`,
+)
+
+// gerritUnsupported are commands and flags of pull request, which are
+// available only for Stash.
+var gerritUnsupported = []string{
+	"ls", "show", "diffstat", "export", "commits", "edit", "reviewers",
+	"sync", "apply-suggestions", "delete", "watch", "unwatch", "web",
+	"--web", "--commit", "--since-last",
+}
+
+// gerritMode runs command of Gerrit change given by URL.
+func gerritMode(args map[string]interface{}, matches []string) {
+	host := matches[1] + "/"
+
+	httpClient, err := getHTTPClient(args)
+	if err != nil {
+		fmt.Printf("%s.\n", err.Error())
+		os.Exit(exitAuth)
+	}
+
+	client := &gerrit.Client{
+		URL:  matches[1],
+		HTTP: httpClient,
+	}
+
+	client.User, err = getUser(args, host)
+	if err == nil {
+		client.Password, err = getPassword(args, host, client.User)
+	}
+
+	if err != nil {
+		fmt.Printf("%s.\n", err.Error())
+		os.Exit(exitAuth)
+	}
+
+	number, err := strconv.ParseInt(matches[3], 10, 64)
+	if err != nil {
+		fmt.Printf("Invalid change number: %s.\n", matches[3])
+		os.Exit(exitUsage)
+	}
+
+	change := client.Change(matches[2], number)
+
+	change.Labels, err = parseLabels(args["--label"].([]string))
+	if err != nil {
+		fmt.Printf("%s.\n", err.Error())
+		os.Exit(exitUsage)
+	}
+
+	target := reviewTarget{
+		service:  change,
+		comments: change,
+		project:  filepath.Join("gerrit", getHostName(host)),
+		repo:     change.Project,
+		id:       change.Number,
+		user:     client.User,
+	}
+
+	serviceMode(
+		args, target, "Gerrit changes", gerritUnsupported,
+	)
+}
+
+// parseLabels parses labels given as <name>=<value>, e.g. Verified=+1.
+func parseLabels(values []string) (map[string]int, error) {
+	labels := map[string]int{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf(
+				"label should be given as <name>=<value>, got '%s'", value,
+			)
+		}
+
+		vote, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of label '%s'", value)
+		}
+
+		labels[parts[0]] = vote
+	}
+
+	return labels, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGerritURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected []string
+	}{
+		{
+			"https://review.example.com/c/infra/tools/+/42",
+			[]string{"https://review.example.com", "infra/tools", "42"},
+		},
+		{
+			"https://example.com/gerrit/c/tools/+/42/3/",
+			[]string{"https://example.com/gerrit", "tools", "42"},
+		},
+		{
+			"http://review.example.com/#/c/42/",
+			[]string{"http://review.example.com", "", "42"},
+		},
+		{
+			"https://stash.example.com/projects/c/repos/r/pull-requests/4",
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		matches := reGerritURL.FindStringSubmatch(test.url)
+
+		var actual []string
+		if matches != nil {
+			actual = matches[1:]
+		}
+
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("unexpected parts of %s\n%q\n%q",
+				test.url, test.expected, actual)
+		}
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels([]string{"Code-Review=+2", "Verified=-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{"Code-Review": 2, "Verified": -1}
+	if !reflect.DeepEqual(expected, labels) {
+		t.Fatalf("unexpected labels\n%#v\n%#v", expected, labels)
+	}
+
+	for _, invalid := range []string{"Verified", "=1", "Verified=yes"} {
+		_, err := parseLabels([]string{invalid})
+		if err == nil {
+			t.Fatalf("invalid label is parsed: %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Review file has 'diff.ash' filetype, so diff syntax and plugins still
+// work even if ash support files are not installed.
+const vimFtdetect = `" generated by 'ash integration vim'
+autocmd BufRead,BufNewFile */ash.*/review.diff setfiletype diff.ash
+`
+
+const vimSyntax = `" generated by 'ash integration vim'
+syn match ashIgnored "^###.*$"
+syn match ashFileMarker "^### === .* ===$"
+syn match ashComment "^#\([^#].*\)\?$"
+syn match ashCommentHeader "^# \[\d\+@\d\+\] |.*$"
+syn match ashTask "\[[ xX]\] TASK: .*$" containedin=ashComment
+syn match ashNewTask "TASK: .*$" containedin=ashComment
+
+hi def link ashIgnored Comment
+hi def link ashFileMarker Title
+hi def link ashComment Special
+hi def link ashCommentHeader Identifier
+hi def link ashTask Todo
+hi def link ashNewTask Todo
+`
+
+const vimFtplugin = `" generated by 'ash integration vim'
+if exists("b:did_ash_ftplugin")
+    finish
+endif
+
+let b:did_ash_ftplugin = 1
+
+" every file and every hunk are folded separately
+function! AshFoldLevel(lnum)
+    let line = getline(a:lnum)
+    if line =~# '^### === .* ===$'
+        return '>1'
+    endif
+
+    if line =~# '^@@ '
+        return '>2'
+    endif
+
+    return '='
+endfunction
+
+setlocal foldmethod=expr
+setlocal foldexpr=AshFoldLevel(v:lnum)
+setlocal foldlevel=1
+
+nnoremap <buffer> <silent> ]f :call search('^### === .* ===$', 'W')<CR>
+nnoremap <buffer> <silent> [f :call search('^### === .* ===$', 'bW')<CR>
+nnoremap <buffer> <silent> ]h :call search('^@@ ', 'W')<CR>
+nnoremap <buffer> <silent> [h :call search('^@@ ', 'bW')<CR>
+`
+
+type integrationFile struct {
+	path    string
+	content string
+}
+
+var vimIntegrationFiles = []integrationFile{
+	{"ftdetect/ash.vim", vimFtdetect},
+	{"syntax/ash.vim", vimSyntax},
+	{"ftplugin/ash.vim", vimFtplugin},
+}
+
+func integrationMode(args map[string]interface{}) {
+	dir := args["<dir>"].(string)
+
+	err := writeIntegrationFiles(dir, vimIntegrationFiles)
+	if err != nil {
+		logger.Critical("can not write vim support files: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	printInfo("Vim support files successfully written to %s", dir)
+}
+
+func writeIntegrationFiles(dir string, files []integrationFile) error {
+	for _, file := range files {
+		path := filepath.Join(dir, file.path)
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(path, []byte(file.content), 0644)
+		if err != nil {
+			return err
+		}
+
+		logger.Debug("written %s", path)
+	}
+
+	return nil
+}
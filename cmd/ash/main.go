@@ -0,0 +1,3165 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bndr/gopencils"
+	"github.com/docopt/docopt-go"
+	"github.com/op/go-logging"
+	"github.com/seletskiy/ash/stash"
+)
+
+var (
+	reStashURL = regexp.MustCompile(
+		`(https?://.*/)` +
+			`((users|projects)/([^/]+))` +
+			`/repos/([^/]+)` +
+			`/pull-requests/(\d+)`)
+)
+
+var configPath = os.Getenv("HOME") + "/.config/ash/ashrc"
+
+var logger = logging.MustGetLogger("main")
+
+// logModules are go-logging modules of ash and of its backend packages,
+// which share log levels.
+var logModules = []string{"main", "stash", "bitbucket", "gerrit"}
+
+var tmpWorkDir = ""
+var panicState = false
+
+// quietMode suppresses progress and informational messages, so only
+// results and errors are printed.
+var quietMode = false
+
+// stdin is shared by all prompts, so answers piped to ash, which are read
+// ahead into buffer by one prompt, are not lost for the next ones.
+var stdin = bufio.NewReader(os.Stdin)
+
+const logFormat = "%{time:15:04:05.00} [%{level:.4s}] %{message}"
+const logFormatColor = "%{color}" + logFormat + "%{color:reset}"
+
+const declineReasonHint = "### Enter decline reason above (optional).\n" +
+	"### Lines beginning with ### will be ignored.\n"
+
+const pullRequestTextHint = "### First line is the pull request title, " +
+	"rest is the description.\n" +
+	"### Lines beginning with ### will be ignored.\n"
+
+const changeTextHint = "### Edit text of the change above.\n" +
+	"### Lines beginning with ### will be ignored.\n"
+
+const startUrlExample = "http[s]://<host>/(users|projects)/<project>/repos/<repo>/pull-requests/<id>"
+
+type CmdLineArgs string
+
+func parseCmdLine(cmd []string) (map[string]interface{}, error) {
+	help := `Atlassian Stash Reviewer.
+
+Most convenient usage is specify pull request url and file you want to review:
+  ash ` + startUrlExample + ` review <file-to-review>
+
+However, you can set up --url and --project flags in ~/.config/ash/ashrc file
+(--url, --user, --pass and -e can be also set through ASH_HOST, ASH_USER,
+ASH_PASS and ASH_EDITOR env vars) and access pull requests by shorthand
+commands:
+  ash proj/mycoolrepo/1 review  # if --url is given
+  ash mycoolrepo/1 review       # if --url and --project is given
+  ash mycoolrepo ls-reviews     # --//--
+
+Pull requests of Bitbucket Cloud are reviewed by their bitbucket.org URL, e.g.
+  ash https://bitbucket.org/<workspace>/<repo>/pull-requests/<id> review
+using app password of the user or OAuth token given by --token.
+
+Changes of Gerrit are reviewed by their URL the same way, e.g.
+  ash https://<host>/c/<project>/+/<number> review --label=Verified=+1
+using HTTP password of the user. Comments are saved as drafts and published
+with given labels by single review after all of them are applied.
+
+Ash then open $EDITOR for commenting on pull request.
+
+You can add comments by just specifying them after line you want to comment,
+beginning with '# '.
+
+You can delete comment by deleting it from file, and, of course, modify comment
+you own by modifying it in the file.
+
+After you finish your edits, just save file and exit from editor. Ash will
+apply all changes made to the review.
+
+If <file-name> is omitted, ash welcomes you to review the overview. Use --all
+to review every changed file at once or specify several files to review them
+in one file.
+
+'ls' command can be used to list various things, including:
+* files in pull request;
+* opened/merged/declined pull requests for repo;
+* repositories in specified project;
+* projects;
+
+'inbox' command lists pull requests across all repos where you are author or
+reviewer; ones with commits you have not reviewed yet are marked with '*'.
+
+'review' command without pull request lets to pick one among open pull
+requests of repo given by --project in <project>/<repo> format, or of inbox.
+File names, which are not found in pull request, are matched fuzzily, and
+file is picked if several ones are matched.
+
+'tui' command opens full-screen interface with open pull requests of repo (or
+inbox if repo is not given), their files and comment threads; 'r' key opens
+review of selected item in editor.
+
+'completion' command prints script, which completes commands, projects, repos
+and open pull requests in bash, zsh or fish; listed slugs are cached for few
+minutes.
+
+Line can be commented with fenced code block with 'suggestion' info string,
+which contains lines to replace commented line with. 'apply-suggestions'
+command writes suggestions made in pull request as patch or commits them to
+the source branch.
+
+Usage:
+  ash [options] auth (login|logout)
+  ash [options] config get <key>
+  ash [options] config set <key> <value>
+  ash [options] doctor
+  ash [options] completion (bash|zsh|fish)
+  ash [options] complete [--] [<word>...]
+  ash [options] integration vim <dir>
+  ash [options] inbox [-d] [--absolute]
+                 [(reviewer|author|all)]
+  ash [options] tui [<project>/<repo>]
+  ash [options] review [<file-name>...] [-w] [--all] [--exclude=<glob>...]
+                 [--commit=<hash> | --since-last] [--preview] [--dry-run]
+                 [--side-by-side]
+  ash [options] push
+  ash [options] <project>/<repo> ls-reviews [-d] [--all] [--builds]
+                 [--conflicts] [--counts] [--absolute] [--sort=<key>] [--reverse]
+                 [--author=<user>] [--reviewer=<user>] [--target=<branch>]
+                 [(open|merged|declined)]
+  ash [options] <project>/<repo> search <query> [-d] [--comments]
+                 [--absolute] [(open|merged|declined)]
+  ash [options] <project>/<repo> stats [--since=<period>]
+  ash [options] <project>/<repo> create --from=<branch> --to=<branch>
+  ash [options] ls-projects [--filter=<name>] [--all]
+  ash [options] <project> ls-repos [--all]
+  ash [options] <project>/<repo>/<pr> ls [--exclude=<glob>...] [--lines]
+  ash [options] <project>/<repo>/<pr> show
+  ash [options] <project>/<repo>/<pr> show-diff [<file-name>...] [-w]
+                 [--exclude=<glob>...] [--commit=<hash>] [--side-by-side]
+                 [--width=<cols>]
+  ash [options] <project>/<repo>/<pr> diffstat [--exclude=<glob>...]
+  ash [options] <project>/<repo>/<pr> export [<file-name>...] [-w]
+                 [--exclude=<glob>...] [--commit=<hash>]
+  ash [options] <project>/<repo>/<pr> commits [--all]
+  ash [options] <project>/<repo>/<pr> edit
+  ash [options] <project>/<repo>/<pr> reviewers [ls]
+  ash [options] <project>/<repo>/<pr> reviewers (add|rm) <user>...
+  ash [options] <project>/<repo>/<pr> (approve|unapprove|needs-work|decline|reopen|merge)
+  ash [options] <project>/<repo>/<pr> watch --interval=<duration>
+                 [--notify=<events>]
+  ash [options] <project>/<repo>/<pr> (watch|unwatch)
+  ash [options] <project>/<repo>/<pr> delete [--force]
+  ash [options] <project>/<repo>/<pr> sync
+  ash [options] <project>/<repo>/<pr> web [--open]
+  ash [options] <project>/<repo>/<pr> apply-suggestions [--exclude=<glob>...]
+                 [--push]
+  ash [options] <project>/<repo>/<pr> [review] [<file-name>...] [-w] [--all]
+                 [--exclude=<glob>...] [--commit=<hash> | --since-last]
+                 [--preview] [--offline] [--dry-run] [--label=<label>...]
+                 [--side-by-side]
+  ash -h | --help
+  ash -v | --version
+
+Options:
+  -h --help          Show this help.
+  -v --version       Show version
+  -u --user=<user>   Stash username.
+  -p --pass=<pass>   Stash password. You want to set this flag in .ashrc file
+                     or store password in system keychain via 'auth login'.
+                     Password is taken from keychain, --pass-cmd, --pass or
+                     netrc, whichever is found first.
+  --pass-cmd=<cmd>   Shell command which prints Stash password, e.g.
+                     'pass show work/stash'. Has priority over --pass, but
+                     not over password stored in keychain.
+  --token=<token>    OAuth access token for Bitbucket Cloud, which is used
+                     instead of user and app password.
+  --label=<label>    Label to vote for in Gerrit review, e.g.
+                     Code-Review=+1. Can be repeated.
+  -d                 Show descriptions for the listed PRs.
+  -l=<count>         Number of activities to retrieve. [default: 1000]
+  --limit=<count>    Number of items to retrieve per page.
+                     [default: 25]
+  --all              Retrieve all pages of items. In review mode, review all
+                     files of pull request in one file.
+  --filter=<name>    Show only projects which name contains specified string.
+  --force            Do not ask for confirmation.
+  --builds           Show build status of the listed PRs.
+  --conflicts        Show whether the listed PRs can be merged.
+  --counts           Show number of open tasks and unresolved comment threads
+                     of the listed PRs.
+  --sort=<key>       Sort listed PRs by updated, created, id or author,
+                     oldest or smallest first. All pages are retrieved to
+                     sort them.
+  --reverse          Reverse order of the listed PRs, e.g. newest first.
+  --author=<user>    Show only PRs created by specified user, 'me' is the
+                     authenticated user.
+  --reviewer=<user>  Show only PRs which specified user is reviewer of, 'me'
+                     is the authenticated user.
+  --target=<branch>  Show only PRs to specified branch.
+  --open             Open printed URL in browser.
+  --web              Open pull request in browser after 'create' or command
+                     of pull request succeeds.
+  --interval=<duration>  Poll pull request for new activity with specified
+                         interval, e.g. 60s, and print it as a feed.
+  --notify=<events>  Send desktop notifications about activity of watched
+                     PR: comma separated comments, approvals, pushes, or
+                     all.
+  --since=<period>   Summarize PRs created during specified period, e.g.
+                     30d, 2w or 12h. [default: 30d]
+  --comments         Search in comments of PRs too, which requires
+                     retrieving activities of every PR.
+  --absolute         Show dates of the listed PRs in ISO 8601 instead of
+                     relative to now, e.g. '2h ago'.
+  --date-format=<format>  Format of printed dates, either strftime one, e.g.
+                          '%Y-%m-%d %H:%M', or Go layout, e.g.
+                          '2006-01-02 15:04'.
+  --format=<format>  Output format of listing commands: table, tsv, csv or
+                     Go template, which is executed for every item, e.g.
+                     '{{.Id}} {{.Author.User.Name}} {{.FromRef.DisplayId}}'.
+                     Export accepts html, which is default, or md for
+                     markdown report of pull request activity.
+                     [default: table]
+  --columns=<list>   Comma separated columns to print in tsv or csv format,
+                     e.g. 'id,title,author'. Unknown column error lists
+                     available ones.
+  --jobs=<count>     Number of concurrent requests for build and merge
+                     statuses of the listed PRs. [default: 8]
+  -w --ignore-whitespace  Ignore changes in whitespaces, so re-indented
+                         lines are not shown as changed.
+  --exclude=<glob>   Do not show and review files matching pattern, e.g.
+                     'vendor/**' or '**/*.pb.go'. Can be repeated.
+  --lines            Show number of added and removed lines of every file.
+  --commit=<hash>    Review changes of single commit of pull request. All
+                     files of the commit are reviewed if no file specified.
+  --since-last       Review only commits pushed since your last review.
+  --context=<lines>  Number of context lines around changes in diff.
+  -e=<editor>        Editor to use. This has priority over $EDITOR env var.
+  --editor-args=<args>  Arguments to open review file in editor at the first
+                        hunk, {file} and {line} are replaced by path of file
+                        and line number, e.g. '+{line} {file}'. Known
+                        editors are supported by default.
+  -i --interactive   Interactive mode. Ask before applying every change.
+  --preview          Print review with rendered comments instead of opening
+                     it in editor.
+  --wrap=<cols>      Wrap comments longer than specified width in review file,
+                     0 disables wrapping. [default: 80]
+  --templates=<dir>  Dir with comment templates, which are inserted by writing
+                     '@<name>' line in comment, e.g. '@nitpick' for
+                     nitpick.md. Default is ~/.config/ash/templates.
+  --fold-context=<lines>  Fold runs of unchanged lines longer than specified
+                          number of lines in review file, 0 disables
+                          folding of context. [default: 12]
+  --fold-markers=<markers>  Fold markers, which are put around folded
+                            context and resolved threads. Modeline of review
+                            file makes vim fold by them.
+                            [default: {{{,}}}]
+  --no-fold          Do not put fold markers in review file.
+  --gutter           Prefix diff lines in review file with their line numbers
+                     in the new version of file. Gutter is stripped when
+                     review is read.
+  --gutter-source    Show line numbers in the old version of file in gutter
+                     too. Implies --gutter.
+  --push             Commit suggestions to the source branch of pull request
+                     instead of writing them as patch.
+  --no-emoji         Do not convert emoji shortcodes like ':+1:' to unicode
+                     in posted comments, leave them for Stash.
+  --dry-run          Print changes made in review without applying them.
+  --offline          Do not send review changes to Stash, but put them in
+                     queue, which is sent by 'push' command. Review should be
+                     given via --origin.
+  --debug=<level>    Verbosity [default: 0].
+  -q --quiet         Print only results and errors, without progress and
+                     informational messages. Outcome can be checked by exit
+                     code: 0 ok, 1 usage error, 2 no changes, 3 changes are
+                     applied partially, 4 auth failure, 5 not found, 6 other
+                     error.
+  --url=<url>        Stash server URL, either full or in <host>[:<port>] form.
+  --scheme=<scheme>  Scheme to use if --url has no scheme. [default: https]
+  --input=<input>    File for loading diff in review file
+  -o --output=<output>  Output review to specified file. Editor is ignored.
+                        Exported review is written to specified file.
+  --origin=<origin>  Do not download review from stash and use specified file
+                     instead.
+  --project=<proj>   Use to specify default project that can be used when
+                     serching pull requests. Can be set in either <project> or
+                     <project>/<repo> format.
+  --color=<when>     Use colors in output: auto, always or never; auto uses
+                     colors only if output is a terminal. [default: auto]
+  --color-theme=<theme>  Colors of output elements in 'element=color,...'
+                         form, where color is SGR code or names joined by
+                         '+', e.g. 'added=bold+green,branch=33'.
+  --no-color         Do not use color in output, same as --color=never.
+  --proxy=<url>      HTTP or SOCKS5 proxy to use, e.g. socks5://localhost:1080.
+                     HTTP_PROXY, HTTPS_PROXY and NO_PROXY env vars are used
+                     if not specified.
+  --ca-cert=<file>   PEM bundle of CA certificates to verify Stash with.
+  --client-cert=<file>  PEM client certificate for mutual TLS.
+  --client-key=<file>   PEM private key of the client certificate. Taken
+                        from --client-cert file if not specified.
+  --insecure         Do not verify TLS certificate of Stash.
+  --side-by-side     Show old and new versions of lines in two columns. In
+                     review mode, review is printed like by --preview,
+                     since it can not be edited in two columns.
+  --width=<cols>     Width of side-by-side diff. Width of terminal is used by
+                     default.
+  --trace            Log every request to Stash and its response.
+  --timeout=<sec>    Timeout of requests to Stash in seconds, 0 means no
+                     timeout. [default: 60]
+  --retries=<count>  Number of retries of GET requests, which time out, are
+                     reset or fail with 5xx status, and of any requests
+                     rejected by rate limiting. [default: 3]
+  --profile=<name>   Use args from specified section of config file. By
+                     default, section is chosen by host of pull request URL.
+  --from=<branch>    Source branch for the pull request to create.
+  --to=<branch>      Target branch for the pull request to create.
+`
+
+	args, err := docopt.Parse(help, cmd, true, "1.3", false, false)
+
+	if _, ok := err.(*docopt.UserError); ok {
+		fmt.Println()
+		fmt.Println("Command line entered is invalid.")
+		fmt.Println()
+		fmt.Println(
+			"Arguments were merged with config values and " +
+				"the resulting command line is:")
+		fmt.Printf("\t%s\n\n", CmdLineArgs(fmt.Sprintf("%s", cmd)).Redacted())
+		os.Exit(exitUsage)
+	}
+
+	if err == nil && args == nil {
+		os.Exit(exitOK)
+	}
+
+	return args, err
+}
+
+func main() {
+	rawArgs := mergeArgsWithConfig(configPath)
+
+	args, err := parseCmdLine(rawArgs)
+	if err != nil {
+		logger.Critical(err.Error())
+	}
+
+	tmpWorkDir, err = ioutil.TempDir(os.TempDir(), "ash.")
+	if err != nil {
+		logger.Critical(err.Error())
+	}
+
+	setupLogger(args)
+	setupColors(args)
+	setupDateFormat(args)
+
+	logger.Info("cmd line args are read from %s", configPath)
+	logger.Debug("cmd line args: %s", CmdLineArgs(fmt.Sprintf("%s", rawArgs)))
+
+	if args["--web"].(bool) && !isWebApplicable(args) {
+		fmt.Println("'--web' is supported only for commands of pull request " +
+			"and 'create'.")
+		os.Exit(exitUsage)
+	}
+
+	if args["config"].(bool) {
+		configMode(args)
+		os.RemoveAll(tmpWorkDir)
+		return
+	}
+
+	if args["doctor"].(bool) {
+		doctorMode(args)
+		os.RemoveAll(tmpWorkDir)
+		return
+	}
+
+	if args["integration"].(bool) {
+		integrationMode(args)
+		os.RemoveAll(tmpWorkDir)
+		return
+	}
+
+	if args["completion"].(bool) {
+		completionMode(args)
+		os.RemoveAll(tmpWorkDir)
+		return
+	}
+
+	if args["complete"].(bool) {
+		completeMode(args)
+		os.RemoveAll(tmpWorkDir)
+		return
+	}
+
+	if args["<project>/<repo>/<pr>"] != nil {
+		matches := reBitbucketURL.FindStringSubmatch(
+			args["<project>/<repo>/<pr>"].(string),
+		)
+		if matches != nil {
+			bitbucketMode(args, matches)
+			os.RemoveAll(tmpWorkDir)
+			return
+		}
+
+		matches = reGerritURL.FindStringSubmatch(
+			args["<project>/<repo>/<pr>"].(string),
+		)
+		if matches != nil {
+			gerritMode(args, matches)
+			os.RemoveAll(tmpWorkDir)
+			return
+		}
+	}
+
+	uri := parseUri(args)
+
+	uri.base, err = getBaseURL(uri.base, args["--scheme"].(string))
+	if err != nil {
+		fmt.Printf("%s.\n", err.Error())
+		os.Exit(exitUsage)
+	}
+
+	user, err := getUser(args, uri.base)
+	if err != nil {
+		fmt.Printf("%s.\n", err.Error())
+		os.Exit(exitUsage)
+	}
+
+	if args["auth"].(bool) {
+		authMode(args, uri.base, user)
+		os.RemoveAll(tmpWorkDir)
+		return
+	}
+
+	client, err := getHTTPClient(args)
+	if err != nil {
+		fmt.Printf("%s.\n", err.Error())
+		os.Exit(exitUsage)
+	}
+
+	retries, err := getRetries(args)
+	if err != nil {
+		fmt.Printf("%s.\n", err.Error())
+		os.Exit(exitUsage)
+	}
+
+	api := stash.Api{
+		URL:      uri.base,
+		Auth:     gopencils.BasicAuth{Username: user},
+		Password: getLazyPassword(args, uri.base, user),
+		Client:   client,
+		Retries:  retries,
+	}
+	project := stash.Project{Api: &api, Name: uri.project}
+	repo := project.GetRepo(uri.repo)
+
+	switch {
+	case args["tui"].(bool):
+		if args["<project>/<repo>"] == nil {
+			tuiMode(args, api, nil)
+		} else {
+			tuiMode(args, api, &repo)
+		}
+	case args["<project>/<repo>/<pr>"] == nil && args["review"].(bool):
+		pickReviewMode(args, api)
+	case args["<project>/<repo>/<pr>"] != nil:
+		reviewMode(args, repo, uri.pr)
+	case args["<project>/<repo>"] != nil:
+		repoMode(args, repo)
+	case args["<project>"] != nil:
+		projectMode(args, project)
+	case args["inbox"].(bool):
+		inboxMode(args, api)
+	case args["push"].(bool):
+		pushQueue(api, getTemplates(args), !args["--no-emoji"].(bool))
+	case args["ls-projects"].(bool):
+		filter := ""
+		if args["--filter"] != nil {
+			filter = args["--filter"].(string)
+		}
+
+		showProjects(
+			api, filter, getLimit(args), args["--all"].(bool),
+			getListFormat(args),
+		)
+	}
+
+	if !panicState {
+		// in case of everything is fine
+		logger.Debug("removing %s", tmpWorkDir)
+		os.RemoveAll(tmpWorkDir)
+	}
+}
+
+func authMode(args map[string]interface{}, host string, user string) {
+	switch {
+	case args["login"].(bool):
+		pass, err := promptPassword(
+			fmt.Sprintf("Password for %s at %s: ", user, getHostName(host)),
+		)
+		if err != nil {
+			logger.Critical("can not read password: %s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		err = setKeychainPassword(host, user, pass)
+		if err != nil {
+			logger.Critical("can not store password: %s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		printInfo("Password successfully stored in system keychain")
+	case args["logout"].(bool):
+		stash.ClearSessionCookies(host, user)
+
+		err := deleteKeychainPassword(host, user)
+		if err != nil {
+			logger.Critical("can not remove password: %s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		printInfo("Password successfully removed from system keychain")
+	}
+}
+
+func configMode(args map[string]interface{}) {
+	section, key := splitConfigKey(args["<key>"].(string))
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Critical("can not read config: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	switch {
+	case args["get"].(bool):
+		value, ok := getConfigValue(string(data), section, key)
+		if !ok {
+			fmt.Printf("%s is not set.\n", args["<key>"].(string))
+			os.Exit(exitNotFound)
+		}
+
+		fmt.Println(value)
+	case args["set"].(bool):
+		newData, err := setConfigValue(
+			string(data), section, key, args["<value>"].(string),
+		)
+		if err != nil {
+			logger.Critical("can not set config value: %s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		err = writeConfig(configPath, newData)
+		if err != nil {
+			logger.Critical("can not write config: %s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		printInfo("Config value successfully set")
+	}
+}
+
+func setupLogger(args map[string]interface{}) {
+	debugLogFile, err := os.Create(tmpWorkDir + "/debug.log")
+	if err != nil {
+		logger.Critical(err.Error())
+	}
+
+	debugLog := logging.AddModuleLevel(
+		logging.NewLogBackend(debugLogFile, "", 0))
+
+	stderrLog := logging.AddModuleLevel(logging.NewLogBackend(os.Stderr, "", 0))
+
+	logging.SetBackend(logging.MultiLogger(debugLog, stderrLog))
+
+	targetLogFormat := logFormatColor
+	if !isColorEnabled(args, os.Stderr) {
+		targetLogFormat = logFormat
+	}
+
+	logging.SetFormatter(logging.MustStringFormatter(targetLogFormat))
+
+	logLevels := []logging.Level{
+		logging.WARNING,
+		logging.INFO,
+		logging.DEBUG,
+	}
+
+	requestedLogLevel := int64(0)
+	if args["--debug"] != nil {
+		requestedLogLevel, _ = strconv.ParseInt(args["--debug"].(string), 10, 16)
+	}
+
+	for _, module := range logModules {
+		for _, lvl := range logLevels[:requestedLogLevel+1] {
+			logging.SetLevel(lvl, module)
+		}
+
+		debugLog.SetLevel(logging.DEBUG, module)
+	}
+
+	if args["--quiet"].(bool) {
+		quietMode = true
+		for _, module := range logModules {
+			stderrLog.SetLevel(logging.ERROR, module)
+		}
+	}
+}
+
+// printInfo prints informational message unless quiet mode is on.
+func printInfo(format string, values ...interface{}) {
+	if !quietMode {
+		fmt.Printf(format+"\n", values...)
+	}
+}
+
+func inboxMode(args map[string]interface{}, api stash.Api) {
+	roles := []string{"author", "reviewer"}
+	for _, role := range roles {
+		if args[role].(bool) {
+			roles = []string{role}
+			break
+		}
+	}
+
+	channels := make(map[string]chan []stash.PullRequest)
+	for _, role := range roles {
+		channels[role] = requestInboxFor(role, api)
+	}
+
+	items := []pullRequestListItem{}
+	for _, role := range roles {
+		for _, pullRequest := range <-channels[role] {
+			items = append(items, pullRequestListItem{
+				PullRequest: pullRequest,
+				unreviewed:  pullRequest.HasUnreviewedChanges(api.Auth.Username),
+			})
+		}
+	}
+
+	format := getListFormat(args)
+	if !format.isTable() {
+		printListRecords(format, len(items),
+			func(i int) interface{} { return items[i] },
+			getPullRequestColumns(items), defaultPullRequestColumns,
+		)
+		return
+	}
+
+	printPullRequestTable(os.Stdout, items, pullRequestPrintOptions{
+		withDesc:     args["-d"].(bool),
+		absoluteDate: args["--absolute"].(bool),
+	})
+}
+
+func requestInboxFor(role string, api stash.Api) chan []stash.PullRequest {
+	resultChannel := make(chan []stash.PullRequest, 0)
+
+	go func() {
+		reviews, err := api.GetInbox(role)
+		if err != nil {
+			logger.Critical(
+				"error retrieving inbox for '%s': %s",
+				role,
+				err.Error(),
+			)
+		}
+
+		resultChannel <- reviews
+	}()
+
+	return resultChannel
+}
+
+func getEditor(args map[string]interface{}) string {
+	if args["-e"] != nil {
+		return args["-e"].(string)
+	}
+
+	return os.Getenv("EDITOR")
+}
+
+// getExcludes returns exclude patterns without duplicates, because docopt
+// can return repeated option twice.
+func getExcludes(args map[string]interface{}) []string {
+	excludes := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range args["--exclude"].([]string) {
+		if !seen[pattern] {
+			excludes = append(excludes, pattern)
+			seen[pattern] = true
+		}
+	}
+
+	return excludes
+}
+
+// getCommitRange returns range to diff changes of single commit.
+func getCommitRange(pr stash.PullRequest, hash string) (string, string) {
+	commit, err := pr.GetCommit(hash)
+	if err != nil {
+		logger.Critical("can not get commit %s: %s", hash, err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	since := ""
+	if len(commit.Parents) > 0 {
+		since = commit.Parents[0].Id
+	}
+
+	return since, commit.Id
+}
+
+// getSinceLastRange returns range to diff commits pushed after last review
+// of given user.
+func getSinceLastRange(target reviewTarget, user string) (string, string) {
+	info, err := target.service.GetInfo()
+	if err != nil {
+		logger.Critical("error obtaining pull request info: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	since := getLastReviewedCommit(target, user, info)
+	if since == "" {
+		fmt.Println("No previous review is found, review whole pull request.")
+		os.Exit(exitNotFound)
+	}
+
+	latest := info.GetLatestCommit()
+	if since == latest {
+		fmt.Println("No new commits since your last review.")
+		exitSucceeded()
+	}
+
+	return since, latest
+}
+
+func getEditorArgsTemplate(args map[string]interface{}) string {
+	if args["--editor-args"] != nil {
+		return args["--editor-args"].(string)
+	}
+
+	return ""
+}
+
+func reviewMode(args map[string]interface{}, repo stash.Repo, pr int64) {
+	editor := getEditor(args)
+
+	paths := args["<file-name>"].([]string)
+
+	input := ""
+	if args["--input"] != nil {
+		input = args["--input"].(string)
+	}
+
+	output := ""
+	if args["--output"] != nil {
+		output = args["--output"].(string)
+	}
+
+	excludes := getExcludes(args)
+
+	diff := getDiffOptions(args)
+
+	pullRequest := repo.GetPullRequest(pr)
+
+	origin := ""
+	if args["--origin"] != nil {
+		origin = args["--origin"].(string)
+	}
+
+	interactiveMode := args["--interactive"].(bool)
+
+	reviewAll := args["--all"].(bool)
+
+	if args["--commit"] != nil {
+		diff.SinceId, diff.UntilId = getCommitRange(
+			pullRequest, args["--commit"].(string),
+		)
+
+		if len(paths) == 0 {
+			reviewAll = true
+		}
+	}
+
+	if args["--since-last"].(bool) {
+		diff.SinceId, diff.UntilId = getSinceLastRange(
+			newStashTarget(pullRequest), pullRequest.Auth.Username,
+		)
+
+		if len(paths) == 0 {
+			reviewAll = true
+		}
+	}
+
+	if len(paths) > 0 && origin == "" && input == "" {
+		paths = pickFiles(&pullRequest, paths, diff)
+	}
+
+	// commands exit on failures, so pull request is opened only after
+	// successful one
+	if args["--web"].(bool) && !args["web"].(bool) {
+		webURL = getPullRequestURL(pullRequest)
+		defer openWebURL()
+	}
+
+	switch {
+	case args["web"].(bool):
+		webMode(pullRequest, args["--open"].(bool))
+	case isFilesList(args):
+		showFilesList(
+			pullRequest, excludes, getListFormat(args), args["--lines"].(bool),
+		)
+	case args["diffstat"].(bool):
+		showDiffStat(pullRequest, excludes)
+	case args["export"].(bool):
+		exportReview(
+			pullRequest, paths, diff, args["--format"].(string), output,
+		)
+	case args["show"].(bool):
+		showPullRequest(pullRequest, colors.enabled)
+	case args["show-diff"].(bool):
+		var renderer stash.ReviewRenderer = stash.UnifiedRenderer{}
+		switch {
+		case args["--side-by-side"].(bool):
+			renderer = sideBySideRenderer{getWidth(args)}
+		case colors.enabled:
+			renderer = coloredRenderer{renderer}
+		}
+
+		showDiff(&pullRequest, paths, diff, renderer)
+	case args["commits"].(bool):
+		showCommitsList(
+			pullRequest, getLimit(args), args["--all"].(bool),
+			getListFormat(args),
+		)
+	case args["edit"].(bool):
+		edit(pullRequest, editor)
+	case args["reviewers"].(bool):
+		users := args["<user>"].([]string)
+		switch {
+		case args["add"].(bool):
+			addReviewers(pullRequest, users)
+		case args["rm"].(bool):
+			removeReviewers(pullRequest, users)
+		default:
+			showReviewers(pullRequest)
+		}
+	case args["sync"].(bool):
+		syncPullRequest(pullRequest)
+	case args["apply-suggestions"].(bool):
+		applySuggestions(
+			pullRequest, diff, output, interactiveMode, args["--push"].(bool),
+		)
+	case args["delete"].(bool):
+		deletePullRequest(pullRequest, args["--force"].(bool))
+	case args["watch"].(bool) && args["--interval"] != nil:
+		watchMode(pullRequest, getWatchInterval(args), getNotifier(args))
+	case args["watch"].(bool):
+		watch(pullRequest)
+	case args["unwatch"].(bool):
+		unwatch(pullRequest)
+	case args["approve"].(bool):
+		approve(&pullRequest)
+	case args["unapprove"].(bool):
+		unapprove(&pullRequest)
+	case args["needs-work"].(bool):
+		needsWork(&pullRequest)
+	case args["decline"].(bool):
+		decline(&pullRequest, editor)
+	case args["reopen"].(bool):
+		reopen(&pullRequest)
+	case args["merge"].(bool):
+		merge(&pullRequest)
+	default:
+		runReview(args, newStashTarget(pullRequest), paths, reviewAll, diff)
+	}
+}
+
+// runReview opens review of given files of pull request in editor with
+// options specified in args and applies changes made in it.
+// isFilesList reports whether files of pull request are listed; docopt sets
+// the same 'ls' key for 'reviewers ls'.
+func isFilesList(args map[string]interface{}) bool {
+	return args["ls"] == true && !args["reviewers"].(bool)
+}
+
+func runReview(
+	args map[string]interface{}, target reviewTarget,
+	paths []string, reviewAll bool, diff stash.DiffOptions,
+) {
+	input := ""
+	if args["--input"] != nil {
+		input = args["--input"].(string)
+	}
+
+	output := ""
+	if args["--output"] != nil {
+		output = args["--output"].(string)
+	}
+
+	origin := ""
+	if args["--origin"] != nil {
+		origin = args["--origin"].(string)
+	}
+
+	var preview stash.ReviewRenderer
+	switch {
+	case args["--side-by-side"].(bool):
+		preview = sideBySideRenderer{getWidth(args)}
+	case args["--preview"].(bool):
+		preview = previewRenderer{colors.enabled}
+	}
+
+	review(
+		target, getEditor(args), getEditorArgsTemplate(args),
+		paths, reviewAll,
+		origin, input, output,
+		args["-l"].(string), diff,
+		args["--interactive"].(bool), preview, args["--offline"].(bool),
+		args["--dry-run"].(bool), getTemplates(args),
+		!args["--no-emoji"].(bool), getWrapWidth(args), getFoldOptions(args),
+		getGutterMode(args),
+	)
+}
+
+// pickReviewMode reviews pull request, which is picked among open pull
+// requests of default repo, or of inbox if default repo is not given.
+func pickReviewMode(args map[string]interface{}, api stash.Api) {
+	project, repoName := "", ""
+	if args["--project"] != nil {
+		parts := strings.SplitN(args["--project"].(string), "/", 2)
+		project = parts[0]
+
+		if len(parts) == 2 {
+			repoName = parts[1]
+		}
+	}
+
+	if repoName != "" {
+		repo := stash.Project{
+			Api: &api, Name: getProjectPath(project),
+		}.GetRepo(repoName)
+
+		pullRequests, err := repo.ListPullRequest("open", getLimit(args), true)
+		if err != nil {
+			logger.Critical("can not list pull requests: %s", err.Error())
+			os.Exit(getErrorExitCode(err))
+		}
+
+		reviewMode(args, repo, pickPullRequest(pullRequests).Id)
+		return
+	}
+
+	pullRequests, err := api.GetInbox("reviewer")
+	if err != nil {
+		logger.Critical("can not list pull requests: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	pr := pickPullRequest(pullRequests)
+
+	repo := stash.Project{
+		Api:  &api,
+		Name: getProjectPath(pr.FromRef.Repository.Project.Key),
+	}.GetRepo(pr.FromRef.Repository.Slug)
+
+	reviewMode(args, repo, pr.Id)
+}
+
+// pickFiles resolves file names given by user, which are not found in pull
+// request, to its files by fuzzy matching; user picks file if several ones
+// are matched.
+func pickFiles(
+	service stash.PullRequestService, paths []string, diff stash.DiffOptions,
+) []string {
+	files, err := service.GetFiles(diff)
+	if err != nil {
+		logger.Warning("can not get files of pull request: %s", err.Error())
+		return paths
+	}
+
+	files = files.Exclude(diff.Exclude)
+
+	result := []string{}
+	for _, path := range paths {
+		result = append(result, pickFile(files, path, isTerminal(os.Stdin)))
+	}
+
+	return result
+}
+
+func getDiffOptions(args map[string]interface{}) stash.DiffOptions {
+	return stash.DiffOptions{
+		IgnoreWhitespaces: args["--ignore-whitespace"].(bool),
+		ContextLines:      getContextLines(args),
+		Exclude:           getExcludes(args),
+	}
+}
+
+func edit(pr stash.PullRequest, editor string) {
+	if editor == "" {
+		fmt.Println("Editor should be specified to edit pull request.")
+		os.Exit(exitUsage)
+	}
+
+	info, err := pr.GetInfo()
+	if err != nil {
+		logger.Critical("error obtaining pull request info: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	text, err := editTextInEditor(
+		editor, "pull-request.txt",
+		info.Title+"\n\n"+info.Description+"\n",
+		pullRequestTextHint,
+	)
+	if err != nil {
+		logger.Critical("error reading pull request text: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	title, description := splitPullRequestText(text)
+
+	if title == "" {
+		fmt.Println("Empty title, pull request is not modified.")
+		os.Exit(exitNoChanges)
+	}
+
+	titleChanged := title != strings.TrimSpace(info.Title)
+	descriptionChanged := stash.TrimCommentSpaces(description) !=
+		stash.TrimCommentSpaces(info.Description)
+
+	if !titleChanged && !descriptionChanged {
+		logger.Info("no changes detected in pull request")
+		os.Exit(exitNoChanges)
+	}
+
+	logger.Debug("Updating pr")
+	err = pr.Update(info, title, description)
+	if err != nil {
+		logger.Critical("error updating: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request successfully updated")
+}
+
+func showPullRequest(pr stash.PullRequest, color bool) {
+	logger.Debug("showing PR summary")
+	info, err := pr.GetInfo()
+	if err != nil {
+		logger.Critical("error obtaining pull request info: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	mergeStatus, err := pr.GetMergeStatus()
+	if err != nil {
+		logger.Warning("error checking merge status: %s", err.Error())
+	}
+
+	fmt.Printf("#%d %s\n\n", info.Id, info.Title)
+
+	writer := newTableWriter(os.Stdout)
+
+	fmt.Fprintf(writer, "State:\t%s\n", info.State)
+	fmt.Fprintf(writer, "Author:\t%s (%s)\n",
+		info.Author.User.DisplayName, info.Author.User.Name)
+	fmt.Fprintf(writer, "Branches:\t%s -> %s\n",
+		info.FromRef.DisplayId, info.ToRef.DisplayId)
+	fmt.Fprintf(writer, "Created:\t%s\n", info.CreatedDate)
+	fmt.Fprintf(writer, "Updated:\t%s\n", info.UpdatedDate)
+	fmt.Fprintf(writer, "Comments:\t%d\n", info.Properties.CommentCount)
+	fmt.Fprintf(writer, "Open tasks:\t%d\n", info.Properties.OpenTaskCount)
+
+	fmt.Fprintf(writer, "Build:\t%s\n",
+		getBuildStatus(*pr.Api, info.GetLatestCommit()))
+
+	if mergeStatus != nil {
+		mergeable := "yes"
+		if !mergeStatus.CanMerge {
+			mergeable = "no"
+			if mergeStatus.Conflicted {
+				mergeable += ", has conflicts"
+			}
+		}
+
+		fmt.Fprintf(writer, "Can be merged:\t%s\n", mergeable)
+	}
+
+	for i, reviewer := range info.Reviewers {
+		title := ""
+		if i == 0 {
+			title = "Reviewers:"
+		}
+
+		fmt.Fprintf(writer, "%s\t%s (%s)\t%s\n",
+			title, reviewer.User.DisplayName, reviewer.User.Name,
+			getReviewerStatus(reviewer.Status, reviewer.Approved))
+	}
+
+	writer.Flush()
+
+	if info.Description != "" {
+		fmt.Printf("\n%s\n", renderMarkdown(info.Description, color))
+	}
+}
+
+func getReviewerStatus(status string, approved bool) string {
+	if status != "" {
+		return status
+	}
+
+	if approved {
+		return stash.ParticipantApproved
+	}
+
+	return stash.ParticipantUnapproved
+}
+
+func showReviewers(pr stash.PullRequest) {
+	logger.Debug("showing list of reviewers in PR")
+	info, err := pr.GetInfo()
+	if err != nil {
+		logger.Critical("error obtaining pull request info: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	writer := newTableWriter(os.Stdout)
+	for _, reviewer := range info.Reviewers {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n",
+			reviewer.User.Name, reviewer.User.DisplayName,
+			getReviewerStatus(reviewer.Status, reviewer.Approved))
+	}
+	writer.Flush()
+}
+
+func addReviewers(pr stash.PullRequest, users []string) {
+	for _, user := range users {
+		logger.Debug("Adding reviewer %s", user)
+		err := pr.AddReviewer(user)
+		if err != nil {
+			logger.Critical("error adding reviewer %s: %s", user, err.Error())
+			os.Exit(getErrorExitCode(err))
+		}
+
+		printInfo("Reviewer %s successfully added", user)
+	}
+}
+
+func removeReviewers(pr stash.PullRequest, users []string) {
+	for _, user := range users {
+		logger.Debug("Removing reviewer %s", user)
+		err := pr.RemoveReviewer(user)
+		if err != nil {
+			logger.Critical("error removing reviewer %s: %s", user, err.Error())
+			os.Exit(getErrorExitCode(err))
+		}
+
+		printInfo("Reviewer %s successfully removed", user)
+	}
+}
+
+func deletePullRequest(pr stash.PullRequest, force bool) {
+	if !force && !askConfirmation("Delete pull request?", false) {
+		os.Exit(exitNoChanges)
+	}
+
+	logger.Debug("Deleting pr")
+	err := pr.Delete()
+	if err != nil {
+		logger.Critical("error deleting: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request successfully deleted")
+}
+
+func askConfirmation(question string, defaultAnswer bool) bool {
+	hint := "[yN]"
+	if defaultAnswer {
+		hint = "[Yn]"
+	}
+
+	for {
+		fmt.Printf("%s %s ", question, hint)
+		answer, _ := stdin.ReadString('\n')
+
+		switch strings.TrimSpace(answer) {
+		case "y", "Y":
+			return true
+		case "n", "N":
+			return false
+		case "":
+			return defaultAnswer
+		}
+	}
+}
+
+func watch(pr stash.PullRequest) {
+	logger.Debug("Watching pr")
+	err := pr.Watch()
+	if err != nil {
+		logger.Critical("error watching: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request successfully watched")
+}
+
+func unwatch(pr stash.PullRequest) {
+	logger.Debug("Unwatching pr")
+	err := pr.Unwatch()
+	if err != nil {
+		logger.Critical("error unwatching: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request successfully unwatched")
+}
+
+func approve(service stash.PullRequestService) {
+	logger.Debug("Approving pr")
+	err := service.Approve()
+	if err != nil {
+		logger.Critical("error approving: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request successfully approved")
+}
+
+func unapprove(service stash.PullRequestService) {
+	logger.Debug("Unapproving pr")
+	err := service.Unapprove()
+	if err != nil {
+		logger.Critical("error unapproving: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request approval successfully withdrawn")
+}
+
+func needsWork(service stash.PullRequestService) {
+	logger.Debug("Marking pr as needs work")
+	err := service.NeedsWork()
+	if err != nil {
+		logger.Critical("error marking as needs work: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request successfully marked as needs work")
+}
+
+func decline(service stash.PullRequestService, editor string) {
+	reason := ""
+	if editor != "" {
+		var err error
+		reason, err = editTextInEditor(
+			editor, "decline.txt", "", declineReasonHint,
+		)
+		if err != nil {
+			logger.Critical("error reading decline reason: %s", err.Error())
+			os.Exit(exitFailure)
+		}
+	}
+
+	logger.Debug("Declining pr")
+	err := service.Decline(reason)
+	if err != nil {
+		logger.Critical("error declining: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request successfully declined")
+}
+
+func reopen(service stash.PullRequestService) {
+	logger.Debug("Reopening pr")
+	err := service.Reopen()
+	if err != nil {
+		logger.Critical("error reopening: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request successfully reopened")
+}
+
+// mergeChecker is implemented by backends which can tell whether pull
+// request can be merged before merging it.
+type mergeChecker interface {
+	GetMergeStatus() (*stash.MergeStatus, error)
+}
+
+func merge(service stash.PullRequestService) {
+	if checker, ok := service.(mergeChecker); ok {
+		logger.Debug("Checking if pr can be merged")
+		status, err := checker.GetMergeStatus()
+		if err != nil {
+			logger.Critical("error checking merge status: %s", err.Error())
+			os.Exit(getErrorExitCode(err))
+		}
+
+		if !status.CanMerge {
+			fmt.Println("Pull request can not be merged:")
+
+			if status.Conflicted {
+				fmt.Println("* Pull request has conflicts.")
+			}
+
+			printVetoes(status.Vetoes)
+
+			os.Exit(exitFailure)
+		}
+	}
+
+	logger.Debug("Merging pr")
+	err := service.Merge()
+	if err != nil {
+		logger.Critical("error merging: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request successfully merged")
+}
+
+func syncPullRequest(pr stash.PullRequest) {
+	logger.Debug("Checking if pr can be rebased")
+	status, err := pr.GetRebaseStatus()
+	if err != nil {
+		logger.Critical("error checking rebase status: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	if !status.CanRebase {
+		fmt.Println("Pull request can not be synced:")
+
+		if !status.CanWrite {
+			fmt.Println("* You have no write access to the source branch.")
+		}
+
+		printVetoes(status.Vetoes)
+
+		os.Exit(exitFailure)
+	}
+
+	logger.Debug("Rebasing pr")
+	err = pr.Rebase()
+	if err != nil {
+		logger.Critical("error syncing: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request successfully synced with target branch")
+}
+
+func printVetoes(vetoes []stash.Veto) {
+	for _, veto := range vetoes {
+		fmt.Printf("* %s\n", veto.SummaryMessage)
+		if veto.DetailedMessage != "" {
+			fmt.Println(stash.Indent(veto.DetailedMessage, "  "))
+		}
+	}
+}
+
+func repoMode(args map[string]interface{}, repo stash.Repo) {
+	switch {
+	case args["ls-reviews"]:
+		showReviewsInRepo(repo, reviewsListOptions{
+			state:           getReviewsState(args),
+			limit:           getLimit(args),
+			all:             args["--all"].(bool),
+			withDesc:        args["-d"].(bool),
+			withBuilds:      args["--builds"].(bool),
+			withConflicts:   args["--conflicts"].(bool),
+			withCounts:      args["--counts"].(bool),
+			absoluteDate:    args["--absolute"].(bool),
+			sort:            getSortKey(args),
+			reverse:         args["--reverse"].(bool),
+			filter:          getPullRequestFilter(args, repo.Auth.Username),
+			jobs:            getJobs(args),
+			activitiesLimit: getActivitiesLimit(args),
+			format:          getListFormat(args),
+		})
+	case args["search"]:
+		searchPullRequests(repo, args["<query>"].(string), searchOptions{
+			withComments:    args["--comments"].(bool),
+			activitiesLimit: args["-l"].(string),
+			reviewsListOptions: reviewsListOptions{
+				state:        getReviewsState(args),
+				limit:        getLimit(args),
+				withDesc:     args["-d"].(bool),
+				absoluteDate: args["--absolute"].(bool),
+				jobs:         getJobs(args),
+				format:       getListFormat(args),
+			},
+		})
+	case args["stats"]:
+		statsMode(
+			repo, getSincePeriod(args), getActivitiesLimit(args),
+			getJobs(args),
+		)
+	case args["create"]:
+		createPullRequest(
+			repo, getEditor(args),
+			args["--from"].(string), args["--to"].(string),
+			args["--web"].(bool),
+		)
+	}
+}
+
+func getReviewsState(args map[string]interface{}) string {
+	switch {
+	case args["declined"]:
+		return "declined"
+	case args["merged"]:
+		return "merged"
+	default:
+		return "open"
+	}
+}
+
+func projectMode(args map[string]interface{}, project stash.Project) {
+	switch {
+	case args["ls-repos"]:
+		showReposInProject(
+			project, getLimit(args), args["--all"].(bool),
+			getListFormat(args),
+		)
+	}
+}
+
+func getWidth(args map[string]interface{}) int {
+	if args["--width"] == nil {
+		return getTerminalWidth()
+	}
+
+	width, err := strconv.Atoi(args["--width"].(string))
+	if err != nil {
+		fmt.Println("--width should be a number.")
+		os.Exit(exitUsage)
+	}
+
+	return width
+}
+
+func getContextLines(args map[string]interface{}) int {
+	if args["--context"] == nil {
+		return -1
+	}
+
+	lines, err := strconv.Atoi(args["--context"].(string))
+	if err != nil || lines < 0 {
+		fmt.Println("--context should be a number.")
+		os.Exit(exitUsage)
+	}
+
+	return lines
+}
+
+func getWrapWidth(args map[string]interface{}) int {
+	width, err := strconv.Atoi(args["--wrap"].(string))
+	if err != nil || width < 0 {
+		fmt.Println("--wrap should be a number.")
+		os.Exit(exitUsage)
+	}
+
+	return width
+}
+
+func getFoldOptions(args map[string]interface{}) stash.FoldOptions {
+	if args["--no-fold"].(bool) {
+		return stash.FoldOptions{}
+	}
+
+	context, err := strconv.Atoi(args["--fold-context"].(string))
+	if err != nil || context < 0 {
+		fmt.Println("--fold-context should be a number.")
+		os.Exit(exitUsage)
+	}
+
+	markers := strings.Split(args["--fold-markers"].(string), ",")
+	if len(markers) != 2 || markers[0] == "" || markers[1] == "" ||
+		strings.ContainsAny(args["--fold-markers"].(string), " \t:") {
+		fmt.Println("--fold-markers should be two markers separated by comma.")
+		os.Exit(exitUsage)
+	}
+
+	return stash.FoldOptions{
+		Context: context,
+		Open:    markers[0],
+		Close:   markers[1],
+	}
+}
+
+func getGutterMode(args map[string]interface{}) stash.GutterMode {
+	switch {
+	case args["--gutter-source"].(bool):
+		return stash.GutterBoth
+	case args["--gutter"].(bool):
+		return stash.GutterDestination
+	default:
+		return stash.GutterNone
+	}
+}
+
+func getJobs(args map[string]interface{}) int {
+	jobs, err := strconv.Atoi(args["--jobs"].(string))
+	if err != nil || jobs < 1 {
+		fmt.Println("--jobs should be a positive number.")
+		os.Exit(exitUsage)
+	}
+
+	return jobs
+}
+
+func getActivitiesLimit(args map[string]interface{}) int {
+	limit, err := strconv.Atoi(args["-l"].(string))
+	if err != nil {
+		fmt.Println("-l should be a number.")
+		os.Exit(exitUsage)
+	}
+
+	return limit
+}
+
+func getLimit(args map[string]interface{}) int {
+	limit, err := strconv.Atoi(args["--limit"].(string))
+	if err != nil {
+		fmt.Println("--limit should be a number.")
+		os.Exit(exitUsage)
+	}
+
+	return limit
+}
+
+func showProjects(
+	api stash.Api, filter string, limit int, all bool, format listFormat,
+) {
+	projects, err := api.ListProjects(filter, limit, all)
+	if err != nil {
+		logger.Critical("can not list projects: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	if !format.isTable() {
+		columns := listColumns{
+			"key":         func(i int) string { return projects[i].Key },
+			"name":        func(i int) string { return projects[i].Name },
+			"description": func(i int) string { return projects[i].Description },
+		}
+
+		printListRecords(format, len(projects),
+			func(i int) interface{} { return projects[i] },
+			columns, []string{"key", "name"},
+		)
+		return
+	}
+
+	writer := newTableWriter(os.Stdout)
+
+	for _, project := range projects {
+		fmt.Fprintf(writer, "%s\t%s\n", project.Key, project.Name)
+	}
+
+	writer.Flush()
+}
+
+func showReposInProject(
+	project stash.Project, limit int, all bool, format listFormat,
+) {
+	repos, err := project.ListRepos(limit, all)
+	if err != nil {
+		logger.Critical("can not list repos: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	if !format.isTable() {
+		columns := listColumns{
+			"slug": func(i int) string { return repos[i].Slug },
+			"name": func(i int) string { return repos[i].Name },
+			"clone": func(i int) string {
+				return getCloneURL(repos[i])
+			},
+			"branch": func(i int) string {
+				repo := project.GetRepo(repos[i].Slug)
+
+				defaultBranch, err := repo.GetDefaultBranch()
+				if err != nil {
+					logger.Warning(
+						"can not get default branch of %s: %s",
+						repos[i].Slug, err.Error(),
+					)
+				}
+
+				return defaultBranch
+			},
+		}
+
+		printListRecords(format, len(repos),
+			func(i int) interface{} { return repos[i] },
+			columns, []string{"slug", "clone", "branch"},
+		)
+		return
+	}
+
+	writer := newTableWriter(os.Stdout)
+
+	for _, info := range repos {
+		repo := project.GetRepo(info.Slug)
+
+		defaultBranch, err := repo.GetDefaultBranch()
+		if err != nil {
+			logger.Warning(
+				"can not get default branch of %s: %s", info.Slug, err.Error(),
+			)
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\n",
+			info.Slug, getCloneURL(info), defaultBranch,
+		)
+	}
+
+	writer.Flush()
+}
+
+// getCloneURL returns clone URL of repo, ssh one is preferred.
+func getCloneURL(info stash.RepoInfo) string {
+	cloneURL := ""
+	for _, link := range info.Links.Clone {
+		if cloneURL == "" || link.Name == "ssh" {
+			cloneURL = link.Href
+		}
+	}
+
+	return cloneURL
+}
+
+func createPullRequest(
+	repo stash.Repo, editor string, from string, to string, openWeb bool,
+) {
+	if editor == "" {
+		fmt.Println("Editor should be specified to create pull request.")
+		os.Exit(exitUsage)
+	}
+
+	text, err := editTextInEditor(
+		editor, "pull-request.txt", "", pullRequestTextHint,
+	)
+	if err != nil {
+		logger.Critical("error reading pull request text: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	if text == "" {
+		fmt.Println("Empty title, pull request is not created.")
+		os.Exit(exitNoChanges)
+	}
+
+	title, description := splitPullRequestText(text)
+
+	logger.Debug("Creating pr from %s to %s", from, to)
+	pr, err := repo.CreatePullRequest(title, description, from, to)
+	if err != nil {
+		logger.Critical("error creating pull request: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	printInfo("Pull request #%d successfully created", pr.Id)
+	if len(pr.Links.Self) > 0 {
+		fmt.Println(pr.Links.Self[0].Href)
+
+		if openWeb {
+			openURL(pr.Links.Self[0].Href)
+		}
+	}
+}
+
+func splitPullRequestText(text string) (title string, description string) {
+	parts := strings.SplitN(text, "\n", 2)
+
+	title = strings.TrimSpace(parts[0])
+	if len(parts) > 1 {
+		description = strings.TrimSpace(parts[1])
+	}
+
+	return title, description
+}
+
+// pullRequestListItem is a pull request along with additional data, which
+// is requested separately for listing.
+type pullRequestListItem struct {
+	stash.PullRequest
+	unreviewed  bool
+	buildStatus string
+	mergeStatus string
+	counts      string
+}
+
+// Unreviewed, BuildStatus and MergeStatus make statuses of listed pull
+// request available in --format template.
+func (item pullRequestListItem) Unreviewed() bool {
+	return item.unreviewed
+}
+
+func (item pullRequestListItem) BuildStatus() string {
+	return item.buildStatus
+}
+
+func (item pullRequestListItem) MergeStatus() string {
+	return item.mergeStatus
+}
+
+func (item pullRequestListItem) Counts() string {
+	return item.counts
+}
+
+type reviewsListOptions struct {
+	state         string
+	limit         int
+	all           bool
+	withDesc      bool
+	withBuilds    bool
+	withConflicts bool
+	withCounts    bool
+	absoluteDate  bool
+
+	// key to sort listed pull requests by, they are listed in order
+	// returned by Stash if empty
+	sort    string
+	reverse bool
+
+	filter pullRequestFilter
+
+	// number of concurrent requests for additional data
+	jobs int
+
+	// number of activities retrieved to count threads
+	activitiesLimit int
+
+	format listFormat
+}
+
+func showReviewsInRepo(repo stash.Repo, options reviewsListOptions) {
+	// sorting and client-side filtering only make sense across all pull
+	// requests, not a page
+	all := options.all || options.sort != "" || options.filter.isClientSide()
+
+	reviews, err := repo.ListPullRequestTo(
+		options.state, options.filter.target, options.limit, all,
+	)
+
+	if err != nil {
+		logger.Critical("can not list reviews: %s", err.Error())
+	}
+
+	reviews = filterPullRequests(reviews, options.filter)
+
+	sortPullRequests(reviews, options.sort, options.reverse)
+
+	printPullRequestList(repo, reviews, options)
+}
+
+// printPullRequestList prints pull requests of repo in the ls-reviews
+// format.
+func printPullRequestList(
+	repo stash.Repo, reviews []stash.PullRequest, options reviewsListOptions,
+) {
+	items := make([]pullRequestListItem, len(reviews))
+	for i, r := range reviews {
+		items[i] = pullRequestListItem{PullRequest: r}
+	}
+
+	if options.withBuilds || options.withConflicts || options.withCounts {
+		enrichListItems(repo, items, options)
+	}
+
+	if !options.format.isTable() {
+		printListRecords(options.format, len(items),
+			func(i int) interface{} { return items[i] },
+			getPullRequestColumns(items), defaultPullRequestColumns,
+		)
+		return
+	}
+
+	printPullRequestTable(os.Stdout, items, pullRequestPrintOptions{
+		withDesc:     options.withDesc,
+		printStatus:  true,
+		absoluteDate: options.absoluteDate,
+	})
+}
+
+// enrichListItems requests build and merge statuses of the listed pull
+// requests concurrently, using limited number of workers to not overload
+// Stash.
+func enrichListItems(
+	repo stash.Repo, items []pullRequestListItem, options reviewsListOptions,
+) {
+	indexes := make(chan int)
+
+	workers := sync.WaitGroup{}
+	for i := 0; i < options.jobs && i < len(items); i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for index := range indexes {
+				item := &items[index]
+
+				if options.withBuilds {
+					item.buildStatus = getBuildStatus(
+						*repo.Api, item.GetLatestCommit(),
+					)
+				}
+
+				if options.withConflicts {
+					item.mergeStatus = getMergeStatus(
+						repo.GetPullRequest(item.Id),
+					)
+				}
+
+				if options.withCounts {
+					item.counts = getDiscussionCounts(
+						repo.GetPullRequest(item.Id), options.activitiesLimit,
+					)
+				}
+			}
+		}()
+	}
+
+	for index := range items {
+		indexes <- index
+	}
+
+	close(indexes)
+
+	workers.Wait()
+}
+
+func getMergeStatus(pr stash.PullRequest) string {
+	status, err := pr.GetMergeStatus()
+	switch {
+	case err != nil:
+		logger.Warning(
+			"can not get merge status of %d: %s", pr.Id, err.Error(),
+		)
+
+		return "?"
+	case status.Conflicted:
+		return "conflicted"
+	case !status.CanMerge:
+		return "blocked"
+	default:
+		return "mergeable"
+	}
+}
+
+func getBuildStatus(api stash.Api, commit string) string {
+	stats, err := api.GetBuildStats(commit)
+	if err != nil {
+		logger.Warning(
+			"can not get build status of %s: %s", commit, err.Error(),
+		)
+
+		return "?"
+	}
+
+	return stats.String()
+}
+
+type pullRequestPrintOptions struct {
+	withDesc     bool
+	printStatus  bool
+	absoluteDate bool
+
+	// widths which branch and author are truncated to with ellipsis, zero
+	// means that they are not truncated
+	branchWidth int
+	authorWidth int
+}
+
+// printPullRequestTable prints pull requests aligned in columns. Branch and
+// author columns are truncated to fit width of terminal, if output is one.
+func printPullRequestTable(
+	output *os.File, items []pullRequestListItem,
+	options pullRequestPrintOptions,
+) {
+	if isTerminal(output) {
+		options = fitPullRequestColumns(items, options, getTerminalWidth())
+	}
+
+	writer := newTableWriter(output)
+	for _, item := range items {
+		printPullRequest(writer, item, options)
+	}
+
+	writer.Flush()
+}
+
+// fitPullRequestColumns returns options with branch and author widths, so
+// table of pull requests does not exceed given width. Longer of columns is
+// truncated first, but not shorter than minimal width.
+func fitPullRequestColumns(
+	items []pullRequestListItem, options pullRequestPrintOptions, width int,
+) pullRequestPrintOptions {
+	measured := options
+	measured.withDesc = false
+
+	buffer := &bytes.Buffer{}
+	writer := newTableWriter(buffer)
+	branchWidth, authorWidth := 0, 0
+	for _, item := range items {
+		printPullRequest(writer, item, measured)
+
+		if width := displayWidth(getBranchName(item.FromRef.Id)); width > branchWidth {
+			branchWidth = width
+		}
+
+		if width := displayWidth(item.Author.User.Name); width > authorWidth {
+			authorWidth = width
+		}
+	}
+
+	writer.Flush()
+
+	tableWidth := 0
+	for _, line := range strings.Split(buffer.String(), "\n") {
+		if displayWidth(line) > tableWidth {
+			tableWidth = displayWidth(line)
+		}
+	}
+
+	if tableWidth <= width {
+		return options
+	}
+
+	widths := shrinkColumns(
+		[]int{branchWidth, authorWidth},
+		[]int{minBranchWidth, minAuthorWidth},
+		tableWidth-width,
+	)
+
+	options.branchWidth, options.authorWidth = widths[0], widths[1]
+
+	return options
+}
+
+func printPullRequest(
+	writer io.Writer, item pullRequestListItem,
+	options pullRequestPrintOptions,
+) {
+	pr := item.PullRequest
+
+	slug := fmt.Sprintf("%s/%s/%d",
+		strings.ToLower(pr.FromRef.Repository.Project.Key),
+		pr.FromRef.Repository.Slug,
+		pr.Id,
+	)
+
+	// marks pull requests which got new commits since last review
+	if item.unreviewed {
+		slug += " *"
+	}
+
+	// slug is padded before it is colored, because padding counts escape
+	// sequences
+	slug = fmt.Sprintf("%-30s", slug)
+	if item.unreviewed {
+		slug = colors.paint("unreviewed", slug)
+	}
+
+	fmt.Fprint(writer, slug)
+
+	fmt.Fprintf(writer, "\t%s",
+		colors.paint("branch", truncateToWidth(
+			getBranchName(pr.FromRef.Id), options.branchWidth,
+		)),
+	)
+
+	fmt.Fprintf(writer,
+		"\t%8s %s",
+		formatDate(pr.UpdatedDate, options.absoluteDate),
+		truncateToWidth(pr.Author.User.Name, options.authorWidth),
+	)
+
+	reviewers := countReviewers(pr)
+
+	fmt.Fprintf(
+		writer,
+		"\t%3d %d✓ %d✗ %d·",
+		pr.Properties.CommentCount,
+		reviewers.approved, reviewers.needsWork, reviewers.unreviewed,
+	)
+
+	if options.printStatus {
+		fmt.Fprintf(writer, " %s",
+			colors.paint(strings.ToLower(pr.State), pr.State),
+		)
+	}
+
+	if item.buildStatus != "" {
+		fmt.Fprintf(writer, "\t%s", item.buildStatus)
+	}
+
+	if item.mergeStatus != "" {
+		fmt.Fprintf(writer, "\t%s", item.mergeStatus)
+	}
+
+	if item.counts != "" {
+		fmt.Fprintf(writer, "\t%s", item.counts)
+	}
+
+	fmt.Fprintf(writer, "\t%s\n", strings.Join(reviewers.pending, " "))
+
+	if options.withDesc && pr.Description != "" {
+		fmt.Fprintln(writer, fmt.Sprintf("\n---\n%s\n---", pr.Description))
+	}
+}
+
+// getBranchName returns short name of branch by its ref id.
+func getBranchName(ref string) string {
+	refSegments := strings.Split(ref, "/")
+	return refSegments[len(refSegments)-1]
+}
+
+type reviewersCount struct {
+	approved   int
+	needsWork  int
+	unreviewed int
+
+	// reviewers, which have not approved pull request yet
+	pending []string
+}
+
+func countReviewers(pr stash.PullRequest) reviewersCount {
+	count := reviewersCount{}
+	for _, reviewer := range pr.Reviewers {
+		switch getReviewerStatus(reviewer.Status, reviewer.Approved) {
+		case stash.ParticipantApproved:
+			count.approved += 1
+			continue
+		case stash.ParticipantNeedsWork:
+			count.needsWork += 1
+		default:
+			count.unreviewed += 1
+		}
+
+		count.pending = append(count.pending, reviewer.User.Name)
+	}
+
+	sort.Strings(count.pending)
+
+	return count
+}
+
+var defaultPullRequestColumns = []string{
+	"project", "repo", "id", "title", "author", "branch", "state",
+	"updated", "comments", "approved", "needs-work", "pending",
+}
+
+// getPullRequestColumns returns columns of listed pull requests for tsv
+// and csv formats.
+func getPullRequestColumns(items []pullRequestListItem) listColumns {
+	return listColumns{
+		"project": func(i int) string {
+			return items[i].FromRef.Repository.Project.Key
+		},
+		"repo": func(i int) string {
+			return items[i].FromRef.Repository.Slug
+		},
+		"id": func(i int) string {
+			return fmt.Sprint(items[i].Id)
+		},
+		"title": func(i int) string {
+			return items[i].Title
+		},
+		"description": func(i int) string {
+			return items[i].Description
+		},
+		"author": func(i int) string {
+			return items[i].Author.User.Name
+		},
+		"branch": func(i int) string {
+			return getBranchName(items[i].FromRef.Id)
+		},
+		"state": func(i int) string {
+			return items[i].State
+		},
+		"created": func(i int) string {
+			return formatTime(items[i].CreatedDate.AsTime(), time.RFC3339)
+		},
+		"updated": func(i int) string {
+			return formatTime(items[i].UpdatedDate.AsTime(), time.RFC3339)
+		},
+		"comments": func(i int) string {
+			return fmt.Sprint(items[i].Properties.CommentCount)
+		},
+		"approved": func(i int) string {
+			return fmt.Sprint(countReviewers(items[i].PullRequest).approved)
+		},
+		"needs-work": func(i int) string {
+			return fmt.Sprint(countReviewers(items[i].PullRequest).needsWork)
+		},
+		"pending": func(i int) string {
+			return strings.Join(countReviewers(items[i].PullRequest).pending, " ")
+		},
+		"unreviewed": func(i int) string {
+			return fmt.Sprint(items[i].unreviewed)
+		},
+		"build": func(i int) string {
+			return items[i].buildStatus
+		},
+		"merge": func(i int) string {
+			return items[i].mergeStatus
+		},
+		"counts": func(i int) string {
+			return items[i].counts
+		},
+		"url": func(i int) string {
+			if len(items[i].Links.Self) == 0 {
+				return ""
+			}
+
+			return items[i].Links.Self[0].Href
+		},
+	}
+}
+
+func parseUri(args map[string]interface{}) (
+	result struct {
+		base    string
+		project string
+		repo    string
+		pr      int64
+	},
+) {
+	uri := ""
+	keyName := ""
+	should := 0
+
+	if args["<project>/<repo>/<pr>"] != nil {
+		keyName = "<project>/<repo>/<pr>"
+		uri = args[keyName].(string)
+		should = 3
+	}
+
+	if args["<project>/<repo>"] != nil {
+		keyName = "<project>/<repo>"
+		uri = args[keyName].(string)
+		should = 2
+	}
+
+	if args["<project>"] != nil {
+		keyName = "<project>"
+		uri = args[keyName].(string)
+		should = 1
+	}
+
+	matches := reStashURL.FindStringSubmatch(uri)
+	if len(matches) != 0 {
+		result.base = matches[1]
+		result.project = matches[2]
+		result.repo = matches[5]
+		result.pr, _ = strconv.ParseInt(matches[6], 10, 16)
+
+		return result
+	}
+
+	if args["--url"] == nil {
+		fmt.Println(
+			"In case of shorthand syntax --url should be specified")
+		os.Exit(exitUsage)
+	}
+
+	if should == 0 {
+		result.base = args["--url"].(string)
+		return
+	}
+
+	matches = strings.Split(uri, "/")
+
+	result.base = args["--url"].(string)
+
+	if len(matches) == 2 && should == 3 && args["--project"] != nil {
+		result.repo = matches[0]
+		result.pr, _ = strconv.ParseInt(matches[1], 10, 16)
+	}
+
+	if args["--project"] != nil {
+		result.project = args["--project"].(string)
+	}
+
+	if len(matches) == 1 && should == 1 {
+		result.project = matches[0]
+	}
+
+	if len(matches) == 1 && should == 2 {
+		result.repo = matches[0]
+	}
+
+	if len(matches) == 2 && should == 2 {
+		result.project = matches[0]
+		result.repo = matches[1]
+	}
+
+	if len(matches) >= 3 && should == 3 {
+		result.project = matches[0]
+		result.repo = matches[1]
+		result.pr, _ = strconv.ParseInt(matches[2], 10, 16)
+	}
+
+	enough := result.project != "" && (result.repo != "" || should == 1) &&
+		(result.pr != 0 || should <= 2)
+
+	if !enough {
+		fmt.Println(
+			"<pull-request> should be in either:\n" +
+				" - URL Format: " + startUrlExample + "\n" +
+				" - Shorthand format: " + keyName,
+		)
+		os.Exit(exitUsage)
+	}
+
+	result.project = getProjectPath(result.project)
+
+	return result
+}
+
+// getProjectPath returns path of project in Stash API by its key; personal
+// projects are given as '~user'.
+func getProjectPath(key string) string {
+	if key[0] == '~' || key[0] == '%' {
+		return "users/" + key[1:]
+	}
+
+	return "projects/" + key
+}
+
+// getBaseURL adds scheme to the Stash URL given as <host>[:<port>]. Scheme
+// of the full URL is kept as is.
+func getBaseURL(base string, scheme string) (string, error) {
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme '%s'", scheme)
+	}
+
+	if !strings.Contains(base, "://") {
+		base = scheme + "://" + base
+	}
+
+	return strings.TrimSuffix(base, "/"), nil
+}
+
+func editReviewInEditor(
+	editor string, editorArgs []string, reviewToEdit *stash.Review, fileToUse *os.File,
+) ([]stash.ReviewChange, error) {
+	if editor == "" {
+		fileToUse.Close()
+
+		fmt.Printf("%s", fileToUse.Name())
+		exitSucceeded()
+	}
+
+	logger.Debug("opening editor: %s %s", editor, strings.Join(editorArgs, " "))
+	editorCmd := exec.Command(editor, editorArgs...)
+	editorCmd.Stdin = os.Stdin
+	editorCmd.Stdout = os.Stdout
+	editorCmd.Stderr = os.Stderr
+
+	err := editorCmd.Run()
+	if err != nil {
+		logger.Critical("%s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	fileToUse.Sync()
+	fileToUse.Seek(0, os.SEEK_SET)
+
+	logger.Debug("reading modified review back")
+	editedReview, err := stash.ReadReview(fileToUse)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("comparing old and new reviews")
+	return reviewToEdit.Compare(editedReview), nil
+}
+
+func editTextInEditor(
+	editor string, fileName string, text string, hint string,
+) (string, error) {
+	filePath := tmpWorkDir + "/" + fileName
+
+	err := ioutil.WriteFile(filePath, []byte(text+"\n"+hint), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	logger.Debug("opening editor: %s %s", editor, filePath)
+	editorCmd := exec.Command(editor, filePath)
+	editorCmd.Stdin = os.Stdin
+	editorCmd.Stdout = os.Stdout
+	editorCmd.Stderr = os.Stderr
+
+	err = editorCmd.Run()
+	if err != nil {
+		return "", err
+	}
+
+	edited, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(string(edited), "\n") {
+		if strings.HasPrefix(line, "###") {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+func mergeArgsWithConfig(path string) []string {
+	args := make([]string, 0)
+
+	profile := getArgValue(os.Args[1:], "--profile")
+
+	conf, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		logger.Warning("can not access config: %s", err.Error())
+	} else {
+		args = parseConfig(string(conf)).getArgs(profile, os.Args[1:])
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		logger.Warning("can not get current directory: %s", err.Error())
+	} else if localPath := findLocalConfig(cwd); localPath != "" {
+		localConf, err := ioutil.ReadFile(localPath)
+		if err != nil {
+			logger.Warning("can not access local config: %s", err.Error())
+		} else {
+			logger.Info("local config is found at %s", localPath)
+			args = overrideArgs(
+				args,
+				parseConfig(string(localConf)).getArgs(profile, os.Args[1:]),
+			)
+		}
+	}
+
+	args = overrideArgs(args, getEnvArgs())
+	args = overrideArgs(args, os.Args[1:])
+
+	return args
+}
+
+// showFilesList prints changed files of pull request. Lines are counted
+// only if they are requested, because whole diff of pull request should be
+// downloaded for that.
+func showFilesList(
+	pr stash.PullRequest, excludes []string, format listFormat, lines bool,
+) {
+	logger.Debug("showing list of files in PR")
+	files, err := pr.GetFiles(stash.DiffOptions{})
+	if err != nil {
+		logger.Error("error accessing Stash: %s", err.Error())
+	}
+
+	files = files.Exclude(excludes)
+
+	if !format.isTable() {
+		lines = format.usesColumn("added", "Added") ||
+			format.usesColumn("removed", "Removed")
+	}
+
+	if lines {
+		changeset, err := pr.GetDiff()
+		if err != nil {
+			logger.Warning("can not count changed lines: %s", err.Error())
+		} else {
+			files.CountLines(changeset)
+		}
+	}
+
+	if !format.isTable() {
+		columns := listColumns{
+			"change": func(i int) string { return files[i].ChangeType },
+			"path":   func(i int) string { return files[i].DstPath },
+			"source": func(i int) string { return files[i].SrcPath },
+			"type":   func(i int) string { return files[i].Type },
+			"exec":   func(i int) string { return fmt.Sprint(files[i].DstExec) },
+			"added": func(i int) string {
+				return fmt.Sprint(files[i].Added)
+			},
+			"removed": func(i int) string {
+				return fmt.Sprint(files[i].Removed)
+			},
+		}
+
+		printListRecords(format, len(files),
+			func(i int) interface{} { return files[i] },
+			columns, []string{"change", "path"},
+		)
+		return
+	}
+
+	if !lines {
+		for _, file := range files {
+			fmt.Printf("%7s %s%s\n",
+				file.ChangeType, file.DstPath, getExecFlag(file),
+			)
+		}
+
+		return
+	}
+
+	added, removed := 0, 0
+
+	writer := newTableWriter(os.Stdout)
+	for _, file := range files {
+		fmt.Fprintf(writer, "%7s\t%s\t%s\t%s%s\n",
+			file.ChangeType,
+			colors.paint("added", fmt.Sprintf("+%d", file.Added)),
+			colors.paint("removed", fmt.Sprintf("-%d", file.Removed)),
+			file.DstPath, getExecFlag(file),
+		)
+
+		added += file.Added
+		removed += file.Removed
+	}
+
+	fmt.Fprintf(writer, "%7s\t+%d\t-%d\t%d files\n",
+		"total", added, removed, len(files),
+	)
+
+	writer.Flush()
+}
+
+// getExecFlag returns +x or -x if executable bit of file is changed.
+func getExecFlag(file stash.ReviewFile) string {
+	switch {
+	case file.DstExec == file.SrcExec:
+		return ""
+	case file.DstExec:
+		return " +x"
+	default:
+		return " -x"
+	}
+}
+
+func showCommitsList(pr stash.PullRequest, limit int, all bool, format listFormat) {
+	logger.Debug("showing list of commits in PR")
+	commits, err := pr.GetCommits(limit, all)
+	if err != nil {
+		logger.Critical("error accessing Stash: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	if !format.isTable() {
+		columns := listColumns{
+			"id":    func(i int) string { return commits[i].Id },
+			"short": func(i int) string { return commits[i].DisplayId },
+			"author": func(i int) string {
+				return commits[i].Author.Name
+			},
+			"email": func(i int) string {
+				return commits[i].Author.EmailAddress
+			},
+			"date": func(i int) string {
+				return formatTime(
+					commits[i].AuthorTimestamp.AsTime(), time.RFC3339,
+				)
+			},
+			"subject": func(i int) string { return commits[i].Subject() },
+			"message": func(i int) string { return commits[i].Message },
+		}
+
+		printListRecords(format, len(commits),
+			func(i int) interface{} { return commits[i] },
+			columns, []string{"short", "author", "date", "subject"},
+		)
+		return
+	}
+
+	writer := newTableWriter(os.Stdout)
+
+	for _, commit := range commits {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n",
+			commit.DisplayId,
+			commit.Author.Name,
+			commit.AuthorTimestamp,
+			commit.Subject(),
+		)
+	}
+
+	writer.Flush()
+}
+
+// showDiff prints diff of specified file or of the whole pull request
+// along with comments without opening editor.
+func showDiff(
+	service stash.PullRequestService, paths []string, diff stash.DiffOptions,
+	renderer stash.ReviewRenderer,
+) {
+	var review *stash.Review
+	var err error
+
+	if len(paths) == 0 {
+		logger.Debug("downloading review of all files from Stash")
+		review, err = service.GetFullReview(diff)
+	} else {
+		logger.Debug("downloading review from Stash")
+		review, err = service.GetFilesReview(paths, diff)
+	}
+
+	if err != nil {
+		logger.Critical("can not get diff: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	if review == nil {
+		fmt.Fprintln(os.Stderr, "Pull request not found.")
+		os.Exit(exitNotFound)
+	}
+
+	if review.IsBinary() {
+		showBinaryChanges(service, review)
+		exitSucceeded()
+	}
+
+	if len(review.Changeset.Diffs) == 0 {
+		fmt.Println("Specified file is not found in pull request.")
+		os.Exit(exitNotFound)
+	}
+
+	err = renderer.Render(review, os.Stdout)
+	if err != nil {
+		logger.Critical("can not show diff: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+}
+
+// showBinaryChanges prints how size of binary files is changed, because
+// Stash does not return diff of binary files.
+func showBinaryChanges(
+	service stash.PullRequestService, review *stash.Review,
+) {
+	for _, diff := range review.Changeset.Diffs {
+		path := diff.Destination.ToString
+		if path == "" {
+			path = diff.Source.ToString
+		}
+
+		oldSize, err := service.GetFileSize(
+			diff.Source.ToString, review.Changeset.FromHash,
+		)
+		if err == nil {
+			var newSize int64
+			newSize, err = service.GetFileSize(
+				diff.Destination.ToString, review.Changeset.ToHash,
+			)
+
+			if err == nil {
+				changed := newSize - oldSize
+				if changed < 0 {
+					changed = -changed
+				}
+
+				fmt.Printf("%s: binary file, %d bytes changed\n", path, changed)
+				continue
+			}
+		}
+
+		logger.Warning("can not get size of %s: %s", path, err.Error())
+
+		fmt.Printf("%s: binary file\n", path)
+	}
+}
+
+func review(
+	target reviewTarget, editor string, editorArgsTemplate string,
+	paths []string, reviewAll bool,
+	origin string, input string, output string,
+	activitiesLimit string,
+	diff stash.DiffOptions,
+	interactiveMode bool,
+	preview stash.ReviewRenderer,
+	offline bool,
+	dryRun bool,
+	templates map[string]string,
+	emoji bool,
+	wrapWidth int,
+	fold stash.FoldOptions,
+	gutter stash.GutterMode,
+) {
+	var review *stash.Review
+	var err error
+
+	if offline && origin == "" {
+		fmt.Println("Pre-fetched review should be given via --origin " +
+			"in offline mode.")
+		os.Exit(exitUsage)
+	}
+
+	if offline && target.stash == nil {
+		fmt.Println("Offline review is supported only for Stash pull requests.")
+		os.Exit(exitUsage)
+	}
+
+	if origin == "" {
+		review = downloadReview(
+			target.service, target.comments,
+			paths, reviewAll, activitiesLimit, diff,
+		)
+	} else {
+		logger.Debug("using origin review from file %s", origin)
+		originFile, err := os.Open(origin)
+		if err != nil {
+			logger.Critical("%s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		defer originFile.Close()
+
+		review, err = stash.ReadReview(originFile)
+		if err != nil {
+			logger.Critical("%s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		if len(paths) == 0 && !reviewAll {
+			review.IsOverview = true
+		}
+
+		review.IsMultiFile = reviewAll || stash.IsMultiFilePaths(paths)
+	}
+
+	if err != nil {
+		logger.Critical("%s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	review.WrapComments(wrapWidth)
+
+	if preview != nil {
+		err = preview.Render(review, os.Stdout)
+		if err != nil {
+			logger.Critical("can not show review: %s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		return
+	}
+
+	review.Fold(fold)
+	review.ShowLineNumbers(gutter)
+
+	var changes []stash.ReviewChange
+	var fileToUse *os.File
+	var reviewDraft *draft
+
+	draftPath := getDraftPath(target, paths, reviewAll)
+
+	defer func() {
+		if r := recover(); r != nil {
+			panicState = true
+			printPanicMsg(r, fileToUse.Name())
+		}
+	}()
+
+	if input != "" {
+		logger.Debug("reading review from file %s", input)
+
+		fileToUse, err = os.Open(input)
+		if err != nil {
+			logger.Critical("%s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		editedReview, err := stash.ReadReview(fileToUse)
+
+		if err != nil {
+			panic(err)
+		}
+
+		logger.Debug("comparing old and new reviews")
+		changes = review.Compare(editedReview)
+
+		if isDraftPath(input, draftPath) {
+			reviewDraft = &draft{path: draftPath}
+		}
+	} else {
+		reviewURL := ""
+		if offline {
+			reviewURL = getPullRequestURL(*target.stash)
+		} else {
+			pullRequestInfo, err := target.service.GetInfo()
+			if err != nil {
+				fmt.Printf("Error while obtaining pull request info: %s\n", err)
+				os.Exit(getErrorExitCode(err))
+			}
+
+			reviewURL = pullRequestInfo.Links.Self[0].Href
+		}
+
+		printFileName := false
+		writeAndExit := false
+
+		if output == "" {
+			output = tmpWorkDir + "/review.diff"
+		} else if output == "-" {
+			writeAndExit = true
+			printFileName = true
+			output = tmpWorkDir + "/review.diff"
+		} else {
+			writeAndExit = true
+		}
+
+		selected := paths
+		if reviewAll {
+			selected = nil
+		}
+
+		fileToUse, err = WriteReviewToFile(reviewURL, review, output, selected)
+
+		if err != nil {
+			logger.Critical("%s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		if writeAndExit {
+			if printFileName {
+				fmt.Println(output)
+			}
+
+			exitSucceeded()
+		}
+
+		warnAboutDraft(draftPath)
+
+		reviewDraft = startDraft(fileToUse.Name(), draftPath)
+
+		editorArgs := getEditorArgs(
+			editor, editorArgsTemplate,
+			fileToUse.Name(), getFirstHunkLine(fileToUse.Name()),
+		)
+
+		changes, err = editReviewInEditor(
+			editor, editorArgs, review, fileToUse,
+		)
+
+		reviewDraft.Stop()
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if len(changes) == 0 {
+		logger.Info("no changes detected in review file (maybe a bug)")
+
+		// review can still vote for labels without comments, but votes are
+		// not published silently, since quitting editor without changes is
+		// the way to abort review
+		publisher, ok := target.comments.(stash.ReviewPublisher)
+		if ok && !dryRun && publisher.HasPending() && askConfirmation(
+			"Review file is not changed, publish votes anyway?", false,
+		) {
+			err := publisher.Publish()
+			if err != nil {
+				logger.Critical("can not publish review: %s", err.Error())
+				os.Exit(getErrorExitCode(err))
+			}
+		}
+
+		// there is nothing to resume
+		reviewDraft.Remove()
+
+		os.Exit(exitNoChanges)
+	}
+
+	expandChangesTemplates(changes, templates)
+
+	if emoji {
+		expandChangesEmoji(changes)
+	}
+
+	if dryRun {
+		printChanges(changes)
+		printInfo("Dry run, changes are not applied")
+		return
+	}
+
+	selected := changes
+
+	// queued review can not contain only part of changes, so it is
+	// confirmed as a whole
+	if interactiveMode && offline {
+		printChanges(changes)
+
+		fmt.Print("\n---\n")
+		if !askConfirmation("Is that what you want to do?", true) {
+			reviewDraft.Remove()
+			os.Exit(exitNoChanges)
+		}
+	}
+
+	if interactiveMode && !offline {
+		selected = selectChanges(editor, changes)
+		if len(selected) == 0 {
+			fmt.Println("No changes selected, review is not applied.")
+			reviewDraft.Remove()
+			os.Exit(exitNoChanges)
+		}
+	}
+
+	if offline {
+		queueOfflineReview(
+			*target.stash, paths, reviewAll, wrapWidth, origin, fileToUse.Name(),
+		)
+		reviewDraft.Remove()
+		return
+	}
+
+	applied := applyChanges(target.comments, selected)
+	if applied && reviewAll && !review.IsOverview {
+		rememberReviewedCommit(target, diff)
+	}
+
+	if applied && len(selected) == len(changes) {
+		reviewDraft.Remove()
+	} else if reviewDraft != nil {
+		logger.Info("review is kept in draft %s", draftPath)
+	}
+
+	if !applied {
+		os.Exit(exitPartialApply)
+	}
+}
+
+func getTemplates(args map[string]interface{}) map[string]string {
+	templates, err := loadTemplates(getTemplatesDir(args))
+	if err != nil {
+		logger.Critical("can not load templates: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	return templates
+}
+
+func printChanges(changes []stash.ReviewChange) {
+	for i, change := range changes {
+		fmt.Printf("%d. %s\n\n", i+1, change.String())
+	}
+}
+
+// selectChanges asks user about every change whether it should be applied,
+// skipped or edited before applying, like 'git add -p' does.
+func selectChanges(editor string, changes []stash.ReviewChange) []stash.ReviewChange {
+	selected := []stash.ReviewChange{}
+
+	for i, change := range changes {
+	asking:
+		for {
+			fmt.Printf("(%d/%d) %s\n\n", i+1, len(changes), change.String())
+
+			switch askChangeAction("Apply this change?") {
+			case "y":
+				selected = append(selected, change)
+				break asking
+			case "n":
+				break asking
+			case "e":
+				edited, err := editChange(editor, change)
+				if err != nil {
+					fmt.Printf("Change is not edited: %s.\n\n", err.Error())
+					continue
+				}
+
+				change = edited
+			case "q":
+				return selected
+			}
+		}
+	}
+
+	return selected
+}
+
+func askChangeAction(question string) string {
+	for {
+		fmt.Printf("%s [y,n,e,q,?] ", question)
+		answer, err := stdin.ReadString('\n')
+
+		switch answer = strings.TrimSpace(answer); answer {
+		case "y", "n", "e", "q":
+			return answer
+		default:
+			// stdin is closed, so nothing else can be answered
+			if err != nil {
+				fmt.Println()
+				return "q"
+			}
+
+			fmt.Println("y - apply this change")
+			fmt.Println("n - do not apply this change")
+			fmt.Println("e - edit text of this change before applying")
+			fmt.Println("q - quit; do not apply this change or any of " +
+				"the remaining ones")
+		}
+	}
+}
+
+// editChange opens text of the new or modified comment or task in editor.
+func editChange(editor string, change stash.ReviewChange) (stash.ReviewChange, error) {
+	if editor == "" {
+		return nil, fmt.Errorf("editor is not specified")
+	}
+
+	text := ""
+
+	task, isTask := change.(stash.TaskAdded)
+	comment := stash.GetChangeComment(change)
+
+	switch {
+	case isTask:
+		text = task.Text
+	case comment != nil:
+		text = comment.Text
+	default:
+		return nil, fmt.Errorf("only added and modified text can be edited")
+	}
+
+	text, err := editTextInEditor(editor, "change.txt", text, changeTextHint)
+	if err != nil {
+		return nil, err
+	}
+
+	if text == "" {
+		return nil, fmt.Errorf("text can not be empty")
+	}
+
+	if isTask {
+		task.Text = text
+		return task, nil
+	}
+
+	comment.Text = text
+
+	return change, nil
+}
+
+// downloadReview gets review of given files, of all files or overview of
+// pull request with its tasks, which is written to the review file.
+func downloadReview(
+	service stash.PullRequestService, comments stash.CommentService,
+	paths []string, reviewAll bool, activitiesLimit string,
+	diff stash.DiffOptions,
+) *stash.Review {
+	var review *stash.Review
+	var err error
+
+	switch {
+	case reviewAll:
+		logger.Debug("downloading review of all files from Stash")
+		review, err = service.GetFullReview(diff)
+	case len(paths) == 0:
+		logger.Debug("downloading overview from Stash")
+		review, err = service.GetActivities(activitiesLimit)
+	default:
+		logger.Debug("downloading review from Stash")
+		review, err = service.GetFilesReview(paths, diff)
+	}
+
+	if err != nil {
+		logger.Critical("can not get diff: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	if review == nil {
+		fmt.Fprintln(os.Stderr, "Pull request not found.")
+		os.Exit(exitNotFound)
+	}
+
+	if review.IsBinary() {
+		showBinaryChanges(service, review)
+		exitSucceeded()
+	}
+
+	if len(review.Changeset.Diffs) == 0 {
+		fmt.Println("Specified file is not found in pull request.")
+		os.Exit(exitNotFound)
+	}
+
+	logger.Debug("downloading tasks from Stash")
+	tasks, err := comments.GetTasks()
+	if err != nil {
+		logger.Warning("can not get tasks: %s", err.Error())
+	} else {
+		review.AddTasks(tasks)
+	}
+
+	review.AddReplyQuotes()
+
+	return review
+}
+
+func applyChanges(
+	comments stash.CommentService, changes []stash.ReviewChange,
+) bool {
+	logger.Debug("applying changes (%d)", len(changes))
+
+	progress := newApplyProgress(len(changes))
+
+	// failed change does not stop applying, so all failures are reported
+	// at once in summary
+	for _, change := range changes {
+		logger.Debug("change payload: %#v", change.GetPayload())
+		err := comments.ApplyChange(change)
+		if err != nil {
+			logger.Debug("can not apply change: %s", err.Error())
+		}
+
+		progress.report(change, err)
+	}
+
+	progress.summarize()
+
+	// changes which are applied are published even if some failed, the
+	// same way as they are posted right away to Stash
+	if publisher, ok := comments.(stash.ReviewPublisher); ok {
+		logger.Debug("publishing review")
+		err := publisher.Publish()
+		if err != nil {
+			logger.Error("can not publish review: %s", err.Error())
+			return false
+		}
+	}
+
+	return len(progress.failures) == 0
+}
+
+func queueOfflineReview(
+	pr stash.PullRequest, paths []string, reviewAll bool, wrapWidth int,
+	origin string, edited string,
+) {
+	originData, err := ioutil.ReadFile(origin)
+	if err != nil {
+		logger.Critical("%s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	editedData, err := ioutil.ReadFile(edited)
+	if err != nil {
+		logger.Critical("%s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	queuedPath, err := queueReview(queuedReview{
+		Host:    pr.URL,
+		Project: pr.Project.Name,
+		Repo:    pr.Repo.Name,
+		PR:      pr.Id,
+		Paths:   paths,
+		All:     reviewAll,
+		Wrap:    wrapWidth,
+		Origin:  string(originData),
+		Edited:  string(editedData),
+		Created: time.Now(),
+	})
+	if err != nil {
+		logger.Critical("can not queue review: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	logger.Debug("review queued in %s", queuedPath)
+
+	printInfo("Review successfully queued, run 'ash push' to send it")
+}
+
+// getPullRequestURL returns web URL of pull request without requesting
+// Stash.
+func getPullRequestURL(pr stash.PullRequest) string {
+	return fmt.Sprintf(
+		"%s/%s/repos/%s/pull-requests/%d",
+		pr.URL, pr.Project.Name, pr.Repo.Name, pr.Id,
+	)
+}
+
+func WriteReviewToFile(
+	url string, review *stash.Review, output string, paths []string,
+) (
+	*os.File, error,
+) {
+	fileToUse, err := os.Create(output)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("writing review to file: %s", fileToUse.Name())
+
+	stash.AddAshModeline(url, review, paths)
+
+	stash.AddUsageComment(review)
+
+	err = stash.AddTableOfContents(review)
+	if err != nil {
+		logger.Warning("can not add table of contents: %s", err.Error())
+	}
+
+	stash.WriteReview(review, fileToUse)
+
+	fileToUse.Sync()
+
+	return fileToUse, nil
+}
+
+func (p CmdLineArgs) Redacted() interface{} {
+	return stash.RedactSecrets(string(p))
+}
+
+func printPanicMsg(r interface{}, reviewFileName string) {
+	fmt.Println()
+	fmt.Println("PANIC:", r)
+	fmt.Println()
+	fmt.Println(string(debug.Stack()))
+	fmt.Println("Well, program has crashed. This is probably a bug.")
+	fmt.Println()
+	fmt.Printf("All data you've entered are kept in the file:\n\t%s",
+		reviewFileName)
+	fmt.Println()
+	fmt.Printf("Debug log of program execution can be found at:\n\t%s",
+		tmpWorkDir+"/debug.log")
+	fmt.Println()
+	fmt.Printf("Feel free to open issue or PR on the:\n\t%s",
+		"https://github.com/seletskiy/ash")
+	fmt.Println()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestAskChangeActionReadsPipedAnswers(t *testing.T) {
+	defer func(reader *bufio.Reader) { stdin = reader }(stdin)
+
+	stdin = bufio.NewReader(strings.NewReader("?\ny\nn"))
+
+	expected := []string{"y", "n", "q", "q"}
+	for _, answer := range expected {
+		actual := askChangeAction("Apply this change?")
+		if actual != answer {
+			t.Fatalf("expected answer %q, got %q", answer, actual)
+		}
+	}
+}
+
+func TestIsFilesList(t *testing.T) {
+	tests := []struct {
+		cmd      []string
+		expected bool
+	}{
+		{[]string{"proj/repo/1", "ls"}, true},
+		{[]string{"proj/repo/1", "reviewers", "ls"}, false},
+		{[]string{"proj/repo/1", "reviewers"}, false},
+	}
+
+	for _, test := range tests {
+		args, err := parseCmdLine(test.cmd)
+		if err != nil {
+			t.Fatalf("can not parse %q: %s", test.cmd, err)
+		}
+
+		actual := isFilesList(args)
+		if actual != test.expected {
+			t.Errorf(
+				"unexpected result for %q: %v, expected %v",
+				test.cmd, actual, test.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+const (
+	ansiBold      = "\x1b[1m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiCyan      = "\x1b[36m"
+	ansiReset     = "\x1b[0m"
+)
+
+var (
+	reMarkdownCode   = regexp.MustCompile("`([^`]+)`")
+	reMarkdownBold   = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	reMarkdownItalic = regexp.MustCompile(
+		`(^|[^\w*])\*([^*\s][^*]*)\*|(^|[^\w_])_([^_\s][^_]*)_`,
+	)
+	reMarkdownLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+	reMarkdownHeader = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	reMarkdownList   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	reMarkdownFence  = regexp.MustCompile("^\\s*```")
+)
+
+// markdownRenderer renders markdown of Stash comments and descriptions in
+// terminal. Without colors markup is just stripped.
+type markdownRenderer struct {
+	color bool
+
+	// renderer is inside fenced code block
+	inCode bool
+}
+
+// renderMarkdown renders whole markdown text.
+func renderMarkdown(text string, color bool) string {
+	renderer := &markdownRenderer{color: color}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = renderer.RenderLine(line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// RenderLine renders next line of the text, state of code blocks is kept
+// between calls, so text can be rendered line by line.
+func (renderer *markdownRenderer) RenderLine(line string) string {
+	if reMarkdownFence.MatchString(line) {
+		renderer.inCode = !renderer.inCode
+		return ""
+	}
+
+	if renderer.inCode {
+		return renderer.style(ansiCyan, "    "+line)
+	}
+
+	if matches := reMarkdownHeader.FindStringSubmatch(line); matches != nil {
+		return renderer.style(ansiBold+ansiUnderline,
+			renderer.renderInline(matches[1]),
+		)
+	}
+
+	if matches := reMarkdownList.FindStringSubmatch(line); matches != nil {
+		line = matches[1] + "• " + matches[2]
+	}
+
+	return renderer.renderInline(line)
+}
+
+func (renderer *markdownRenderer) renderInline(text string) string {
+	// code spans are rendered first and protected from other markup
+	spans := []string{}
+	text = reMarkdownCode.ReplaceAllStringFunc(text, func(span string) string {
+		spans = append(spans, renderer.style(ansiCyan, span[1:len(span)-1]))
+		return "\x00"
+	})
+
+	text = expandLineEmoji(text)
+
+	text = reMarkdownBold.ReplaceAllStringFunc(text, func(bold string) string {
+		return renderer.style(ansiBold, bold[2:len(bold)-2])
+	})
+
+	text = reMarkdownItalic.ReplaceAllStringFunc(text,
+		func(italic string) string {
+			matches := reMarkdownItalic.FindStringSubmatch(italic)
+			if matches[2] != "" {
+				return matches[1] + renderer.style(ansiItalic, matches[2])
+			}
+
+			return matches[3] + renderer.style(ansiItalic, matches[4])
+		})
+
+	text = reMarkdownLink.ReplaceAllStringFunc(text, func(link string) string {
+		matches := reMarkdownLink.FindStringSubmatch(link)
+		return matches[1] + " (" + renderer.style(ansiUnderline, matches[2]) + ")"
+	})
+
+	for _, span := range spans {
+		text = strings.Replace(text, "\x00", span, 1)
+	}
+
+	return text
+}
+
+func (renderer *markdownRenderer) style(style string, text string) string {
+	if !renderer.color {
+		return text
+	}
+
+	return style + text + ansiReset
+}
+
+// previewRenderer renders review in unified format with markdown of
+// comments rendered for the terminal, so review can be read without editor.
+type previewRenderer struct {
+	color bool
+}
+
+func (renderer previewRenderer) Render(review *stash.Review, writer io.Writer) error {
+	buffer := &bytes.Buffer{}
+
+	err := stash.UnifiedRenderer{}.Render(review, buffer)
+	if err != nil {
+		return err
+	}
+
+	markdown := &markdownRenderer{color: renderer.color}
+
+	painter := diffPainter{palette: colors}
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "###") {
+			text := strings.TrimLeft(line[1:], " ")
+			prefix := line[:len(line)-len(text)]
+
+			line = prefix + markdown.RenderLine(text)
+		} else {
+			// comment is finished, so unclosed code block is not continued
+			markdown.inCode = false
+
+			// lines are painted even without colors to keep track of hunks
+			painted := painter.paint(line)
+			if renderer.color {
+				line = painted
+			}
+		}
+
+		_, err = fmt.Fprintln(writer, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderMarkdownWithoutColor(t *testing.T) {
+	actual := renderMarkdown(
+		"# Title\n"+
+			"Use **bold**, _italic_ and `a*b*c` in [docs](http://x/).\n"+
+			"- first\n"+
+			"  * nested\n"+
+			"```\n"+
+			"code **here**\n"+
+			"```\n"+
+			"snake_case_name stays",
+		false,
+	)
+
+	expected := "Title\n" +
+		"Use bold, italic and a*b*c in docs (http://x/).\n" +
+		"• first\n" +
+		"  • nested\n" +
+		"\n" +
+		"    code **here**\n" +
+		"\n" +
+		"snake_case_name stays"
+
+	if actual != expected {
+		t.Fatalf("unexpected markdown rendering\n%q\n%q", expected, actual)
+	}
+}
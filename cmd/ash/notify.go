@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Kinds of pull request activity, which desktop notifications can be sent
+// about.
+const (
+	notifyComments  = "comments"
+	notifyApprovals = "approvals"
+	notifyPushes    = "pushes"
+)
+
+var notifyEventKinds = []string{notifyComments, notifyApprovals, notifyPushes}
+
+// notifier sends desktop notifications about activity of kinds, which are
+// enabled by --notify.
+type notifier struct {
+	events map[string]bool
+	send   func(title string, message string) error
+}
+
+func getNotifier(args map[string]interface{}) notifier {
+	result := notifier{
+		events: map[string]bool{},
+		send:   sendDesktopNotification,
+	}
+
+	if args["--notify"] == nil {
+		return result
+	}
+
+	events, err := parseNotifyEvents(args["--notify"].(string))
+	if err != nil {
+		fmt.Printf("--notify is invalid: %s.\n", err.Error())
+		os.Exit(exitUsage)
+	}
+
+	result.events = events
+
+	return result
+}
+
+// parseNotifyEvents parses comma separated kinds of activity, 'all' enables
+// every kind and 'none' disables notifications.
+func parseNotifyEvents(value string) (map[string]bool, error) {
+	events := map[string]bool{}
+
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.TrimSpace(kind)
+
+		switch {
+		case kind == "" || kind == "none":
+		case kind == "all":
+			for _, kind := range notifyEventKinds {
+				events[kind] = true
+			}
+		case isStringInSlice(kind, notifyEventKinds):
+			events[kind] = true
+		default:
+			return nil, fmt.Errorf(
+				"unknown event '%s', should be one of: %s, all or none",
+				kind, strings.Join(notifyEventKinds, ", "),
+			)
+		}
+	}
+
+	return events, nil
+}
+
+// notify sends notification if its kind is enabled. Failure is only
+// reported, because activity is printed anyway.
+func (notifier notifier) notify(kind string, title string, message string) {
+	if !notifier.events[kind] {
+		return
+	}
+
+	err := notifier.send(title, message)
+	if err != nil {
+		logger.Warning("can not send notification: %s", err.Error())
+	}
+}
+
+// sendDesktopNotification shows notification by notify-send on linux and
+// by osascript on macOS.
+func sendDesktopNotification(title string, message string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		// text is passed as arguments, so it is not escaped for AppleScript
+		cmd = exec.Command(
+			"osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) "+
+				"with title (item 1 of argv)",
+			"-e", "end run",
+			title, message,
+		)
+	default:
+		cmd = exec.Command("notify-send", "--app-name=ash", title, message)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf(
+			"%s: %s", err.Error(), strings.TrimSpace(string(output)),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNotifyEvents(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected map[string]bool
+	}{
+		{"comments, pushes", map[string]bool{"comments": true, "pushes": true}},
+		{"all", map[string]bool{
+			"comments": true, "approvals": true, "pushes": true,
+		}},
+		{"none", map[string]bool{}},
+	}
+
+	for _, test := range tests {
+		actual, err := parseNotifyEvents(test.value)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", test.value, err)
+		}
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf(
+				"unexpected events for %q: %v, expected %v",
+				test.value, actual, test.expected,
+			)
+		}
+	}
+
+	_, err := parseNotifyEvents("comments,merges")
+	if err == nil {
+		t.Fatalf("error is expected for unknown event")
+	}
+}
+
+func TestNotifierSendsOnlyEnabledEvents(t *testing.T) {
+	sent := []string{}
+
+	notifier := notifier{
+		events: map[string]bool{notifyApprovals: true},
+		send: func(title string, message string) error {
+			sent = append(sent, title+": "+message)
+			return nil
+		},
+	}
+
+	notifier.notify(notifyComments, "repo/1", "bob commented")
+	notifier.notify(notifyApprovals, "repo/1", "alice approved")
+
+	expected := []string{"repo/1: alice approved"}
+	if !reflect.DeepEqual(sent, expected) {
+		t.Fatalf("unexpected notifications: %q", sent)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// pickerHeight is max number of candidates shown by picker.
+const pickerHeight = 15
+
+var errPickCanceled = errors.New("nothing is picked")
+
+// fuzzyMatch returns score of candidate for query, which chars should be
+// found in candidate in the same order, like in fzf. Consecutive chars and
+// chars at the start of words score more. Negative score means that
+// candidate is not matched.
+func fuzzyMatch(query string, candidate string) int {
+	query = strings.ToLower(query)
+	lowered := strings.ToLower(candidate)
+
+	score := 0
+	position := 0
+	previous := -2
+
+	for _, char := range query {
+		if unicode.IsSpace(char) {
+			continue
+		}
+
+		index := strings.IndexRune(lowered[position:], char)
+		if index == -1 {
+			return -1
+		}
+
+		index += position
+
+		switch {
+		case index == previous+1:
+			score += 3
+		case index == 0 || strings.IndexByte("/_-. ", lowered[index-1]) != -1:
+			score += 2
+		default:
+			score++
+		}
+
+		previous = index
+		position = index + utf8.RuneLen(char)
+	}
+
+	return score
+}
+
+// filterFuzzy returns indexes of candidates matched by query, best matches
+// go first; shorter candidates are preferred if scores are equal.
+func filterFuzzy(query string, candidates []string) []int {
+	scores := map[int]int{}
+	matched := []int{}
+
+	for i, candidate := range candidates {
+		score := fuzzyMatch(query, candidate)
+		if score < 0 {
+			continue
+		}
+
+		scores[i] = score
+		matched = append(matched, i)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+
+		return len(candidates[a]) < len(candidates[b])
+	})
+
+	return matched
+}
+
+// pickFuzzy asks user to pick one of candidates by typing fuzzy query in
+// terminal, query is prefilled with given one. Index of picked candidate is
+// returned.
+func pickFuzzy(
+	prompt string, candidates []string, query string,
+) (int, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tty.Close()
+
+	ui := &tui{tty: tty}
+
+	err = ui.enter()
+	if err != nil {
+		return 0, err
+	}
+
+	defer ui.leave()
+
+	selected := 0
+	for {
+		matched := filterFuzzy(query, candidates)
+		selected = clamp(selected, 0, len(matched)-1)
+
+		ui.drawPicker(prompt, query, candidates, matched, selected)
+
+		input, err := ui.readInput()
+		if err != nil {
+			return 0, err
+		}
+
+		switch input {
+		case "\r", "\n":
+			if len(matched) > 0 {
+				return matched[selected], nil
+			}
+		case "\x1b", "\x03":
+			return 0, errPickCanceled
+		case "\x1b[A", "\x1bOA", "\x10":
+			selected--
+		case "\x1b[B", "\x1bOB", "\x0e":
+			selected++
+		case "\x7f", "\x08":
+			if query != "" {
+				_, size := utf8.DecodeLastRuneInString(query)
+				query = query[:len(query)-size]
+			}
+		case "\x15":
+			query = ""
+		default:
+			if !utf8.ValidString(input) || strings.ContainsAny(input, "\x1b\r\t") {
+				break
+			}
+
+			query += input
+			selected = 0
+		}
+	}
+}
+
+func (ui *tui) drawPicker(
+	prompt string, query string, candidates []string,
+	matched []int, selected int,
+) {
+	rows, columns, err := getTerminalSize()
+	if err != nil {
+		rows, columns = 24, 80
+	}
+
+	height := clamp(pickerHeight, 1, rows-2)
+
+	output := &bytes.Buffer{}
+	output.WriteString("\x1b[H\x1b[2J")
+
+	output.WriteString(fitToWidth(
+		fmt.Sprintf("%s (%d/%d)", prompt, len(matched), len(candidates)),
+		columns,
+	) + "\r\n")
+
+	offset := clamp(selected-height+1, 0, len(matched))
+	for row := 0; row < height && offset+row < len(matched); row++ {
+		index := offset + row
+
+		line := fitToWidth(candidates[matched[index]], columns)
+		if index == selected {
+			line = "\x1b[7m" + line + ansiReset
+		}
+
+		output.WriteString(line + "\r\n")
+	}
+
+	output.WriteString("> " + query + "\x1b[?25h")
+
+	ui.tty.Write(output.Bytes())
+}
+
+// pickFile resolves path given by user to one of pull request files. Path
+// is returned as is if it is glob or file is found by it; otherwise, file
+// is picked among fuzzy matches.
+func pickFile(files stash.ReviewFiles, path string, interactive bool) string {
+	if stash.IsGlob(path) || files.Find(path) != nil {
+		return path
+	}
+
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, file.GetPath())
+	}
+
+	matched := filterFuzzy(path, paths)
+
+	switch {
+	case len(matched) == 0:
+		return path
+	case len(matched) == 1:
+		logger.Info("%s is found by %s", paths[matched[0]], path)
+		return paths[matched[0]]
+	case !interactive:
+		logger.Warning(
+			"%s matches %d files, specify it more exactly",
+			path, len(matched),
+		)
+
+		return path
+	}
+
+	picked, err := pickFuzzy("Pick file", paths, path)
+	if err == errPickCanceled {
+		os.Exit(exitNoChanges)
+	}
+
+	if err != nil {
+		logger.Critical("file is not picked: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	return paths[picked]
+}
+
+// pickPullRequest asks user to pick one of pull requests.
+func pickPullRequest(pullRequests []stash.PullRequest) stash.PullRequest {
+	if len(pullRequests) == 0 {
+		fmt.Println("There are no open pull requests to review.")
+		os.Exit(exitNotFound)
+	}
+
+	candidates := []string{}
+	for _, pr := range pullRequests {
+		candidates = append(candidates, fmt.Sprintf(
+			"%s/%s/%d %s (%s, %s)",
+			strings.ToLower(pr.FromRef.Repository.Project.Key),
+			pr.FromRef.Repository.Slug, pr.Id, pr.Title,
+			pr.Author.User.Name, getBranchName(pr.FromRef.Id),
+		))
+	}
+
+	picked, err := pickFuzzy("Pick pull request", candidates, "")
+	if err == errPickCanceled {
+		os.Exit(exitNoChanges)
+	}
+
+	if err != nil {
+		logger.Critical("pull request is not picked: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	return pullRequests[picked]
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestFilterFuzzyPrefersConsecutiveAndWordStartMatches(t *testing.T) {
+	candidates := []string{
+		"vendor/github.com/foo/main.go",
+		"cmd/main.go",
+		"review.go",
+		"README.md",
+		"main.go",
+	}
+
+	matched := filterFuzzy("main", candidates)
+
+	expected := []int{4, 1, 0}
+	if !reflect.DeepEqual(matched, expected) {
+		t.Fatalf("unexpected matches: %v, expected %v", matched, expected)
+	}
+
+	if len(filterFuzzy("rvw", candidates)) != 1 {
+		t.Fatal("only review.go should be matched")
+	}
+
+	if len(filterFuzzy("", candidates)) != len(candidates) {
+		t.Fatal("empty query should match everything")
+	}
+}
+
+func TestPickFileResolvesUniqueFuzzyMatch(t *testing.T) {
+	files := stash.ReviewFiles{
+		{DstPath: "api.go"},
+		{DstPath: "pr.go"},
+		{SrcPath: "old/picker.go"},
+	}
+
+	tests := map[string]string{
+		"pr.go":   "pr.go",
+		"**/*.go": "**/*.go",
+		"pckr":    "old/picker.go",
+		"missing": "missing",
+		"go":      "go",
+	}
+
+	for path, expected := range tests {
+		actual := pickFile(files, path, false)
+		if actual != expected {
+			t.Errorf("%q is resolved to %q, expected %q", path, actual, expected)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+const progressBarWidth = 30
+
+// applyProgress reports progress of applying changes to Stash. Status of
+// every change is printed as it is applied; on terminal, progress bar is
+// kept below statuses and redrawn in place. In quiet mode, only failed
+// changes are reported.
+type applyProgress struct {
+	writer   io.Writer
+	terminal bool
+	quiet    bool
+	total    int
+	done     int
+	failures []string
+	started  time.Time
+	now      func() time.Time
+}
+
+func newApplyProgress(total int) *applyProgress {
+	if quietMode {
+		return &applyProgress{
+			writer:  os.Stderr,
+			quiet:   true,
+			total:   total,
+			started: time.Now(),
+			now:     time.Now,
+		}
+	}
+
+	return &applyProgress{
+		writer:   os.Stdout,
+		terminal: isTerminal(os.Stdout),
+		total:    total,
+		started:  time.Now(),
+		now:      time.Now,
+	}
+}
+
+// report prints status of applied change and redraws progress bar.
+func (progress *applyProgress) report(change stash.ReviewChange, err error) {
+	progress.done++
+
+	status := "✓ " + getChangeSummary(change)
+	if err != nil {
+		status = "✗ " + getChangeSummary(change) + ": " + err.Error()
+		progress.failures = append(progress.failures, status[len("✗ "):])
+	}
+
+	if progress.quiet && err == nil {
+		return
+	}
+
+	if progress.terminal {
+		// clear progress bar, which is drawn on the current line
+		fmt.Fprint(progress.writer, "\r\x1b[K")
+	}
+
+	fmt.Fprintf(progress.writer, "(%d/%d) %s\n",
+		progress.done, progress.total, status,
+	)
+
+	if progress.terminal && progress.done < progress.total {
+		fmt.Fprint(progress.writer, progress.bar())
+	}
+}
+
+func (progress *applyProgress) bar() string {
+	filled := progressBarWidth
+	if progress.total > 0 {
+		filled = progressBarWidth * progress.done / progress.total
+	}
+
+	return fmt.Sprintf("[%s%s] %d/%d %s",
+		strings.Repeat("#", filled),
+		strings.Repeat(".", progressBarWidth-filled),
+		progress.done, progress.total, progress.elapsed(),
+	)
+}
+
+func (progress *applyProgress) elapsed() string {
+	return progress.now().Sub(progress.started).Round(100 * time.Millisecond).
+		String()
+}
+
+// summarize prints number of applied and failed changes and reasons of
+// failures.
+func (progress *applyProgress) summarize() {
+	if progress.quiet {
+		return
+	}
+
+	applied := progress.done - len(progress.failures)
+
+	if len(progress.failures) == 0 {
+		fmt.Fprintf(progress.writer, "%d of %d changes applied in %s\n",
+			applied, progress.total, progress.elapsed(),
+		)
+
+		return
+	}
+
+	fmt.Fprintf(progress.writer,
+		"%d of %d changes applied in %s, %d failed:\n",
+		applied, progress.total, progress.elapsed(), len(progress.failures),
+	)
+
+	for _, failure := range progress.failures {
+		fmt.Fprintf(progress.writer, "  %s\n", failure)
+	}
+}
+
+// getChangeSummary returns first line of change description, e.g.
+// 'Line comment added to main.go:12'.
+func getChangeSummary(change stash.ReviewChange) string {
+	summary := strings.SplitN(change.String(), "\n", 2)[0]
+
+	return strings.TrimSuffix(summary, ":")
+}
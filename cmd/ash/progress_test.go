@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+func TestApplyProgressReportsStatusesAndSummary(t *testing.T) {
+	output := &bytes.Buffer{}
+
+	started := time.Now()
+	progress := &applyProgress{
+		writer:  output,
+		total:   2,
+		started: started,
+		now:     func() time.Time { return started.Add(1500 * time.Millisecond) },
+	}
+
+	comment := &godiff.Comment{Text: "looks good"}
+
+	progress.report(stash.ReviewCommentAdded{Comment: comment}, nil)
+	progress.report(stash.CommentRemoved{Comment: comment}, errors.New("comment is not found"))
+	progress.summarize()
+
+	expected := "(1/2) ✓ Review comment added\n" +
+		"(2/2) ✗ Comment <0> removed: comment is not found\n" +
+		"1 of 2 changes applied in 1.5s, 1 failed:\n" +
+		"  Comment <0> removed: comment is not found\n"
+
+	if output.String() != expected {
+		t.Fatalf("unexpected output:\n%s\nexpected:\n%s", output, expected)
+	}
+}
+
+func TestApplyProgressBar(t *testing.T) {
+	started := time.Now()
+	progress := &applyProgress{
+		total:   4,
+		done:    1,
+		started: started,
+		now:     func() time.Time { return started.Add(2 * time.Second) },
+	}
+
+	expected := "[#######.......................] 1/4 2s"
+	if progress.bar() != expected {
+		t.Fatalf("unexpected bar: %q", progress.bar())
+	}
+}
+
+func TestApplyProgressReportsOnlyFailuresInQuietMode(t *testing.T) {
+	output := &bytes.Buffer{}
+
+	progress := &applyProgress{
+		writer:  output,
+		quiet:   true,
+		total:   2,
+		started: time.Now(),
+		now:     time.Now,
+	}
+
+	comment := &godiff.Comment{Text: "looks good"}
+
+	progress.report(stash.ReviewCommentAdded{Comment: comment}, nil)
+	progress.report(stash.CommentRemoved{Comment: comment}, errors.New("comment is not found"))
+	progress.summarize()
+
+	expected := "(2/2) ✗ Comment <0> removed: comment is not found\n"
+	if output.String() != expected {
+		t.Fatalf("unexpected output:\n%s\nexpected:\n%s", output, expected)
+	}
+}
+
+// fakeComments is comment backend, which records applied changes and fails
+// to apply removals.
+type fakeComments struct {
+	applied []stash.ReviewChange
+}
+
+func (comments *fakeComments) GetTasks() ([]*stash.Task, error) {
+	return nil, nil
+}
+
+func (comments *fakeComments) ApplyChange(change stash.ReviewChange) error {
+	if _, ok := change.(stash.CommentRemoved); ok {
+		return errors.New("comment is not found")
+	}
+
+	comments.applied = append(comments.applied, change)
+
+	return nil
+}
+
+func TestApplyChangesUsesCommentService(t *testing.T) {
+	defer func(quiet bool) { quietMode = quiet }(quietMode)
+	quietMode = true
+
+	comment := &godiff.Comment{Text: "looks good"}
+	comments := &fakeComments{}
+
+	changes := []stash.ReviewChange{
+		stash.ReviewCommentAdded{Comment: comment},
+		stash.LineCommentAdded{Comment: comment},
+	}
+
+	if !applyChanges(comments, changes) {
+		t.Fatal("changes are expected to be applied")
+	}
+
+	if len(comments.applied) != 2 || comments.applied[1] != changes[1] {
+		t.Fatalf("unexpected applied changes: %v", comments.applied)
+	}
+
+	if applyChanges(comments, []stash.ReviewChange{stash.CommentRemoved{Comment: comment}}) {
+		t.Fatal("failed change is not reported")
+	}
+}
+
+// fakeDrafts is comment backend, which keeps changes as drafts until they
+// are published.
+type fakeDrafts struct {
+	fakeComments
+	published []stash.ReviewChange
+	err       error
+}
+
+func (drafts *fakeDrafts) HasPending() bool {
+	return len(drafts.applied) > 0
+}
+
+func (drafts *fakeDrafts) Publish() error {
+	drafts.published = append(drafts.published, drafts.applied...)
+	drafts.applied = nil
+
+	return drafts.err
+}
+
+func TestApplyChangesPublishesDrafts(t *testing.T) {
+	defer func(quiet bool) { quietMode = quiet }(quietMode)
+	quietMode = true
+
+	comment := &godiff.Comment{Text: "looks good"}
+	drafts := &fakeDrafts{}
+
+	if !applyChanges(drafts, []stash.ReviewChange{stash.LineCommentAdded{Comment: comment}}) {
+		t.Fatal("changes are expected to be applied")
+	}
+
+	if len(drafts.published) != 1 || len(drafts.applied) != 0 {
+		t.Fatalf("drafts are not published: %v", drafts.published)
+	}
+
+	drafts.err = errors.New("labels are not permitted")
+
+	if applyChanges(drafts, []stash.ReviewChange{stash.LineCommentAdded{Comment: comment}}) {
+		t.Fatal("failed publishing is not reported")
+	}
+}
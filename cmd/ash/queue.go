@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+var queuePath = os.Getenv("HOME") + "/.local/share/ash/queue"
+
+// queuedReview is review edited in offline mode. Both original and edited
+// review files are stored, so changes are computed again on push and
+// comments added in the same review can get tasks and replies.
+type queuedReview struct {
+	Host    string
+	Project string
+	Repo    string
+	PR      int64
+	Paths   []string
+	All     bool
+	Wrap    int
+	Origin  string
+	Edited  string
+	Created time.Time
+
+	// Applied holds indexes of changes, which are applied by previous push,
+	// along with ids of comments added by them.
+	Applied map[int]int64
+
+	// path is file of queued review
+	path string
+}
+
+func (queued queuedReview) String() string {
+	target := "overview"
+	switch {
+	case queued.All:
+		target = "all files"
+	case len(queued.Paths) > 0:
+		target = strings.Join(queued.Paths, ", ")
+	}
+
+	project := strings.TrimPrefix(queued.Project, "projects/")
+	if strings.HasPrefix(project, "users/") {
+		project = "~" + strings.TrimPrefix(project, "users/")
+	}
+
+	return fmt.Sprintf(
+		"%s/%s/%d (%s)", project, queued.Repo, queued.PR, target,
+	)
+}
+
+// getOrigin returns review which changes were made against.
+func (queued queuedReview) getOrigin() (*stash.Review, error) {
+	review, err := stash.ReadReview(strings.NewReader(queued.Origin))
+	if err != nil {
+		return nil, err
+	}
+
+	review.IsOverview = len(queued.Paths) == 0 && !queued.All
+	review.IsMultiFile = queued.All || stash.IsMultiFilePaths(queued.Paths)
+	review.WrapWidth = queued.Wrap
+
+	return review, nil
+}
+
+func (queued queuedReview) getChanges() ([]stash.ReviewChange, error) {
+	origin, err := queued.getOrigin()
+	if err != nil {
+		return nil, err
+	}
+
+	edited, err := stash.ReadReview(strings.NewReader(queued.Edited))
+	if err != nil {
+		return nil, err
+	}
+
+	return origin.Compare(edited), nil
+}
+
+func queueReview(queued queuedReview) (string, error) {
+	err := os.MkdirAll(queuePath, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(
+		queuePath, fmt.Sprintf("%d.json", queued.Created.UnixNano()),
+	)
+
+	return path, writeQueuedReview(path, queued)
+}
+
+func writeQueuedReview(path string, queued queuedReview) error {
+	data, err := json.MarshalIndent(queued, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// readQueue returns queued reviews in order they were queued.
+func readQueue() ([]queuedReview, error) {
+	paths, err := filepath.Glob(filepath.Join(queuePath, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+
+	queue := []queuedReview{}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		queued := queuedReview{path: path}
+
+		err = json.Unmarshal(data, &queued)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err.Error())
+		}
+
+		queue = append(queue, queued)
+	}
+
+	return queue, nil
+}
+
+// pushQueue applies queued reviews of the given Stash. Review is removed
+// from queue only if all of its changes are applied, otherwise applied
+// changes are remembered in it; ash exits with exitPartialApply if any
+// review, including ones of other Stash, is left.
+func pushQueue(api stash.Api, templates map[string]string, emoji bool) {
+	queue, err := readQueue()
+	if err != nil {
+		logger.Critical("can not read queue: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	if len(queue) == 0 {
+		fmt.Println("Queue is empty")
+		return
+	}
+
+	failed := 0
+	skipped := 0
+	for _, queued := range queue {
+		if queued.Host != api.URL {
+			logger.Warning(
+				"skipping %s: it is queued for %s", queued, queued.Host,
+			)
+			skipped++
+			continue
+		}
+
+		printInfo("pushing review of %s", queued)
+
+		changes, err := queued.getChanges()
+		if err != nil {
+			logger.Critical("can not read queued review: %s", err.Error())
+			failed++
+			continue
+		}
+
+		expandChangesTemplates(changes, templates)
+
+		if emoji {
+			expandChangesEmoji(changes)
+		}
+
+		project := stash.Project{Api: &api, Name: queued.Project}
+		repo := project.GetRepo(queued.Repo)
+		pr := repo.GetPullRequest(queued.PR)
+
+		if !applyQueuedChanges(&queued, &pr, changes) {
+			logger.Critical("review is kept in queue: %s", queued.path)
+			failed++
+
+			err = writeQueuedReview(queued.path, queued)
+			if err != nil {
+				logger.Error(
+					"can not save applied changes: %s", err.Error(),
+				)
+			}
+
+			continue
+		}
+
+		err = os.Remove(queued.path)
+		if err != nil {
+			logger.Warning("can not remove pushed review: %s", err.Error())
+		}
+	}
+
+	if skipped > 0 {
+		logger.Warning(
+			"%d queued review(s) of other Stash are kept in queue", skipped,
+		)
+	}
+
+	if failed > 0 || skipped > 0 {
+		os.Exit(exitPartialApply)
+	}
+
+	printInfo("Queued reviews successfully pushed")
+}
+
+// applyQueuedChanges applies changes of queued review, which are not applied
+// by previous push, and records newly applied ones into queued review, so
+// they are not posted again if review is pushed once more.
+func applyQueuedChanges(
+	queued *queuedReview,
+	comments stash.CommentService,
+	changes []stash.ReviewChange,
+) bool {
+	if queued.Applied == nil {
+		queued.Applied = map[int]int64{}
+	}
+
+	recorder := &appliedChangesRecorder{
+		CommentService: comments,
+		queued:         queued,
+	}
+
+	pending := []stash.ReviewChange{}
+	for index, change := range changes {
+		id, ok := queued.Applied[index]
+		if !ok {
+			pending = append(pending, change)
+			recorder.indexes = append(recorder.indexes, index)
+			continue
+		}
+
+		// replies and tasks can be added to the comment added by previous
+		// push, so its id is restored
+		if comment := getAddedComment(change); comment != nil {
+			comment.Id = id
+		}
+	}
+
+	return applyChanges(recorder, pending)
+}
+
+// appliedChangesRecorder records changes of queued review, which are
+// successfully applied. Changes are applied in order, so indexes are
+// indexes of pending changes in queued review.
+type appliedChangesRecorder struct {
+	stash.CommentService
+
+	queued  *queuedReview
+	indexes []int
+}
+
+func (recorder *appliedChangesRecorder) ApplyChange(
+	change stash.ReviewChange,
+) error {
+	index := recorder.indexes[0]
+	recorder.indexes = recorder.indexes[1:]
+
+	err := recorder.CommentService.ApplyChange(change)
+	if err != nil {
+		return err
+	}
+
+	id := int64(0)
+	if comment := getAddedComment(change); comment != nil {
+		id = comment.Id
+	}
+
+	recorder.queued.Applied[index] = id
+
+	return nil
+}
+
+// getAddedComment returns comment, which is added by change, or nil.
+func getAddedComment(change stash.ReviewChange) *godiff.Comment {
+	switch change := change.(type) {
+	case stash.ReplyAdded:
+		return change.Comment
+	case stash.LineCommentAdded:
+		return change.Comment
+	case stash.FileCommentAdded:
+		return change.Comment
+	case stash.ReviewCommentAdded:
+		return change.Comment
+	}
+
+	return nil
+}
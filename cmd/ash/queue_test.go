@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+// flakyComments fails to add comments with the specified text and gives
+// ids to comments it adds.
+type flakyComments struct {
+	fakeComments
+	failing string
+	lastId  int64
+}
+
+func (comments *flakyComments) ApplyChange(change stash.ReviewChange) error {
+	comment := getAddedComment(change)
+	if comment != nil {
+		if comment.Text == comments.failing {
+			return errors.New("internal server error")
+		}
+
+		comments.lastId++
+		comment.Id = comments.lastId
+	}
+
+	return comments.fakeComments.ApplyChange(change)
+}
+
+func TestApplyQueuedChangesDoesNotRepeatAppliedChanges(t *testing.T) {
+	defer func(quiet bool) { quietMode = quiet }(quietMode)
+	quietMode = true
+
+	// changes are computed again from queued review on every push
+	getChanges := func() []stash.ReviewChange {
+		comment := &godiff.Comment{Text: "looks good"}
+
+		return []stash.ReviewChange{
+			stash.LineCommentAdded{Comment: comment},
+			stash.ReplyAdded{
+				Comment: &godiff.Comment{Text: "agreed"},
+				Parent:  comment,
+			},
+			stash.TaskAdded{Comment: comment, Text: "add tests"},
+		}
+	}
+
+	queued := queuedReview{}
+	comments := &flakyComments{failing: "agreed"}
+
+	if applyQueuedChanges(&queued, comments, getChanges()) {
+		t.Fatal("failed change is not reported")
+	}
+
+	if len(comments.applied) != 2 {
+		t.Fatalf("unexpected applied changes: %v", comments.applied)
+	}
+
+	data, err := json.Marshal(queued)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued = queuedReview{}
+
+	err = json.Unmarshal(data, &queued)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comments.failing = ""
+
+	if !applyQueuedChanges(&queued, comments, getChanges()) {
+		t.Fatal("changes are expected to be applied")
+	}
+
+	if len(comments.applied) != 3 {
+		t.Fatalf("applied changes are posted again: %v", comments.applied)
+	}
+
+	reply, ok := comments.applied[2].(stash.ReplyAdded)
+	if !ok || reply.Parent.Id != 1 {
+		t.Fatalf("reply is not posted to applied comment: %#v", reply)
+	}
+}
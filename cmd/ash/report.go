@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// reportPageSize is number of commits and activities retrieved per request
+// for markdown report.
+const reportPageSize = 100
+
+const reportDateLayout = "2006-01-02 15:04"
+
+// getMarkdownReport gets commits and activities of pull request and returns
+// function, which renders them as markdown report.
+func getMarkdownReport(pr stash.PullRequest, info stash.PullRequestInfo) func(io.Writer) error {
+	commits, err := pr.GetCommits(reportPageSize, true)
+	if err != nil {
+		logger.Critical("can not get commits: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	events, err := pr.GetAllEvents(reportPageSize)
+	if err != nil {
+		logger.Critical("can not get activities: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	url := getPullRequestURL(pr)
+
+	return func(writer io.Writer) error {
+		return renderMarkdownReport(writer, info, url, commits, events)
+	}
+}
+
+// renderMarkdownReport writes description, commits and activity of pull
+// request in chronological order as markdown. Commits and events are
+// expected in order Stash returns them, newest first.
+func renderMarkdownReport(
+	writer io.Writer, info stash.PullRequestInfo, url string,
+	commits []stash.Commit, events []stash.PullRequestEvent,
+) error {
+	report := &bytes.Buffer{}
+
+	fmt.Fprintf(report, "# #%d %s\n\n", info.Id, info.Title)
+
+	author := info.Author.User.DisplayName
+	if author == "" {
+		author = info.Author.User.Name
+	}
+
+	fmt.Fprintf(report, "* **Author:** %s\n", author)
+	fmt.Fprintf(report, "* **Branch:** %s → %s\n",
+		info.FromRef.DisplayId, info.ToRef.DisplayId,
+	)
+	fmt.Fprintf(report, "* **State:** %s\n", strings.ToLower(info.State))
+	fmt.Fprintf(report, "* **Created:** %s\n",
+		formatTime(info.CreatedDate.AsTime(), reportDateLayout),
+	)
+
+	if url != "" {
+		fmt.Fprintf(report, "* **URL:** %s\n", url)
+	}
+
+	report.WriteString("\n## Description\n\n")
+
+	description := strings.TrimSpace(info.Description)
+	if description == "" {
+		description = "_No description._"
+	}
+
+	report.WriteString(description + "\n")
+
+	if len(commits) > 0 {
+		report.WriteString("\n## Commits\n\n")
+
+		for i := len(commits) - 1; i >= 0; i-- {
+			commit := commits[i]
+
+			fmt.Fprintf(report, "* %s `%s` %s: %s\n",
+				formatTime(commit.AuthorTimestamp.AsTime(), reportDateLayout),
+				commit.DisplayId, commit.Author.Name,
+				strings.SplitN(strings.TrimSpace(commit.Message), "\n", 2)[0],
+			)
+		}
+	}
+
+	if len(events) > 0 {
+		report.WriteString("\n## Activity\n\n")
+
+		for i := len(events) - 1; i >= 0; i-- {
+			writeReportEvent(report, events[i])
+		}
+	}
+
+	_, err := writer.Write(report.Bytes())
+
+	return err
+}
+
+// writeReportEvent writes event as list item; added comments are written
+// with their text and replies.
+func writeReportEvent(report *bytes.Buffer, event stash.PullRequestEvent) {
+	date := formatTime(event.CreatedDate.AsTime(), reportDateLayout)
+
+	if event.Action != "COMMENTED" || event.CommentAction != "ADDED" {
+		fmt.Fprintf(report, "* **%s** %s\n", date, getReportEventText(event))
+		return
+	}
+
+	user := event.User.DisplayName
+	if user == "" {
+		user = event.User.Name
+	}
+
+	place := "on pull request"
+	if event.CommentAnchor.Path != "" {
+		place = "on `" + event.CommentAnchor.Path
+		if event.CommentAnchor.Line > 0 {
+			place += fmt.Sprintf(":%d", event.CommentAnchor.Line)
+		}
+
+		place += "`"
+	}
+
+	fmt.Fprintf(report, "* **%s** %s commented %s:\n", date, user, place)
+
+	writeReportComment(report, event.Comment, "  ")
+}
+
+func writeReportComment(
+	report *bytes.Buffer, comment stash.EventComment, indent string,
+) {
+	report.WriteString("\n")
+
+	for _, line := range strings.Split(strings.TrimSpace(comment.Text), "\n") {
+		report.WriteString(strings.TrimRight(indent+"> "+line, " ") + "\n")
+	}
+
+	report.WriteString("\n")
+
+	for _, reply := range comment.Comments {
+		author := reply.Author.DisplayName
+		if author == "" {
+			author = reply.Author.Name
+		}
+
+		fmt.Fprintf(report, "%s* **%s** %s replied:\n", indent,
+			formatTime(reply.CreatedDate.AsTime(), reportDateLayout), author,
+		)
+
+		writeReportComment(report, reply, indent+"  ")
+	}
+}
+
+// getReportEventText returns one line description of event, e.g.
+// 'alice merged pull request'.
+func getReportEventText(event stash.PullRequestEvent) string {
+	_, text := describeEvent(event)
+
+	switch event.Action {
+	case "OPENED", "MERGED", "DECLINED", "REOPENED":
+		return text + " pull request"
+	case "UPDATED":
+		return text + " pull request details"
+	case "RESCOPED":
+		ids := []string{}
+		for _, commit := range event.Added.Commits {
+			ids = append(ids, "`"+commit.DisplayId+"`")
+		}
+
+		if len(ids) > 0 {
+			text += ": " + strings.Join(ids, ", ")
+		}
+	}
+
+	return text
+}
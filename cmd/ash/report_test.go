@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestRenderMarkdownReportIsChronological(t *testing.T) {
+	info := stash.PullRequestInfo{
+		Id: 12, Title: "Fix comparison", State: "MERGED",
+		Description: "Fixes off by one.",
+		CreatedDate: 1456833600000,
+	}
+	info.Author.User.Name = "bob"
+	info.FromRef.DisplayId = "feature"
+	info.ToRef.DisplayId = "master"
+
+	commits := []stash.Commit{{DisplayId: "abc1234", Message: "Fix check\n\nbody"}}
+	commits[0].AuthorTimestamp = 1456833600000
+	commits[0].Author.Name = "bob"
+
+	opened := stash.PullRequestEvent{Action: "OPENED", CreatedDate: 1456833660000}
+	opened.User.Name = "bob"
+
+	commented := stash.PullRequestEvent{
+		Action: "COMMENTED", CommentAction: "ADDED",
+		CreatedDate: 1456833720000,
+		Comment:     stash.EventComment{Text: "why?\n\ncheck it"},
+	}
+	commented.User.DisplayName = "Alice"
+	commented.CommentAnchor.Path = "main.go"
+	commented.CommentAnchor.Line = 3
+
+	reply := stash.EventComment{Text: "done", CreatedDate: 1456833780000}
+	reply.Author.Name = "bob"
+	commented.Comment.Comments = []stash.EventComment{reply}
+
+	merged := stash.PullRequestEvent{Action: "MERGED", CreatedDate: 1456833840000}
+	merged.User.Name = "alice"
+
+	output := &bytes.Buffer{}
+	err := renderMarkdownReport(
+		output, info, "http://stash/pr/12", commits,
+		[]stash.PullRequestEvent{merged, commented, opened},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(timestamp stash.UnixTimestamp) string {
+		return formatTime(timestamp.AsTime(), reportDateLayout)
+	}
+
+	expected := `# #12 Fix comparison
+
+* **Author:** bob
+* **Branch:** feature → master
+* **State:** merged
+* **Created:** ` + date(info.CreatedDate) + `
+* **URL:** http://stash/pr/12
+
+## Description
+
+Fixes off by one.
+
+## Commits
+
+* ` + date(commits[0].AuthorTimestamp) + " `abc1234` bob: Fix check" + `
+
+## Activity
+
+* **` + date(opened.CreatedDate) + `** bob opened pull request
+* **` + date(commented.CreatedDate) + "** Alice commented on `main.go:3`:" + `
+
+  > why?
+  >
+  > check it
+
+  * **` + date(reply.CreatedDate) + `** bob replied:
+
+    > done
+
+* **` + date(merged.CreatedDate) + `** alice merged pull request
+`
+
+	if output.String() != expected {
+		t.Fatalf("unexpected report:\n%s\nexpected:\n%s", output, expected)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+type searchOptions struct {
+	reviewsListOptions
+
+	// search in comments too, activities of every pull request, which is
+	// not matched by title and description, are retrieved for that
+	withComments    bool
+	activitiesLimit string
+}
+
+// searchPullRequests lists pull requests of repo, which title, description
+// or comments contain every word of query. Stash does not search pull
+// requests by text, so they are matched client-side.
+func searchPullRequests(repo stash.Repo, query string, options searchOptions) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		logger.Critical("search query is empty")
+		os.Exit(exitUsage)
+	}
+
+	pullRequests, err := repo.ListPullRequest(
+		options.state, options.limit, true,
+	)
+	if err != nil {
+		logger.Critical("can not list reviews: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	matched := make([]bool, len(pullRequests))
+	unmatched := []int{}
+	for i, pr := range pullRequests {
+		matched[i] = matchSearchWords(words, pr.Title, pr.Description)
+		if !matched[i] {
+			unmatched = append(unmatched, i)
+		}
+	}
+
+	if options.withComments {
+		matchComments(repo, pullRequests, unmatched, words, matched, options)
+	}
+
+	result := []stash.PullRequest{}
+	for i, pr := range pullRequests {
+		if matched[i] {
+			result = append(result, pr)
+		}
+	}
+
+	printPullRequestList(repo, result, options.reviewsListOptions)
+}
+
+// matchComments retrieves comments of pull requests by given indexes and
+// marks ones which are matched along with their title and description.
+func matchComments(
+	repo stash.Repo, pullRequests []stash.PullRequest, indexes []int, words []string,
+	matched []bool, options searchOptions,
+) {
+	queue := make(chan int)
+
+	workers := sync.WaitGroup{}
+	for i := 0; i < options.jobs && i < len(indexes); i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for index := range queue {
+				pr := pullRequests[index]
+
+				comments, err := getPullRequestComments(
+					repo.GetPullRequest(pr.Id), options.activitiesLimit,
+				)
+				if err != nil {
+					logger.Warning(
+						"can not get comments of pull request %d: %s",
+						pr.Id, err.Error(),
+					)
+
+					continue
+				}
+
+				matched[index] = matchSearchWords(words,
+					append([]string{pr.Title, pr.Description}, comments...)...,
+				)
+			}
+		}()
+	}
+
+	for _, index := range indexes {
+		queue <- index
+	}
+
+	close(queue)
+
+	workers.Wait()
+}
+
+func getPullRequestComments(pr stash.PullRequest, limit string) ([]string, error) {
+	review, err := pr.GetActivities(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	comments := []string{}
+	review.Changeset.ForEachComment(
+		func(_ *godiff.Diff, comment, _ *godiff.Comment) {
+			comments = append(comments, comment.Text)
+		})
+
+	return comments, nil
+}
+
+// matchSearchWords returns true if every word is found in any of texts,
+// case insensitive. Words should be lowercase.
+func matchSearchWords(words []string, texts ...string) bool {
+	text := strings.ToLower(strings.Join(texts, "\n"))
+
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+
+	return true
+}
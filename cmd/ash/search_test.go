@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMatchSearchWords(t *testing.T) {
+	tests := []struct {
+		query    []string
+		texts    []string
+		expected bool
+	}{
+		{[]string{"login"}, []string{"Fix Login form", ""}, true},
+		{[]string{"fix", "form"}, []string{"Fix login", "form is broken"}, true},
+		{[]string{"fix", "logout"}, []string{"Fix login", "form"}, false},
+		{[]string{"typo"}, []string{"Fix login", "", "there is typo"}, true},
+	}
+
+	for _, test := range tests {
+		actual := matchSearchWords(test.query, test.texts...)
+		if actual != test.expected {
+			t.Errorf(
+				"unexpected match of %q in %q: %v, expected %v",
+				test.query, test.texts, actual, test.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+const (
+	defaultTerminalWidth = 160
+
+	// line numbers of both columns and separator between them
+	sideBySideGutter = len("1234 ") + len(" | ") + len("1234 ")
+
+	minSideBySideColumn = 20
+)
+
+// sideBySideRenderer renders old and new versions of changed lines in two
+// columns, which fit into specified width.
+type sideBySideRenderer struct {
+	width int
+}
+
+type sideBySideLine struct {
+	number   int64
+	text     string
+	comments godiff.CommentsTree
+}
+
+func (renderer sideBySideRenderer) Render(
+	review *stash.Review, writer io.Writer,
+) error {
+	column := (renderer.width - sideBySideGutter) / 2
+	if column < minSideBySideColumn {
+		column = minSideBySideColumn
+	}
+
+	hasMarker := false
+	for _, diff := range review.Changeset.Diffs {
+		if diff.Note != "" {
+			fmt.Fprintln(writer, diff.Note)
+		}
+
+		// multi-file review already has headers for every file
+		header := getDiffHeader(diff)
+		if header != "" && !hasMarker {
+			fmt.Fprintln(writer, stash.FileMarkerPrefix+header+stash.FileMarkerSuffix)
+		}
+
+		hasMarker = stash.IsFileMarker(diff.Note)
+
+		if diff.Binary {
+			fmt.Fprintln(writer, "binary file")
+		}
+
+		renderSideBySideComments(writer, diff.FileComments, 0)
+
+		for _, hunk := range diff.Hunks {
+			fmt.Fprintf(writer, "@@ -%d,%d +%d,%d @@\n",
+				hunk.SourceLine, hunk.SourceSpan,
+				hunk.DestinationLine, hunk.DestinationSpan,
+			)
+
+			renderer.renderHunk(writer, hunk, column)
+		}
+	}
+
+	return nil
+}
+
+// renderHunk pairs removed lines with added lines which follow them, so
+// changed lines are rendered side by side.
+func (renderer sideBySideRenderer) renderHunk(
+	writer io.Writer, hunk *godiff.Hunk, column int,
+) {
+	removed := []*godiff.Line{}
+
+	flush := func(added []*godiff.Line) {
+		for i := 0; i < len(removed) || i < len(added); i++ {
+			var left, right *sideBySideLine
+			if i < len(removed) {
+				left = &sideBySideLine{
+					removed[i].Source, removed[i].Line, removed[i].Comments,
+				}
+			}
+
+			if i < len(added) {
+				right = &sideBySideLine{
+					added[i].Destination, added[i].Line, added[i].Comments,
+				}
+			}
+
+			renderSideBySideRow(writer, left, right, column)
+		}
+
+		removed = []*godiff.Line{}
+	}
+
+	for _, segment := range hunk.Segments {
+		switch segment.Type {
+		case godiff.SegmentTypeRemoved:
+			removed = append(removed, segment.Lines...)
+		case godiff.SegmentTypeAdded:
+			flush(segment.Lines)
+		default:
+			flush(nil)
+
+			for _, line := range segment.Lines {
+				renderSideBySideRow(writer,
+					&sideBySideLine{line.Source, line.Line, nil},
+					&sideBySideLine{line.Destination, line.Line, line.Comments},
+					column,
+				)
+			}
+		}
+	}
+
+	flush(nil)
+}
+
+// renderSideBySideRow renders row of two columns separated by marker, like
+// sdiff does: '|' for changed lines, '<' and '>' for removed and added ones
+// and space for unchanged lines.
+func renderSideBySideRow(
+	writer io.Writer, left, right *sideBySideLine, column int,
+) {
+	marker := " "
+	switch {
+	case left == nil:
+		marker = ">"
+	case right == nil:
+		marker = "<"
+	case left.text != right.text:
+		marker = "|"
+	}
+
+	row := fmt.Sprintf("%s %s %s",
+		formatSideBySideCell(left, column), marker,
+		formatSideBySideCell(right, column),
+	)
+
+	fmt.Fprintln(writer, strings.TrimRight(row, " "))
+
+	for _, line := range []*sideBySideLine{left, right} {
+		if line != nil {
+			renderSideBySideComments(writer, line.comments, 0)
+		}
+	}
+}
+
+func formatSideBySideCell(line *sideBySideLine, column int) string {
+	if line == nil {
+		return strings.Repeat(" ", len("1234 ")+column)
+	}
+
+	return fmt.Sprintf("%4d %s", line.number, fitToWidth(line.text, column))
+}
+
+func renderSideBySideComments(
+	writer io.Writer, comments godiff.CommentsTree, depth int,
+) {
+	for _, comment := range comments {
+		prefix := strings.Repeat("  ", depth) + "# "
+
+		fmt.Fprintf(writer, "%s%s:\n", prefix, comment.Author.DisplayName)
+		fmt.Fprintln(writer, stash.Indent(comment.Text, prefix+"  "))
+
+		renderSideBySideComments(writer, comment.Comments, depth+1)
+	}
+}
+
+// fitToWidth truncates or pads text to the exactly specified width of
+// columns, taking into account wide characters.
+func fitToWidth(text string, width int) string {
+	text = strings.Replace(text, "\t", "    ", -1)
+
+	textWidth := displayWidth(text)
+	if textWidth <= width {
+		return text + strings.Repeat(" ", width-textWidth)
+	}
+
+	result := []rune{}
+	resultWidth := 0
+	for _, r := range text {
+		if resultWidth+runeWidth(r) > width-1 {
+			break
+		}
+
+		result = append(result, r)
+		resultWidth += runeWidth(r)
+	}
+
+	return string(result) + "…" + strings.Repeat(" ", width-1-resultWidth)
+}
+
+func getDiffHeader(diff *godiff.Diff) string {
+	source := diff.Source.ToString
+	destination := diff.Destination.ToString
+
+	switch {
+	case source == "" && destination == "":
+		return ""
+	case source == destination || source == "":
+		return destination
+	case destination == "":
+		return source
+	default:
+		return source + " → " + destination
+	}
+}
+
+// getTerminalWidth returns width of the terminal, which is taken from
+// $COLUMNS or asked from the terminal itself.
+func getTerminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil {
+		return columns
+	}
+
+	_, columns, err := getTerminalSize()
+	if err != nil {
+		return defaultTerminalWidth
+	}
+
+	return columns
+}
+
+// getTerminalSize asks terminal for its number of rows and columns.
+func getTerminalSize() (int, int, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer tty.Close()
+
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = tty
+
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var rows, columns int
+
+	_, err = fmt.Sscan(string(output), &rows, &columns)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected terminal size %q", output)
+	}
+
+	return rows, columns, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRenderSideBySideRowMarkers(t *testing.T) {
+	old := &sideBySideLine{number: 1, text: "old"}
+	changed := &sideBySideLine{number: 1, text: "new"}
+
+	tests := []struct {
+		left, right *sideBySideLine
+		expected    string
+	}{
+		{old, old, "   1 old       1 old\n"},
+		{old, changed, "   1 old  |    1 new\n"},
+		{old, nil, "   1 old  <\n"},
+		{nil, changed, "          >    1 new\n"},
+	}
+
+	for _, test := range tests {
+		buffer := &bytes.Buffer{}
+		renderSideBySideRow(buffer, test.left, test.right, 4)
+
+		if buffer.String() != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, buffer.String())
+		}
+	}
+}
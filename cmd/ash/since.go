@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+var reviewedPath = os.Getenv("HOME") + "/.local/share/ash/reviewed"
+
+// getLastReviewedCommit returns commit which user has reviewed last time.
+// Commit is taken from Stash, which tracks it for reviewers, and from the
+// local marker, which is saved after review is applied; the newer of them is
+// used.
+func getLastReviewedCommit(
+	target reviewTarget, user string, info *stash.PullRequestInfo,
+) string {
+	remote := ""
+	for _, reviewer := range info.Reviewers {
+		if reviewer.User.Name == user &&
+			reviewer.LastReviewedCommit != "" {
+			remote = reviewer.LastReviewedCommit
+		}
+	}
+
+	local := ""
+
+	data, err := ioutil.ReadFile(getReviewedMarkerPath(target))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning("can not read last reviewed commit: %s", err.Error())
+		}
+	} else {
+		local = strings.TrimSpace(string(data))
+	}
+
+	switch {
+	case remote == "":
+		return local
+	case local == "" || local == remote:
+		return remote
+	}
+
+	return getNewerCommit(target, remote, local)
+}
+
+// getNewerCommit returns which of two commits is pushed to pull request
+// later. Commits, which are not in pull request anymore, e.g. after force
+// push, are considered older; first commit is returned if neither is found.
+func getNewerCommit(target reviewTarget, first string, second string) string {
+	if target.stash == nil {
+		return first
+	}
+
+	commits, err := target.stash.GetCommits(reportPageSize, true)
+	if err != nil {
+		logger.Warning("can not get commits of pull request: %s", err.Error())
+		return first
+	}
+
+	// commits are listed newest first
+	for _, commit := range commits {
+		switch commit.Id {
+		case first:
+			return first
+		case second:
+			return second
+		}
+	}
+
+	return first
+}
+
+// rememberReviewedCommit saves latest commit of pull request as reviewed,
+// unless reviewed commits do not cover everything pushed since last review.
+// It should be called only after all files are reviewed, otherwise files,
+// which are not looked at, will be skipped by --since-last.
+func rememberReviewedCommit(target reviewTarget, options stash.DiffOptions) {
+	info, err := target.service.GetInfo()
+	if err != nil {
+		logger.Warning("can not get pull request info: %s", err.Error())
+		return
+	}
+
+	latest := info.GetLatestCommit()
+	last := getLastReviewedCommit(target, target.user, info)
+	if !isReviewedUpToLatest(options, latest, last) {
+		return
+	}
+
+	path := getReviewedMarkerPath(target)
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte(latest+"\n"), 0600)
+	}
+
+	if err != nil {
+		logger.Warning("can not save last reviewed commit: %s", err.Error())
+		return
+	}
+
+	logger.Debug("commit %s is marked as reviewed", latest)
+}
+
+// isReviewedUpToLatest reports whether diff of given options covers all
+// commits from last reviewed one up to the latest one. Range, which starts
+// after last reviewed commit, leaves commits in between unreviewed.
+func isReviewedUpToLatest(
+	options stash.DiffOptions, latest string, last string,
+) bool {
+	if options.UntilId != "" && options.UntilId != latest {
+		return false
+	}
+
+	return options.SinceId == "" || options.SinceId == last
+}
+
+func getReviewedMarkerPath(target reviewTarget) string {
+	return filepath.Join(
+		reviewedPath, target.project, target.repo,
+		strconv.FormatInt(target.id, 10),
+	)
+}
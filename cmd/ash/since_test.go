@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestGetLastReviewedCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ash-reviewed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	defer func(path string) { reviewedPath = path }(reviewedPath)
+	reviewedPath = dir
+
+	info := &stash.PullRequestInfo{}
+	err = json.Unmarshal([]byte(`{"reviewers": [
+		{"user": {"name": "alice"}, "lastReviewedCommit": "remote"}
+	]}`), info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := reviewTarget{project: "projects/proj", repo: "repo", id: 1}
+
+	if commit := getLastReviewedCommit(target, "bob", info); commit != "" {
+		t.Fatalf("unexpected commit without review: %q", commit)
+	}
+
+	if commit := getLastReviewedCommit(target, "alice", info); commit != "remote" {
+		t.Fatalf("commit is not taken from Stash: %q", commit)
+	}
+
+	err = os.MkdirAll(dir+"/projects/proj/repo", 0700)
+	if err == nil {
+		err = ioutil.WriteFile(dir+"/projects/proj/repo/1", []byte("local\n"), 0600)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if commit := getLastReviewedCommit(target, "bob", info); commit != "local" {
+		t.Fatalf("commit is not taken from marker: %q", commit)
+	}
+}
+
+func TestIsReviewedUpToLatest(t *testing.T) {
+	tests := []struct {
+		since    string
+		until    string
+		last     string
+		expected bool
+	}{
+		{"", "", "", true},
+		{"", "tip", "old", true},
+		{"old", "tip", "old", true},
+		{"old", "", "old", true},
+		{"", "middle", "", false},
+		{"middle", "tip", "old", false},
+		{"middle", "tip", "", false},
+	}
+
+	for _, test := range tests {
+		options := stash.DiffOptions{SinceId: test.since, UntilId: test.until}
+
+		actual := isReviewedUpToLatest(options, "tip", test.last)
+		if actual != test.expected {
+			t.Errorf(
+				"unexpected result for %s..%s after %q: %v, expected %v",
+				test.since, test.until, test.last, actual, test.expected,
+			)
+		}
+	}
+}
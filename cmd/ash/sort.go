@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// pullRequestSortKeys are fields which listed pull requests can be sorted
+// by; every one orders oldest or smallest first.
+var pullRequestSortKeys = map[string]func(a, b stash.PullRequest) bool{
+	"updated": func(a, b stash.PullRequest) bool {
+		return a.UpdatedDate < b.UpdatedDate
+	},
+	"created": func(a, b stash.PullRequest) bool {
+		return a.CreatedDate < b.CreatedDate
+	},
+	"id": func(a, b stash.PullRequest) bool {
+		return a.Id < b.Id
+	},
+	"author": func(a, b stash.PullRequest) bool {
+		return strings.ToLower(a.Author.User.Name) <
+			strings.ToLower(b.Author.User.Name)
+	},
+}
+
+func getSortKey(args map[string]interface{}) string {
+	if args["--sort"] == nil {
+		return ""
+	}
+
+	key := args["--sort"].(string)
+	if _, ok := pullRequestSortKeys[key]; !ok {
+		fmt.Println("--sort should be one of: updated, created, id or author.")
+		os.Exit(exitUsage)
+	}
+
+	return key
+}
+
+// sortPullRequests sorts pull requests by given key in place. Pull requests
+// which are equal by key keep order they were listed by Stash. Without key,
+// order of Stash is only reversed if requested.
+func sortPullRequests(pullRequests []stash.PullRequest, key string, reverse bool) {
+	less := pullRequestSortKeys[key]
+	if less == nil {
+		less = func(a, b stash.PullRequest) bool { return false }
+	}
+
+	if reverse {
+		for i, j := 0, len(pullRequests)-1; i < j; i, j = i+1, j-1 {
+			pullRequests[i], pullRequests[j] = pullRequests[j], pullRequests[i]
+		}
+
+		original := less
+		less = func(a, b stash.PullRequest) bool { return original(b, a) }
+	}
+
+	sort.SliceStable(pullRequests, func(i, j int) bool {
+		return less(pullRequests[i], pullRequests[j])
+	})
+}
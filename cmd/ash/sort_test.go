@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestSortPullRequests(t *testing.T) {
+	newPullRequest := func(id int64, author string, updated int64) stash.PullRequest {
+		pr := stash.PullRequest{Id: id, UpdatedDate: stash.UnixTimestamp(updated)}
+		pr.CreatedDate = stash.UnixTimestamp(id)
+		pr.Author.User.Name = author
+		return pr
+	}
+
+	tests := []struct {
+		key      string
+		reverse  bool
+		expected []int64
+	}{
+		{"updated", false, []int64{2, 3, 1}},
+		{"updated", true, []int64{1, 3, 2}},
+		{"created", false, []int64{1, 2, 3}},
+		{"id", true, []int64{3, 2, 1}},
+		{"author", false, []int64{3, 1, 2}},
+		{"", false, []int64{1, 2, 3}},
+		{"", true, []int64{3, 2, 1}},
+	}
+
+	for _, test := range tests {
+		pullRequests := []stash.PullRequest{
+			newPullRequest(1, "bob", 300),
+			newPullRequest(2, "bob", 100),
+			newPullRequest(3, "Alice", 200),
+		}
+
+		sortPullRequests(pullRequests, test.key, test.reverse)
+
+		actual := []int64{}
+		for _, pr := range pullRequests {
+			actual = append(actual, pr.Id)
+		}
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf(
+				"unexpected order by %q (reverse %v): %v, expected %v",
+				test.key, test.reverse, actual, test.expected,
+			)
+		}
+	}
+}
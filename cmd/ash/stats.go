@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// reviewStats summarizes review activity of pull requests for team
+// retrospectives.
+type reviewStats struct {
+	total    int
+	merged   int
+	declined int
+
+	// number of pull requests reviewed by anyone except author and total
+	// time they waited for the first review
+	reviewed        int
+	firstReviewTime time.Duration
+
+	// total time merged pull requests were open
+	mergeTime time.Duration
+
+	reviewers map[string]*reviewerStats
+}
+
+type reviewerStats struct {
+	comments  int
+	approvals int
+}
+
+func newReviewStats() *reviewStats {
+	return &reviewStats{reviewers: map[string]*reviewerStats{}}
+}
+
+// getSincePeriod parses period like '30d', '2w' or Go duration like '12h'.
+func getSincePeriod(args map[string]interface{}) time.Duration {
+	value := args["--since"].(string)
+
+	period, err := parsePeriod(value)
+	if err != nil || period <= 0 {
+		fmt.Println("--since should be a period like 30d, 2w or 12h.")
+		os.Exit(exitUsage)
+	}
+
+	return period
+}
+
+func parsePeriod(value string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+
+	for suffix, unit := range units {
+		if strings.HasSuffix(value, suffix) {
+			count, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+			if err != nil {
+				return 0, err
+			}
+
+			return time.Duration(count) * unit, nil
+		}
+	}
+
+	return time.ParseDuration(value)
+}
+
+// statsMode prints review statistics of pull requests created in repo
+// during the period. Activities of every pull request are retrieved, so
+// they are requested concurrently.
+func statsMode(
+	repo stash.Repo, period time.Duration, activitiesLimit int, jobs int,
+) {
+	recent, err := repo.ListPullRequestSince(time.Now().Add(-period), 100)
+	if err != nil {
+		logger.Critical("can not list reviews: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	stats := newReviewStats()
+	lock := sync.Mutex{}
+
+	indexes := make(chan int)
+
+	workers := sync.WaitGroup{}
+	for i := 0; i < jobs && i < len(recent); i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for index := range indexes {
+				pr := recent[index]
+				bound := repo.GetPullRequest(pr.Id)
+
+				events, err := bound.GetEvents(activitiesLimit)
+				if err != nil {
+					logger.Warning(
+						"can not get activities of pull request %d: %s",
+						pr.Id, err.Error(),
+					)
+
+					continue
+				}
+
+				lock.Lock()
+				stats.add(pr, events)
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for index := range recent {
+		indexes <- index
+	}
+
+	close(indexes)
+
+	workers.Wait()
+
+	stats.print(os.Stdout, period)
+}
+
+// add takes pull request and its activities into account. Activities go
+// newest first, as Stash returns them.
+func (stats *reviewStats) add(pr stash.PullRequest, events []stash.PullRequestEvent) {
+	stats.total++
+
+	author := pr.Author.User.Name
+	created := pr.CreatedDate.AsTime()
+
+	var firstReview time.Time
+
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		user := event.User.Name
+
+		switch event.Action {
+		case "MERGED":
+			stats.merged++
+			stats.mergeTime += event.CreatedDate.AsTime().Sub(created)
+			continue
+		case "DECLINED":
+			stats.declined++
+			continue
+		case "COMMENTED", "APPROVED", "REVIEWED":
+		default:
+			continue
+		}
+
+		if user == author {
+			continue
+		}
+
+		if firstReview.IsZero() {
+			firstReview = event.CreatedDate.AsTime()
+		}
+
+		reviewer := stats.reviewers[user]
+		if reviewer == nil {
+			reviewer = &reviewerStats{}
+			stats.reviewers[user] = reviewer
+		}
+
+		switch {
+		case event.Action == "APPROVED":
+			reviewer.approvals++
+		case event.Action == "COMMENTED" &&
+			(event.CommentAction == "ADDED" || event.CommentAction == "REPLIED"):
+			reviewer.comments++
+		}
+	}
+
+	if !firstReview.IsZero() {
+		stats.reviewed++
+		stats.firstReviewTime += firstReview.Sub(created)
+	}
+}
+
+func (stats *reviewStats) print(writer io.Writer, period time.Duration) {
+	fmt.Fprintf(writer,
+		"Pull requests created in last %s: %d (%d merged, %d declined)\n",
+		formatPeriod(period), stats.total, stats.merged, stats.declined,
+	)
+
+	if stats.reviewed > 0 {
+		fmt.Fprintf(writer, "Average time to first review: %s (%d reviewed)\n",
+			formatPeriod(stats.firstReviewTime/time.Duration(stats.reviewed)),
+			stats.reviewed,
+		)
+	}
+
+	if stats.merged > 0 {
+		fmt.Fprintf(writer, "Average time to merge: %s (%d merged)\n",
+			formatPeriod(stats.mergeTime/time.Duration(stats.merged)),
+			stats.merged,
+		)
+	}
+
+	if len(stats.reviewers) == 0 {
+		return
+	}
+
+	names := []string{}
+	for name := range stats.reviewers {
+		names = append(names, name)
+	}
+
+	// most active reviewers go first
+	sort.Slice(names, func(i, j int) bool {
+		a, b := stats.reviewers[names[i]], stats.reviewers[names[j]]
+		if a.comments != b.comments {
+			return a.comments > b.comments
+		}
+
+		return names[i] < names[j]
+	})
+
+	fmt.Fprintln(writer)
+
+	table := newTableWriter(writer)
+	fmt.Fprintln(table, "Reviewer\tComments\tApprovals")
+	for _, name := range names {
+		reviewer := stats.reviewers[name]
+		fmt.Fprintf(table, "%s\t%d\t%d\n",
+			name, reviewer.comments, reviewer.approvals,
+		)
+	}
+
+	table.Flush()
+}
+
+// formatPeriod formats duration in days, hours and minutes, e.g. '1d 3h'.
+func formatPeriod(period time.Duration) string {
+	days := int(period / (24 * time.Hour))
+	hours := int(period % (24 * time.Hour) / time.Hour)
+	minutes := int(period % time.Hour / time.Minute)
+
+	switch {
+	case days > 0 && hours > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case days > 0:
+		return fmt.Sprintf("%dd", days)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+	}
+
+	for value, expected := range tests {
+		actual, err := parsePeriod(value)
+		if err != nil || actual != expected {
+			t.Errorf("unexpected period for %q: %s, %v", value, actual, err)
+		}
+	}
+}
+
+func TestReviewStats(t *testing.T) {
+	hour := int64(time.Hour / time.Millisecond)
+
+	newEvent := func(
+		action string, commentAction string, user string, hours int64,
+	) stash.PullRequestEvent {
+		event := stash.PullRequestEvent{
+			Action:        action,
+			CommentAction: commentAction,
+			CreatedDate:   stash.UnixTimestamp(hours * hour),
+		}
+		event.User.Name = user
+		return event
+	}
+
+	merged := stash.PullRequest{CreatedDate: 0}
+	merged.Author.User.Name = "alice"
+
+	declined := stash.PullRequest{CreatedDate: stash.UnixTimestamp(10 * hour)}
+	declined.Author.User.Name = "bob"
+
+	stats := newReviewStats()
+
+	// activities go newest first
+	stats.add(merged, []stash.PullRequestEvent{
+		newEvent("MERGED", "", "alice", 30),
+		newEvent("APPROVED", "", "bob", 20),
+		newEvent("COMMENTED", "REPLIED", "alice", 5),
+		newEvent("COMMENTED", "ADDED", "bob", 4),
+		newEvent("OPENED", "", "alice", 0),
+	})
+
+	stats.add(declined, []stash.PullRequestEvent{
+		newEvent("DECLINED", "", "bob", 20),
+		newEvent("COMMENTED", "EDITED", "carol", 13),
+		newEvent("COMMENTED", "ADDED", "carol", 12),
+	})
+
+	output := &bytes.Buffer{}
+	stats.print(output, 30*24*time.Hour)
+
+	expected := "Pull requests created in last 30d: 2 (1 merged, 1 declined)\n" +
+		"Average time to first review: 3h 0m (2 reviewed)\n" +
+		"Average time to merge: 1d 6h (1 merged)\n" +
+		"\n" +
+		"Reviewer Comments Approvals\n" +
+		"bob      1        1\n" +
+		"carol    1        0\n"
+
+	if output.String() != expected {
+		t.Fatalf("unexpected stats:\n%s\nexpected:\n%s", output, expected)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// applySuggestions writes patch with suggestions made in pull request or
+// commits them to the source branch if push is specified. In interactive
+// mode user is asked about every suggestion.
+func applySuggestions(
+	pr stash.PullRequest, diff stash.DiffOptions, output string,
+	interactiveMode bool, push bool,
+) {
+	logger.Debug("getting pull request info")
+	info, err := pr.GetInfo()
+	if err != nil {
+		logger.Critical("can not get pull request: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	logger.Debug("downloading review of all files from Stash")
+	review, err := pr.GetFullReview(diff)
+	if err != nil {
+		logger.Critical("can not get review: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	files := stash.GroupSuggestions(review.GetSuggestions())
+	if len(files) == 0 {
+		fmt.Println("No suggestions found")
+		return
+	}
+
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	var writer io.Writer = os.Stdout
+	if output != "" && !push {
+		patchFile, err := os.Create(output)
+		if err != nil {
+			logger.Critical("can not create patch: %s", err.Error())
+			os.Exit(exitFailure)
+		}
+
+		defer patchFile.Close()
+
+		writer = patchFile
+	}
+
+	commit := info.GetLatestCommit()
+	applied := 0
+
+	for _, path := range paths {
+		content, err := pr.GetFileLines(path, commit)
+		if err != nil {
+			logger.Critical("can not get %s: %s", path, err.Error())
+			os.Exit(getErrorExitCode(err))
+		}
+
+		accepted := []stash.Suggestion{}
+		for _, suggested := range files[path] {
+			if !suggested.IsActual(content) {
+				logger.Warning(
+					"skipping suggestion <%d>: line %s:%d is changed",
+					suggested.Comment.Id, path, suggested.Line,
+				)
+				continue
+			}
+
+			if interactiveMode {
+				fmt.Printf("%s\n\n", suggested)
+				if !askConfirmation("Apply this suggestion?", true) {
+					continue
+				}
+			}
+
+			accepted = append(accepted, suggested)
+		}
+
+		if len(accepted) == 0 {
+			continue
+		}
+
+		applied += len(accepted)
+
+		if !push {
+			fmt.Fprint(writer, stash.FormatSuggestionsPatch(path, content, accepted))
+			continue
+		}
+
+		logger.Debug("committing suggestions to %s", path)
+		commit = pushSuggestions(pr, info, path, commit, content, accepted)
+	}
+
+	if applied == 0 {
+		fmt.Println("No suggestions applied")
+		os.Exit(exitNoChanges)
+	}
+
+	if push {
+		printInfo(
+			"Suggestions successfully committed to %s",
+			info.FromRef.DisplayId,
+		)
+	}
+}
+
+// pushSuggestions commits suggestions to the source branch of pull request
+// and returns new commit.
+func pushSuggestions(
+	pr stash.PullRequest, info *stash.PullRequestInfo,
+	path string, parent string, content []string, accepted []stash.Suggestion,
+) string {
+	project := stash.Project{
+		Api:  pr.Project.Api,
+		Name: "projects/" + info.FromRef.Repository.Project.Key,
+	}
+
+	repo := project.GetRepo(info.FromRef.Repository.Slug)
+
+	lines := stash.ReplaceSuggestedLines(content, accepted)
+
+	// lines of file are given without line endings
+	original, err := repo.GetRawFile(path, parent)
+	if err != nil {
+		logger.Critical("can not get %s: %s", path, err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	commit, err := repo.CommitFile(
+		path, stash.JoinFileLines(lines, original), info.FromRef.Id, parent,
+		fmt.Sprintf(
+			"Apply suggestions to %s from pull request #%d", path, pr.Id,
+		),
+	)
+	if err != nil {
+		logger.Critical("can not commit %s: %s", path, err.Error())
+		os.Exit(exitFailure)
+	}
+
+	return commit.Id
+}
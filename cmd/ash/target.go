@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// reviewTarget is pull request which is reviewed in review file. It is
+// either pull request of Stash or of other backend, e.g. Bitbucket Cloud.
+type reviewTarget struct {
+	service  stash.PullRequestService
+	comments stash.CommentService
+
+	// location of pull request, which drafts and reviewed commits are
+	// stored by
+	project string
+	repo    string
+	id      int64
+
+	// user, which reviews pull request
+	user string
+
+	// pull request of Stash, nil for other backends, which do not support
+	// offline reviews
+	stash *stash.PullRequest
+}
+
+func newStashTarget(pr stash.PullRequest) reviewTarget {
+	return reviewTarget{
+		service:  &pr,
+		comments: &pr,
+		project:  pr.Project.Name,
+		repo:     pr.Repo.Name,
+		id:       pr.Id,
+		user:     pr.Auth.Username,
+		stash:    &pr,
+	}
+}
+
+// serviceMode runs command of pull request of backend other than Stash,
+// which supports only review and state changes. Commands and flags, which
+// are listed as unsupported, are rejected.
+func serviceMode(
+	args map[string]interface{}, target reviewTarget, backend string,
+	unsupported []string,
+) {
+	for _, key := range unsupported {
+		if isArgSet(args[key]) {
+			fmt.Printf("'%s' is not supported for %s.\n", key, backend)
+			os.Exit(exitUsage)
+		}
+	}
+
+	paths := args["<file-name>"].([]string)
+	diff := getDiffOptions(args)
+	reviewAll := args["--all"].(bool)
+
+	if args["--since-last"].(bool) {
+		diff.SinceId, diff.UntilId = getSinceLastRange(target, target.user)
+
+		if len(paths) == 0 {
+			reviewAll = true
+		}
+	}
+
+	if len(paths) > 0 && args["--origin"] == nil && args["--input"] == nil {
+		paths = pickFiles(target.service, paths, diff)
+	}
+
+	switch {
+	case args["show-diff"].(bool):
+		var renderer stash.ReviewRenderer = stash.UnifiedRenderer{}
+		switch {
+		case args["--side-by-side"].(bool):
+			renderer = sideBySideRenderer{getWidth(args)}
+		case colors.enabled:
+			renderer = coloredRenderer{renderer}
+		}
+
+		showDiff(target.service, paths, diff, renderer)
+	case args["approve"].(bool):
+		approve(target.service)
+	case args["unapprove"].(bool):
+		unapprove(target.service)
+	case args["needs-work"].(bool):
+		needsWork(target.service)
+	case args["decline"].(bool):
+		decline(target.service, getEditor(args))
+	case args["reopen"].(bool):
+		reopen(target.service)
+	case args["merge"].(bool):
+		merge(target.service)
+	default:
+		runReview(args, target, paths, reviewAll, diff)
+	}
+}
+
+// isArgSet returns whether command, flag or option is given in cmd line.
+func isArgSet(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return value
+	case []string:
+		return len(value) > 0
+	default:
+		return true
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+var templatesPath = os.Getenv("HOME") + "/.config/ash/templates"
+
+// Template is inserted by writing its name prefixed by '@' on separate line
+// of comment, e.g. '# @nitpick'.
+var reTemplateLine = regexp.MustCompile(`^\s*@([\w.-]+)\s*$`)
+
+func getTemplatesDir(args map[string]interface{}) string {
+	if args["--templates"] != nil {
+		return args["--templates"].(string)
+	}
+
+	return templatesPath
+}
+
+// loadTemplates reads templates from given dir; name of template is the
+// name of the file without extension, so 'nitpick.md' is '@nitpick'.
+func loadTemplates(dir string) (map[string]string, error) {
+	templates := map[string]string{}
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return templates, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+
+		templates[name] = strings.TrimSpace(string(data))
+	}
+
+	return templates, nil
+}
+
+// expandTemplates replaces template lines in text with bodies of templates.
+// Lines with unknown names are kept as is, because they can be mentions.
+func expandTemplates(text string, templates map[string]string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		matches := reTemplateLine.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		if body, ok := templates[matches[1]]; ok {
+			lines[i] = body
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// expandChangesTemplates expands templates in texts of new and modified
+// comments, so they are posted already expanded.
+func expandChangesTemplates(
+	changes []stash.ReviewChange, templates map[string]string,
+) {
+	if len(templates) == 0 {
+		return
+	}
+
+	for _, change := range changes {
+		comment := stash.GetChangeComment(change)
+		if comment != nil {
+			comment.Text = expandTemplates(comment.Text, templates)
+		}
+	}
+}
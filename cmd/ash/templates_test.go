@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExpandTemplates(t *testing.T) {
+	templates := map[string]string{
+		"nitpick": "Nitpick, feel free to ignore.",
+	}
+
+	actual := expandTemplates(
+		"@nitpick\nMissing space after comma.\n@john, what do you think?\n@seletskiy",
+		templates,
+	)
+
+	expected := "Nitpick, feel free to ignore.\nMissing space after comma.\n" +
+		"@john, what do you think?\n@seletskiy"
+
+	if actual != expected {
+		t.Fatalf("unexpected expanded text\n%q\n%q", expected, actual)
+	}
+}
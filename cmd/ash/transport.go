@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+const maxIdleConnsPerHost = 16
+
+// getHTTPClient returns client for requests to Stash, which is shared by
+// all resources of the Api, so connections and cookies are shared too.
+func getHTTPClient(args map[string]interface{}) (*http.Client, error) {
+	timeout, err := strconv.Atoi(args["--timeout"].(string))
+	if err != nil || timeout < 0 {
+		return nil, errors.New("--timeout should be a number of seconds")
+	}
+
+	transport, err := getTransport(args)
+	if err != nil {
+		return nil, err
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(timeout) * time.Second,
+		Jar:       jar,
+	}
+
+	if args["--trace"].(bool) {
+		client.Transport = stash.TracingTransport{Next: transport}
+	}
+
+	return client, nil
+}
+
+func getRetries(args map[string]interface{}) (int, error) {
+	retries, err := strconv.Atoi(args["--retries"].(string))
+	if err != nil || retries < 0 {
+		return 0, errors.New("--retries should be a number")
+	}
+
+	return retries, nil
+}
+
+// getTransport returns transport for requests to Stash. Proxy is taken from
+// --proxy or, if it is not specified, from HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY env vars.
+func getTransport(args map[string]interface{}) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+
+		// requests are made concurrently when PRs are listed, so more
+		// than default two idle connections should be kept
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	if args["--proxy"] != nil {
+		proxyURL, err := parseProxyURL(args["--proxy"].(string))
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Debug("using proxy %s", proxyURL.Host)
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := getTLSConfig(args)
+	if err != nil {
+		return nil, err
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
+
+// getTLSConfig returns TLS config with custom CA bundle and client
+// certificate for Stash instances behind internal CA and mutual TLS.
+func getTLSConfig(args map[string]interface{}) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if args["--insecure"].(bool) {
+		logger.Warning("TLS certificate verification is disabled")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if args["--ca-cert"] != nil {
+		caPath := args["--ca-cert"].(string)
+
+		caData, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("can not read CA bundle: %s", err.Error())
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificates found in %s", caPath)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	certPath, _ := args["--client-cert"].(string)
+	keyPath, _ := args["--client-key"].(string)
+
+	switch {
+	case certPath == "" && keyPath == "":
+		return tlsConfig, nil
+	case certPath == "":
+		return nil, errors.New("--client-cert should be specified")
+	case keyPath == "":
+		// key can be stored in the same file with certificate
+		keyPath = certPath
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"can not load client certificate: %s", err.Error(),
+		)
+	}
+
+	tlsConfig.Certificates = []tls.Certificate{cert}
+
+	return tlsConfig, nil
+}
+
+// parseProxyURL parses proxy address; http:// is assumed if no scheme is
+// specified, as curl does.
+func parseProxyURL(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || proxyURL.Host == "" {
+		proxyURL, err = url.Parse("http://" + proxy)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy '%s': %s", proxy, err.Error())
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+		return proxyURL, nil
+	default:
+		return nil, fmt.Errorf(
+			"unsupported proxy scheme '%s'", proxyURL.Scheme,
+		)
+	}
+}
@@ -0,0 +1,703 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+const (
+	keyUp       = "up"
+	keyDown     = "down"
+	keyPageUp   = "page-up"
+	keyPageDown = "page-down"
+	keyHome     = "home"
+	keyEnd      = "end"
+	keyEnter    = "enter"
+	keyEscape   = "escape"
+	keyQuit     = "ctrl-c"
+)
+
+// tuiKeys maps input sequences of terminal in raw mode to keys; vi-like
+// keys are aliases for arrows.
+var tuiKeys = map[string]string{
+	"\x1b[A":  keyUp,
+	"\x1bOA":  keyUp,
+	"k":       keyUp,
+	"\x1b[B":  keyDown,
+	"\x1bOB":  keyDown,
+	"j":       keyDown,
+	"\x1b[5~": keyPageUp,
+	"b":       keyPageUp,
+	"\x1b[6~": keyPageDown,
+	" ":       keyPageDown,
+	"\x1b[H":  keyHome,
+	"\x1b[1~": keyHome,
+	"g":       keyHome,
+	"\x1b[F":  keyEnd,
+	"\x1b[4~": keyEnd,
+	"G":       keyEnd,
+	"\r":      keyEnter,
+	"\n":      keyEnter,
+	"l":       keyEnter,
+	"\x1b":    keyEscape,
+	"h":       keyEscape,
+	"q":       keyEscape,
+	"\x03":    keyQuit,
+}
+
+// tuiScreen is a scrollable list of lines. Screens are stacked when user
+// drills into pull request, its files and their diffs.
+type tuiScreen struct {
+	title string
+	lines []string
+
+	// selectable screen highlights line under cursor, others are just
+	// scrolled like in pager
+	selectable bool
+
+	cursor int
+	offset int
+
+	// jumps are indexes of lines, which are visited by 'n' and 'N', like
+	// comment threads in diff
+	jumps []int
+
+	load func() error
+
+	// open returns screen with details of the selected line
+	open func(index int) (*tuiScreen, error)
+
+	// review returns what is reviewed in editor by 'r' for the selected
+	// line; nothing is reviewed if pull request is nil
+	review func(index int) (*stash.PullRequest, []string)
+}
+
+// tui is a full-screen terminal interface, which is drawn on /dev/tty in
+// raw mode, so it does not need any terminal libraries.
+type tui struct {
+	tty     *os.File
+	state   string
+	screens []*tuiScreen
+	status  string
+	rows    int
+	columns int
+
+	startReview func(pr stash.PullRequest, paths []string) error
+}
+
+func tuiMode(args map[string]interface{}, api stash.Api, repo *stash.Repo) {
+	diff := getDiffOptions(args)
+
+	var screen *tuiScreen
+	if repo == nil {
+		screen = newInboxScreen(api, diff, args["-l"].(string))
+	} else {
+		screen = newPullRequestsScreen(
+			args["<project>/<repo>"].(string), *repo, getLimit(args), diff,
+			args["-l"].(string),
+		)
+	}
+
+	err := screen.load()
+	if err != nil {
+		logger.Critical("can not list pull requests: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		logger.Critical("can not open terminal: %s", err.Error())
+		os.Exit(exitFailure)
+	}
+
+	defer tty.Close()
+
+	ui := &tui{
+		tty:         tty,
+		screens:     []*tuiScreen{screen},
+		startReview: runReviewCommand,
+	}
+
+	err = ui.run()
+	if err != nil {
+		logger.Critical("tui failed: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+}
+
+func (ui *tui) run() error {
+	err := ui.enter()
+	if err != nil {
+		return err
+	}
+
+	defer ui.leave()
+
+	for len(ui.screens) > 0 {
+		ui.draw()
+
+		key, err := ui.readKey()
+		if err != nil {
+			return err
+		}
+
+		ui.status = ""
+
+		screen := ui.screens[len(ui.screens)-1]
+
+		switch key {
+		case keyQuit:
+			return nil
+		case keyEscape:
+			ui.screens = ui.screens[:len(ui.screens)-1]
+		case keyEnter:
+			if screen.open == nil || len(screen.lines) == 0 {
+				break
+			}
+
+			next, err := screen.open(screen.cursor)
+			if err != nil {
+				ui.status = err.Error()
+				break
+			}
+
+			if next != nil {
+				ui.screens = append(ui.screens, next)
+			}
+		case "r":
+			ui.review(screen)
+		case "n":
+			screen.jump(1, ui.height())
+		case "N":
+			screen.jump(-1, ui.height())
+		default:
+			screen.move(key, ui.height())
+		}
+	}
+
+	return nil
+}
+
+// review suspends tui to run review in editor, like it is run from cmd
+// line, and reloads screen after that, because review could change it.
+func (ui *tui) review(screen *tuiScreen) {
+	if screen.review == nil || len(screen.lines) == 0 {
+		return
+	}
+
+	pr, paths := screen.review(screen.cursor)
+	if pr == nil {
+		return
+	}
+
+	ui.leave()
+
+	reviewErr := ui.startReview(*pr, paths)
+
+	fmt.Print("\nPress any key to return to ash tui.")
+
+	err := ui.enter()
+	if err == nil {
+		_, err = ui.readKey()
+	}
+
+	if err != nil {
+		ui.status = err.Error()
+		return
+	}
+
+	if reviewErr != nil {
+		ui.status = "review is not applied: " + reviewErr.Error()
+	}
+
+	if screen.load != nil {
+		err := screen.load()
+		if err != nil {
+			ui.status = err.Error()
+		}
+	}
+}
+
+// runReviewCommand runs review of pull request in separate ash process,
+// so review can exit as usual without quitting tui. Options given before
+// 'tui' command are passed to it.
+func runReviewCommand(pr stash.PullRequest, paths []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	args := []string{}
+	for _, arg := range os.Args[1:] {
+		if arg == "tui" {
+			break
+		}
+
+		args = append(args, arg)
+	}
+
+	args = append(args, getPullRequestURL(pr), "review")
+	args = append(args, paths...)
+
+	cmd := exec.Command(executable, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// enter switches terminal to raw mode and alternate screen; terminal
+// state is saved to be restored on leave.
+func (ui *tui) enter() error {
+	state, err := ui.stty("-g")
+	if err != nil {
+		return err
+	}
+
+	ui.state = strings.TrimSpace(state)
+
+	_, err = ui.stty("raw", "-echo")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(ui.tty, "\x1b[?1049h\x1b[?25l")
+
+	return nil
+}
+
+func (ui *tui) leave() {
+	fmt.Fprint(ui.tty, "\x1b[?25h\x1b[?1049l")
+
+	_, err := ui.stty(ui.state)
+	if err != nil {
+		logger.Error("can not restore terminal: %s", err.Error())
+	}
+}
+
+func (ui *tui) stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = ui.tty
+
+	output, err := cmd.Output()
+
+	return string(output), err
+}
+
+func (ui *tui) readKey() (string, error) {
+	input, err := ui.readInput()
+	if err != nil {
+		return "", err
+	}
+
+	if key, ok := tuiKeys[input]; ok {
+		return key, nil
+	}
+
+	return input, nil
+}
+
+// readInput reads input of single key press, which is several bytes for
+// special keys.
+func (ui *tui) readInput() (string, error) {
+	buffer := make([]byte, 16)
+
+	size, err := ui.tty.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buffer[:size]), nil
+}
+
+// height returns number of lines of screen, first line of terminal is
+// taken by title and last one by status.
+func (ui *tui) height() int {
+	return ui.rows - 2
+}
+
+func (ui *tui) draw() {
+	rows, columns, err := getTerminalSize()
+	if err != nil {
+		rows, columns = 24, 80
+	}
+
+	ui.rows, ui.columns = rows, columns
+
+	screen := ui.screens[len(ui.screens)-1]
+	screen.scroll(ui.height())
+
+	output := &bytes.Buffer{}
+	output.WriteString("\x1b[H\x1b[2J")
+
+	output.WriteString(
+		"\x1b[1;7m" + fitToWidth(screen.title, columns) + ansiReset + "\r\n",
+	)
+
+	// lines above the screen are painted too, so hunk of the first visible
+	// line is known
+	painter := diffPainter{palette: colors}
+	for index, line := range screen.lines {
+		if index >= screen.offset {
+			break
+		}
+
+		painter.paint(reAnsiEscape.ReplaceAllString(line, ""))
+	}
+
+	for row := 0; row < ui.height(); row++ {
+		index := screen.offset + row
+		if index >= len(screen.lines) {
+			output.WriteString("\r\n")
+			continue
+		}
+
+		line := fitToWidth(
+			reAnsiEscape.ReplaceAllString(screen.lines[index], ""), columns,
+		)
+
+		switch {
+		case screen.selectable && index == screen.cursor:
+			line = "\x1b[7m" + line + ansiReset
+		case !screen.selectable:
+			line = painter.paint(line)
+		}
+
+		output.WriteString(line + "\r\n")
+	}
+
+	status := ui.status
+	if status == "" {
+		status = screen.help()
+	}
+
+	output.WriteString(fitToWidth(status, columns-1))
+
+	ui.tty.Write(output.Bytes())
+}
+
+func (screen *tuiScreen) help() string {
+	keys := []string{"j/k move"}
+
+	if screen.open != nil {
+		keys = append(keys, "enter open")
+	}
+
+	if screen.review != nil {
+		keys = append(keys, "r review")
+	}
+
+	if screen.jumps != nil {
+		keys = append(keys, "n/N next/prev thread")
+	}
+
+	keys = append(keys, "q back", "ctrl-c quit")
+
+	return strings.Join(keys, "  ")
+}
+
+// move moves cursor of selectable screen or scrolls others.
+func (screen *tuiScreen) move(key string, height int) {
+	position := &screen.offset
+	if screen.selectable {
+		position = &screen.cursor
+	}
+
+	switch key {
+	case keyUp:
+		*position--
+	case keyDown:
+		*position++
+	case keyPageUp:
+		*position -= height
+	case keyPageDown:
+		*position += height
+	case keyHome:
+		*position = 0
+	case keyEnd:
+		*position = len(screen.lines)
+	}
+
+	screen.scroll(height)
+}
+
+// jump scrolls screen to the next or previous jump line.
+func (screen *tuiScreen) jump(direction int, height int) {
+	current := screen.offset
+	if screen.selectable {
+		current = screen.cursor
+	}
+
+	target := -1
+	for _, index := range screen.jumps {
+		if direction > 0 && index > current && target == -1 {
+			target = index
+		}
+
+		if direction < 0 && index < current {
+			target = index
+		}
+	}
+
+	if target == -1 {
+		return
+	}
+
+	if screen.selectable {
+		screen.cursor = target
+	} else {
+		screen.offset = target
+	}
+
+	screen.scroll(height)
+}
+
+// scroll keeps cursor and offset in bounds of lines, so cursor is always
+// visible.
+func (screen *tuiScreen) scroll(height int) {
+	if height < 1 {
+		height = 1
+	}
+
+	if screen.selectable {
+		screen.cursor = clamp(screen.cursor, 0, len(screen.lines)-1)
+
+		if screen.cursor < screen.offset {
+			screen.offset = screen.cursor
+		}
+
+		if screen.cursor >= screen.offset+height {
+			screen.offset = screen.cursor - height + 1
+		}
+	}
+
+	screen.offset = clamp(screen.offset, 0, len(screen.lines)-height)
+}
+
+func clamp(value int, min int, max int) int {
+	if value > max {
+		value = max
+	}
+
+	if value < min {
+		value = min
+	}
+
+	return value
+}
+
+func newInboxScreen(api stash.Api, diff stash.DiffOptions, limit string) *tuiScreen {
+	return newPullRequestListScreen("Inbox", api, diff, limit,
+		func() ([]stash.PullRequest, error) {
+			pullRequests := []stash.PullRequest{}
+			for _, role := range []string{"reviewer", "author"} {
+				inbox, err := api.GetInbox(role)
+				if err != nil {
+					return nil, err
+				}
+
+				pullRequests = append(pullRequests, inbox...)
+			}
+
+			return pullRequests, nil
+		},
+	)
+}
+
+func newPullRequestsScreen(
+	slug string, repo stash.Repo, pageLimit int, diff stash.DiffOptions, limit string,
+) *tuiScreen {
+	return newPullRequestListScreen(
+		slug+": open pull requests", *repo.Project.Api, diff, limit,
+		func() ([]stash.PullRequest, error) {
+			return repo.ListPullRequest("open", pageLimit, true)
+		},
+	)
+}
+
+func newPullRequestListScreen(
+	title string, api stash.Api, diff stash.DiffOptions, limit string,
+	list func() ([]stash.PullRequest, error),
+) *tuiScreen {
+	pullRequests := []stash.PullRequest{}
+
+	screen := &tuiScreen{title: title, selectable: true}
+
+	screen.load = func() error {
+		var err error
+
+		pullRequests, err = list()
+		if err != nil {
+			return err
+		}
+
+		// listed pull requests are not bound to API, so they are got
+		// from their repos to be used
+		for i, pr := range pullRequests {
+			repo := stash.Project{
+				Api:  &api,
+				Name: getProjectPath(pr.FromRef.Repository.Project.Key),
+			}.GetRepo(pr.FromRef.Repository.Slug)
+
+			bound := repo.GetPullRequest(pr.Id)
+
+			pr.Repo, pr.Resource = bound.Repo, bound.Resource
+			pullRequests[i] = pr
+		}
+
+		buffer := &bytes.Buffer{}
+		writer := newTableWriter(buffer)
+		for _, pr := range pullRequests {
+			printPullRequest(writer, pullRequestListItem{
+				PullRequest: pr,
+				unreviewed:  pr.HasUnreviewedChanges(api.Auth.Username),
+			}, pullRequestPrintOptions{})
+		}
+
+		writer.Flush()
+
+		screen.lines = nil
+		for _, line := range strings.Split(buffer.String(), "\n") {
+			if line != "" {
+				screen.lines = append(screen.lines, line)
+			}
+		}
+
+		return nil
+	}
+
+	screen.open = func(index int) (*tuiScreen, error) {
+		files := newFilesScreen(pullRequests[index], diff, limit)
+
+		return files, files.load()
+	}
+
+	screen.review = func(index int) (*stash.PullRequest, []string) {
+		return &pullRequests[index], nil
+	}
+
+	return screen
+}
+
+// newFilesScreen lists changed files of pull request; first line is the
+// overview with pull request level comments.
+func newFilesScreen(pr stash.PullRequest, diff stash.DiffOptions, limit string) *tuiScreen {
+	files := stash.ReviewFiles{}
+
+	screen := &tuiScreen{
+		title:      fmt.Sprintf("#%d %s", pr.Id, pr.Title),
+		selectable: true,
+	}
+
+	screen.load = func() error {
+		var err error
+
+		files, err = pr.GetFiles(stash.DiffOptions{})
+		if err != nil {
+			return err
+		}
+
+		files = files.Exclude(diff.Exclude)
+
+		screen.lines = []string{"        overview"}
+		for _, file := range files {
+			screen.lines = append(screen.lines,
+				fmt.Sprintf("%7s %s", file.ChangeType, file.DstPath),
+			)
+		}
+
+		return nil
+	}
+
+	path := func(index int) string {
+		if index == 0 {
+			return ""
+		}
+
+		return files[index-1].GetPath()
+	}
+
+	screen.open = func(index int) (*tuiScreen, error) {
+		review := newReviewScreen(pr, path(index), diff, limit)
+
+		return review, review.load()
+	}
+
+	screen.review = func(index int) (*stash.PullRequest, []string) {
+		if index == 0 {
+			return &pr, nil
+		}
+
+		return &pr, []string{path(index)}
+	}
+
+	return screen
+}
+
+// newReviewScreen shows diff of file with comment threads, or overview if
+// path is empty, as it is written in review file.
+func newReviewScreen(
+	pr stash.PullRequest, path string, diff stash.DiffOptions, limit string,
+) *tuiScreen {
+	title := fmt.Sprintf("#%d %s", pr.Id, path)
+	if path == "" {
+		title = fmt.Sprintf("#%d overview", pr.Id)
+	}
+
+	screen := &tuiScreen{title: title}
+
+	screen.load = func() error {
+		var review *stash.Review
+		var err error
+
+		if path == "" {
+			review, err = pr.GetActivities(limit)
+		} else {
+			review, err = pr.GetReview(path, diff)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		buffer := &bytes.Buffer{}
+
+		if review.IsBinary() {
+			buffer.WriteString("Binary file is not shown.")
+		} else {
+			err = stash.WriteReview(review, buffer)
+			if err != nil {
+				return err
+			}
+		}
+
+		screen.lines = strings.Split(
+			strings.TrimRight(buffer.String(), "\n"), "\n",
+		)
+
+		screen.jumps = []int{}
+		for i, line := range screen.lines {
+			if stash.ReThreadHeader.MatchString(strings.TrimSpace(line)) {
+				screen.jumps = append(screen.jumps, i)
+			}
+		}
+
+		return nil
+	}
+
+	screen.review = func(int) (*stash.PullRequest, []string) {
+		if path == "" {
+			return &pr, nil
+		}
+
+		return &pr, []string{path}
+	}
+
+	return screen
+}
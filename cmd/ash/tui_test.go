@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTuiScreenKeepsCursorVisible(t *testing.T) {
+	screen := &tuiScreen{
+		lines:      []string{"a", "b", "c", "d", "e", "f"},
+		selectable: true,
+	}
+
+	screen.move(keyDown, 3)
+	screen.move(keyDown, 3)
+	screen.move(keyDown, 3)
+
+	if screen.cursor != 3 || screen.offset != 1 {
+		t.Fatalf("unexpected cursor %d and offset %d", screen.cursor, screen.offset)
+	}
+
+	screen.move(keyEnd, 3)
+	if screen.cursor != 5 || screen.offset != 3 {
+		t.Fatalf("unexpected cursor %d and offset %d", screen.cursor, screen.offset)
+	}
+
+	screen.move(keyPageUp, 3)
+	screen.move(keyUp, 3)
+	if screen.cursor != 1 || screen.offset != 1 {
+		t.Fatalf("unexpected cursor %d and offset %d", screen.cursor, screen.offset)
+	}
+}
+
+func TestTuiScreenJumpsBetweenThreads(t *testing.T) {
+	screen := &tuiScreen{
+		lines: make([]string, 20),
+		jumps: []int{4, 9},
+	}
+
+	screen.jump(1, 5)
+	if screen.offset != 4 {
+		t.Fatalf("unexpected offset %d", screen.offset)
+	}
+
+	screen.jump(1, 5)
+	screen.jump(1, 5)
+	if screen.offset != 9 {
+		t.Fatalf("unexpected offset %d", screen.offset)
+	}
+
+	screen.jump(-1, 5)
+	if screen.offset != 4 {
+		t.Fatalf("unexpected offset %d", screen.offset)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// watchEventsLimit is number of latest activities retrieved on every poll;
+// activities beyond it, which happened between polls, are missed.
+const watchEventsLimit = 50
+
+func getWatchInterval(args map[string]interface{}) time.Duration {
+	interval, err := time.ParseDuration(args["--interval"].(string))
+	if err != nil || interval < time.Second {
+		fmt.Println("--interval should be a duration of at least 1s, e.g. 60s.")
+		os.Exit(exitUsage)
+	}
+
+	return interval
+}
+
+// watchMode polls activities of pull request and prints new ones as a feed,
+// until interrupted. Notifications are sent about activities of enabled
+// kinds.
+func watchMode(pr stash.PullRequest, interval time.Duration, notifier notifier) {
+	events, err := pr.GetEvents(watchEventsLimit)
+	if err != nil {
+		logger.Critical("can not get activities: %s", err.Error())
+		os.Exit(getErrorExitCode(err))
+	}
+
+	lastId := int64(0)
+	if len(events) > 0 {
+		lastId = events[0].Id
+	}
+
+	title := fmt.Sprintf("%s/%d", pr.Repo.Name, pr.Id)
+
+	printInfo(
+		"Watching %s every %s, press ctrl-c to stop",
+		getPullRequestURL(pr), interval,
+	)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-interrupt:
+			return
+		case <-ticker.C:
+		}
+
+		events, err := pr.GetEvents(watchEventsLimit)
+		if err != nil {
+			code := getErrorExitCode(err)
+			if code == exitAuth || code == exitNotFound {
+				logger.Critical("can not get activities: %s", err.Error())
+				os.Exit(code)
+			}
+
+			logger.Warning("can not get activities: %s", err.Error())
+			continue
+		}
+
+		var newEvents []stash.PullRequestEvent
+		newEvents, lastId = getNewEvents(events, lastId)
+
+		for _, event := range newEvents {
+			kind, text := describeEvent(event)
+
+			fmt.Printf("[%s] %s\n",
+				formatTime(event.CreatedDate.AsTime(), "15:04"), text,
+			)
+
+			notifier.notify(kind, title, text)
+		}
+	}
+}
+
+// getNewEvents returns events, which are newer than last seen one, in
+// chronological order, and id of the newest event.
+func getNewEvents(
+	events []stash.PullRequestEvent, lastId int64,
+) ([]stash.PullRequestEvent, int64) {
+	result := []stash.PullRequestEvent{}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Id > lastId {
+			result = append(result, events[i])
+		}
+	}
+
+	if len(result) > 0 {
+		lastId = result[len(result)-1].Id
+	}
+
+	return result, lastId
+}
+
+// describeEvent returns kind of notification for event and its one line
+// description. Kind is empty for events, which are not notified about.
+func describeEvent(event stash.PullRequestEvent) (string, string) {
+	user := event.User.DisplayName
+	if user == "" {
+		user = event.User.Name
+	}
+
+	switch event.Action {
+	case "COMMENTED":
+		verb := "commented"
+		switch event.CommentAction {
+		case "EDITED":
+			verb = "edited comment"
+		case "DELETED":
+			verb = "deleted comment"
+		case "REPLIED":
+			verb = "replied"
+		}
+
+		place := "on pull request"
+		if event.CommentAnchor.Path != "" {
+			place = "on " + event.CommentAnchor.Path
+			if event.CommentAnchor.Line > 0 {
+				place += fmt.Sprintf(":%d", event.CommentAnchor.Line)
+			}
+		}
+
+		text := strings.TrimSpace(event.Comment.Text)
+		text = strings.SplitN(text, "\n", 2)[0]
+
+		return notifyComments, fmt.Sprintf(
+			"%s %s %s: %s", user, verb, place, text,
+		)
+	case "APPROVED":
+		return notifyApprovals, user + " approved"
+	case "UNAPPROVED":
+		return notifyApprovals, user + " removed approval"
+	case "REVIEWED":
+		return notifyApprovals, user + " marked as needs work"
+	case "RESCOPED":
+		if len(event.Added.Commits) == 0 {
+			return notifyPushes, user + " updated source branch"
+		}
+
+		return notifyPushes, fmt.Sprintf(
+			"%s pushed %d commit(s)", user, len(event.Added.Commits),
+		)
+	default:
+		return "", fmt.Sprintf("%s %s", user, strings.ToLower(event.Action))
+	}
+}
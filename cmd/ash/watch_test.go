@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestGetNewEvents(t *testing.T) {
+	events := []stash.PullRequestEvent{{Id: 5}, {Id: 4}, {Id: 3}, {Id: 2}}
+
+	newEvents, lastId := getNewEvents(events, 3)
+	if len(newEvents) != 2 || newEvents[0].Id != 4 || newEvents[1].Id != 5 {
+		t.Fatalf("unexpected new events: %+v", newEvents)
+	}
+
+	if lastId != 5 {
+		t.Fatalf("unexpected last id: %d", lastId)
+	}
+
+	newEvents, lastId = getNewEvents(events, 5)
+	if len(newEvents) != 0 || lastId != 5 {
+		t.Fatalf("unexpected new events: %+v, last id %d", newEvents, lastId)
+	}
+}
+
+func TestDescribeEvent(t *testing.T) {
+	tests := []struct {
+		data         string
+		expectedKind string
+		expectedText string
+	}{
+		{
+			`{"action": "COMMENTED", "commentAction": "ADDED",
+				"user": {"name": "bob", "displayName": "Bob"},
+				"comment": {"text": "Typo here\nand there"},
+				"commentAnchor": {"path": "main.go", "line": 12}}`,
+			notifyComments, "Bob commented on main.go:12: Typo here",
+		},
+		{
+			`{"action": "APPROVED", "user": {"name": "alice"}}`,
+			notifyApprovals, "alice approved",
+		},
+		{
+			`{"action": "RESCOPED", "user": {"name": "bob"},
+				"added": {"commits": [{"displayId": "a"}, {"displayId": "b"}]}}`,
+			notifyPushes, "bob pushed 2 commit(s)",
+		},
+		{
+			`{"action": "MERGED", "user": {"name": "alice"}}`,
+			"", "alice merged",
+		},
+	}
+
+	for _, test := range tests {
+		event := stash.PullRequestEvent{}
+		err := json.Unmarshal([]byte(test.data), &event)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kind, text := describeEvent(event)
+		if kind != test.expectedKind || text != test.expectedText {
+			t.Errorf(
+				"unexpected description of %s: %q %q", test.data, kind, text,
+			)
+		}
+	}
+}
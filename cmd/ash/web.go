@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// webURL is URL of pull request, which is opened in browser by --web after
+// command of pull request succeeds.
+var webURL string
+
+// webMode prints browser URL of pull request, which is built by the same
+// template as URLs given in cmd line are parsed by, so no request to Stash
+// is needed. URL is opened in browser if requested.
+func webMode(pr stash.PullRequest, open bool) {
+	url := getPullRequestURL(pr)
+
+	fmt.Println(url)
+
+	if open {
+		openURL(url)
+	}
+}
+
+// openURL opens URL in browser, failure is only reported, because URL is
+// already printed or can be opened by hand.
+func openURL(url string) {
+	err := getBrowserCommand(url).Run()
+	if err != nil {
+		logger.Warning("can not open %s in browser: %s", url, err.Error())
+	}
+}
+
+// openWebURL opens pull request in browser, if --web is given.
+func openWebURL() {
+	if webURL != "" {
+		openURL(webURL)
+	}
+}
+
+// exitSucceeded exits with exitOK after opening pull request in browser, if
+// --web is given, because deferred calls are not run on os.Exit.
+func exitSucceeded() {
+	openWebURL()
+	os.Exit(exitOK)
+}
+
+// isWebApplicable returns true if --web can be given for the command: it
+// opens pull request only after command of pull request or after 'create'.
+func isWebApplicable(args map[string]interface{}) bool {
+	return args["<project>/<repo>/<pr>"] != nil ||
+		isArgSet(args["review"]) || isArgSet(args["create"])
+}
+
+// getBrowserCommand returns command, which opens URL in $BROWSER or in
+// default browser of system.
+func getBrowserCommand(url string) *exec.Cmd {
+	if browser := os.Getenv("BROWSER"); browser != "" {
+		args := strings.Fields(browser)
+		return exec.Command(args[0], append(args[1:], url)...)
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url)
+	case "windows":
+		return exec.Command("cmd", "/c", "start", "", url)
+	default:
+		return exec.Command("xdg-open", url)
+	}
+}
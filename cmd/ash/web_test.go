@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+func TestGetBrowserCommandUsesBrowserEnv(t *testing.T) {
+	defer os.Setenv("BROWSER", os.Getenv("BROWSER"))
+
+	os.Setenv("BROWSER", "firefox --new-tab")
+
+	url := "https://stash.local/projects/P/repos/r/pull-requests/1"
+
+	cmd := getBrowserCommand(url)
+
+	expected := []string{"firefox", "--new-tab", url}
+
+	if !reflect.DeepEqual(cmd.Args, expected) {
+		t.Fatalf("unexpected browser command: %q", cmd.Args)
+	}
+}
+
+func TestGetPullRequestURLMatchesStashURL(t *testing.T) {
+	api := stash.Api{URL: "https://stash.local/stash"}
+	repo := stash.Project{Api: &api, Name: getProjectPath("proj")}.GetRepo("repo")
+
+	url := getPullRequestURL(repo.GetPullRequest(12))
+
+	matches := reStashURL.FindStringSubmatch(url)
+	if matches == nil {
+		t.Fatalf("URL is not parsed back: %s", url)
+	}
+
+	if matches[2] != "projects/proj" || matches[5] != "repo" ||
+		matches[6] != "12" {
+		t.Fatalf("unexpected parts of URL %s: %q", url, matches)
+	}
+}
+
+func TestIsWebApplicable(t *testing.T) {
+	tests := []struct {
+		args     map[string]interface{}
+		expected bool
+	}{
+		{map[string]interface{}{"<project>/<repo>/<pr>": "repo/12"}, true},
+		{map[string]interface{}{"review": true}, true},
+		{map[string]interface{}{"create": true}, true},
+		{map[string]interface{}{"inbox": true, "review": false}, false},
+	}
+
+	for _, test := range tests {
+		actual := isWebApplicable(test.args)
+		if actual != test.expected {
+			t.Errorf(
+				"unexpected result for %v: %v, expected %v",
+				test.args, actual, test.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var reAnsiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// wideRanges are ranges of runes, which take two columns in terminal: east
+// asian wide and fullwidth characters and emoji.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f},
+	{0x231a, 0x231b},
+	{0x23e9, 0x23ec},
+	{0x23f0, 0x23f0},
+	{0x23f3, 0x23f3},
+	{0x25fd, 0x25fe},
+	{0x2614, 0x2615},
+	{0x2648, 0x2653},
+	{0x267f, 0x267f},
+	{0x2693, 0x2693},
+	{0x26a1, 0x26a1},
+	{0x26aa, 0x26ab},
+	{0x26bd, 0x26be},
+	{0x26c4, 0x26c5},
+	{0x26ce, 0x26ce},
+	{0x26d4, 0x26d4},
+	{0x26ea, 0x26ea},
+	{0x26f2, 0x26f3},
+	{0x26f5, 0x26f5},
+	{0x26fa, 0x26fa},
+	{0x26fd, 0x26fd},
+	{0x2705, 0x2705},
+	{0x270a, 0x270b},
+	{0x2728, 0x2728},
+	{0x274c, 0x274c},
+	{0x274e, 0x274e},
+	{0x2753, 0x2755},
+	{0x2757, 0x2757},
+	{0x2795, 0x2797},
+	{0x27b0, 0x27b0},
+	{0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c},
+	{0x2b50, 0x2b50},
+	{0x2b55, 0x2b55},
+	{0x2e80, 0x303e},
+	{0x3041, 0x33ff},
+	{0x3400, 0x4dbf},
+	{0x4e00, 0x9fff},
+	{0xa000, 0xa4cf},
+	{0xac00, 0xd7a3},
+	{0xf900, 0xfaff},
+	{0xfe30, 0xfe4f},
+	{0xff00, 0xff60},
+	{0xffe0, 0xffe6},
+	{0x1f004, 0x1f004},
+	{0x1f0cf, 0x1f0cf},
+	{0x1f18e, 0x1f18e},
+	{0x1f191, 0x1f19a},
+	{0x1f200, 0x1f251},
+	{0x1f300, 0x1f64f},
+	{0x1f680, 0x1f6ff},
+	{0x1f900, 0x1f9ff},
+	{0x1fa70, 0x1faff},
+	{0x20000, 0x3fffd},
+}
+
+// runeWidth returns number of columns, which rune takes in terminal.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0x200d || (r >= 0xfe00 && r <= 0xfe0f):
+		// zero width joiner and variation selectors, which make emoji
+		// from the previous rune
+		return 0
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r):
+		return 0
+	case unicode.IsControl(r):
+		return 0
+	}
+
+	for _, wide := range wideRanges {
+		if r < wide[0] {
+			return 1
+		}
+
+		if r <= wide[1] {
+			return 2
+		}
+	}
+
+	return 1
+}
+
+// displayWidth returns number of columns, which text takes in terminal.
+// Color escape sequences are not counted.
+func displayWidth(text string) int {
+	width := 0
+	for _, r := range reAnsiEscape.ReplaceAllString(text, "") {
+		width += runeWidth(r)
+	}
+
+	return width
+}
+
+// tableWriter aligns tab-separated cells into columns like tabwriter does,
+// but takes into account display width of cells, so wide characters and
+// emoji do not break columns.
+type tableWriter struct {
+	output io.Writer
+	buffer bytes.Buffer
+}
+
+func newTableWriter(output io.Writer) *tableWriter {
+	return &tableWriter{output: output}
+}
+
+func (writer *tableWriter) Write(data []byte) (int, error) {
+	return writer.buffer.Write(data)
+}
+
+// Flush aligns buffered lines and writes them to the output. Column is
+// aligned in the block of consecutive lines, which have this column.
+func (writer *tableWriter) Flush() error {
+	lines := strings.Split(writer.buffer.String(), "\n")
+	writer.buffer.Reset()
+
+	cells := make([][]string, len(lines))
+	for i, line := range lines {
+		cells[i] = strings.Split(line, "\t")
+	}
+
+	widths := make([][]int, len(lines))
+	for column := 0; ; column++ {
+		found := false
+
+		for i := 0; i < len(cells); {
+			// last cell is not terminated by tab, so it is not aligned
+			if len(cells[i])-1 <= column {
+				i++
+				continue
+			}
+
+			found = true
+
+			end := i
+			width := 0
+			for end < len(cells) && len(cells[end])-1 > column {
+				cellWidth := displayWidth(cells[end][column])
+				if cellWidth > width {
+					width = cellWidth
+				}
+
+				end++
+			}
+
+			for ; i < end; i++ {
+				widths[i] = append(widths[i], width+1)
+			}
+		}
+
+		if !found {
+			break
+		}
+	}
+
+	result := &bytes.Buffer{}
+	for i, line := range cells {
+		for column, cell := range line {
+			result.WriteString(cell)
+
+			if column < len(line)-1 {
+				result.WriteString(strings.Repeat(
+					" ", widths[i][column]-displayWidth(cell),
+				))
+			}
+		}
+
+		if i < len(cells)-1 {
+			result.WriteString("\n")
+		}
+	}
+
+	_, err := writer.output.Write(result.Bytes())
+
+	return err
+}
+
+const (
+	minBranchWidth = 12
+	minAuthorWidth = 8
+)
+
+// truncateToWidth truncates text longer than specified width of columns,
+// putting ellipsis at the end. Text is not truncated if width is zero.
+func truncateToWidth(text string, width int) string {
+	if width <= 0 || displayWidth(text) <= width {
+		return text
+	}
+
+	return strings.TrimRight(fitToWidth(text, width), " ")
+}
+
+// shrinkColumns returns column widths reduced by overflow in total. The
+// widest column is shrunk first, columns are not shrunk below minimums.
+func shrinkColumns(widths []int, minimums []int, overflow int) []int {
+	result := append([]int{}, widths...)
+
+	for ; overflow > 0; overflow-- {
+		widest := -1
+		for i := range result {
+			if result[i] <= minimums[i] {
+				continue
+			}
+
+			if widest == -1 || result[i] > result[widest] {
+				widest = i
+			}
+		}
+
+		if widest == -1 {
+			break
+		}
+
+		result[widest]--
+	}
+
+	return result
+}
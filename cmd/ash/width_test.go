@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"text/tabwriter"
+)
+
+func TestTableWriterIsCompatibleWithTabwriter(t *testing.T) {
+	text := "a\tbb\tccc\n" +
+		"dddd\te\n" +
+		"no tabs\n" +
+		"ff\tg\th\ti\n" +
+		"trailing"
+
+	expected := &bytes.Buffer{}
+	tabs := tabwriter.NewWriter(expected, 0, 8, 1, ' ', 0)
+	fmt.Fprint(tabs, text)
+	tabs.Flush()
+
+	actual := &bytes.Buffer{}
+	table := newTableWriter(actual)
+	fmt.Fprint(table, text)
+	table.Flush()
+
+	if actual.String() != expected.String() {
+		t.Fatalf("unexpected table:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestTableWriterAlignsWideCharacters(t *testing.T) {
+	actual := &bytes.Buffer{}
+	table := newTableWriter(actual)
+	fmt.Fprint(table, "🚀\tship\nab\tit\n")
+	table.Flush()
+
+	expected := "🚀 ship\nab it\n"
+	if actual.String() != expected {
+		t.Fatalf("unexpected table:\n%s", actual)
+	}
+}
+
+func TestFitToWidth(t *testing.T) {
+	if text := fitToWidth("日本語", 5); text != "日本…" {
+		t.Fatalf("unexpected truncated text: %q", text)
+	}
+
+	if text := fitToWidth("👍", 4); text != "👍  " {
+		t.Fatalf("unexpected padded text: %q", text)
+	}
+}
+
+func TestTruncateToWidth(t *testing.T) {
+	if text := truncateToWidth("feature/login", 8); text != "feature…" {
+		t.Fatalf("unexpected truncated text: %q", text)
+	}
+
+	if text := truncateToWidth("master", 8); text != "master" {
+		t.Fatalf("unexpected short text: %q", text)
+	}
+
+	if text := truncateToWidth("feature/login", 0); text != "feature/login" {
+		t.Fatalf("text is truncated without width: %q", text)
+	}
+}
+
+func TestShrinkColumns(t *testing.T) {
+	tests := []struct {
+		widths   []int
+		overflow int
+		expected []int
+	}{
+		{[]int{30, 10}, 5, []int{25, 10}},
+		{[]int{20, 16}, 10, []int{13, 13}},
+		{[]int{20, 16}, 100, []int{12, 8}},
+	}
+
+	for _, test := range tests {
+		actual := shrinkColumns(test.widths, []int{12, 8}, test.overflow)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf(
+				"unexpected widths of %v shrunk by %d: %v, expected %v",
+				test.widths, test.overflow, actual, test.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package gerrit
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+)
+
+// codeReviewLabel is label, which is voted for by approving change or
+// marking it as needing work.
+const codeReviewLabel = "Code-Review"
+
+// ErrRangeUnsupported is returned on attempt to review range of commits,
+// because change in Gerrit is single commit.
+var ErrRangeUnsupported = errors.New(
+	"changes of Gerrit can not be reviewed by range of commits",
+)
+
+// Files which are added by Gerrit to the list of changed files, but are not
+// files of the commit.
+var magicFiles = map[string]bool{
+	"/COMMIT_MSG":     true,
+	"/MERGE_LIST":     true,
+	"/PATCHSET_LEVEL": true,
+}
+
+// Change is change of Gerrit, which is reviewed as pull request. Comments
+// of review are saved as drafts and published by Publish along with review
+// level comments and Labels.
+type Change struct {
+	client *Client
+
+	Project string
+	Number  int64
+
+	// labels which are voted for by published review, e.g. Verified: 1
+	Labels map[string]int
+
+	// comments of change by ids, which are used in review file
+	comments map[int64]*commentInfo
+
+	// review level comments, which are published as review message
+	messages []string
+
+	// whether drafts are saved and should be published
+	drafted bool
+}
+
+var (
+	_ stash.PullRequestService = (*Change)(nil)
+	_ stash.CommentService     = (*Change)(nil)
+	_ stash.ReviewPublisher    = (*Change)(nil)
+)
+
+type changeInfo struct {
+	Number  int64 `json:"_number"`
+	Project string
+	Branch  string
+	Subject string
+	Status  string
+	Created string
+	Updated string
+	Owner   account
+
+	CurrentRevision string `json:"current_revision"`
+	Revisions       map[string]revisionInfo
+
+	Labels map[string]struct {
+		All []struct {
+			account
+			Value int
+		}
+	}
+
+	PermittedLabels map[string][]string `json:"permitted_labels"`
+
+	TotalCommentCount      int64 `json:"total_comment_count"`
+	UnresolvedCommentCount int64 `json:"unresolved_comment_count"`
+}
+
+type revisionInfo struct {
+	Number int64 `json:"_number"`
+	Ref    string
+	Commit commitInfo
+}
+
+type commitInfo struct {
+	Commit  string
+	Parents []struct {
+		Commit string
+	}
+	Author struct {
+		Name  string
+		Email string
+		Date  string
+	}
+	Subject string
+	Message string
+}
+
+type fileInfo struct {
+	Status    string
+	Binary    bool
+	OldPath   string `json:"old_path"`
+	Size      int64
+	SizeDelta int64 `json:"size_delta"`
+}
+
+// getId returns id of change in API, which includes project, if it is
+// known.
+func (change *Change) getId() string {
+	if change.Project == "" {
+		return fmt.Sprint(change.Number)
+	}
+
+	return url.PathEscape(change.Project) + "~" + fmt.Sprint(change.Number)
+}
+
+func (change *Change) getPath(resource ...string) string {
+	return strings.Join(
+		append([]string{"changes", change.getId()}, resource...), "/",
+	)
+}
+
+// GetURL returns URL of change in web interface of Gerrit.
+func (change *Change) GetURL() string {
+	base := strings.TrimSuffix(change.client.URL, "/")
+	if change.Project == "" {
+		return fmt.Sprintf("%s/c/%d", base, change.Number)
+	}
+
+	return fmt.Sprintf("%s/c/%s/+/%d", base, change.Project, change.Number)
+}
+
+func (change *Change) getInfo() (*changeInfo, error) {
+	query := url.Values{
+		"o": {
+			"CURRENT_REVISION", "CURRENT_COMMIT", "DETAILED_LABELS",
+			"DETAILED_ACCOUNTS",
+		},
+	}
+
+	info := changeInfo{}
+
+	err := change.client.get(change.getPath(), query, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := info.Revisions[info.CurrentRevision]; !ok {
+		return nil, fmt.Errorf(
+			"current revision of change %d is not returned", change.Number,
+		)
+	}
+
+	return &info, nil
+}
+
+func (info changeInfo) getRevision() revisionInfo {
+	return info.Revisions[info.CurrentRevision]
+}
+
+// GetInfo returns info of change converted to the form of Stash pull
+// request, so it can be shown by the same templates.
+func (change *Change) GetInfo() (*stash.PullRequestInfo, error) {
+	info, err := change.getInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	revision := info.getRevision()
+
+	result := stash.PullRequestInfo{
+		Id:          info.Number,
+		Title:       info.Subject,
+		Description: getDescription(revision.Commit.Message),
+		State:       getState(info.Status),
+		CreatedDate: stash.ParseTimestamp(timestampLayout, info.Created),
+		UpdatedDate: stash.ParseTimestamp(timestampLayout, info.Updated),
+	}
+
+	result.FromRef.Id = revision.Ref
+	result.FromRef.DisplayId = revision.Ref
+	result.FromRef.LatestCommit = info.CurrentRevision
+	result.FromRef.Repository.Slug = info.Project
+	result.ToRef.DisplayId = info.Branch
+
+	result.Author.User.Name = info.Owner.GetName()
+	result.Author.User.DisplayName = info.Owner.Name
+
+	result.Properties.CommentCount = info.TotalCommentCount
+	result.Properties.OpenTaskCount = info.UnresolvedCommentCount
+
+	for _, vote := range info.Labels[codeReviewLabel].All {
+		if vote.AccountId == info.Owner.AccountId {
+			continue
+		}
+
+		status := stash.ParticipantUnapproved
+		switch {
+		case vote.Value > 0:
+			status = stash.ParticipantApproved
+		case vote.Value < 0:
+			status = stash.ParticipantNeedsWork
+		}
+
+		reviewer := struct {
+			Approved           bool
+			Status             string
+			LastReviewedCommit string
+			User               struct {
+				Name        string
+				DisplayName string
+			}
+		}{
+			Approved: vote.Value > 0,
+			Status:   status,
+		}
+
+		reviewer.User.Name = vote.GetName()
+		reviewer.User.DisplayName = vote.Name
+
+		result.Reviewers = append(result.Reviewers, reviewer)
+	}
+
+	result.Links.Self = append(result.Links.Self, struct {
+		Href string
+	}{change.GetURL()})
+
+	return &result, nil
+}
+
+// getDescription returns commit message without subject.
+func getDescription(message string) string {
+	parts := strings.SplitN(message, "\n", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+
+	return strings.TrimSpace(parts[1])
+}
+
+// getState converts status of change to state of Stash pull request.
+func getState(status string) string {
+	switch status {
+	case "NEW":
+		return "OPEN"
+	case "ABANDONED":
+		return "DECLINED"
+	default:
+		return status
+	}
+}
+
+// GetCommits returns commit of current patch set, because change in Gerrit
+// is single commit.
+func (change *Change) GetCommits(limit int, all bool) ([]stash.Commit, error) {
+	info, err := change.getInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	revision := info.getRevision()
+
+	commit := stash.Commit{
+		Id:              info.CurrentRevision,
+		DisplayId:       stash.ShortHash(info.CurrentRevision),
+		AuthorTimestamp: stash.ParseTimestamp(timestampLayout, revision.Commit.Author.Date),
+		Message:         strings.TrimSuffix(revision.Commit.Message, "\n"),
+	}
+
+	commit.Author.Name = revision.Commit.Author.Name
+	commit.Author.EmailAddress = revision.Commit.Author.Email
+
+	for _, parent := range revision.Commit.Parents {
+		commit.Parents = append(commit.Parents, struct {
+			Id string
+		}{parent.Commit})
+	}
+
+	return []stash.Commit{commit}, nil
+}
+
+func (change *Change) getFiles() (map[string]fileInfo, error) {
+	files := map[string]fileInfo{}
+
+	err := change.client.get(
+		change.getPath("revisions", "current", "files"), nil, &files,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for path := range magicFiles {
+		delete(files, path)
+	}
+
+	return files, nil
+}
+
+// GetFiles returns files changed in current patch set, sorted by path.
+func (change *Change) GetFiles(
+	options stash.DiffOptions,
+) (stash.ReviewFiles, error) {
+	if options.UntilId != "" {
+		return nil, ErrRangeUnsupported
+	}
+
+	files, err := change.getFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	result := stash.ReviewFiles{}
+	for path, file := range files {
+		reviewFile := stash.ReviewFile{
+			SrcPath:    path,
+			DstPath:    path,
+			Type:       "FILE",
+			ChangeType: stash.GetChangeType(file.Status, changeTypes),
+			Binary:     file.Binary,
+		}
+
+		switch file.Status {
+		case "A":
+			reviewFile.SrcPath = ""
+		case "D":
+			reviewFile.DstPath = ""
+		case "R", "C":
+			reviewFile.SrcPath = file.OldPath
+		}
+
+		result = append(result, reviewFile)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetPath() < result[j].GetPath()
+	})
+
+	logger.Debug("successfully got files list from Gerrit")
+
+	return result, nil
+}
+
+// changeTypes maps statuses of files to change types, which are used by
+// Stash.
+var changeTypes = map[string]string{
+	"A": "ADD",
+	"D": "DELETE",
+	"R": "MOVE",
+	"C": "COPY",
+}
+
+// GetFileSize returns size of file at given commit, which is either current
+// revision or its parent. Empty path means that file does not exist, so its
+// size is zero.
+func (change *Change) GetFileSize(path string, commit string) (int64, error) {
+	if path == "" {
+		return 0, nil
+	}
+
+	info, err := change.getInfo()
+	if err != nil {
+		return 0, err
+	}
+
+	files, err := change.getFiles()
+	if err != nil {
+		return 0, err
+	}
+
+	if file, ok := files[path]; ok && commit == info.CurrentRevision {
+		return file.Size, nil
+	}
+
+	for newPath, file := range files {
+		if newPath == path || file.OldPath == path {
+			return file.Size - file.SizeDelta, nil
+		}
+	}
+
+	return 0, fmt.Errorf("file %s is not found in change", path)
+}
+
+// review posts review of current patch set. Drafts of all patch sets are
+// published only if publishDrafts is set, so plain votes do not publish
+// drafts, which user has saved in web interface.
+func (change *Change) review(
+	message string, labels map[string]int, publishDrafts bool,
+) error {
+	payload := map[string]interface{}{
+		"drafts": "KEEP",
+	}
+
+	if publishDrafts {
+		payload["drafts"] = "PUBLISH_ALL_REVISIONS"
+	}
+
+	if message != "" {
+		payload["message"] = message
+	}
+
+	if len(labels) > 0 {
+		payload["labels"] = labels
+	}
+
+	_, err := change.client.do("POST",
+		change.getPath("revisions", "current", "review"), nil, payload,
+	)
+
+	return err
+}
+
+// Approve votes for change with the highest Code-Review value, which is
+// permitted to the user, e.g. +1 or +2.
+func (change *Change) Approve() error {
+	info, err := change.getInfo()
+	if err != nil {
+		return err
+	}
+
+	value := 0
+	for _, permitted := range info.PermittedLabels[codeReviewLabel] {
+		number, err := strconv.Atoi(strings.TrimSpace(permitted))
+		if err == nil && number > value {
+			value = number
+		}
+	}
+
+	if value == 0 {
+		return fmt.Errorf("%s vote is not permitted", codeReviewLabel)
+	}
+
+	return change.review("", map[string]int{codeReviewLabel: value}, false)
+}
+
+// Unapprove resets vote of the user.
+func (change *Change) Unapprove() error {
+	return change.review("", map[string]int{codeReviewLabel: 0}, false)
+}
+
+// NeedsWork votes against change with -1.
+func (change *Change) NeedsWork() error {
+	return change.review("", map[string]int{codeReviewLabel: -1}, false)
+}
+
+// Decline abandons change.
+func (change *Change) Decline(reason string) error {
+	payload := map[string]interface{}{}
+	if reason != "" {
+		payload["message"] = reason
+	}
+
+	_, err := change.client.do("POST", change.getPath("abandon"), nil, payload)
+
+	return err
+}
+
+// Reopen restores abandoned change.
+func (change *Change) Reopen() error {
+	_, err := change.client.do("POST", change.getPath("restore"), nil,
+		map[string]interface{}{},
+	)
+
+	return err
+}
+
+// Merge submits current patch set of change.
+func (change *Change) Merge() error {
+	_, err := change.client.do("POST",
+		change.getPath("revisions", "current", "submit"), nil,
+		map[string]interface{}{},
+	)
+
+	return err
+}
@@ -0,0 +1,151 @@
+// Package gerrit is client of Gerrit Code Review REST API. It provides
+// changes of Gerrit, which implement review services of the stash package,
+// so they can be reviewed with ash the same way as pull requests of Stash.
+// Comments are saved as drafts and published by single review, which sets
+// labels of the change.
+package gerrit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/op/go-logging"
+	"github.com/seletskiy/ash/stash"
+)
+
+// logger is logger of the package, its output and levels are set up by
+// application with go-logging module "gerrit".
+var logger = logging.MustGetLogger("gerrit")
+
+// Gerrit prepends JSON responses with this line to prevent XSSI.
+const jsonPrefix = ")]}'"
+
+// timestampLayout is layout of dates returned by Gerrit, which are in UTC.
+const timestampLayout = "2006-01-02 15:04:05.999999999"
+
+// Client is client of Gerrit server. Requests are authenticated by HTTP
+// password of the user, which is generated in Gerrit settings.
+type Client struct {
+	URL      string
+	User     string
+	Password string
+	HTTP     *http.Client
+}
+
+type account struct {
+	AccountId int64 `json:"_account_id"`
+	Name      string
+	Email     string
+	Username  string
+}
+
+// GetName returns user name of account, which is empty if account has not
+// set it.
+func (user account) GetName() string {
+	if user.Username != "" {
+		return user.Username
+	}
+
+	return user.Email
+}
+
+// Change returns change with given number. Project is optional, but it
+// makes change id unambiguous across projects.
+func (client *Client) Change(project string, number int64) *Change {
+	return &Change{
+		client:  client,
+		Project: project,
+		Number:  number,
+	}
+}
+
+func (client *Client) getURL(path string, query url.Values) string {
+	result := strings.TrimSuffix(client.URL, "/")
+
+	// authenticated endpoints are prefixed with /a/
+	if client.User != "" {
+		result += "/a"
+	}
+
+	result += "/" + strings.TrimPrefix(path, "/")
+	if len(query) > 0 {
+		result += "?" + query.Encode()
+	}
+
+	return result
+}
+
+// do sends request to Gerrit and returns body of successful response
+// without XSSI prefix. Non-2xx responses are returned as stash.StatusError,
+// so they are handled by application the same way as errors of Stash.
+func (client *Client) do(
+	method string, path string, query url.Values, payload interface{},
+) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequest(method, client.getURL(path, query), body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept", "application/json")
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	if client.User != "" {
+		request.SetBasicAuth(client.User, client.Password)
+	}
+
+	httpClient := client.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	logger.Debug("%s %s", method, request.URL)
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil, stash.StatusError{
+			Status: response.StatusCode,
+			Body:   bytes.TrimSpace(data),
+		}
+	}
+
+	return bytes.TrimPrefix(data, []byte(jsonPrefix)), nil
+}
+
+func (client *Client) get(
+	path string, query url.Values, result interface{},
+) error {
+	data, err := client.do("GET", path, query, nil)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, result)
+}
@@ -0,0 +1,704 @@
+package gerrit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+const commentPreviewLen = 40
+
+// sideParent is side of comments to lines of parent commit, comments to
+// lines of the change itself have no side.
+const sideParent = "PARENT"
+
+// ErrTasksUnsupported is returned on attempt to add or resolve task,
+// because Gerrit has no tasks.
+var ErrTasksUnsupported = errors.New("tasks are not supported by Gerrit")
+
+// ErrPublishedComment is returned on attempt to modify or remove comment,
+// which is already published, because only drafts can be changed in Gerrit.
+var ErrPublishedComment = errors.New(
+	"only draft comments can be changed in Gerrit",
+)
+
+// commentInfo is comment of change as it is returned by API. Comments
+// without line are comments to file.
+type commentInfo struct {
+	Id        string   `json:"id,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	PatchSet  int64    `json:"patch_set,omitempty"`
+	Line      int64    `json:"line,omitempty"`
+	Side      string   `json:"side,omitempty"`
+	InReplyTo string   `json:"in_reply_to,omitempty"`
+	Message   string   `json:"message"`
+	Author    *account `json:"author,omitempty"`
+
+	// draft comments are visible only to the user and can be changed
+	draft bool
+}
+
+type diffInfo struct {
+	MetaA *struct {
+		Name string
+	} `json:"meta_a"`
+	MetaB *struct {
+		Name string
+	} `json:"meta_b"`
+	Content []struct {
+		A    []string
+		B    []string
+		AB   []string
+		Skip int64
+	}
+	Binary bool
+}
+
+// getCommentId converts id of Gerrit comment, which is string, to number,
+// which identifies comment in review file. Ids are hashed, so they are the
+// same across runs.
+func getCommentId(id string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(id))
+
+	return int64(hash.Sum64() &^ (1 << 63))
+}
+
+func (info commentInfo) toComment() *godiff.Comment {
+	result := &godiff.Comment{
+		Id:   getCommentId(info.Id),
+		Text: info.Message,
+	}
+
+	if info.Author != nil {
+		result.Author.Name = info.Author.GetName()
+		result.Author.DisplayName = info.Author.Name
+	}
+
+	return result
+}
+
+// getComments returns published comments and drafts of the user, which are
+// remembered to apply changes made to them.
+func (change *Change) getComments() ([]*commentInfo, error) {
+	published := map[string][]*commentInfo{}
+
+	err := change.client.get(change.getPath("comments"), nil, &published)
+	if err != nil {
+		return nil, err
+	}
+
+	drafts := map[string][]*commentInfo{}
+	if change.client.User != "" {
+		err = change.client.get(change.getPath("drafts"), nil, &drafts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for path, comments := range drafts {
+		for _, comment := range comments {
+			comment.draft = true
+			comment.Author = &account{
+				Name:     "draft",
+				Username: change.client.User,
+			}
+		}
+
+		published[path] = append(published[path], comments...)
+	}
+
+	paths := []string{}
+	for path := range published {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	if change.comments == nil {
+		change.comments = map[int64]*commentInfo{}
+	}
+
+	result := []*commentInfo{}
+	for _, path := range paths {
+		for _, comment := range published[path] {
+			comment.Path = path
+			change.comments[getCommentId(comment.Id)] = comment
+
+			result = append(result, comment)
+		}
+	}
+
+	return result, nil
+}
+
+// getDiff returns diff of file in current patch set.
+func (change *Change) getDiff(
+	path string, options stash.DiffOptions,
+) (*godiff.Diff, error) {
+	query := url.Values{"intraline": {"false"}}
+
+	if options.ContextLines >= 0 {
+		query.Set("context", fmt.Sprint(options.ContextLines))
+	}
+
+	if options.IgnoreWhitespaces {
+		query.Set("whitespace", "IGNORE_ALL")
+	}
+
+	info := diffInfo{}
+
+	err := change.client.get(
+		change.getPath(
+			"revisions", "current", "files", url.PathEscape(path), "diff",
+		),
+		query, &info,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertDiff(info), nil
+}
+
+// convertDiff converts diff of file, which is returned by Gerrit as chunks
+// of common and changed lines, to diff of Stash format. Skipped common
+// lines separate hunks.
+func convertDiff(info diffInfo) *godiff.Diff {
+	diff := &godiff.Diff{Binary: info.Binary}
+
+	if info.MetaA != nil {
+		diff.Source.ToString = info.MetaA.Name
+	}
+
+	if info.MetaB != nil {
+		diff.Destination.ToString = info.MetaB.Name
+	}
+
+	var hunk *godiff.Hunk
+	source, destination := int64(1), int64(1)
+
+	addLines := func(segmentType string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+
+		if hunk == nil {
+			hunk = &godiff.Hunk{
+				SourceLine:      source,
+				DestinationLine: destination,
+			}
+
+			diff.Hunks = append(diff.Hunks, hunk)
+		}
+
+		segment := &godiff.Segment{Type: segmentType}
+		for _, text := range lines {
+			segment.Lines = append(segment.Lines, &godiff.Line{
+				Source:      source,
+				Destination: destination,
+				Line:        text,
+			})
+
+			if segmentType != godiff.SegmentTypeAdded {
+				source++
+				hunk.SourceSpan++
+			}
+
+			if segmentType != godiff.SegmentTypeRemoved {
+				destination++
+				hunk.DestinationSpan++
+			}
+		}
+
+		hunk.Segments = append(hunk.Segments, segment)
+	}
+
+	for _, chunk := range info.Content {
+		if chunk.Skip > 0 {
+			hunk = nil
+			source += chunk.Skip
+			destination += chunk.Skip
+
+			continue
+		}
+
+		addLines(godiff.SegmentTypeContext, chunk.AB)
+		addLines(godiff.SegmentTypeRemoved, chunk.A)
+		addLines(godiff.SegmentTypeAdded, chunk.B)
+	}
+
+	return diff
+}
+
+// attachComments adds comments of current patch set to lines of diff they
+// are anchored to. Comments to files, as well as comments of previous patch
+// sets, which lines can be changed since then, are added as file comments.
+// Replies are added to their parent comments.
+func attachComments(
+	diff *godiff.Diff, comments []*commentInfo, patchSet int64,
+) {
+	path := diff.Destination.ToString
+	if path == "" {
+		path = diff.Source.ToString
+	}
+
+	threads := map[string]*godiff.Comment{}
+	for _, info := range comments {
+		if info.Path == path {
+			threads[info.Id] = info.toComment()
+		}
+	}
+
+	for _, info := range comments {
+		comment, ok := threads[info.Id]
+		if !ok {
+			continue
+		}
+
+		if parent, ok := threads[info.InReplyTo]; ok {
+			parent.Comments = append(parent.Comments, comment)
+			continue
+		}
+
+		comment.Anchor.Path = diff.Destination.ToString
+		comment.Anchor.SrcPath = diff.Source.ToString
+
+		var segment *godiff.Segment
+		var line *godiff.Line
+		if info.PatchSet == patchSet && info.Line > 0 {
+			segment, line = findLine(diff, info.Side, info.Line)
+		}
+
+		if line == nil {
+			diff.FileComments = append(diff.FileComments, comment)
+			continue
+		}
+
+		comment.Anchor.LineType = segment.Type
+		comment.Anchor.Line = info.Line
+
+		line.Comments = append(line.Comments, comment)
+		diff.LineComments = append(diff.LineComments, comment)
+	}
+}
+
+// findLine returns line which comment is anchored to. Comments to parent
+// side are anchored to removed lines, other comments are anchored to added
+// and context lines.
+func findLine(
+	diff *godiff.Diff, side string, number int64,
+) (*godiff.Segment, *godiff.Line) {
+	for _, hunk := range diff.Hunks {
+		for _, segment := range hunk.Segments {
+			for _, line := range segment.Lines {
+				switch {
+				case side == sideParent:
+					if segment.Type == godiff.SegmentTypeRemoved &&
+						line.Source == number {
+						return segment, line
+					}
+				case segment.Type != godiff.SegmentTypeRemoved &&
+					line.Destination == number:
+					return segment, line
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// getChangeset returns diffs of given files with their comments.
+func (change *Change) getChangeset(
+	paths []string, options stash.DiffOptions, markers map[string]string,
+) (godiff.Changeset, error) {
+	result := godiff.Changeset{}
+
+	if options.UntilId != "" {
+		return result, ErrRangeUnsupported
+	}
+
+	info, err := change.getInfo()
+	if err != nil {
+		return result, err
+	}
+
+	revision := info.getRevision()
+
+	result.ToHash = info.CurrentRevision
+	if len(revision.Commit.Parents) > 0 {
+		result.FromHash = revision.Commit.Parents[0].Commit
+	}
+
+	comments, err := change.getComments()
+	if err != nil {
+		return result, err
+	}
+
+	for _, path := range paths {
+		if marker, ok := markers[path]; ok {
+			result.Diffs = append(result.Diffs, &godiff.Diff{Note: marker})
+		}
+
+		diff, err := change.getDiff(path, options)
+		if err != nil {
+			return result, err
+		}
+
+		attachComments(diff, comments, revision.Number)
+
+		result.Diffs = append(result.Diffs, diff)
+	}
+
+	return result, nil
+}
+
+// GetReview returns review of single file of current patch set.
+func (change *Change) GetReview(
+	path string, options stash.DiffOptions,
+) (*stash.Review, error) {
+	changeset, err := change.getChangeset([]string{path}, options, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	changeset.Path = path
+
+	logger.Debug("successfully got review from Gerrit")
+
+	return &stash.Review{
+		Changeset:  changeset,
+		IsOverview: false,
+	}, nil
+}
+
+// GetFullReview joins diffs of all files of current patch set into the
+// single review, separating them by headers with file names.
+func (change *Change) GetFullReview(
+	options stash.DiffOptions,
+) (*stash.Review, error) {
+	files, err := change.GetFiles(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return change.getMultiFileReview(files.Exclude(options.Exclude), options)
+}
+
+// GetFilesReview returns review of specified files, paths can be glob
+// patterns.
+func (change *Change) GetFilesReview(
+	paths []string, options stash.DiffOptions,
+) (*stash.Review, error) {
+	if !stash.IsMultiFilePaths(paths) {
+		return change.GetReview(paths[0], options)
+	}
+
+	files, err := change.GetFiles(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return change.getMultiFileReview(
+		files.Select(paths, options.Exclude), options,
+	)
+}
+
+func (change *Change) getMultiFileReview(
+	files stash.ReviewFiles, options stash.DiffOptions,
+) (*stash.Review, error) {
+	paths := []string{}
+	markers := map[string]string{}
+	for _, file := range files {
+		path := file.GetPath()
+
+		paths = append(paths, path)
+		markers[path] = stash.FormatFileMarker(path, file.ChangeType)
+	}
+
+	changeset, err := change.getChangeset(paths, options, markers)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("successfully got review of %d files from Gerrit", len(files))
+
+	return &stash.Review{
+		Changeset:   changeset,
+		IsOverview:  false,
+		IsMultiFile: true,
+	}, nil
+}
+
+// GetActivities returns overview of change with its messages, newest go
+// first.
+func (change *Change) GetActivities(limit string) (*stash.Review, error) {
+	count, err := strconv.Atoi(limit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid activities limit: %q", limit)
+	}
+
+	messages := []struct {
+		Id             string
+		Author         *account
+		Message        string
+		RevisionNumber int64 `json:"_revision_number"`
+	}{}
+
+	err = change.client.get(change.getPath("messages"), nil, &messages)
+	if err != nil {
+		return nil, err
+	}
+
+	result := godiff.Changeset{}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if count > 0 && len(result.Diffs) >= count {
+			break
+		}
+
+		message := messages[i]
+
+		comment := commentInfo{
+			Id:      message.Id,
+			Message: message.Message,
+			Author:  message.Author,
+		}
+
+		author := "Gerrit"
+		if message.Author != nil {
+			author = message.Author.Name
+		}
+
+		result.Diffs = append(result.Diffs, &godiff.Diff{
+			Note: fmt.Sprintf(
+				"%s commented on patch set %d:",
+				author, message.RevisionNumber,
+			),
+			FileComments: godiff.CommentsTree{comment.toComment()},
+		})
+	}
+
+	logger.Debug("successfully got review from Gerrit")
+
+	return &stash.Review{
+		Changeset:  result,
+		IsOverview: true,
+	}, nil
+}
+
+// GetTasks returns no tasks, because Gerrit has no tasks.
+func (change *Change) GetTasks() ([]*stash.Task, error) {
+	return []*stash.Task{}, nil
+}
+
+// ApplyChange saves change made in review file as draft. Review level
+// comments, as well as replies to messages of change, are kept to be
+// published as review message.
+func (change *Change) ApplyChange(reviewChange stash.ReviewChange) error {
+	switch c := reviewChange.(type) {
+	case stash.ReplyAdded:
+		logger.Info("replying to <%d>: <%s>", c.Parent.Id,
+			c.Comment.Short(commentPreviewLen))
+
+		parent, ok := change.comments[c.Parent.Id]
+		if !ok {
+			change.messages = append(change.messages,
+				stash.Indent(c.Parent.Text, "> ")+"\n\n"+c.Comment.Text,
+			)
+
+			return nil
+		}
+
+		return change.saveDraft(c.Comment, commentInfo{
+			Path:      parent.Path,
+			PatchSet:  parent.PatchSet,
+			Line:      parent.Line,
+			Side:      parent.Side,
+			InReplyTo: parent.Id,
+			Message:   c.Comment.Text,
+		})
+	case stash.LineCommentAdded:
+		logger.Info("commenting (L%d): <%s>",
+			c.Comment.Anchor.Line,
+			c.Comment.Short(commentPreviewLen))
+
+		draft := commentInfo{
+			Path:    stash.GetAnchorPath(c.Comment.Anchor),
+			Line:    c.Comment.Anchor.Line,
+			Message: c.Comment.Text,
+		}
+
+		if c.Comment.Anchor.LineType == godiff.SegmentTypeRemoved {
+			draft.Side = sideParent
+		}
+
+		return change.saveDraft(c.Comment, draft)
+	case stash.FileCommentAdded:
+		logger.Info("adding file level comment (%s): <%s>",
+			c.Comment.Anchor.Path,
+			c.Comment.Short(commentPreviewLen))
+
+		return change.saveDraft(c.Comment, commentInfo{
+			Path:    stash.GetAnchorPath(c.Comment.Anchor),
+			Message: c.Comment.Text,
+		})
+	case stash.ReviewCommentAdded:
+		logger.Info("adding review level comment: <%s>",
+			c.Comment.Short(commentPreviewLen))
+
+		change.messages = append(change.messages, c.Comment.Text)
+
+		return nil
+	case stash.CommentModified:
+		logger.Info("modifying comment <%d>: <%s>",
+			c.Comment.Id, c.Comment.Short(commentPreviewLen))
+
+		draft, err := change.getDraft(c.Comment.Id)
+		if err != nil {
+			return err
+		}
+
+		draft.Message = c.Comment.Text
+
+		// line and side of draft are reset, if they are not given
+		_, err = change.client.do("PUT", change.getDraftPath(draft), nil,
+			commentInfo{
+				Path:      draft.Path,
+				Line:      draft.Line,
+				Side:      draft.Side,
+				InReplyTo: draft.InReplyTo,
+				Message:   draft.Message,
+			},
+		)
+
+		return err
+	case stash.CommentRemoved:
+		logger.Info("wasting comment: <%d>", c.Comment.Id)
+
+		draft, err := change.getDraft(c.Comment.Id)
+		if err != nil {
+			return err
+		}
+
+		_, err = change.client.do("DELETE", change.getDraftPath(draft), nil, nil)
+		if err != nil {
+			return err
+		}
+
+		delete(change.comments, c.Comment.Id)
+
+		return nil
+	case stash.TaskAdded, stash.TaskStateChanged:
+		return ErrTasksUnsupported
+	default:
+		logger.Warning("unexpected <change> argument: %#v", reviewChange)
+	}
+
+	return nil
+}
+
+func (change *Change) getDraft(id int64) (*commentInfo, error) {
+	draft, ok := change.comments[id]
+	if !ok {
+		return nil, fmt.Errorf("comment <%d> is not found", id)
+	}
+
+	if !draft.draft {
+		return nil, ErrPublishedComment
+	}
+
+	return draft, nil
+}
+
+func (change *Change) getDraftPath(draft *commentInfo) string {
+	return change.getPath(
+		"revisions", getRevisionId(draft.PatchSet), "drafts", draft.Id,
+	)
+}
+
+// getRevisionId returns id of revision with given patch set number, zero
+// number means current revision, e.g. for drafts saved in it.
+func getRevisionId(patchSet int64) string {
+	if patchSet == 0 {
+		return "current"
+	}
+
+	return fmt.Sprint(patchSet)
+}
+
+// saveDraft creates draft comment in patch set of draft or in current one,
+// and sets id of draft to the comment of review.
+func (change *Change) saveDraft(
+	comment *godiff.Comment, draft commentInfo,
+) error {
+	// patch set is given by revision of request
+	payload := draft
+	payload.PatchSet = 0
+
+	data, err := change.client.do("PUT",
+		change.getPath("revisions", getRevisionId(draft.PatchSet), "drafts"),
+		nil, payload,
+	)
+	if err != nil {
+		return err
+	}
+
+	// fields, which are not returned, e.g. patch set, are kept from request
+	result := &draft
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return err
+	}
+
+	result.draft = true
+
+	if change.comments == nil {
+		change.comments = map[int64]*commentInfo{}
+	}
+
+	// tasks and replies can be added to the new comment afterwards
+	comment.Id = getCommentId(result.Id)
+	change.comments[comment.Id] = result
+	change.drafted = true
+
+	logger.Info("draft saved: <%s>", result.Id)
+
+	return nil
+}
+
+// HasPending returns whether there are saved drafts, review level comments
+// or votes for Labels to publish.
+func (change *Change) HasPending() bool {
+	return change.drafted || len(change.messages) > 0 || len(change.Labels) > 0
+}
+
+// Publish posts review, which publishes saved drafts and review level
+// comments and votes for Labels.
+func (change *Change) Publish() error {
+	if !change.HasPending() {
+		return nil
+	}
+
+	err := change.review(
+		strings.Join(change.messages, "\n\n"), change.Labels, change.drafted,
+	)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("review published")
+
+	change.messages = nil
+	change.drafted = false
+
+	return nil
+}
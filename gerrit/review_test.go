@@ -0,0 +1,289 @@
+package gerrit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/seletskiy/ash/stash"
+	"github.com/seletskiy/godiff"
+)
+
+func TestConvertDiff(t *testing.T) {
+	info := diffInfo{}
+
+	err := json.Unmarshal([]byte(`{
+		"meta_a": {"name": "main.go"},
+		"meta_b": {"name": "main.go"},
+		"content": [
+			{"skip": 10},
+			{"ab": ["func main() {"]},
+			{"a": ["\tprintln(1)"], "b": ["\tprintln(2)", "\tprintln(3)"]},
+			{"ab": ["}"]},
+			{"skip": 20},
+			{"b": ["// EOF"]}
+		]
+	}`), &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := convertDiff(info)
+
+	if diff.Source.ToString != "main.go" ||
+		diff.Destination.ToString != "main.go" {
+		t.Fatalf("unexpected paths: %q %q",
+			diff.Source.ToString, diff.Destination.ToString)
+	}
+
+	type line struct {
+		Type        string
+		Source      int64
+		Destination int64
+		Text        string
+	}
+
+	actual := [][]line{}
+	spans := [][4]int64{}
+	for _, hunk := range diff.Hunks {
+		lines := []line{}
+		for _, segment := range hunk.Segments {
+			for _, diffLine := range segment.Lines {
+				lines = append(lines, line{
+					segment.Type, diffLine.Source, diffLine.Destination,
+					diffLine.Line,
+				})
+			}
+		}
+
+		actual = append(actual, lines)
+		spans = append(spans, [4]int64{
+			hunk.SourceLine, hunk.SourceSpan,
+			hunk.DestinationLine, hunk.DestinationSpan,
+		})
+	}
+
+	expected := [][]line{
+		{
+			{godiff.SegmentTypeContext, 11, 11, "func main() {"},
+			{godiff.SegmentTypeRemoved, 12, 12, "\tprintln(1)"},
+			{godiff.SegmentTypeAdded, 13, 12, "\tprintln(2)"},
+			{godiff.SegmentTypeAdded, 13, 13, "\tprintln(3)"},
+			{godiff.SegmentTypeContext, 13, 14, "}"},
+		},
+		{
+			{godiff.SegmentTypeAdded, 34, 35, "// EOF"},
+		},
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("unexpected lines\n%#v\n%#v", expected, actual)
+	}
+
+	expectedSpans := [][4]int64{{11, 3, 11, 4}, {34, 0, 35, 1}}
+	if !reflect.DeepEqual(expectedSpans, spans) {
+		t.Fatalf("unexpected hunks\n%#v\n%#v", expectedSpans, spans)
+	}
+}
+
+func TestAttachComments(t *testing.T) {
+	diff := convertDiff(diffInfo{
+		MetaA: &struct{ Name string }{"main.go"},
+		MetaB: &struct{ Name string }{"main.go"},
+		Content: []struct {
+			A    []string
+			B    []string
+			AB   []string
+			Skip int64
+		}{
+			{AB: []string{"a"}},
+			{A: []string{"b"}, B: []string{"c"}},
+		},
+	})
+
+	comments := []*commentInfo{
+		{Id: "1", Path: "main.go", PatchSet: 2, Line: 2, Message: "added"},
+		{Id: "2", Path: "main.go", PatchSet: 2, Line: 2, Side: sideParent,
+			Message: "removed"},
+		{Id: "3", Path: "main.go", PatchSet: 1, Line: 1, Message: "outdated"},
+		{Id: "4", Path: "main.go", PatchSet: 2, Message: "file"},
+		{Id: "5", Path: "main.go", PatchSet: 2, Line: 2, InReplyTo: "1",
+			Message: "reply"},
+		{Id: "6", Path: "other.go", PatchSet: 2, Line: 1, Message: "other"},
+	}
+
+	attachComments(diff, comments, 2)
+
+	texts := func(comments godiff.CommentsTree) []string {
+		result := []string{}
+		for _, comment := range comments {
+			result = append(result, comment.Text)
+		}
+
+		return result
+	}
+
+	if actual := texts(diff.LineComments); !reflect.DeepEqual(
+		[]string{"added", "removed"}, actual,
+	) {
+		t.Fatalf("unexpected line comments: %q", actual)
+	}
+
+	if actual := texts(diff.FileComments); !reflect.DeepEqual(
+		[]string{"outdated", "file"}, actual,
+	) {
+		t.Fatalf("unexpected file comments: %q", actual)
+	}
+
+	added := diff.LineComments[0]
+	if added.Anchor.LineType != godiff.SegmentTypeAdded ||
+		added.Anchor.Line != 2 {
+		t.Fatalf("unexpected anchor of added line: %#v", added.Anchor)
+	}
+
+	if actual := texts(added.Comments); !reflect.DeepEqual(
+		[]string{"reply"}, actual,
+	) {
+		t.Fatalf("unexpected replies: %q", actual)
+	}
+
+	removed := diff.LineComments[1]
+	if removed.Anchor.LineType != godiff.SegmentTypeRemoved {
+		t.Fatalf("unexpected anchor of removed line: %#v", removed.Anchor)
+	}
+}
+
+func TestApplyChange(t *testing.T) {
+	requests := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			body, _ := ioutil.ReadAll(request.Body)
+			requests = append(requests,
+				request.Method+" "+request.URL.EscapedPath()+" "+string(body),
+			)
+
+			if user, pass, _ := request.BasicAuth(); user != "john" ||
+				pass != "secret" {
+				writer.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			writer.Write([]byte(jsonPrefix + "\n" + fmt.Sprintf(
+				`{"id": "draft%d", "patch_set": 3}`, len(requests),
+			)))
+		},
+	))
+	defer server.Close()
+
+	client := &Client{URL: server.URL, User: "john", Password: "secret"}
+	change := client.Change("infra/tools", 42)
+	change.Labels = map[string]int{"Verified": 1}
+
+	added := &godiff.Comment{Text: "added"}
+	added.Anchor.Path = "main.go"
+	added.Anchor.Line = 3
+	added.Anchor.LineType = godiff.SegmentTypeAdded
+
+	removed := &godiff.Comment{Text: "removed"}
+	removed.Anchor.SrcPath = "old.go"
+	removed.Anchor.Line = 2
+	removed.Anchor.LineType = godiff.SegmentTypeRemoved
+
+	changes := []stash.ReviewChange{
+		stash.LineCommentAdded{Comment: added},
+		stash.LineCommentAdded{Comment: removed},
+		stash.CommentModified{Comment: &godiff.Comment{Id: getCommentId("draft1"),
+			Text: "modified"}},
+		stash.ReviewCommentAdded{Comment: &godiff.Comment{Text: "overall"}},
+		stash.ReplyAdded{
+			Comment: &godiff.Comment{Text: "agreed"},
+			Parent: &godiff.Comment{
+				Id: 100, Text: "Patch Set 1: Code-Review-1",
+			},
+		},
+	}
+
+	for _, reviewChange := range changes {
+		err := change.ApplyChange(reviewChange)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if added.Id != getCommentId("draft1") {
+		t.Fatalf("id of added comment is not set: %d", added.Id)
+	}
+
+	err := change.ApplyChange(stash.TaskAdded{Comment: added, Text: "fix it"})
+	if err != ErrTasksUnsupported {
+		t.Fatalf("unexpected error of task: %v", err)
+	}
+
+	err = change.Publish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/a/changes/infra%2Ftools~42/revisions/"
+	expected := []string{
+		"PUT " + path + "current/drafts " +
+			`{"path":"main.go","line":3,"message":"added"}`,
+		"PUT " + path + "current/drafts " +
+			`{"path":"old.go","line":2,"side":"PARENT","message":"removed"}`,
+		"PUT " + path + "3/drafts/draft1 " +
+			`{"path":"main.go","line":3,"message":"modified"}`,
+		"POST " + path + "current/review " +
+			`{"drafts":"PUBLISH_ALL_REVISIONS","labels":{"Verified":1},` +
+			`"message":"overall\n\n\u003e Patch Set 1: Code-Review-1\n\n` +
+			`agreed"}`,
+	}
+
+	if !reflect.DeepEqual(expected, requests) {
+		t.Fatalf("unexpected requests\n%#v\n%#v", expected, requests)
+	}
+
+	requests = []string{}
+
+	err = change.Publish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// drafts saved in web interface are not published by plain vote
+	expected = []string{
+		"POST " + path + "current/review " +
+			`{"drafts":"KEEP","labels":{"Verified":1}}`,
+	}
+
+	if !reflect.DeepEqual(expected, requests) {
+		t.Fatalf("unexpected requests of vote\n%#v\n%#v", expected, requests)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusConflict)
+			writer.Write([]byte("change is closed\n"))
+		},
+	))
+	defer server.Close()
+
+	client := &Client{URL: server.URL}
+
+	err := client.Change("", 42).Reopen()
+
+	expected := stash.StatusError{
+		Status: http.StatusConflict,
+		Body:   []byte("change is closed"),
+	}
+
+	if !reflect.DeepEqual(expected, err) {
+		t.Fatalf("unexpected error\n%#v\n%#v", expected, err)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package stash
 
 import (
 	"encoding/json"
@@ -58,6 +58,11 @@ var commentOnFileTpl = template.Must(
 {{.Comment.Author.DisplayName}} commented on file {{.CommentAnchor.Path}}:
 `)))
 
+var commentOnPullRequestTpl = template.Must(
+	template.New(`prcomment`).Parse(tplutil.Strip(`
+{{.Comment.Author.DisplayName}} commented on pull request:
+`)))
+
 type ReviewActivity struct {
 	godiff.Changeset
 }
@@ -159,8 +164,14 @@ func (rc *reviewActionCommented) UnmarshalJSON(data []byte) error {
 				rc.diff.Note, _ = tplutil.ExecuteToString(commentOnFileTpl,
 					value)
 			}
+
+			return nil
 		}
 
+		// in case of general comment to pull request
+		rc.diff.Note, _ = tplutil.ExecuteToString(commentOnPullRequestTpl,
+			value)
+
 		return nil
 	}
 
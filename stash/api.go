@@ -0,0 +1,711 @@
+// Package stash is client of Atlassian Stash (Bitbucket Server) REST API,
+// which is used by ash. It also reads and writes review files, where
+// comments to pull request diffs are edited, and finds changes made in them.
+package stash
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bndr/gopencils"
+	"github.com/op/go-logging"
+)
+
+// logger is logger of the package, its output and levels are set up by
+// application with go-logging module "stash".
+var logger = logging.MustGetLogger("stash")
+
+type Api struct {
+	URL         string
+	Auth        gopencils.BasicAuth
+	AuthCookies []*http.Cookie
+	Client      *http.Client
+
+	// Password returns password of Auth user, if Auth.Password is empty. It
+	// is called only when credentials are sent, i.e. there is no stored
+	// session or it is expired, so user is not asked for password in vain.
+	Password func() (string, error)
+
+	// number of retries of idempotent requests
+	Retries int
+}
+
+// delay before first retry, it is doubled after every failed attempt
+const retryDelay = 500 * time.Millisecond
+
+// Retry-After delay is limited to not hang for hours on misconfigured server
+const maxRetryAfter = 2 * time.Minute
+
+type Project struct {
+	*Api
+	Name string
+}
+
+type ProjectInfo struct {
+	Key         string
+	Name        string
+	Description string
+}
+
+type BuildStats struct {
+	Successful int
+	InProgress int
+	Failed     int
+}
+
+func (stats BuildStats) String() string {
+	switch {
+	case stats.Failed > 0:
+		return "✗"
+	case stats.InProgress > 0:
+		return "…"
+	case stats.Successful > 0:
+		return "✓"
+	default:
+		return "-"
+	}
+}
+
+type ApiError struct {
+	Errors []struct {
+		Message string
+	}
+}
+
+type pagedReply struct {
+	IsLastPage    bool
+	NextPageStart int
+	Values        json.RawMessage
+}
+
+// UnixTimestamp is date in milliseconds since epoch, as Stash returns it.
+type UnixTimestamp int64
+
+// TimestampLayout is layout of timestamps formatted by String, e.g. when
+// they are printed by templates.
+var TimestampLayout = "Mon Jan _2 15:04 2006"
+
+func (u UnixTimestamp) String() string {
+	return u.AsTime().Format(TimestampLayout)
+}
+
+func (u UnixTimestamp) AsTime() time.Time {
+	return time.Unix(0, int64(u)*int64(time.Millisecond))
+}
+
+// ParseTimestamp parses date of given layout, which is returned by other
+// backends, into timestamp; zero is returned if date can not be parsed.
+func ParseTimestamp(layout string, value string) UnixTimestamp {
+	date, err := time.Parse(layout, value)
+	if err != nil {
+		return 0
+	}
+
+	return UnixTimestamp(date.UnixNano() / int64(time.Millisecond))
+}
+
+func (api Api) GetResource() *gopencils.Resource {
+	cookies := loadSessionCookies(api.URL, api.Auth.Username)
+	if len(cookies) == 0 {
+		return api.withClient(
+			gopencils.Api(fmt.Sprintf("%s/rest", api.URL), &api.Auth),
+		)
+	}
+
+	// basic auth will be used only if session is expired
+	resource := api.withClient(
+		gopencils.Api(fmt.Sprintf("%s/rest", api.URL)),
+	)
+
+	hostURL, _ := url.Parse(api.URL)
+	resource.Api.Cookies.SetCookies(hostURL, cookies)
+
+	return resource
+}
+
+// withClient makes resource use shared client of the Api instead of the
+// one created by gopencils, so connections to Stash are kept alive and
+// reused by all requests, as well as session cookies.
+func (api Api) withClient(
+	resource *gopencils.Resource,
+) *gopencils.Resource {
+	if api.Client == nil {
+		return resource
+	}
+
+	jar, ok := api.Client.Jar.(*cookiejar.Jar)
+	if !ok {
+		return resource
+	}
+
+	resource.Api.Client = api.Client
+	resource.Api.Cookies = jar
+
+	return resource
+}
+
+func (api Api) GetClient() *http.Client {
+	if api.Client == nil {
+		return &http.Client{}
+	}
+
+	client := *api.Client
+
+	return &client
+}
+
+// getAuth returns credentials of user, resolving password by Password if
+// it is not given.
+func (api Api) getAuth() (gopencils.BasicAuth, error) {
+	auth := api.Auth
+	if auth.Password != "" || api.Password == nil {
+		return auth, nil
+	}
+
+	password, err := api.Password()
+	if err != nil {
+		return auth, err
+	}
+
+	auth.Password = password
+
+	return auth, nil
+}
+
+func (api Api) authViaWeb() ([]*http.Cookie, error) {
+	if api.AuthCookies != nil {
+		return api.AuthCookies, nil
+	}
+
+	auth, err := api.getAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	jar, _ := cookiejar.New(nil)
+	client := api.GetClient()
+	client.Jar = jar
+
+	_, err = client.PostForm(api.URL+"/j_stash_security_check",
+		url.Values{
+			"j_username": {auth.Username},
+			"j_password": {auth.Password},
+		})
+
+	if err != nil {
+		return nil, err
+	}
+
+	hostURL, _ := url.Parse(api.URL)
+	api.AuthCookies = jar.Cookies(hostURL)
+
+	return api.AuthCookies, nil
+}
+
+func (api Api) DoGet(
+	res *gopencils.Resource,
+	payload ...interface{},
+) error {
+	logger.Debug("performing GET %s %v", res.Url, payload)
+	return api.doRetriedRequest(res,
+		func() (*gopencils.Resource, error) { return res.Get(payload...) })
+}
+
+func (api Api) DoPost(
+	res *gopencils.Resource,
+	payload ...interface{},
+) error {
+	logger.Debug("performing POST %s %v", res.Url, payload)
+	return api.doRequest(res,
+		func() (*gopencils.Resource, error) { return res.Post(payload...) })
+}
+
+func (api Api) DoPut(
+	res *gopencils.Resource,
+	payload ...interface{},
+) error {
+	logger.Debug("performing PUT %s %v", res.Url, payload)
+	return api.doRequest(res,
+		func() (*gopencils.Resource, error) { return res.Put(payload...) })
+}
+
+func (api Api) DoDelete(
+	res *gopencils.Resource,
+	payload ...interface{},
+) error {
+	logger.Debug("performing DELETE %s %v", res.Url, payload)
+	return api.doRequest(res,
+		func() (*gopencils.Resource, error) { return res.Delete(payload...) })
+}
+
+// DoDeleteWithBody performs DELETE request with JSON body, which is not
+// supported by gopencils, but required by some Stash endpoints.
+func (api Api) DoDeleteWithBody(
+	res *gopencils.Resource,
+	payload interface{},
+) error {
+	logger.Debug("performing DELETE %s %v", res.Url, payload)
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	auth, err := api.getAuth()
+	if err != nil {
+		return err
+	}
+
+	var response *http.Response
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequest(
+			"DELETE", getResourceURL(res), bytes.NewReader(body),
+		)
+		if err != nil {
+			return err
+		}
+
+		request.SetBasicAuth(auth.Username, auth.Password)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-Atlassian-Token", "no-check")
+
+		response, err = api.GetClient().Do(request)
+		if err != nil {
+			return err
+		}
+
+		if !api.waitRateLimit(response, attempt) {
+			break
+		}
+
+		response.Body.Close()
+	}
+
+	defer response.Body.Close()
+
+	res.Raw = response
+
+	if err := checkErrorStatus(res); err != nil {
+		logger.Warningf("Stash returned error code: %d", response.StatusCode)
+		return err
+	}
+
+	logger.Debugf("Stash returned status code: %d", response.StatusCode)
+
+	return nil
+}
+
+// DoPutMultipart performs PUT request with multipart form body, which is
+// required by Stash to edit files, and decodes response into result.
+func (api Api) DoPutMultipart(
+	res *gopencils.Resource,
+	fields map[string]string,
+	result interface{},
+) error {
+	logger.Debug("performing multipart PUT %s", res.Url)
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+
+	for name, value := range fields {
+		err := form.WriteField(name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := form.Close()
+	if err != nil {
+		return err
+	}
+
+	auth, err := api.getAuth()
+	if err != nil {
+		return err
+	}
+
+	var response *http.Response
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequest(
+			"PUT", getResourceURL(res), bytes.NewReader(body.Bytes()),
+		)
+		if err != nil {
+			return err
+		}
+
+		request.SetBasicAuth(auth.Username, auth.Password)
+		request.Header.Set("Content-Type", form.FormDataContentType())
+		request.Header.Set("X-Atlassian-Token", "no-check")
+
+		response, err = api.GetClient().Do(request)
+		if err != nil {
+			return err
+		}
+
+		if !api.waitRateLimit(response, attempt) {
+			break
+		}
+
+		response.Body.Close()
+	}
+
+	defer response.Body.Close()
+
+	res.Raw = response
+
+	if err := checkErrorStatus(res); err != nil {
+		logger.Warningf("Stash returned error code: %d", response.StatusCode)
+		return err
+	}
+
+	logger.Debugf("Stash returned status code: %d", response.StatusCode)
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// getResourceURL returns absolute URL of the resource. Path of resource is
+// relative to the base URL, which can include context path of Stash, e.g.
+// https://tools.example.com/stash/rest.
+func getResourceURL(res *gopencils.Resource) string {
+	if res.Api.BaseUrl == nil || strings.Contains(res.Url, "://") {
+		return res.Url
+	}
+	resourceURL := *res.Api.BaseUrl
+	resourceURL.Path = strings.TrimSuffix(resourceURL.Path, "/") + "/" +
+		strings.TrimPrefix(res.Url, "/")
+	return resourceURL.String()
+}
+
+// errLastPage is returned by handler of DoGetPaged to stop paging before
+// the last page.
+var errLastPage = errors.New("last page")
+
+// DoGetPaged requests resource page by page, passing values of every page
+// to the handler. Only first page is requested unless all is specified.
+func (api Api) DoGetPaged(
+	res *gopencils.Resource,
+	name string,
+	query map[string]string,
+	limit int,
+	all bool,
+	handler func(values json.RawMessage) error,
+) error {
+	pageQuery := map[string]string{}
+	for key, value := range query {
+		pageQuery[key] = value
+	}
+
+	pageQuery["limit"] = fmt.Sprint(limit)
+
+	start := 0
+	for {
+		reply := pagedReply{}
+
+		pageQuery["start"] = fmt.Sprint(start)
+
+		err := api.DoGet(res.Res(name, &reply), pageQuery)
+		if err != nil {
+			return err
+		}
+
+		err = handler(reply.Values)
+		if err == errLastPage {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !all || reply.IsLastPage {
+			return nil
+		}
+
+		start = reply.NextPageStart
+	}
+}
+
+// doRetriedRequest performs request, retrying it with exponential backoff
+// if Stash is unavailable. Only idempotent requests should be retried.
+func (api Api) doRetriedRequest(
+	res *gopencils.Resource,
+	doFunc func() (*gopencils.Resource, error),
+) error {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := api.doRequest(res, doFunc)
+		if err == nil || attempt >= api.Retries || !isTemporaryError(err) {
+			return err
+		}
+
+		logger.Warning(
+			"request to %s failed: %s; retrying in %s",
+			res.Url, err.Error(), delay,
+		)
+
+		time.Sleep(delay)
+
+		delay *= 2
+	}
+}
+
+// waitRateLimit waits for time requested by Stash in Retry-After header and
+// returns true if request was rejected because of rate limiting. Such
+// requests are not processed by Stash, so they are safe to retry.
+func (api Api) waitRateLimit(response *http.Response, attempt int) bool {
+	if attempt >= api.Retries {
+		return false
+	}
+
+	delay, ok := getRetryAfter(response, retryDelay<<uint(attempt))
+	if !ok {
+		return false
+	}
+
+	logger.Warning(
+		"Stash asked to slow down (%d), retrying in %s",
+		response.StatusCode, delay,
+	)
+
+	time.Sleep(delay)
+
+	return true
+}
+
+// getRetryAfter returns delay requested by Stash for 429 and 503 responses.
+// Retry-After can be either number of seconds or HTTP date; if it is
+// absent in 429 response, fallback delay is used.
+func getRetryAfter(
+	response *http.Response, fallback time.Duration,
+) (time.Duration, bool) {
+	header := response.Header.Get("Retry-After")
+
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests:
+	case response.StatusCode == http.StatusServiceUnavailable && header != "":
+	default:
+		return 0, false
+	}
+
+	delay := fallback
+	if seconds, err := strconv.Atoi(header); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		delay = date.Sub(time.Now())
+	}
+
+	switch {
+	case delay < 0:
+		delay = 0
+	case delay > maxRetryAfter:
+		delay = maxRetryAfter
+	}
+
+	return delay, true
+}
+
+// isTemporaryError returns true if request can succeed on retry: on
+// timeouts and reset connections as well as when Stash fails with 5xx
+// status. Other errors, e.g. of invalid URL or refused TLS certificate,
+// are not retried.
+func isTemporaryError(err error) bool {
+	switch err := err.(type) {
+	case UnexpectedStatusCode:
+		return err >= 500 && err < 600
+	case *url.Error:
+		return err.Timeout() || isTemporaryError(err.Err)
+	case *net.OpError:
+		return err.Timeout() || isTemporaryError(err.Err)
+	case *os.SyscallError:
+		return isTemporaryError(err.Err)
+	case syscall.Errno:
+		return err == syscall.ECONNRESET
+	case net.Error:
+		return err.Timeout()
+	}
+
+	return false
+}
+
+func (api Api) doRequest(
+	res *gopencils.Resource,
+	doFunc func() (*gopencils.Resource, error),
+) error {
+	res.SetHeader("X-Atlassian-Token", "no-check")
+
+	// password is resolved only for requests, which send credentials
+	if res.Api.BasicAuth != nil && res.Api.BasicAuth.Password == "" {
+		auth, err := api.getAuth()
+		if err != nil {
+			return err
+		}
+
+		res.Api.BasicAuth = &auth
+	}
+
+	resp, err := doFunc()
+	if err != nil && !isErrorResponse(resp) {
+		return err
+	}
+
+	for attempt := 0; api.waitRateLimit(resp.Raw, attempt); attempt++ {
+		resp, err = doFunc()
+		if err != nil && !isErrorResponse(resp) {
+			return err
+		}
+	}
+
+	if resp.Raw.StatusCode == 401 && res.Api.BasicAuth == nil {
+		logger.Debug("session is expired, authenticating again")
+		ClearSessionCookies(api.URL, api.Auth.Username)
+
+		auth, err := api.getAuth()
+		if err != nil {
+			return err
+		}
+
+		res.Api.BasicAuth = &auth
+		resp, err = doFunc()
+		if err != nil && !isErrorResponse(resp) {
+			return err
+		}
+	}
+
+	if err := checkErrorStatus(resp); err != nil {
+		logger.Warningf("Stash returned error code: %d", resp.Raw.StatusCode)
+		return err
+	} else {
+		logger.Debugf("Stash returned status code: %d", resp.Raw.StatusCode)
+	}
+
+	if res.Api.BasicAuth != nil {
+		storeSessionCookies(
+			api.URL, api.Auth.Username,
+			getJarCookies(res.Api.Cookies, api.URL),
+		)
+	}
+
+	return nil
+}
+
+// isNoContent returns true if Stash has responded with empty body, which
+// gopencils fails to decode. Response is missing if request itself failed.
+func isNoContent(resp *gopencils.Resource) bool {
+	return resp.Raw != nil && resp.Raw.StatusCode == http.StatusNoContent
+}
+
+// isErrorResponse returns true if Stash has responded with error status.
+// Body of error response can be not JSON, e.g. login page of expired
+// session, so its status is checked even if body can not be decoded.
+func isErrorResponse(resp *gopencils.Resource) bool {
+	return resp != nil && resp.Raw != nil && resp.Raw.StatusCode >= 400
+}
+
+func (project Project) GetRepo(name string) Repo {
+	return Repo{
+		Project: &project,
+		Name:    name,
+		Resource: project.GetResource().
+			Res("api/1.0").Res(project.Name).Res("repos").Res(name),
+	}
+}
+
+func (api Api) GetBuildStats(commit string) (*BuildStats, error) {
+	stats := BuildStats{}
+
+	err := api.DoGet(
+		api.GetResource().Res("build-status/1.0").Res("commits").
+			Res("stats").Res(commit, &stats),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func (api Api) ListProjects(
+	filter string, limit int, all bool,
+) ([]ProjectInfo, error) {
+	result := []ProjectInfo{}
+
+	query := map[string]string{}
+	if filter != "" {
+		query["name"] = filter
+	}
+
+	resource := api.GetResource().Res("api/1.0")
+
+	err := api.DoGetPaged(resource, "projects", query, limit, all,
+		func(values json.RawMessage) error {
+			page := []ProjectInfo{}
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return err
+			}
+
+			result = append(result, page...)
+
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (project Project) ListRepos(limit int, all bool) ([]RepoInfo, error) {
+	result := []RepoInfo{}
+
+	resource := project.GetResource().Res("api/1.0").Res(project.Name)
+
+	err := project.DoGetPaged(resource, "repos", nil, limit, all,
+		func(values json.RawMessage) error {
+			page := []RepoInfo{}
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return err
+			}
+
+			result = append(result, page...)
+
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func checkErrorStatus(resp *gopencils.Resource) error {
+	switch resp.Raw.StatusCode {
+	case 200, 201, 204:
+		return nil
+
+	case 400, 401, 404, 409:
+		errorBody, _ := ioutil.ReadAll(resp.Raw.Body)
+		if len(errorBody) > 0 {
+			return StatusError{resp.Raw.StatusCode, errorBody}
+		} else {
+			return UnexpectedStatusCode(resp.Raw.StatusCode)
+		}
+
+	default:
+		return UnexpectedStatusCode(resp.Raw.StatusCode)
+	}
+}
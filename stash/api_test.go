@@ -0,0 +1,137 @@
+package stash
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bndr/gopencils"
+)
+
+func TestUnixTimestampAsTime(t *testing.T) {
+	timestamp := UnixTimestamp(1456833600123)
+
+	expected := time.Date(2016, 3, 1, 12, 0, 0, 123000000, time.UTC)
+	if !timestamp.AsTime().Equal(expected) {
+		t.Fatalf("unexpected time: %s", timestamp.AsTime().UTC())
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	timestamp := ParseTimestamp(time.RFC3339Nano, "2016-03-01T12:00:00.123Z")
+	if timestamp != 1456833600123 {
+		t.Fatalf("unexpected timestamp: %d", timestamp)
+	}
+
+	if timestamp := ParseTimestamp(time.RFC3339Nano, "yesterday"); timestamp != 0 {
+		t.Fatalf("unexpected timestamp of invalid date: %d", timestamp)
+	}
+}
+
+func TestDoRequestChecksStatusOfNotJSONResponse(t *testing.T) {
+	res := &gopencils.Resource{
+		Api: &gopencils.ApiStruct{
+			BasicAuth: &gopencils.BasicAuth{Username: "alice"},
+		},
+		Headers: http.Header{},
+	}
+
+	err := Api{}.doRequest(res, func() (*gopencils.Resource, error) {
+		res.Raw = &http.Response{
+			StatusCode: 401,
+			Body:       ioutil.NopCloser(strings.NewReader("<html>")),
+		}
+
+		return res, errors.New("invalid character '<'")
+	})
+
+	status, ok := err.(StatusError)
+	if !ok || status.Status != 401 {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+}
+
+func TestDoRequestResolvesPasswordOnlyForCredentials(t *testing.T) {
+	asked := 0
+	api := Api{
+		Auth: gopencils.BasicAuth{Username: "alice"},
+		Password: func() (string, error) {
+			asked++
+			return "secret", nil
+		},
+	}
+
+	// basic auth is not set if session cookie is used
+	res := &gopencils.Resource{
+		Api:     &gopencils.ApiStruct{},
+		Headers: http.Header{},
+	}
+
+	doFunc := func() (*gopencils.Resource, error) {
+		res.Raw = &http.Response{StatusCode: 200}
+		return res, nil
+	}
+
+	err := api.doRequest(res, doFunc)
+	if err != nil || asked != 0 {
+		t.Fatalf("password is asked with session (%d times): %v", asked, err)
+	}
+
+	res.Api.BasicAuth = &gopencils.BasicAuth{Username: "alice"}
+
+	err = api.doRequest(res, doFunc)
+	if err != nil || asked != 1 {
+		t.Fatalf("password is not asked without session: %v", err)
+	}
+
+	if res.Api.BasicAuth.Password != "secret" {
+		t.Fatalf("password is not sent: %#v", res.Api.BasicAuth)
+	}
+}
+
+func TestIsTemporaryError(t *testing.T) {
+	reset := &url.Error{
+		Op:  "Get",
+		URL: "https://stash.local/rest",
+		Err: &net.OpError{
+			Op:  "read",
+			Net: "tcp",
+			Err: os.NewSyscallError("read", syscall.ECONNRESET),
+		},
+	}
+
+	invalid := &url.Error{
+		Op:  "Get",
+		URL: "stash.local/rest",
+		Err: errors.New("unsupported protocol scheme"),
+	}
+
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{reset, true},
+		{invalid, false},
+		{UnexpectedStatusCode(500), true},
+		{UnexpectedStatusCode(503), true},
+		{UnexpectedStatusCode(404), false},
+		{errors.New("invalid character"), false},
+	}
+
+	for _, test := range tests {
+		actual := isTemporaryError(test.err)
+		if actual != test.expected {
+			t.Errorf(
+				"unexpected result for %q: %v, expected %v",
+				test.err, actual, test.expected,
+			)
+		}
+	}
+}
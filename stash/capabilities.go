@@ -0,0 +1,143 @@
+package stash
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	capabilityTasks     = "tasks"
+	capabilityNeedsWork = "needs work"
+	capabilityRebase    = "rebase"
+)
+
+// MinServerVersion is the oldest version of Stash, which REST API is
+// supported; features of newer versions are listed in capabilities.
+const MinServerVersion = "3.0"
+
+type capability struct {
+	product string
+	version string
+}
+
+// capabilities lists minimal server versions required by features which
+// are not available in all Stash and Bitbucket Server releases.
+var capabilities = map[string]capability{
+	capabilityTasks:     {"Stash", "3.3"},
+	capabilityNeedsWork: {"Bitbucket Server", "4.2"},
+	capabilityRebase:    {"Bitbucket Server", "7.0"},
+}
+
+var serverInfoCache = struct {
+	sync.Mutex
+	servers map[string]*ServerInfo
+}{servers: map[string]*ServerInfo{}}
+
+type ServerInfo struct {
+	Version     string
+	DisplayName string
+}
+
+// GetServerInfo returns version of Stash, which is requested only once per
+// run.
+func (api Api) GetServerInfo() (*ServerInfo, error) {
+	serverInfoCache.Lock()
+	defer serverInfoCache.Unlock()
+
+	if info, ok := serverInfoCache.servers[api.URL]; ok {
+		return info, nil
+	}
+
+	info := ServerInfo{}
+
+	err := api.DoGet(
+		api.GetResource().Res("api/1.0").Res("application-properties", &info),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("server is %s %s", info.DisplayName, info.Version)
+
+	serverInfoCache.servers[api.URL] = &info
+
+	return &info, nil
+}
+
+// CheckVersion returns error if server is older than MinServerVersion.
+func (info ServerInfo) CheckVersion() error {
+	if compareVersions(info.Version, MinServerVersion) >= 0 {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%s %s is older than Stash %s",
+		info.DisplayName, info.Version, MinServerVersion,
+	)
+}
+
+// RequireCapability returns error if server is too old to support given
+// feature. If server version can not be determined, feature is assumed to
+// be supported.
+func (api Api) RequireCapability(name string) error {
+	required, ok := capabilities[name]
+	if !ok {
+		return nil
+	}
+
+	info, err := api.GetServerInfo()
+	if err != nil {
+		logger.Debug("can not get server version: %s", err.Error())
+		return nil
+	}
+
+	if compareVersions(info.Version, required.version) >= 0 {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%s requires %s %s or newer, but server is %s %s",
+		name, required.product, required.version,
+		info.DisplayName, info.Version,
+	)
+}
+
+// compareVersions compares dot-separated versions like '4.14.3' and
+// returns -1, 0 or 1. Non-numeric suffixes like '-SNAPSHOT' are ignored.
+func compareVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aPart, bPart := 0, 0
+		if i < len(aParts) {
+			aPart = parseVersionPart(aParts[i])
+		}
+
+		if i < len(bParts) {
+			bPart = parseVersionPart(bParts[i])
+		}
+
+		switch {
+		case aPart < bPart:
+			return -1
+		case aPart > bPart:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func parseVersionPart(part string) int {
+	end := 0
+	for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+		end++
+	}
+
+	number, _ := strconv.Atoi(part[:end])
+
+	return number
+}
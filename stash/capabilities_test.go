@@ -0,0 +1,41 @@
+package stash
+
+import (
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"3.3", "3.3", 0},
+		{"3.3.0", "3.3", 0},
+		{"3.11.2", "3.3", 1},
+		{"2.12", "3.3", -1},
+		{"7.0.0-SNAPSHOT", "7.0", 0},
+		{"6.10.1", "7.0", -1},
+	}
+
+	for _, test := range tests {
+		actual := compareVersions(test.a, test.b)
+		if actual != test.expected {
+			t.Fatalf(
+				"compareVersions(%q, %q) = %d, expected %d",
+				test.a, test.b, actual, test.expected,
+			)
+		}
+	}
+}
+
+func TestServerInfoCheckVersion(t *testing.T) {
+	info := ServerInfo{Version: "2.12.1", DisplayName: "Stash"}
+	if info.CheckVersion() == nil {
+		t.Fatalf("error expected for %s", info.Version)
+	}
+
+	info.Version = "7.21.0"
+	if err := info.CheckVersion(); err != nil {
+		t.Fatalf("unexpected error for %s: %s", info.Version, err)
+	}
+}
@@ -0,0 +1,35 @@
+package stash
+
+// PullRequestEvent is activity of pull request as Stash returns it.
+type PullRequestEvent struct {
+	Id            int64
+	CreatedDate   UnixTimestamp
+	Action        string
+	CommentAction string
+	User          struct {
+		Name        string
+		DisplayName string
+	}
+	Comment       EventComment
+	CommentAnchor struct {
+		Path string
+		Line int64
+	}
+	Added struct {
+		Commits []struct {
+			DisplayId string
+		}
+	}
+}
+
+// EventComment is comment of activity with its current replies.
+type EventComment struct {
+	Id          int64
+	Text        string
+	CreatedDate UnixTimestamp
+	Author      struct {
+		Name        string
+		DisplayName string
+	}
+	Comments []EventComment
+}
@@ -0,0 +1,245 @@
+package stash
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/seletskiy/godiff"
+)
+
+type ReviewFiles []ReviewFile
+
+type ReviewFile struct {
+	SrcPath    string
+	DstPath    string
+	Type       string
+	ChangeType string
+	SrcExec    bool
+	DstExec    bool
+	Unchanged  int
+
+	// number of lines added and removed in file, which are counted by
+	// CountLines
+	Added   int
+	Removed int
+	Binary  bool
+}
+
+func (rf *ReviewFiles) UnmarshalJSON(data []byte) error {
+	response := struct {
+		Values []struct {
+			Path struct {
+				ToString string
+			}
+			Executable       bool
+			PercentUnchanged int
+			Type             string
+			NodeType         string
+			SrcPath          struct {
+				ToString string
+			}
+			SrcExecutable bool
+		}
+	}{}
+
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range response.Values {
+		*rf = append(*rf, ReviewFile{
+			SrcPath:    change.SrcPath.ToString,
+			DstPath:    change.Path.ToString,
+			Type:       change.NodeType,
+			ChangeType: change.Type,
+			SrcExec:    change.SrcExecutable,
+			DstExec:    change.Executable,
+		})
+	}
+
+	return nil
+}
+
+// GetChangeType returns type of file change, e.g. ADD, by status of file in
+// other backend; types maps statuses to types, other statuses are MODIFY.
+func GetChangeType(status string, types map[string]string) string {
+	changeType, ok := types[status]
+	if !ok {
+		return "MODIFY"
+	}
+
+	return changeType
+}
+
+// GetPath returns path of the file in pull request, which is source path
+// for deleted files.
+func (file ReviewFile) GetPath() string {
+	if file.DstPath == "" {
+		return file.SrcPath
+	}
+
+	return file.DstPath
+}
+
+// CountLines counts added and removed lines of files in given diff of pull
+// request.
+func (files ReviewFiles) CountLines(changeset godiff.Changeset) {
+	for _, diff := range changeset.Diffs {
+		path := diff.Destination.ToString
+		if path == "" {
+			path = diff.Source.ToString
+		}
+
+		file := files.Find(path)
+		if file == nil {
+			continue
+		}
+
+		file.Binary = diff.Binary
+
+		for _, hunk := range diff.Hunks {
+			for _, segment := range hunk.Segments {
+				switch segment.Type {
+				case godiff.SegmentTypeAdded:
+					file.Added += len(segment.Lines)
+				case godiff.SegmentTypeRemoved:
+					file.Removed += len(segment.Lines)
+				}
+			}
+		}
+	}
+}
+
+// Find returns file with specified path, renamed files can be found by
+// both source and destination path.
+func (files ReviewFiles) Find(path string) *ReviewFile {
+	for i, file := range files {
+		if file.DstPath == path || file.SrcPath == path {
+			return &files[i]
+		}
+	}
+
+	return nil
+}
+
+// Match returns files which paths match given glob pattern. Besides usual
+// wildcards, '**' matches any number of directories.
+func (files ReviewFiles) Match(pattern string) ReviewFiles {
+	matcher := compileGlob(pattern)
+
+	// source path of added files and destination path of deleted ones are
+	// empty, and should not be matched by patterns like '*'
+	matches := func(path string) bool {
+		return path != "" && matcher.MatchString(path)
+	}
+
+	matched := ReviewFiles{}
+	for _, file := range files {
+		if matches(file.DstPath) || matches(file.SrcPath) {
+			matched = append(matched, file)
+		}
+	}
+
+	return matched
+}
+
+// Select returns files with specified paths, which can be glob patterns.
+// Files matching exclude patterns are selected only if they are specified
+// explicitly, not by glob. Paths which are not found are skipped.
+func (files ReviewFiles) Select(paths []string, exclude []string) ReviewFiles {
+	selected := ReviewFiles{}
+	for _, path := range paths {
+		matched := ReviewFiles{}
+		if IsGlob(path) {
+			matched = files.Match(path).Exclude(exclude)
+		} else if file := files.Find(path); file != nil {
+			matched = append(matched, *file)
+		}
+
+		if len(matched) == 0 {
+			logger.Warning("file %s is not found in pull request", path)
+		}
+
+		for _, file := range matched {
+			if selected.Find(file.GetPath()) == nil {
+				selected = append(selected, file)
+			}
+		}
+	}
+
+	return selected
+}
+
+// Exclude returns files which paths do not match any of given patterns.
+func (files ReviewFiles) Exclude(patterns []string) ReviewFiles {
+	excluded := map[string]bool{}
+	for _, pattern := range patterns {
+		for _, file := range files.Match(pattern) {
+			excluded[file.GetPath()] = true
+		}
+	}
+
+	result := ReviewFiles{}
+	for _, file := range files {
+		if !excluded[file.GetPath()] {
+			result = append(result, file)
+		}
+	}
+
+	return result
+}
+
+func IsGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// IsMultiFilePaths returns true if review of given paths is multi-file one.
+func IsMultiFilePaths(paths []string) bool {
+	return len(paths) > 1 || (len(paths) == 1 && IsGlob(paths[0]))
+}
+
+func compileGlob(pattern string) *regexp.Regexp {
+	expression := ""
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expression += "(.*/)?"
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expression += ".*"
+			i++
+		case pattern[i] == '*':
+			expression += "[^/]*"
+		case pattern[i] == '?':
+			expression += "[^/]"
+		case pattern[i] == '[':
+			end := strings.Index(pattern[i:], "]")
+			if end < 0 {
+				expression += regexp.QuoteMeta(pattern[i:])
+				i = len(pattern)
+				continue
+			}
+
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			expression += "[" + class + "]"
+			i += end
+		default:
+			expression += regexp.QuoteMeta(pattern[i : i+1])
+		}
+	}
+
+	matcher, err := regexp.Compile("^" + expression + "$")
+	if err != nil {
+		// malformed character class is matched literally
+		return regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+	}
+
+	return matcher
+}
@@ -0,0 +1,107 @@
+package stash
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seletskiy/godiff"
+)
+
+func TestReviewFilesMatch(t *testing.T) {
+	files := ReviewFiles{
+		{DstPath: "main.go"},
+		{DstPath: "src/api/api.go"},
+		{DstPath: "src/api/api_test.go"},
+		{DstPath: "src/README.md"},
+		{SrcPath: "src/old.go"},
+	}
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"*.go", []string{"main.go"}},
+		{"**/*.go", []string{
+			"main.go", "src/api/api.go", "src/api/api_test.go", "src/old.go",
+		}},
+		{"src/**/*.go", []string{
+			"src/api/api.go", "src/api/api_test.go", "src/old.go",
+		}},
+		{"src/*", []string{"src/README.md", "src/old.go"}},
+		{"src/api/api_?est.go", []string{"src/api/api_test.go"}},
+		{"src/[A-Z]*", []string{"src/README.md"}},
+		{"*.py", []string{}},
+		{"*", []string{"main.go"}},
+	}
+
+	for _, test := range tests {
+		actual := []string{}
+		for _, file := range files.Match(test.pattern) {
+			actual = append(actual, file.GetPath())
+		}
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.pattern, test.expected, actual)
+		}
+	}
+}
+
+func TestReviewFilesExclude(t *testing.T) {
+	files := ReviewFiles{
+		{DstPath: "main.go"},
+		{DstPath: "api.pb.go"},
+		{DstPath: "vendor/lib/lib.go"},
+	}
+
+	actual := []string{}
+	for _, file := range files.Exclude([]string{"vendor/**", "**/*.pb.go"}) {
+		actual = append(actual, file.GetPath())
+	}
+
+	if !reflect.DeepEqual(actual, []string{"main.go"}) {
+		t.Fatalf("unexpected files left: %v", actual)
+	}
+}
+
+func TestReviewFilesCountLines(t *testing.T) {
+	files := ReviewFiles{
+		{DstPath: "main.go", ChangeType: "MODIFY"},
+		{SrcPath: "old.go", ChangeType: "DELETE"},
+	}
+
+	segment := func(kind string, count int) *godiff.Segment {
+		return &godiff.Segment{
+			Type: kind, Lines: make([]*godiff.Line, count),
+		}
+	}
+
+	modified := &godiff.Diff{}
+	modified.Destination.ToString = "main.go"
+	modified.Hunks = []*godiff.Hunk{
+		{Segments: []*godiff.Segment{
+			segment(godiff.SegmentTypeRemoved, 2),
+			segment(godiff.SegmentTypeAdded, 3),
+		}},
+		{Segments: []*godiff.Segment{
+			segment(godiff.SegmentTypeAdded, 1),
+		}},
+	}
+
+	deleted := &godiff.Diff{}
+	deleted.Source.ToString = "old.go"
+	deleted.Hunks = []*godiff.Hunk{
+		{Segments: []*godiff.Segment{
+			segment(godiff.SegmentTypeRemoved, 10),
+		}},
+	}
+
+	files.CountLines(godiff.Changeset{Diffs: []*godiff.Diff{modified, deleted}})
+
+	if files[0].Added != 4 || files[0].Removed != 2 {
+		t.Fatalf("unexpected counts of main.go: %+v", files[0])
+	}
+
+	if files[1].Added != 0 || files[1].Removed != 10 {
+		t.Fatalf("unexpected counts of old.go: %+v", files[1])
+	}
+}
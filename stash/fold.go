@@ -0,0 +1,158 @@
+package stash
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// foldMargin is number of unchanged lines, which are left visible around
+// folded context, so changes are not hidden along with it.
+const foldMargin = 3
+
+var (
+	ReThreadHeader = regexp.MustCompile(`^# \[\d+@\d+\] \|`)
+	reThreadTask   = regexp.MustCompile(`^#\s*\[([ xX])\] TASK: `)
+)
+
+// FoldOptions describes how review file is folded. Fold markers are written
+// as ignored lines, so they are not read back.
+type FoldOptions struct {
+	// Context is number of lines in the run of unchanged lines, which is
+	// enough to fold it; 0 disables folding of context
+	Context int
+
+	// Open and Close markers; folding is disabled if they are not set
+	Open  string
+	Close string
+}
+
+// Fold makes review to be written with unchanged context and resolved
+// threads folded.
+func (review *Review) Fold(options FoldOptions) {
+	review.fold = options
+}
+
+// modeline returns vim options to fold review file by markers.
+func (options FoldOptions) modeline() string {
+	if options.Open == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" fdm=marker fmr=%s,%s", options.Open, options.Close)
+}
+
+// foldText puts fold markers around long runs of unchanged lines and around
+// threads, which tasks are all resolved.
+func foldText(text string, options FoldOptions) string {
+	lines := strings.Split(text, "\n")
+	result := make([]string, 0, len(lines))
+
+	for i := 0; i < len(lines); {
+		end := i + 1
+
+		switch {
+		case isContextLine(lines[i]):
+			for end < len(lines) && isContextLine(lines[end]) {
+				end++
+			}
+
+			result = append(result, foldContext(lines[i:end], options)...)
+		case isCommentLine(lines[i]):
+			for end < len(lines) && isCommentLine(lines[end]) {
+				end++
+			}
+
+			result = append(result, foldThreads(lines[i:end], options)...)
+		default:
+			result = append(result, lines[i])
+		}
+
+		i = end
+	}
+
+	return strings.Join(result, "\n")
+}
+
+func foldContext(lines []string, options FoldOptions) []string {
+	if options.Context == 0 || len(lines) <= options.Context ||
+		len(lines) <= 2*foldMargin {
+		return lines
+	}
+
+	folded := len(lines) - 2*foldMargin
+
+	result := append([]string{}, lines[:foldMargin]...)
+	result = append(result, fmt.Sprintf(
+		"### %s %d unchanged lines", options.Open, folded,
+	))
+	result = append(result, lines[foldMargin:foldMargin+folded]...)
+	result = append(result, "### "+options.Close)
+
+	return append(result, lines[foldMargin+folded:]...)
+}
+
+// foldThreads folds resolved threads in the block of comment lines. Thread
+// starts with delimiter, which precedes header of top-level comment, and
+// lasts until the next thread or the end of block.
+func foldThreads(lines []string, options FoldOptions) []string {
+	starts := []int{}
+	for i, line := range lines {
+		if i >= 2 && ReThreadHeader.MatchString(line) &&
+			lines[i-2] == "# ---" {
+			starts = append(starts, i-2)
+		}
+	}
+
+	if len(starts) == 0 {
+		return lines
+	}
+
+	result := append([]string{}, lines[:starts[0]]...)
+	for i, start := range starts {
+		end := len(lines)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		thread := lines[start:end]
+		if !isResolvedThread(thread) {
+			result = append(result, thread...)
+			continue
+		}
+
+		result = append(result, "### "+options.Open+" resolved thread")
+		result = append(result, thread...)
+		result = append(result, "### "+options.Close)
+	}
+
+	return result
+}
+
+// isResolvedThread returns true if thread has tasks and all of them are
+// resolved.
+func isResolvedThread(lines []string) bool {
+	tasks := 0
+	for _, line := range lines {
+		matches := reThreadTask.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		if matches[1] == " " {
+			return false
+		}
+
+		tasks++
+	}
+
+	return tasks > 0
+}
+
+func isContextLine(line string) bool {
+	return strings.HasPrefix(line, " ")
+}
+
+func isCommentLine(line string) bool {
+	return strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "###")
+}
@@ -0,0 +1,50 @@
+package stash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFoldText(t *testing.T) {
+	options := FoldOptions{Context: 8, Open: "{{{", Close: "}}}"}
+
+	lines := []string{"@@ -1,12 +1,13 @@"}
+	for i := 0; i < 10; i++ {
+		lines = append(lines, " unchanged")
+	}
+
+	lines = append(lines,
+		"+added",
+		"# ---",
+		"#",
+		"# [1@0] | John | Fri Jul  4 19:21:56 2014",
+		"#",
+		"# [x] TASK: resolved",
+		"#",
+		"# ---",
+		"# ---",
+		"#",
+		"# [2@0] | John | Fri Jul  4 19:21:56 2014",
+		"#",
+		"# [ ] TASK: open",
+		"#",
+		"# ---",
+		" unchanged",
+	)
+
+	expected := []string{"@@ -1,12 +1,13 @@"}
+	expected = append(expected, lines[1:4]...)
+	expected = append(expected, "### {{{ 4 unchanged lines")
+	expected = append(expected, lines[4:8]...)
+	expected = append(expected, "### }}}")
+	expected = append(expected, lines[8:12]...)
+	expected = append(expected, "### {{{ resolved thread")
+	expected = append(expected, lines[12:19]...)
+	expected = append(expected, "### }}}")
+	expected = append(expected, lines[19:]...)
+
+	folded := foldText(strings.Join(lines, "\n"), options)
+	if folded != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected folded text:\n%s", folded)
+	}
+}
@@ -0,0 +1,154 @@
+package stash
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GutterMode describes which line numbers are shown in the gutter of diff
+// lines in review file.
+type GutterMode int
+
+const (
+	GutterNone GutterMode = iota
+	GutterDestination
+	GutterBoth
+)
+
+const gutterSeparator = "│"
+
+var (
+	reHunkHeader = regexp.MustCompile(
+		`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`,
+	)
+
+	reGutter = regexp.MustCompile(`^([ +-]) [ 0-9]* ` + gutterSeparator + ` ?`)
+)
+
+// ShowLineNumbers makes review to be written with line numbers in the
+// gutter of diff lines. Gutter is stripped when review is read.
+func (review *Review) ShowLineNumbers(mode GutterMode) {
+	review.gutter = mode
+}
+
+// addGutter prefixes every diff line with line numbers. Diff marker is
+// kept as first char of line, so diff highlighting still works.
+func addGutter(text string, mode GutterMode) string {
+	lines := strings.Split(text, "\n")
+
+	maxNumber := int64(0)
+	forEachHunkLine(lines, func(_ int, source, destination int64) {
+		if source > maxNumber {
+			maxNumber = source
+		}
+
+		if destination > maxNumber {
+			maxNumber = destination
+		}
+	})
+
+	width := len(strconv.FormatInt(maxNumber, 10))
+
+	forEachHunkLine(lines, func(index int, source, destination int64) {
+		gutter := formatGutterNumber(destination, width)
+		if mode == GutterBoth {
+			gutter = formatGutterNumber(source, width) + " " + gutter
+		}
+
+		line := lines[index]
+
+		lines[index] = fmt.Sprintf("%s %s %s %s",
+			line[:1], gutter, gutterSeparator, line[1:],
+		)
+	})
+
+	return strings.Join(lines, "\n")
+}
+
+// stripGutter removes gutter from diff lines, if all of them have it.
+// Review without gutter is returned as is.
+func stripGutter(text string) string {
+	lines := strings.Split(text, "\n")
+
+	found := false
+	withGutter := true
+	forEachHunkLine(lines, func(index int, _, _ int64) {
+		found = true
+		withGutter = withGutter && reGutter.MatchString(lines[index])
+	})
+
+	if !found || !withGutter {
+		return text
+	}
+
+	forEachHunkLine(lines, func(index int, _, _ int64) {
+		lines[index] = lines[index][:1] +
+			lines[index][len(reGutter.FindString(lines[index])):]
+	})
+
+	return strings.Join(lines, "\n")
+}
+
+func formatGutterNumber(number int64, width int) string {
+	if number == 0 {
+		return strings.Repeat(" ", width)
+	}
+
+	return fmt.Sprintf("%*d", width, number)
+}
+
+// forEachHunkLine calls handler for every diff line in hunks of review with
+// its line numbers in old and new versions of file; number is zero if line
+// is absent in the version. Comments inside hunks are skipped.
+func forEachHunkLine(
+	lines []string, handler func(index int, source, destination int64),
+) {
+	for i := 0; i < len(lines); i++ {
+		matches := reHunkHeader.FindStringSubmatch(lines[i])
+		if matches == nil {
+			continue
+		}
+
+		source, sourceLeft := parseHunkRange(matches[1], matches[2])
+		destination, destinationLeft := parseHunkRange(matches[3], matches[4])
+
+		for i+1 < len(lines) && (sourceLeft > 0 || destinationLeft > 0) {
+			line := lines[i+1]
+
+			switch {
+			case strings.HasPrefix(line, "#"), strings.HasPrefix(line, "\\"):
+				// comments and no newline markers
+			case strings.HasPrefix(line, " "):
+				handler(i+1, source, destination)
+				source, sourceLeft = source+1, sourceLeft-1
+				destination, destinationLeft = destination+1, destinationLeft-1
+			case strings.HasPrefix(line, "-"):
+				handler(i+1, source, 0)
+				source, sourceLeft = source+1, sourceLeft-1
+			case strings.HasPrefix(line, "+"):
+				handler(i+1, 0, destination)
+				destination, destinationLeft = destination+1, destinationLeft-1
+			default:
+				// hunk is truncated
+				sourceLeft, destinationLeft = 0, 0
+				continue
+			}
+
+			i++
+		}
+	}
+}
+
+func parseHunkRange(start string, length string) (int64, int64) {
+	first, _ := strconv.ParseInt(start, 10, 64)
+
+	if length == "" {
+		return first, 1
+	}
+
+	count, _ := strconv.ParseInt(length, 10, 64)
+
+	return first, count
+}
@@ -0,0 +1,45 @@
+package stash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddGutter(t *testing.T) {
+	text := strings.Join([]string{
+		"--- a/file",
+		"+++ b/file",
+		"@@ -9,3 +9,3 @@",
+		" 9",
+		"-10",
+		"# comment",
+		"+ten",
+		" 11",
+		"",
+	}, "\n")
+
+	expected := strings.Join([]string{
+		"--- a/file",
+		"+++ b/file",
+		"@@ -9,3 +9,3 @@",
+		"   9  9 │ 9",
+		"- 10    │ 10",
+		"# comment",
+		"+    10 │ ten",
+		"  11 11 │ 11",
+		"",
+	}, "\n")
+
+	withGutter := addGutter(text, GutterBoth)
+	if withGutter != expected {
+		t.Fatalf("unexpected gutter:\n%s", withGutter)
+	}
+
+	if stripped := stripGutter(withGutter); stripped != text {
+		t.Fatalf("gutter is not stripped:\n%s", stripped)
+	}
+
+	if stripped := stripGutter(text); stripped != text {
+		t.Fatalf("review without gutter is changed:\n%s", stripped)
+	}
+}
@@ -0,0 +1,942 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bndr/gopencils"
+	"github.com/seletskiy/godiff"
+)
+
+const commentPreviewLen = 40
+
+const (
+	ParticipantApproved   = "APPROVED"
+	ParticipantUnapproved = "UNAPPROVED"
+	ParticipantNeedsWork  = "NEEDS_WORK"
+)
+
+type UnexpectedStatusCode int
+
+func (u UnexpectedStatusCode) Error() string {
+	return fmt.Sprintf("unexpected status code from Stash: %d", u)
+}
+
+// StatusError is error response of Stash with its status code.
+type StatusError struct {
+	Status int
+	Body   []byte
+}
+
+func (s StatusError) Error() string {
+	return string(s.Body)
+}
+
+type PullRequest struct {
+	*Repo
+	Resource *gopencils.Resource
+
+	Id          int64
+	Version     int64
+	Title       string
+	Description string
+	State       string
+	CreatedDate UnixTimestamp
+	UpdatedDate UnixTimestamp
+
+	FromRef struct {
+		Id              string
+		DisplayId       string
+		LatestCommit    string
+		LatestChangeset string
+		Repository      struct {
+			Slug    string
+			Project struct {
+				Key string
+			}
+		}
+	}
+
+	ToRef struct {
+		Id        string
+		DisplayId string
+	}
+
+	Author struct {
+		User struct {
+			Name        string
+			DisplayName string
+		}
+	}
+
+	Reviewers []struct {
+		Approved           bool
+		Status             string
+		LastReviewedCommit string
+		User               struct {
+			Name string
+		}
+	}
+
+	Properties struct {
+		CommentCount int64
+	}
+
+	Links struct {
+		Self []struct {
+			Href string
+		}
+	}
+}
+
+// HasUnreviewedChanges reports whether there are commits in pull request
+// which were pushed after the given reviewer has looked at it last time.
+func (pr PullRequest) HasUnreviewedChanges(user string) bool {
+	for _, reviewer := range pr.Reviewers {
+		if reviewer.User.Name != user {
+			continue
+		}
+
+		return reviewer.LastReviewedCommit != pr.GetLatestCommit()
+	}
+
+	return false
+}
+
+func (pr PullRequest) GetLatestCommit() string {
+	if pr.FromRef.LatestCommit != "" {
+		return pr.FromRef.LatestCommit
+	}
+
+	// older Stash versions use changeset term instead of commit
+	return pr.FromRef.LatestChangeset
+}
+
+type PullRequestInfo struct {
+	Id          int64
+	Version     int64
+	Title       string
+	Description string
+	State       string
+	CreatedDate UnixTimestamp
+	UpdatedDate UnixTimestamp
+	FromRef     struct {
+		Id              string
+		DisplayId       string
+		LatestCommit    string
+		LatestChangeset string
+		Repository      struct {
+			Slug    string
+			Project struct {
+				Key string
+			}
+		}
+	}
+	ToRef struct {
+		DisplayId string
+	}
+	Author struct {
+		User struct {
+			Name        string
+			DisplayName string
+		}
+	}
+	Properties struct {
+		CommentCount  int64
+		OpenTaskCount int64
+	}
+	Reviewers []struct {
+		Approved           bool
+		Status             string
+		LastReviewedCommit string
+		User               struct {
+			Name        string
+			DisplayName string
+		}
+	}
+	Links struct {
+		Self []struct {
+			Href string
+		}
+	}
+}
+
+type Commit struct {
+	Id              string
+	DisplayId       string
+	AuthorTimestamp UnixTimestamp
+	Author          struct {
+		Name         string
+		EmailAddress string
+	}
+	Message string
+	Parents []struct {
+		Id string
+	}
+}
+
+// ShortHash returns abbreviated hash of commit, which is used as display id
+// of commits of other backends.
+func ShortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+
+	return hash
+}
+
+func (commit Commit) Subject() string {
+	return strings.SplitN(commit.Message, "\n", 2)[0]
+}
+
+type Veto struct {
+	SummaryMessage  string
+	DetailedMessage string
+}
+
+type MergeStatus struct {
+	CanMerge   bool
+	Conflicted bool
+	Vetoes     []Veto
+}
+
+type RebaseStatus struct {
+	CanRebase bool
+	CanWrite  bool
+	Vetoes    []Veto
+}
+
+func (info PullRequestInfo) GetLatestCommit() string {
+	if info.FromRef.LatestCommit != "" {
+		return info.FromRef.LatestCommit
+	}
+
+	return info.FromRef.LatestChangeset
+}
+
+func (pr *PullRequest) GetInfo() (*PullRequestInfo, error) {
+	pr.Resource.Response = &PullRequestInfo{}
+	err := pr.DoGet(pr.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	return pr.Resource.Response.(*PullRequestInfo), nil
+}
+
+func (pr *PullRequest) Update(
+	info *PullRequestInfo, title string, description string,
+) error {
+	reviewers := []map[string]interface{}{}
+	for _, reviewer := range info.Reviewers {
+		reviewers = append(reviewers, map[string]interface{}{
+			"user": map[string]interface{}{
+				"name": reviewer.User.Name,
+			},
+		})
+	}
+
+	payload := map[string]interface{}{
+		"version":     info.Version,
+		"title":       title,
+		"description": description,
+		"reviewers":   reviewers,
+	}
+
+	pr.Resource.Response = &PullRequestInfo{}
+
+	return pr.DoPut(pr.Resource, payload)
+}
+
+// DiffOptions control how diffs are requested from Stash.
+type DiffOptions struct {
+	IgnoreWhitespaces bool
+
+	// number of context lines around changes, negative means default
+	ContextLines int
+
+	// files matching these patterns are not included in multi-file review,
+	// unless they are specified explicitly
+	Exclude []string
+
+	// commits to diff between instead of the whole pull request
+	SinceId string
+	UntilId string
+}
+
+func (options DiffOptions) getQuery() map[string]string {
+	query := make(map[string]string)
+	if options.IgnoreWhitespaces {
+		query["whitespace"] = "ignore-all"
+	}
+
+	if options.ContextLines >= 0 {
+		query["contextLines"] = fmt.Sprint(options.ContextLines)
+	}
+
+	if options.UntilId != "" {
+		query["sinceId"] = options.SinceId
+		query["untilId"] = options.UntilId
+	}
+
+	return query
+}
+
+func (pr *PullRequest) GetReview(
+	path string, options DiffOptions,
+) (*Review, error) {
+	result := godiff.Changeset{}
+
+	queryString := options.getQuery()
+
+	err := pr.DoGet(
+		pr.Resource.Res("diff").Id(path, &result).SetQuery(queryString),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, diff := range result.Diffs {
+		diff.Attributes.FromHash = []string{result.FromHash}
+		diff.Attributes.ToHash = []string{result.ToHash}
+	}
+
+	// TODO: refactor block
+	result.ForEachLine(
+		func(
+			diff *godiff.Diff, _ *godiff.Hunk,
+			_ *godiff.Segment, line *godiff.Line,
+		) error {
+			for _, id := range line.CommentIds {
+				for _, c := range diff.LineComments {
+					if c.Id == id {
+						line.Comments = append(line.Comments, c)
+						diff.LineComments = append(diff.LineComments, c)
+						break
+					}
+				}
+			}
+
+			return nil
+		})
+
+	result.Path = path
+
+	logger.Debug("successfully got review from Stash")
+
+	return &Review{
+		Changeset:  result,
+		IsOverview: false,
+	}, nil
+}
+
+// GetFullReview joins diffs of all files in pull request into the single
+// review, separating them by headers with file names.
+func (pr *PullRequest) GetFullReview(options DiffOptions) (*Review, error) {
+	files, err := pr.GetFiles(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return pr.getMultiFileReview(files.Exclude(options.Exclude), options)
+}
+
+// GetFilesReview returns review of specified files, paths can be glob
+// patterns. Review of single file is the same as returned by GetReview,
+// several files are reviewed in one multi-file review. Files which are not
+// found in pull request are skipped.
+func (pr *PullRequest) GetFilesReview(
+	paths []string, options DiffOptions,
+) (*Review, error) {
+	if !IsMultiFilePaths(paths) {
+		return pr.GetReview(paths[0], options)
+	}
+
+	files, err := pr.GetFiles(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return pr.getMultiFileReview(
+		files.Select(paths, options.Exclude), options,
+	)
+}
+
+func (pr *PullRequest) getMultiFileReview(
+	files ReviewFiles, options DiffOptions,
+) (*Review, error) {
+	result := &Review{
+		IsOverview:  false,
+		IsMultiFile: true,
+	}
+
+	for _, file := range files {
+		path := file.GetPath()
+
+		review, err := pr.GetReview(path, options)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Changeset.FromHash == "" {
+			result.Changeset.FromHash = review.Changeset.FromHash
+			result.Changeset.ToHash = review.Changeset.ToHash
+		}
+
+		result.Changeset.Diffs = append(result.Changeset.Diffs,
+			&godiff.Diff{
+				Note: FormatFileMarker(path, file.ChangeType),
+			},
+		)
+
+		result.Changeset.Diffs = append(result.Changeset.Diffs,
+			review.Changeset.Diffs...)
+	}
+
+	logger.Debug("successfully got review of %d files from Stash", len(files))
+
+	return result, nil
+}
+
+func (pr *PullRequest) Approve() error {
+	return pr.SetParticipantStatus(ParticipantApproved)
+}
+
+func (pr *PullRequest) Unapprove() error {
+	return pr.SetParticipantStatus(ParticipantUnapproved)
+}
+
+func (pr *PullRequest) NeedsWork() error {
+	return pr.SetParticipantStatus(ParticipantNeedsWork)
+}
+
+func (pr *PullRequest) Watch() error {
+	req := pr.Resource.Res("watch")
+
+	// Stash answers with empty body and gopencils fails to decode it
+	err := pr.DoPost(req)
+	if err != nil && !isNoContent(req) {
+		return err
+	}
+
+	return nil
+}
+
+func (pr *PullRequest) Unwatch() error {
+	req := pr.Resource.Res("watch")
+
+	err := pr.DoDelete(req)
+	if err != nil && !isNoContent(req) {
+		return err
+	}
+
+	return nil
+}
+
+func (pr *PullRequest) AddReviewer(user string) error {
+	payload := map[string]interface{}{
+		"user": map[string]interface{}{
+			"name": user,
+		},
+		"role": "REVIEWER",
+	}
+
+	resource := make(map[string]interface{})
+
+	return pr.DoPost(pr.Resource.Res("participants", &resource), payload)
+}
+
+func (pr *PullRequest) RemoveReviewer(user string) error {
+	req := pr.Resource.Res("participants").Id(user)
+
+	err := pr.DoDelete(req)
+	if err != nil && !isNoContent(req) {
+		return err
+	}
+
+	return nil
+}
+
+// SetParticipantStatus sets review status of the user. Status is set by
+// participants API of Bitbucket Server 4.2 or newer, older servers support
+// only approval, which is changed by its own API.
+func (pr *PullRequest) SetParticipantStatus(status string) error {
+	err := pr.RequireCapability(capabilityNeedsWork)
+	if err != nil {
+		return pr.setApproval(status, err)
+	}
+
+	payload := map[string]interface{}{
+		"user": map[string]interface{}{
+			"name": pr.Auth.Username,
+		},
+		"approved": status == ParticipantApproved,
+		"status":   status,
+	}
+
+	resource := make(map[string]interface{})
+
+	return pr.DoPut(
+		pr.Resource.Res("participants").Id(pr.Auth.Username, &resource),
+		payload,
+	)
+}
+
+func (pr *PullRequest) setApproval(status string, unsupported error) error {
+	resource := make(map[string]interface{})
+
+	switch status {
+	case ParticipantApproved:
+		return pr.DoPost(pr.Resource.Res("approve", &resource))
+	case ParticipantUnapproved:
+		return pr.DoDelete(pr.Resource.Res("approve", &resource))
+	}
+
+	return unsupported
+}
+
+// Decline declines pull request, reason is posted as general comment after
+// pull request is declined, so it is not left if declining fails.
+func (pr *PullRequest) Decline(reason string) error {
+	info, err := pr.GetInfo()
+	if err != nil {
+		return err
+	}
+
+	query := map[string]string{
+		"version": fmt.Sprint(info.Version),
+	}
+
+	resource := make(map[string]interface{})
+
+	err = pr.DoPost(pr.Resource.Res("decline", &resource).SetQuery(query))
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	comment := &godiff.Comment{Text: reason}
+
+	err = pr.addComment(ReviewCommentAdded{comment}, comment)
+	if err != nil {
+		return fmt.Errorf(
+			"pull request is declined, but reason is not posted: %s", err,
+		)
+	}
+
+	return nil
+}
+
+func (pr *PullRequest) GetMergeStatus() (*MergeStatus, error) {
+	status := MergeStatus{}
+
+	err := pr.DoGet(pr.Resource.Res("merge", &status))
+	if err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+func (pr *PullRequest) Reopen() error {
+	info, err := pr.GetInfo()
+	if err != nil {
+		return err
+	}
+
+	query := map[string]string{
+		"version": fmt.Sprint(info.Version),
+	}
+
+	result := PullRequestInfo{}
+
+	return pr.DoPost(pr.Resource.Res("reopen", &result).SetQuery(query))
+}
+
+func (pr *PullRequest) Delete() error {
+	info, err := pr.GetInfo()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"version": info.Version,
+	}
+
+	return pr.DoDeleteWithBody(pr.Resource, payload)
+}
+
+func (pr *PullRequest) getGitResource() *gopencils.Resource {
+	return pr.GetResource().Res("git/1.0").Res(pr.Repo.Project.Name).
+		Res("repos").Res(pr.Repo.Name).
+		Res("pull-requests").Id(fmt.Sprint(pr.Id))
+}
+
+func (pr *PullRequest) GetRebaseStatus() (*RebaseStatus, error) {
+	err := pr.RequireCapability(capabilityRebase)
+	if err != nil {
+		return nil, err
+	}
+
+	status := RebaseStatus{}
+
+	err = pr.DoGet(pr.getGitResource().Res("rebase", &status))
+	if err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+func (pr *PullRequest) Rebase() error {
+	err := pr.RequireCapability(capabilityRebase)
+	if err != nil {
+		return err
+	}
+
+	info, err := pr.GetInfo()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"version": info.Version,
+	}
+
+	resource := make(map[string]interface{})
+
+	return pr.DoPost(pr.getGitResource().Res("rebase", &resource), payload)
+}
+
+func (pr *PullRequest) Merge() error {
+	info, err := pr.GetInfo()
+	if err != nil {
+		return err
+	}
+
+	query := map[string]string{
+		"version": fmt.Sprint(info.Version),
+	}
+
+	return pr.DoPost(pr.Resource.Res("merge").SetQuery(query))
+}
+
+func (pr *PullRequest) GetActivities(limit string) (*Review, error) {
+	query := map[string]string{
+		"limit": limit,
+	}
+
+	response := struct {
+		Value ReviewActivity `json:"values"`
+	}{}
+
+	err := pr.DoGet(pr.Resource.Res("activities", &response), query)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("successfully got review from Stash")
+
+	return &Review{
+		Changeset: godiff.Changeset{
+			Diffs: response.Value.Changeset.Diffs,
+		},
+		IsOverview: true,
+	}, nil
+}
+
+// GetEvents returns latest activities of pull request as is, newest go
+// first.
+func (pr *PullRequest) GetEvents(limit int) ([]PullRequestEvent, error) {
+	query := map[string]string{
+		"limit": fmt.Sprint(limit),
+	}
+
+	response := struct {
+		Values []PullRequestEvent
+	}{}
+
+	err := pr.DoGet(pr.Resource.Res("activities", &response), query)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Values, nil
+}
+
+// GetAllEvents returns all activities of pull request, retrieving them by
+// pages of given size, newest go first.
+func (pr *PullRequest) GetAllEvents(pageSize int) ([]PullRequestEvent, error) {
+	result := []PullRequestEvent{}
+
+	err := pr.DoGetPaged(pr.Resource, "activities", nil, pageSize, true,
+		func(values json.RawMessage) error {
+			page := []PullRequestEvent{}
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return err
+			}
+
+			result = append(result, page...)
+
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (pr *PullRequest) GetCommits(limit int, all bool) ([]Commit, error) {
+	result := []Commit{}
+
+	err := pr.DoGetPaged(pr.Resource, "commits", nil, limit, all,
+		func(values json.RawMessage) error {
+			page := []Commit{}
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return err
+			}
+
+			result = append(result, page...)
+
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("successfully got commits list from Stash")
+
+	return result, nil
+}
+
+// GetFileSize returns size of file at given commit. Empty path means that
+// file does not exist, so its size is zero.
+func (pr *PullRequest) GetFileSize(path string, commit string) (int64, error) {
+	if path == "" {
+		return 0, nil
+	}
+
+	result := struct {
+		Size int64
+	}{}
+
+	err := pr.DoGet(
+		pr.Repo.Resource.Res("browse").Id(path, &result).SetQuery(
+			map[string]string{
+				"at":   commit,
+				"size": "true",
+			},
+		),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Size, nil
+}
+
+// GetFileLines returns lines of file at given commit.
+func (pr *PullRequest) GetFileLines(
+	path string, commit string,
+) ([]string, error) {
+	lines := []string{}
+
+	start := 0
+	for {
+		page := struct {
+			Lines []struct {
+				Text string
+			}
+			IsLastPage    bool
+			NextPageStart int
+		}{}
+
+		err := pr.DoGet(
+			pr.Repo.Resource.Res("browse").Id(path, &page).SetQuery(
+				map[string]string{
+					"at":    commit,
+					"start": fmt.Sprint(start),
+					"limit": "1000",
+				},
+			),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range page.Lines {
+			lines = append(lines, line.Text)
+		}
+
+		if page.IsLastPage {
+			return lines, nil
+		}
+
+		start = page.NextPageStart
+	}
+}
+
+// GetCommit returns commit of pull request repo, abbreviated hash can be
+// used.
+func (pr *PullRequest) GetCommit(hash string) (*Commit, error) {
+	commit := Commit{}
+
+	err := pr.DoGet(pr.Repo.Resource.Res("commits").Id(hash, &commit))
+	if err != nil {
+		return nil, err
+	}
+
+	return &commit, nil
+}
+
+// GetDiff returns diff of all files of pull request without context lines
+// and comments, which is enough to count changed lines.
+func (pr *PullRequest) GetDiff() (godiff.Changeset, error) {
+	result := godiff.Changeset{}
+
+	query := DiffOptions{ContextLines: 0}.getQuery()
+	query["withComments"] = "false"
+
+	err := pr.DoGet(pr.Resource.Res("diff", &result).SetQuery(query))
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// GetFiles returns files changed in pull request or in the commits
+// specified in options.
+func (pr *PullRequest) GetFiles(options DiffOptions) (ReviewFiles, error) {
+	files := make(ReviewFiles, 0)
+
+	query := map[string]string{
+		"start": "0",
+		"limit": "1000",
+	}
+
+	if options.UntilId != "" {
+		query["sinceId"] = options.SinceId
+		query["untilId"] = options.UntilId
+	}
+
+	err := pr.DoGet(pr.Resource.Res("changes", &files), query)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("successfully got files list from Stash")
+
+	return files, nil
+}
+
+func (pr *PullRequest) ApplyChange(change ReviewChange) error {
+	switch c := change.(type) {
+	case ReplyAdded:
+		logger.Info("replying to <%d>: <%s>", c.Parent.Id,
+			c.Comment.Short(commentPreviewLen))
+		return pr.addComment(c, c.Comment)
+	case LineCommentAdded:
+		logger.Info("commenting (L%d): <%s>",
+			c.Comment.Anchor.Line,
+			c.Comment.Short(commentPreviewLen))
+		return pr.addComment(c, c.Comment)
+	case CommentRemoved:
+		logger.Info("wasting comment: <%d>",
+			c.Comment.Id)
+		return pr.removeComment(c)
+	case CommentModified:
+		logger.Info("modifying comment <%d>: <%s>",
+			c.Comment.Id, c.Comment.Short(commentPreviewLen))
+		return pr.modifyComment(c)
+	case ReviewCommentAdded:
+		logger.Info("adding review level comment: <%s>",
+			c.Comment.Short(commentPreviewLen))
+		return pr.addComment(c, c.Comment)
+	case FileCommentAdded:
+		logger.Info("adding file level comment (%s): <%s>",
+			c.Comment.Anchor.Path,
+			c.Comment.Short(commentPreviewLen))
+		return pr.addComment(c, c.Comment)
+	case TaskAdded:
+		logger.Info("adding task to <%d>: <%s>", c.Comment.Id, c.Text)
+		return pr.addTask(c)
+	case TaskStateChanged:
+		logger.Info("changing task <%d> state to %s", c.Task.Id, c.State)
+		return pr.changeTaskState(c)
+	default:
+		logger.Warning("unexpected <change> argument: %#v", change)
+	}
+
+	return nil
+}
+
+func (pr *PullRequest) addComment(
+	change ReviewChange, comment *godiff.Comment,
+) error {
+	result := godiff.Comment{}
+
+	err := pr.DoPost(pr.Resource.Res("comments", &result), change.GetPayload())
+	if err != nil {
+		return err
+	}
+
+	logger.Info("comment added: <%d>", result.Id)
+
+	// tasks can be added to the new comment afterwards, so id is needed
+	comment.Id = result.Id
+
+	return nil
+}
+
+func (pr *PullRequest) modifyComment(change CommentModified) error {
+	query := map[string]string{
+		"version": fmt.Sprint(change.Comment.Version),
+	}
+	result := godiff.Comment{}
+
+	err := pr.DoPut(
+		pr.Resource.
+			Res("comments").
+			Id(fmt.Sprint(change.Comment.Id), &result).
+			SetQuery(query),
+		change.GetPayload())
+	if err != nil {
+		return err
+	}
+
+	logger.Info("comment modified: <%d>, version %d", result.Id, result.Version)
+
+	return nil
+}
+
+func (pr *PullRequest) removeComment(change CommentRemoved) error {
+	query := map[string]string{
+		"version": fmt.Sprint(change.Comment.Version),
+	}
+
+	result := make(map[string]interface{})
+
+	logger.Debug("accessing Stash...")
+
+	req := pr.Resource.
+		Res("comments").
+		Id(fmt.Sprint(change.Comment.Id), &result).
+		SetQuery(query)
+
+	err := pr.DoDelete(req)
+	if err != nil && req.Raw.StatusCode != 204 {
+		return err
+	}
+
+	logger.Info("comment wasted: <%d>", change.Comment.Id)
+
+	return nil
+}
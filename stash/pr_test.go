@@ -0,0 +1,555 @@
+package stash
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bndr/gopencils"
+	"github.com/seletskiy/ash/stash/stashtest"
+	"github.com/seletskiy/godiff"
+)
+
+// fakeComment is comment of fake Stash without ids and dates, which differ
+// from run to run.
+type fakeComment struct {
+	Text    string
+	Version int
+	Author  string
+	Anchor  *stashtest.Anchor
+	Replies []fakeComment
+}
+
+func getFakeComments(comments []*stashtest.Comment) []fakeComment {
+	result := []fakeComment{}
+	for _, comment := range comments {
+		result = append(result, fakeComment{
+			Text:    comment.Text,
+			Version: comment.Version,
+			Author:  comment.Author.Name,
+			Anchor:  comment.Anchor,
+			Replies: getFakeComments(comment.Replies),
+		})
+	}
+
+	return result
+}
+
+// newFakePullRequest starts fake Stash with canned pull request and
+// returns the same pull request of stash package, which uses fake Stash.
+func newFakePullRequest() (*stashtest.Server, *stashtest.PullRequest, PullRequest) {
+	server := stashtest.NewServer()
+	server.Password = "secret"
+
+	fake := server.AddPullRequest(stashtest.CannedPullRequest())
+
+	api := Api{
+		URL: server.URL,
+		Auth: gopencils.BasicAuth{
+			Username: server.User.Name, Password: server.Password,
+		},
+	}
+
+	repo := Project{&api, "projects/" + fake.Project}.GetRepo(fake.Repo)
+
+	return server, fake, repo.GetPullRequest(fake.Id)
+}
+
+func getLineComments(review *Review) map[int64][]string {
+	result := map[int64][]string{}
+
+	review.Changeset.ForEachLine(
+		func(
+			_ *godiff.Diff, _ *godiff.Hunk,
+			segment *godiff.Segment, line *godiff.Line,
+		) error {
+			for _, comment := range line.Comments {
+				number := segment.GetLineNum(line)
+				result[number] = append(result[number], comment.Text)
+			}
+
+			return nil
+		})
+
+	return result
+}
+
+func TestGetReviewFromFakeStash(t *testing.T) {
+	server, fake, pr := newFakePullRequest()
+	defer server.Close()
+
+	john := fake.Author
+
+	server.AddComment(fake, nil, &stashtest.Comment{
+		Text:   "why two lines?",
+		Author: john,
+		Anchor: &stashtest.Anchor{
+			Path:     "main.go",
+			Line:     5,
+			LineType: godiff.SegmentTypeAdded,
+		},
+	})
+
+	server.AddComment(fake, nil, &stashtest.Comment{
+		Text:   "nothing was printed",
+		Author: john,
+		Anchor: &stashtest.Anchor{
+			Path:     "main.go",
+			Line:     4,
+			LineType: godiff.SegmentTypeRemoved,
+		},
+	})
+
+	review, err := pr.GetReview("main.go", DiffOptions{ContextLines: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if review.Changeset.FromHash != fake.BaseCommit ||
+		review.Changeset.ToHash != fake.LatestCommit {
+		t.Fatalf("unexpected hashes of review: %s..%s",
+			review.Changeset.FromHash, review.Changeset.ToHash)
+	}
+
+	expected := map[int64][]string{
+		5: {"why two lines?"},
+		4: {"nothing was printed"},
+	}
+
+	actual := getLineComments(review)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("unexpected line comments\n%#v\n%#v", expected, actual)
+	}
+
+	info, err := pr.GetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Title != fake.Title || info.GetLatestCommit() != fake.LatestCommit ||
+		info.Properties.CommentCount != 2 {
+		t.Fatalf("unexpected info of pull request: %#v", info)
+	}
+
+	files, err := pr.GetFiles(DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].GetPath() != "main.go" ||
+		files[0].ChangeType != "MODIFY" {
+		t.Fatalf("unexpected files of pull request: %#v", files)
+	}
+}
+
+func TestReviewRoundTrip(t *testing.T) {
+	anchor := &stashtest.Anchor{
+		Path:     "main.go",
+		Line:     5,
+		LineType: godiff.SegmentTypeAdded,
+	}
+
+	tests := []struct {
+		name     string
+		edit     func(text string) string
+		expected []fakeComment
+	}{
+		{
+			"comment is added to line",
+			func(text string) string {
+				return strings.Replace(text,
+					"+\tprintln(\"hello\")\n",
+					"+\tprintln(\"hello\")\n# say it louder\n", 1,
+				)
+			},
+			[]fakeComment{
+				{
+					Text: "why two lines?", Author: "admin", Anchor: anchor,
+					Replies: []fakeComment{},
+				},
+				{
+					Text: "say it louder", Author: "admin",
+					Anchor: &stashtest.Anchor{
+						Path:     "main.go",
+						SrcPath:  "main.go",
+						Line:     4,
+						LineType: godiff.SegmentTypeAdded,
+					},
+					Replies: []fakeComment{},
+				},
+			},
+		},
+		{
+			"comment is modified",
+			func(text string) string {
+				return strings.Replace(text,
+					"# why two lines?\n", "# why not one line?\n", 1,
+				)
+			},
+			[]fakeComment{
+				{
+					Text: "why not one line?", Version: 1, Author: "admin",
+					Anchor: anchor, Replies: []fakeComment{},
+				},
+			},
+		},
+		{
+			"comment is removed",
+			func(text string) string {
+				lines := []string{}
+				for _, line := range strings.Split(text, "\n") {
+					if !strings.HasPrefix(line, "#") {
+						lines = append(lines, line)
+					}
+				}
+
+				return strings.Join(lines, "\n")
+			},
+			[]fakeComment{},
+		},
+	}
+
+	for _, test := range tests {
+		server, fake, pr := newFakePullRequest()
+
+		server.AddComment(fake, nil, &stashtest.Comment{
+			Text:   "why two lines?",
+			Anchor: anchor,
+		})
+
+		review, err := pr.GetReview("main.go", DiffOptions{ContextLines: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buffer := &bytes.Buffer{}
+
+		err = WriteReview(review, buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		edited, err := ReadReview(strings.NewReader(test.edit(buffer.String())))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, change := range review.Compare(edited) {
+			err := pr.ApplyChange(change)
+			if err != nil {
+				t.Fatalf("%s: can not apply %s: %s", test.name, change, err)
+			}
+		}
+
+		actual := getFakeComments(fake.Comments)
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("%s: unexpected comments\n%#v\n%#v",
+				test.name, test.expected, actual)
+		}
+
+		server.Close()
+	}
+}
+
+func TestApplyChangeToFakeStash(t *testing.T) {
+	server, fake, pr := newFakePullRequest()
+	defer server.Close()
+
+	john := server.AddComment(fake, nil, &stashtest.Comment{
+		Text:   "looks fine",
+		Author: fake.Author,
+	})
+
+	removed := &godiff.Comment{Text: "was it used?"}
+	removed.Anchor.Path = "main.go"
+	removed.Anchor.SrcPath = "main.go"
+	removed.Anchor.Line = 4
+	removed.Anchor.LineType = godiff.SegmentTypeRemoved
+
+	file := &godiff.Comment{Text: "needs tests"}
+	file.Anchor.Path = "main.go"
+	file.Anchor.SrcPath = "main.go"
+
+	overall := &godiff.Comment{Text: "nice"}
+	reply := &godiff.Comment{Text: "thanks"}
+
+	changes := []ReviewChange{
+		LineCommentAdded{removed},
+		FileCommentAdded{file},
+		ReviewCommentAdded{overall},
+		ReplyAdded{reply, &godiff.Comment{Id: john.Id}},
+	}
+
+	for _, change := range changes {
+		err := pr.ApplyChange(change)
+		if err != nil {
+			t.Fatalf("can not apply %s: %s", change, err)
+		}
+	}
+
+	if removed.Id == 0 || file.Id == 0 || overall.Id == 0 || reply.Id == 0 {
+		t.Fatal("ids of added comments are not set")
+	}
+
+	err := pr.ApplyChange(
+		CommentModified{&godiff.Comment{Id: overall.Id, Text: "very nice"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []fakeComment{
+		{
+			Text: "looks fine", Author: "john",
+			Replies: []fakeComment{
+				{Text: "thanks", Author: "admin", Replies: []fakeComment{}},
+			},
+		},
+		{
+			Text: "was it used?", Author: "admin",
+			Anchor: &stashtest.Anchor{
+				Path:     "main.go",
+				SrcPath:  "main.go",
+				Line:     4,
+				LineType: godiff.SegmentTypeRemoved,
+			},
+			Replies: []fakeComment{},
+		},
+		{
+			Text: "needs tests", Author: "admin",
+			Anchor: &stashtest.Anchor{
+				Path:    "main.go",
+				SrcPath: "main.go",
+			},
+			Replies: []fakeComment{},
+		},
+		{
+			Text: "very nice", Version: 1, Author: "admin",
+			Replies: []fakeComment{},
+		},
+	}
+
+	actual := getFakeComments(fake.Comments)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("unexpected comments\n%#v\n%#v", expected, actual)
+	}
+
+	path := "/rest/api/1.0/projects/proj/repos/repo/pull-requests/1/comments"
+	expectedRequests := []string{
+		"POST " + path,
+		"POST " + path,
+		"POST " + path,
+		"POST " + path,
+		fmt.Sprintf("PUT %s/%d", path, overall.Id),
+	}
+
+	if !reflect.DeepEqual(expectedRequests, server.Requests()) {
+		t.Fatalf("unexpected requests\n%#v\n%#v",
+			expectedRequests, server.Requests())
+	}
+
+	server.AddComment(fake, server.GetComment(fake, removed.Id),
+		&stashtest.Comment{Text: "yes", Author: fake.Author},
+	)
+
+	failures := []struct {
+		change ReviewChange
+		status int
+	}{
+		// version of comment is outdated
+		{CommentModified{&godiff.Comment{Id: overall.Id, Text: "?"}}, 409},
+		// comment has reply
+		{CommentRemoved{&godiff.Comment{Id: removed.Id}}, 409},
+		// comment is made by another user
+		{CommentRemoved{&godiff.Comment{Id: john.Id}}, 403},
+		// line is not in the diff
+		{LineCommentAdded{&godiff.Comment{
+			Text: "?",
+			Anchor: godiff.CommentAnchor{
+				Path: "main.go", Line: 42, LineType: godiff.SegmentTypeAdded,
+			},
+		}}, 409},
+		// parent comment does not exist
+		{ReplyAdded{&godiff.Comment{Text: "?"}, &godiff.Comment{Id: 404}}, 404},
+	}
+
+	for _, failure := range failures {
+		err := pr.ApplyChange(failure.change)
+
+		status := 0
+		switch err := err.(type) {
+		case StatusError:
+			status = err.Status
+		case UnexpectedStatusCode:
+			status = int(err)
+		}
+
+		if status != failure.status {
+			t.Fatalf("unexpected error of %s: %#v", failure.change, err)
+		}
+	}
+}
+
+func TestGetActivitiesFromFakeStash(t *testing.T) {
+	server, fake, pr := newFakePullRequest()
+	defer server.Close()
+
+	server.AddComment(fake, nil, &stashtest.Comment{
+		Text:   "first",
+		Author: fake.Author,
+	})
+
+	server.AddComment(fake, nil, &stashtest.Comment{
+		Text:   "second",
+		Author: fake.Author,
+		Anchor: &stashtest.Anchor{
+			Path:     "main.go",
+			Line:     5,
+			LineType: godiff.SegmentTypeAdded,
+		},
+	})
+
+	review, err := pr.GetActivities("10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs := review.Changeset.Diffs
+	if len(diffs) != 3 {
+		t.Fatalf("unexpected number of activities: %d", len(diffs))
+	}
+
+	if len(diffs[0].LineComments) != 1 ||
+		diffs[0].LineComments[0].Text != "second" {
+		t.Fatalf("line comment is not attached: %#v", diffs[0])
+	}
+
+	if len(diffs[1].FileComments) != 1 ||
+		diffs[1].FileComments[0].Text != "first" {
+		t.Fatalf("comment to pull request is not found: %#v", diffs[1])
+	}
+}
+
+func TestWatchFakeStash(t *testing.T) {
+	server, fake, pr := newFakePullRequest()
+	defer server.Close()
+
+	err := pr.Watch()
+	if err != nil {
+		t.Fatalf("can not watch pull request: %s", err)
+	}
+
+	if !reflect.DeepEqual(fake.Watchers, []string{"admin"}) {
+		t.Fatalf("unexpected watchers: %#v", fake.Watchers)
+	}
+
+	err = pr.Unwatch()
+	if err != nil {
+		t.Fatalf("can not unwatch pull request: %s", err)
+	}
+
+	if len(fake.Watchers) != 0 {
+		t.Fatalf("unexpected watchers: %#v", fake.Watchers)
+	}
+}
+
+func TestSetParticipantStatusFakeStash(t *testing.T) {
+	tests := []struct {
+		version  string
+		status   string
+		expected string
+	}{
+		{"7.21.0", ParticipantNeedsWork, "PUT /participants/admin"},
+		{"7.21.0", ParticipantApproved, "PUT /participants/admin"},
+		{"3.11.2", ParticipantApproved, "POST /approve"},
+		{"3.11.2", ParticipantUnapproved, "DELETE /approve"},
+	}
+
+	for _, test := range tests {
+		server, fake, pr := newFakePullRequest()
+		server.Version = test.version
+
+		err := pr.SetParticipantStatus(test.status)
+		if err != nil {
+			t.Fatalf("can not set %s on %s: %s", test.status, test.version, err)
+		}
+
+		requests := server.Requests()
+		request := strings.Replace(
+			requests[len(requests)-1], "/rest/api/1.0/projects/proj/"+
+				"repos/repo/pull-requests/1", "", 1,
+		)
+		if request != test.expected {
+			t.Errorf("unexpected request for %s on %s: %s",
+				test.status, test.version, request)
+		}
+
+		if fake.Statuses["admin"] != test.status {
+			t.Errorf("unexpected status: %q", fake.Statuses["admin"])
+		}
+
+		server.Close()
+	}
+
+	server, _, pr := newFakePullRequest()
+	defer server.Close()
+
+	server.Version = "4.1.0"
+
+	err := pr.SetParticipantStatus(ParticipantNeedsWork)
+	if err == nil || !strings.Contains(err.Error(), "4.2 or newer") {
+		t.Fatalf("unexpected error for needs work on 4.1: %v", err)
+	}
+}
+
+func TestWatchReportsErrorOfFailedRequest(t *testing.T) {
+	server, _, pr := newFakePullRequest()
+	server.Close()
+
+	if pr.Watch() == nil {
+		t.Fatal("error is expected for unreachable server")
+	}
+
+	if pr.Unwatch() == nil {
+		t.Fatal("error is expected for unreachable server")
+	}
+}
+
+func TestRemoveReviewerReportsErrorOfFailedRequest(t *testing.T) {
+	server, _, pr := newFakePullRequest()
+	server.Close()
+
+	if pr.RemoveReviewer("alice") == nil {
+		t.Fatal("error is expected for unreachable server")
+	}
+}
+
+func TestDeclineFakeStash(t *testing.T) {
+	server, fake, pr := newFakePullRequest()
+	defer server.Close()
+
+	fake.State = "MERGED"
+	comments := len(fake.Comments)
+
+	if pr.Decline("not needed anymore") == nil {
+		t.Fatal("error is expected for merged pull request")
+	}
+
+	if len(fake.Comments) != comments {
+		t.Fatalf("reason is posted to not declined pull request")
+	}
+
+	fake.State = "OPEN"
+
+	err := pr.Decline("not needed anymore")
+	if err != nil {
+		t.Fatalf("can not decline pull request: %s", err)
+	}
+
+	if fake.State != "DECLINED" || len(fake.Comments) != comments+1 ||
+		fake.Comments[comments].Text != "not needed anymore" {
+		t.Fatalf("unexpected pull request: %s %#v", fake.State, fake.Comments)
+	}
+}
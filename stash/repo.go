@@ -0,0 +1,250 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bndr/gopencils"
+)
+
+type Repo struct {
+	*Project
+	Name     string
+	Resource *gopencils.Resource
+}
+
+type RepoInfo struct {
+	Slug    string
+	Name    string
+	Project struct {
+		Key string
+	}
+	Links struct {
+		Clone []struct {
+			Href string
+			Name string
+		}
+	}
+}
+
+func (repo *Repo) GetPullRequest(id int64) PullRequest {
+	return PullRequest{
+		Repo:     repo,
+		Id:       id,
+		Resource: repo.Resource.Res("pull-requests").Id(fmt.Sprint(id)),
+	}
+}
+
+func (repo *Repo) ListPullRequest(
+	state string, limit int, all bool,
+) ([]PullRequest, error) {
+	return repo.ListPullRequestTo(state, "", limit, all)
+}
+
+// ListPullRequestTo lists pull requests to target branch, which is either
+// short name or full ref; pull requests to any branch are listed if target
+// is empty.
+func (repo *Repo) ListPullRequestTo(
+	state string, target string, limit int, all bool,
+) ([]PullRequest, error) {
+	result := []PullRequest{}
+
+	query := map[string]string{
+		"state": state,
+	}
+
+	if target != "" {
+		if !strings.HasPrefix(target, "refs/") {
+			target = "refs/heads/" + target
+		}
+
+		query["at"] = target
+	}
+
+	err := repo.DoGetPaged(repo.Resource, "pull-requests", query, limit, all,
+		func(values json.RawMessage) error {
+			page := []PullRequest{}
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return err
+			}
+
+			result = append(result, page...)
+
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ListPullRequestSince lists pull requests in any state, which are created
+// after the given time. Stash returns newest pull requests first, so paging
+// stops at the first pull request not changed since then.
+func (repo *Repo) ListPullRequestSince(
+	since time.Time, limit int,
+) ([]PullRequest, error) {
+	result := []PullRequest{}
+
+	query := map[string]string{
+		"state": "all",
+		"order": "newest",
+	}
+
+	err := repo.DoGetPaged(repo.Resource, "pull-requests", query, limit, true,
+		func(values json.RawMessage) error {
+			page := []PullRequest{}
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return err
+			}
+
+			for _, pr := range page {
+				if !pr.UpdatedDate.AsTime().After(since) &&
+					!pr.CreatedDate.AsTime().After(since) {
+					return errLastPage
+				}
+
+				if pr.CreatedDate.AsTime().After(since) {
+					result = append(result, pr)
+				}
+			}
+
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (repo *Repo) CreatePullRequest(
+	title string, description string, from string, to string,
+) (*PullRequest, error) {
+	result := PullRequest{}
+
+	payload := map[string]interface{}{
+		"title":       title,
+		"description": description,
+		"fromRef":     repo.getRefPayload(from),
+		"toRef":       repo.getRefPayload(to),
+	}
+
+	err := repo.DoPost(repo.Resource.Res("pull-requests", &result), payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (repo *Repo) GetProjectKey() string {
+	switch {
+	case strings.HasPrefix(repo.Project.Name, "users/"):
+		return "~" + strings.TrimPrefix(repo.Project.Name, "users/")
+	default:
+		return strings.TrimPrefix(repo.Project.Name, "projects/")
+	}
+}
+
+func (repo *Repo) getRefPayload(branch string) map[string]interface{} {
+	if !strings.HasPrefix(branch, "refs/") {
+		branch = "refs/heads/" + branch
+	}
+
+	return map[string]interface{}{
+		"id": branch,
+		"repository": map[string]interface{}{
+			"slug": repo.Name,
+			"project": map[string]interface{}{
+				"key": repo.GetProjectKey(),
+			},
+		},
+	}
+}
+
+func (repo *Repo) GetDefaultBranch() (string, error) {
+	branch := struct {
+		Id        string
+		DisplayId string
+	}{}
+
+	err := repo.DoGet(repo.Resource.Res("branches").Res("default", &branch))
+	if err != nil {
+		return "", err
+	}
+
+	return branch.DisplayId, nil
+}
+
+// CommitFile commits new content of file to the branch, parent is commit
+// which content was changed against. New commit is returned.
+func (repo *Repo) CommitFile(
+	path string, content string, branch string, parent string, message string,
+) (*Commit, error) {
+	commit := Commit{}
+
+	err := repo.DoPutMultipart(
+		repo.Resource.Res("browse").Id(path),
+		map[string]string{
+			"content":        content,
+			"branch":         branch,
+			"sourceCommitId": parent,
+			"message":        message,
+		},
+		&commit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &commit, nil
+}
+
+// GetRawFile returns content of file at given commit as is, with original
+// line endings, which are lost in lines returned by browse API.
+func (repo *Repo) GetRawFile(path string, commit string) ([]byte, error) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	request, err := http.NewRequest("GET", fmt.Sprintf(
+		"%s/%s/repos/%s/raw/%s?at=%s",
+		strings.TrimSuffix(repo.URL, "/"), repo.Project.Name, repo.Name,
+		strings.Join(segments, "/"), url.QueryEscape(commit),
+	), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := repo.getAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	request.SetBasicAuth(auth.Username, auth.Password)
+
+	logger.Debug("performing GET %s", request.URL)
+
+	response, err := repo.GetClient().Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, UnexpectedStatusCode(response.StatusCode)
+	}
+
+	return ioutil.ReadAll(response.Body)
+}
@@ -0,0 +1,650 @@
+package stash
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/seletskiy/godiff"
+)
+
+const usageText = "Oh, hello there!\n\n" +
+	"Some points about using ash:\n" +
+	"* Everything beginning with ### will be ignored.\n" +
+	"* Use one # to start a comment.\n" +
+	"* You can add line comments after specific lines.\n" +
+	"* You can add file comments outside of the diff, e.g. right before\n" +
+	"  the first hunk of the file.\n" +
+	"* You can add review comments outside of the diff (in the overview mode).\n" +
+	"* You can reply to comment by adding indented lines after it's\n" +
+	"  closing '---' delimiter.\n" +
+	"* Quote of replied comment in the beginning of reply is not posted.\n" +
+	"* If you want to delete comment, you need to remove all it's contents\n" +
+	"  including header.\n" +
+	"* Start line in comment with 'TASK: ' to add a task to it.\n" +
+	"* Replace '[ ]' with '[x]' in front of task to resolve it."
+
+const vimModeline = "vim: ft=diff.ash"
+
+const (
+	FileMarkerPrefix = "=== "
+	FileMarkerSuffix = " ==="
+)
+
+var reDanglingSpace = regexp.MustCompile(`(?m)\s*$`)
+
+type Review struct {
+	Changeset   godiff.Changeset
+	IsOverview  bool
+	IsMultiFile bool
+	tasks       map[int64][]*Task
+
+	// width which comments are wrapped to in review file
+	WrapWidth int
+
+	// comments wrapped by WrapComments by their ids; it is nil if review
+	// is read from file
+	wrappings map[int64]*wrapping
+
+	// fold markers to write around unchanged context and resolved threads
+	fold FoldOptions
+
+	// line numbers to show in the gutter of diff lines
+	gutter GutterMode
+}
+
+type ReviewChange interface {
+	GetPayload() map[string]interface{}
+	String() string
+}
+
+type LineCommentAdded struct {
+	Comment *godiff.Comment
+}
+
+func (added LineCommentAdded) String() string {
+	return fmt.Sprintf(
+		"Line comment added to %s:%d:\n%s",
+		added.Comment.Anchor.Path, added.Comment.Anchor.Line,
+		Indent(added.Comment.Text, " > "),
+	)
+}
+
+type FileCommentAdded struct {
+	Comment *godiff.Comment
+}
+
+func (added FileCommentAdded) String() string {
+	return fmt.Sprintf(
+		"File comment added to %s:\n%s",
+		added.Comment.Anchor.Path,
+		Indent(added.Comment.Text, " > "),
+	)
+}
+
+type ReviewCommentAdded struct {
+	Comment *godiff.Comment
+}
+
+func (added ReviewCommentAdded) String() string {
+	return fmt.Sprintf(
+		"Review comment added:\n%s",
+		Indent(added.Comment.Text, " > "),
+	)
+}
+
+type ReplyAdded struct {
+	Comment *godiff.Comment
+	Parent  *godiff.Comment
+}
+
+func (added ReplyAdded) String() string {
+	return fmt.Sprintf(
+		"Reply comment added:\n%s\n%s",
+		Indent(added.Parent.Text, " | "),
+		Indent(added.Comment.Text, "    > "),
+	)
+}
+
+type CommentModified struct {
+	Comment *godiff.Comment
+}
+
+func (added CommentModified) String() string {
+	return fmt.Sprintf(
+		"Comment <%d> modified:\n%s",
+		added.Comment.Id,
+		Indent(added.Comment.Text, " > "),
+	)
+}
+
+type CommentRemoved struct {
+	Comment *godiff.Comment
+}
+
+func (added CommentRemoved) String() string {
+	return fmt.Sprintf(
+		"Comment <%d> removed:\n%s",
+		added.Comment.Id,
+		Indent(added.Comment.Text, " > "),
+	)
+}
+
+func (c LineCommentAdded) GetPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"text": formatSuggestions(c.Comment.Text),
+		"anchor": map[string]interface{}{
+			"line":     c.Comment.Anchor.Line,
+			"lineType": c.Comment.Anchor.LineType,
+			"path":     c.Comment.Anchor.Path,
+			"srcPath":  c.Comment.Anchor.SrcPath,
+			"commitRange": map[string]interface{}{
+				"pullRequest": map[string]interface{}{
+					"fromRef": map[string]interface{}{
+						"latestChangeset": c.Comment.Anchor.FromHash,
+					},
+					"toRef": map[string]interface{}{
+						"latestChangeset": c.Comment.Anchor.ToHash,
+					},
+				},
+				"untilRevision": map[string]interface{}{
+					"id": c.Comment.Anchor.ToHash,
+				},
+				"sinceRevision": map[string]interface{}{
+					"id": c.Comment.Anchor.FromHash,
+				},
+			},
+		},
+	}
+}
+
+func (c FileCommentAdded) GetPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"text": c.Comment.Text,
+		"anchor": map[string]interface{}{
+			"path":    c.Comment.Anchor.Path,
+			"srcPath": c.Comment.Anchor.SrcPath,
+		},
+	}
+}
+
+func (c ReviewCommentAdded) GetPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"text": c.Comment.Text,
+	}
+}
+
+func (c ReplyAdded) GetPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"text": c.Comment.Text,
+		"parent": map[string]interface{}{
+			"id": c.Parent.Id,
+		},
+	}
+}
+
+func (c CommentModified) GetPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"text":    formatSuggestions(c.Comment.Text),
+		"id":      c.Comment.Id,
+		"version": c.Comment.Version,
+	}
+}
+
+func (c CommentRemoved) GetPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"id": c.Comment.Id,
+	}
+}
+
+func ReadReview(r io.Reader) (*Review, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	changeset, err := godiff.ReadChangeset(
+		strings.NewReader(stripGutter(string(data))),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Review{
+		Changeset:  changeset,
+		IsOverview: false,
+	}, nil
+}
+
+func AddUsageComment(r *Review) {
+	r.Changeset.Diffs = append(
+		[]*godiff.Diff{
+			&godiff.Diff{
+				Note: usageText,
+			},
+		},
+		r.Changeset.Diffs...,
+	)
+}
+
+// FormatFileMarker returns header, which separates files in multi-file
+// review. It is written as ignored line, so it is not read back.
+func FormatFileMarker(path string, changeType string) string {
+	return fmt.Sprintf("%s%s (%s)%s",
+		FileMarkerPrefix, path, changeType, FileMarkerSuffix,
+	)
+}
+
+// AddTableOfContents adds list of files with line numbers of their headers
+// to the top of multi-file review, right after usage comment.
+func AddTableOfContents(review *Review) error {
+	if !review.IsMultiFile {
+		return nil
+	}
+
+	files := []string{}
+	for _, diff := range review.Changeset.Diffs {
+		if IsFileMarker(diff.Note) {
+			files = append(files, strings.TrimSuffix(
+				strings.TrimPrefix(diff.Note, FileMarkerPrefix),
+				FileMarkerSuffix,
+			))
+		}
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	position := 0
+	if len(review.Changeset.Diffs) > 0 &&
+		review.Changeset.Diffs[0].Note == usageText {
+		position = 1
+	}
+
+	// line numbers are not known until review is written, but they do not
+	// depend on the contents of table, so it is filled on second pass
+	toc := &godiff.Diff{
+		Note: formatTableOfContents(files, make([]int, len(files))),
+	}
+
+	original := review.Changeset.Diffs
+
+	diffs := append([]*godiff.Diff{}, original[:position]...)
+	diffs = append(diffs, toc)
+	review.Changeset.Diffs = append(diffs, original[position:]...)
+
+	buffer := &bytes.Buffer{}
+	err := WriteReview(review, buffer)
+	if err != nil {
+		review.Changeset.Diffs = original
+		return err
+	}
+
+	lines := []int{}
+	for number, line := range strings.Split(buffer.String(), "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		if IsFileMarker(line) {
+			lines = append(lines, number+1)
+		}
+	}
+
+	if len(lines) != len(files) {
+		review.Changeset.Diffs = original
+		return fmt.Errorf(
+			"found %d file headers instead of %d", len(lines), len(files),
+		)
+	}
+
+	toc.Note = formatTableOfContents(files, lines)
+
+	return nil
+}
+
+func IsFileMarker(text string) bool {
+	return strings.HasPrefix(text, FileMarkerPrefix) &&
+		strings.HasSuffix(text, FileMarkerSuffix)
+}
+
+func formatTableOfContents(files []string, lines []int) string {
+	toc := "Files (line numbers of headers):"
+	for i, file := range files {
+		toc += fmt.Sprintf("\n%6d  %s", lines[i], file)
+	}
+
+	return toc
+}
+
+// AddAshModeline adds modeline with URL of pull request and files of review
+// to the end of review. Paths, which are given for review of several files,
+// are listed, otherwise review of several files is review of all files.
+func AddAshModeline(url string, review *Review, paths []string) {
+	fileTag := "overview"
+	switch {
+	case review.IsMultiFile && len(paths) > 0:
+		fileTag = "files=" + strings.Join(paths, ",")
+	case review.IsMultiFile:
+		fileTag = "all"
+	case !review.IsOverview:
+		fileName := review.Changeset.Diffs[0].Source.ToString
+		if fileName == "" {
+			fileName = review.Changeset.Diffs[0].Destination.ToString
+		}
+
+		fileTag = fmt.Sprintf("file=%s", fileName)
+	}
+
+	// ash modeline should be the last line, because it is looked up there
+	// by editor plugins
+	review.Changeset.Diffs = append(
+		review.Changeset.Diffs,
+		&godiff.Diff{
+			Note: vimModeline + review.fold.modeline(),
+		},
+		&godiff.Diff{
+			Note: fmt.Sprintf("ash: review-url=%s %s", url, fileTag),
+		},
+	)
+}
+
+// ReviewRenderer writes review in the specific format. Only unified format
+// can be read back by ReadReview, others are for displaying only.
+type ReviewRenderer interface {
+	Render(review *Review, writer io.Writer) error
+}
+
+type UnifiedRenderer struct{}
+
+func (UnifiedRenderer) Render(review *Review, writer io.Writer) error {
+	if review.fold.Open == "" && review.gutter == GutterNone {
+		return godiff.WriteChangeset(review.Changeset, writer)
+	}
+
+	buffer := &bytes.Buffer{}
+
+	err := godiff.WriteChangeset(review.Changeset, buffer)
+	if err != nil {
+		return err
+	}
+
+	text := buffer.String()
+
+	if review.gutter != GutterNone {
+		text = addGutter(text, review.gutter)
+	}
+
+	if review.fold.Open != "" {
+		text = foldText(text, review.fold)
+	}
+
+	_, err = io.WriteString(writer, text)
+
+	return err
+}
+
+// IsBinary returns true if review consists only of binary files, which
+// have no hunks to review.
+func (review *Review) IsBinary() bool {
+	for _, diff := range review.Changeset.Diffs {
+		if !diff.Binary {
+			return false
+		}
+	}
+
+	return len(review.Changeset.Diffs) > 0
+}
+
+// GetChangeComment returns comment which text is sent by the change, or nil
+// if change does not send any text.
+func GetChangeComment(change ReviewChange) *godiff.Comment {
+	switch c := change.(type) {
+	case LineCommentAdded:
+		return c.Comment
+	case FileCommentAdded:
+		return c.Comment
+	case ReviewCommentAdded:
+		return c.Comment
+	case ReplyAdded:
+		return c.Comment
+	case CommentModified:
+		return c.Comment
+	}
+
+	return nil
+}
+
+func WriteReview(review *Review, writer io.Writer) error {
+	return UnifiedRenderer{}.Render(review, writer)
+}
+
+func (current *Review) Compare(another *Review) []ReviewChange {
+	current.unwrapComments(current)
+	another.unwrapComments(current)
+
+	current.stripReplyQuotes(nil)
+	another.stripReplyQuotes(current)
+
+	existComments := make([]*godiff.Comment, 0)
+
+	current.Changeset.ForEachComment(
+		func(_ *godiff.Diff, comment, _ *godiff.Comment) {
+			comment.Text, _ = extractTasks(comment.Text)
+			existComments = append(existComments, comment)
+		})
+
+	changes := make([]ReviewChange, 0)
+
+	another.Changeset.ForEachComment(
+		func(diff *godiff.Diff, comment, parent *godiff.Comment) {
+			var tasks []*Task
+			comment.Text, tasks = extractTasks(comment.Text)
+
+			// comment consisting only of tasks is a task to the parent
+			if comment.Id == 0 && comment.Text == "" && parent != nil {
+				changes = append(changes,
+					current.matchTaskChanges(parent, tasks)...)
+				return
+			}
+
+			if comment.Text == "" {
+				for _, task := range tasks {
+					comment.Text += task.Text + "\n"
+				}
+			}
+
+			// comments outside of any file are review comments
+			isFileDiff := diff.Destination.ToString != "" ||
+				diff.Source.ToString != ""
+
+			change := matchCommentChange(existComments, comment, parent)
+			_, isReviewComment := change.(ReviewCommentAdded)
+			if isReviewComment && !current.IsOverview && isFileDiff {
+				comment.Anchor.Path = diff.Destination.ToString
+				comment.Anchor.SrcPath = diff.Source.ToString
+				change = FileCommentAdded{comment}
+			}
+
+			if change != nil {
+				changes = append(changes, change)
+			}
+
+			changes = append(changes,
+				current.matchTaskChanges(comment, tasks)...)
+		})
+
+	changes = markRemovedComments(existComments, changes)
+
+	return changes
+}
+
+func matchCommentChange(
+	comments []*godiff.Comment, comment, parent *godiff.Comment,
+) ReviewChange {
+	if comment.Id == 0 {
+		if parent != nil {
+			return ReplyAdded{comment, parent}
+		} else {
+			if comment.Anchor.Line == 0 {
+				return ReviewCommentAdded{comment}
+			} else {
+				return LineCommentAdded{comment}
+			}
+		}
+	} else {
+		for i, c := range comments {
+			if c == nil || c.Id != comment.Id {
+				continue
+			}
+			comments[i] = nil
+			if TrimCommentSpaces(c.Text) != TrimCommentSpaces(comment.Text) {
+				return CommentModified{comment}
+			}
+		}
+	}
+
+	return nil
+}
+
+func markRemovedComments(
+	comments []*godiff.Comment, changes []ReviewChange,
+) []ReviewChange {
+	for _, deleted := range comments {
+		if deleted != nil {
+			changes = append(changes, CommentRemoved{deleted})
+		}
+	}
+
+	return changes
+}
+
+func TrimCommentSpaces(text string) string {
+	return strings.TrimSpace(
+		reDanglingSpace.ReplaceAllString(
+			text,
+			``,
+		),
+	)
+}
+
+// AddReplyQuotes prepends quoted text of the parent comment to replies, so
+// it is seen what is replied to right in the review file.
+func (review *Review) AddReplyQuotes() {
+	quotes := map[*godiff.Comment]string{}
+
+	review.Changeset.ForEachComment(
+		func(_ *godiff.Diff, comment, parent *godiff.Comment) {
+			if parent != nil {
+				text, _ := extractTasks(parent.Text)
+				quotes[comment] = quoteText(strings.TrimSpace(text))
+			}
+		})
+
+	for comment, quote := range quotes {
+		comment.Text = quote + "\n\n" + comment.Text
+	}
+}
+
+// stripReplyQuotes removes quotes of parent comments from replies, so they
+// are not posted. Quote is removed only if it matches parent text, so
+// quotes written by user are kept. Quote can be wrapped, so whitespaces are
+// not compared. Parent text is taken from the original review if it is
+// given, because parent can be edited along with quote left intact.
+func (review *Review) stripReplyQuotes(original *Review) {
+	parents := map[*godiff.Comment]*godiff.Comment{}
+	texts := map[*godiff.Comment]string{}
+
+	originalTexts := map[int64]string{}
+	if original != nil {
+		original.Changeset.ForEachComment(
+			func(_ *godiff.Diff, comment, _ *godiff.Comment) {
+				originalTexts[comment.Id] = comment.Text
+			})
+	}
+
+	review.Changeset.ForEachComment(
+		func(_ *godiff.Diff, comment, parent *godiff.Comment) {
+			parents[comment] = parent
+			texts[comment] = comment.Text
+		})
+
+	stripped := map[*godiff.Comment]string{}
+
+	var strip func(comment *godiff.Comment) string
+	strip = func(comment *godiff.Comment) string {
+		if text, ok := stripped[comment]; ok {
+			return text
+		}
+
+		text := texts[comment]
+		if parent := parents[comment]; parent != nil {
+			parentText, ok := originalTexts[parent.Id]
+			if parent.Id == 0 || !ok {
+				parentText = strip(parent)
+			}
+
+			parentText, _ = extractTasks(parentText)
+			text = stripQuote(text, parentText)
+		}
+
+		stripped[comment] = text
+
+		return text
+	}
+
+	for comment := range parents {
+		comment.Text = strip(comment)
+	}
+}
+
+func quoteText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(quotePrefix+line, " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func stripQuote(text string, quoted string) string {
+	lines := strings.Split(text, "\n")
+
+	quote := []string{}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, ">") {
+			break
+		}
+
+		_, content := splitQuotePrefix(line)
+		quote = append(quote, content)
+	}
+
+	if len(quote) == 0 {
+		return text
+	}
+
+	if strings.Join(strings.Fields(strings.Join(quote, "\n")), " ") !=
+		strings.Join(strings.Fields(quoted), " ") {
+		return text
+	}
+
+	return strings.TrimLeft(strings.Join(lines[len(quote):], "\n"), "\n")
+}
+
+func Indent(text string, indentation string) string {
+	return regexp.MustCompile(`(?m)^`).ReplaceAllLiteralString(
+		text, indentation,
+	)
+}
+
+// GetAnchorPath returns path of file comment is anchored to, which is
+// source path for deleted files.
+func GetAnchorPath(anchor godiff.CommentAnchor) string {
+	if anchor.Path == "" {
+		return anchor.SrcPath
+	}
+
+	return anchor.Path
+}
@@ -1,4 +1,4 @@
-package main
+package stash
 
 import (
 	"log"
@@ -65,6 +65,17 @@ func TestCompare(t *testing.T) {
 				},
 			},
 		},
+		{
+			"_test/with_one_quoted_nested_comment.diff",
+			"_test/with_one_quoted_nested_comment_modified_parent.diff",
+			[]map[string]interface{}{
+				{
+					"text":    "hello again",
+					"id":      int64(1234),
+					"version": 1,
+				},
+			},
+		},
 		{
 			"_test/without_comments.diff",
 			"_test/with_one_new_top_level_comment.diff",
@@ -117,3 +128,29 @@ func parseReviewFile(path string) (*Review, error) {
 
 	return ReadReview(file)
 }
+
+func TestStripQuote(t *testing.T) {
+	quote := quoteText("first\n\nsecond")
+	if quote != "> first\n>\n> second" {
+		t.Fatalf("unexpected quote: %q", quote)
+	}
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"> first\n>\n> second\n\nreply", "reply"},
+		{"> first\n>\n> second", ""},
+		{"> first second\n\nreply", "reply"},
+		{"> first\n>\n> seconds\n\nreply", "> first\n>\n> seconds\n\nreply"},
+		{"> other\n\nreply", "> other\n\nreply"},
+		{"reply", "reply"},
+	}
+
+	for _, test := range tests {
+		actual := stripQuote(test.text, "first\n\nsecond")
+		if actual != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.text, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package stash
+
+// PullRequestService is backend of pull request, which provides its info,
+// diffs to review and changes state of the pull request. Review file is
+// built from returned diffs, so other backends can be used with the same
+// editor pipeline.
+type PullRequestService interface {
+	GetInfo() (*PullRequestInfo, error)
+	GetCommits(limit int, all bool) ([]Commit, error)
+	GetFiles(options DiffOptions) (ReviewFiles, error)
+	GetFileSize(path string, commit string) (int64, error)
+
+	GetReview(path string, options DiffOptions) (*Review, error)
+	GetFullReview(options DiffOptions) (*Review, error)
+	GetFilesReview(paths []string, options DiffOptions) (*Review, error)
+	GetActivities(limit string) (*Review, error)
+
+	Approve() error
+	Unapprove() error
+	NeedsWork() error
+	Decline(reason string) error
+	Reopen() error
+	Merge() error
+}
+
+// CommentService applies changes made in review file, comments and tasks,
+// to the backend.
+type CommentService interface {
+	GetTasks() ([]*Task, error)
+	ApplyChange(change ReviewChange) error
+}
+
+// ReviewPublisher is implemented by comment services, which apply changes
+// as drafts. Drafts are published at once after all changes are applied.
+// HasPending returns whether there is anything to publish, e.g. votes,
+// which are published even if no changes are made.
+type ReviewPublisher interface {
+	HasPending() bool
+	Publish() error
+}
+
+// RepoService lists and creates pull requests of repository.
+type RepoService interface {
+	ListPullRequest(state string, limit int, all bool) ([]PullRequest, error)
+	CreatePullRequest(
+		title string, description string, from string, to string,
+	) (*PullRequest, error)
+	GetDefaultBranch() (string, error)
+}
+
+var (
+	_ PullRequestService = (*PullRequest)(nil)
+	_ CommentService     = (*PullRequest)(nil)
+	_ RepoService        = (*Repo)(nil)
+)
@@ -0,0 +1,154 @@
+package stash
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var sessionPath = os.Getenv("HOME") + "/.config/ash/session"
+
+var sessionMutex = sync.Mutex{}
+
+// sessionStored is used to not rewrite session file after every request.
+var sessionStored = false
+
+// sessions is parsed session file, which is read once on first use.
+var sessions map[string][]sessionCookie
+
+type sessionCookie struct {
+	Name  string
+	Value string
+	Path  string
+}
+
+// getSessionKey returns key of session in session file. Sessions are kept
+// per user, so session of one user is never used on behalf of another one.
+func getSessionKey(host string, user string) string {
+	return user + "@" + host
+}
+
+// loadSessionCookies returns cookies which were saved after last successful
+// authentication of the user on the given host, so LDAP authentication,
+// which is slow and can lead to account lock, is not triggered on every
+// request.
+func loadSessionCookies(host string, user string) []*http.Cookie {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	cookies := []*http.Cookie{}
+	for _, cookie := range readSessions()[getSessionKey(host, user)] {
+		cookies = append(cookies, &http.Cookie{
+			Name:  cookie.Name,
+			Value: cookie.Value,
+			Path:  cookie.Path,
+		})
+	}
+
+	return cookies
+}
+
+func storeSessionCookies(
+	host string, user string, jarCookies []*http.Cookie,
+) {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	if sessionStored || len(jarCookies) == 0 {
+		return
+	}
+
+	key := getSessionKey(host, user)
+
+	stored := []sessionCookie{}
+	for _, cookie := range jarCookies {
+		stored = append(stored, sessionCookie{
+			Name:  cookie.Name,
+			Value: cookie.Value,
+			Path:  "/",
+		})
+	}
+
+	readSessions()[key] = stored
+
+	err := writeSessions()
+	if err != nil {
+		logger.Warning("can not store session: %s", err.Error())
+		return
+	}
+
+	sessionStored = true
+
+	logger.Debug("session for %s stored in %s", key, sessionPath)
+}
+
+// ClearSessionCookies removes stored session of the user on the given host.
+func ClearSessionCookies(host string, user string) {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	delete(readSessions(), getSessionKey(host, user))
+
+	err := writeSessions()
+	if err != nil {
+		logger.Warning("can not clear session: %s", err.Error())
+	}
+
+	sessionStored = false
+}
+
+// readSessions returns sessions from session file, which is read only once.
+// It should be called with sessionMutex locked.
+func readSessions() map[string][]sessionCookie {
+	if sessions != nil {
+		return sessions
+	}
+
+	sessions = map[string][]sessionCookie{}
+
+	data, err := ioutil.ReadFile(sessionPath)
+	if err != nil {
+		return sessions
+	}
+
+	err = json.Unmarshal(data, &sessions)
+	if err != nil {
+		logger.Warning("can not read session file: %s", err.Error())
+		sessions = map[string][]sessionCookie{}
+	}
+
+	return sessions
+}
+
+func writeSessions() error {
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(sessionPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(sessionPath, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	// file can already exist with more permissive mode
+	return os.Chmod(sessionPath, 0600)
+}
+
+func getJarCookies(jar http.CookieJar, host string) []*http.Cookie {
+	hostURL, err := url.Parse(host)
+	if err != nil || jar == nil {
+		return nil
+	}
+
+	return jar.Cookies(hostURL)
+}
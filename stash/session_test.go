@@ -0,0 +1,51 @@
+package stash
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionCookiesAreKeptPerUser(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ash-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	defer func(path string) {
+		sessionPath = path
+		sessions = nil
+		sessionStored = false
+	}(sessionPath)
+
+	sessionPath = filepath.Join(dir, "session")
+	sessions = nil
+
+	host := "https://stash.local"
+
+	storeSessionCookies(host, "alice", []*http.Cookie{
+		{Name: "JSESSIONID", Value: "alice-session"},
+	})
+
+	if cookies := loadSessionCookies(host, "bob"); len(cookies) != 0 {
+		t.Fatalf("session of another user is used: %#v", cookies)
+	}
+
+	// session is read from file by the next run of ash
+	sessions = nil
+
+	cookies := loadSessionCookies(host, "alice")
+	if len(cookies) != 1 || cookies[0].Value != "alice-session" {
+		t.Fatalf("unexpected session cookies: %#v", cookies)
+	}
+
+	ClearSessionCookies(host, "alice")
+
+	if cookies := loadSessionCookies(host, "alice"); len(cookies) != 0 {
+		t.Fatalf("session is not cleared: %#v", cookies)
+	}
+}
@@ -0,0 +1,361 @@
+package stashtest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/seletskiy/godiff"
+)
+
+// defaultLimit is size of page, if it is not requested, as in Stash.
+const defaultLimit = 25
+
+// encodePage returns page of values, which is requested by start and limit
+// query params.
+func encodePage(
+	values []interface{}, request *http.Request,
+) map[string]interface{} {
+	query := request.URL.Query()
+
+	start, _ := strconv.Atoi(query.Get("start"))
+	if start > len(values) || start < 0 {
+		start = len(values)
+	}
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+
+	end := start + limit
+	if end > len(values) {
+		end = len(values)
+	}
+
+	page := map[string]interface{}{
+		"values":     values[start:end],
+		"size":       end - start,
+		"start":      start,
+		"limit":      limit,
+		"isLastPage": end == len(values),
+	}
+
+	if end < len(values) {
+		page["nextPageStart"] = end
+	}
+
+	return page
+}
+
+func encodeUser(user User) map[string]interface{} {
+	return map[string]interface{}{
+		"name":         user.Name,
+		"slug":         user.Name,
+		"displayName":  user.DisplayName,
+		"emailAddress": user.EmailAddress,
+	}
+}
+
+func encodePath(path string) interface{} {
+	if path == "" {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"toString": path,
+	}
+}
+
+func encodeRef(
+	pr *PullRequest, branch string, commit string,
+) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              "refs/heads/" + branch,
+		"displayId":       branch,
+		"latestCommit":    commit,
+		"latestChangeset": commit,
+		"repository": map[string]interface{}{
+			"slug": pr.Repo,
+			"name": pr.Repo,
+			"project": map[string]interface{}{
+				"key": pr.Project,
+			},
+		},
+	}
+}
+
+func (server *Server) encodePullRequest(
+	pr *PullRequest,
+) map[string]interface{} {
+	projectPath := "projects/" + pr.Project
+	if pr.Project != "" && pr.Project[0] == '~' {
+		projectPath = "users/" + pr.Project[1:]
+	}
+
+	return map[string]interface{}{
+		"id":          pr.Id,
+		"version":     pr.Version,
+		"title":       pr.Title,
+		"description": pr.Description,
+		"state":       pr.State,
+		"open":        pr.State == "OPEN",
+		"closed":      pr.State != "OPEN",
+		"createdDate": pr.CreatedDate,
+		"updatedDate": pr.UpdatedDate,
+		"fromRef":     encodeRef(pr, pr.FromBranch, pr.LatestCommit),
+		"toRef":       encodeRef(pr, pr.ToBranch, pr.BaseCommit),
+		"author": map[string]interface{}{
+			"user":     encodeUser(pr.Author),
+			"role":     "AUTHOR",
+			"approved": false,
+			"status":   "UNAPPROVED",
+		},
+		"reviewers":    []interface{}{},
+		"participants": []interface{}{},
+		"properties": map[string]interface{}{
+			"commentCount": countComments(pr.Comments),
+		},
+		"links": map[string]interface{}{
+			"self": []map[string]interface{}{
+				{
+					"href": fmt.Sprintf(
+						"%s/%s/repos/%s/pull-requests/%d",
+						server.URL, projectPath, pr.Repo, pr.Id,
+					),
+				},
+			},
+		},
+	}
+}
+
+func encodeChanges(
+	pr *PullRequest, request *http.Request,
+) map[string]interface{} {
+	values := []interface{}{}
+	for _, file := range pr.Files {
+		change := map[string]interface{}{
+			"path":             encodePath(file.Path),
+			"type":             file.getChangeType(),
+			"nodeType":         "FILE",
+			"executable":       false,
+			"srcExecutable":    false,
+			"percentUnchanged": -1,
+		}
+
+		if file.SrcPath != "" {
+			change["srcPath"] = encodePath(file.SrcPath)
+		}
+
+		values = append(values, change)
+	}
+
+	page := encodePage(values, request)
+	page["fromHash"] = pr.BaseCommit
+	page["toHash"] = pr.LatestCommit
+
+	return page
+}
+
+// encodeComment returns comment with its replies.
+func encodeComment(comment *Comment) map[string]interface{} {
+	replies := []interface{}{}
+	for _, reply := range comment.Replies {
+		replies = append(replies, encodeComment(reply))
+	}
+
+	return map[string]interface{}{
+		"id":          comment.Id,
+		"version":     comment.Version,
+		"text":        comment.Text,
+		"author":      encodeUser(comment.Author),
+		"createdDate": comment.CreatedDate,
+		"updatedDate": comment.UpdatedDate,
+		"comments":    replies,
+		"permittedOperations": map[string]interface{}{
+			"editable":  true,
+			"deletable": len(comment.Replies) == 0,
+		},
+	}
+}
+
+func encodeAnchor(pr *PullRequest, anchor *Anchor) map[string]interface{} {
+	result := map[string]interface{}{
+		"fromHash": pr.BaseCommit,
+		"toHash":   pr.LatestCommit,
+		"path":     anchor.Path,
+	}
+
+	if anchor.SrcPath != "" {
+		result["srcPath"] = anchor.SrcPath
+	}
+
+	if anchor.LineType != "" {
+		result["line"] = anchor.Line
+		result["lineType"] = anchor.LineType
+		result["fileType"] = "TO"
+
+		if anchor.LineType == godiff.SegmentTypeRemoved {
+			result["fileType"] = "FROM"
+		}
+	}
+
+	return result
+}
+
+// encodeFileDiff returns diff of file with given path along with comments
+// to it, which is response of diff endpoint. Diff is empty if file is not
+// changed in pull request.
+func encodeFileDiff(pr *PullRequest, path string) map[string]interface{} {
+	diffs := []interface{}{}
+
+	if file := pr.findFile(path); file != nil {
+		comments := []*Comment{}
+		for _, comment := range pr.Comments {
+			if comment.Anchor != nil && comment.Anchor.getPath() == path {
+				comments = append(comments, comment)
+			}
+		}
+
+		diffs = append(diffs, encodeDiff(file, file.Hunks, comments))
+	}
+
+	return map[string]interface{}{
+		"fromHash": pr.BaseCommit,
+		"toHash":   pr.LatestCommit,
+		"diffs":    diffs,
+	}
+}
+
+// encodeDiff returns diff of file consisting of given hunks. Comments are
+// split to line comments, which ids are listed in lines they are anchored
+// to, and file comments; comments to lines, which are not in the diff, are
+// omitted.
+func encodeDiff(
+	file *File, hunks []*Hunk, comments []*Comment,
+) map[string]interface{} {
+	lineComments := []interface{}{}
+	fileComments := []interface{}{}
+
+	for _, comment := range comments {
+		if comment.Anchor.LineType == "" {
+			fileComments = append(fileComments, encodeComment(comment))
+		}
+	}
+
+	encodedHunks := []interface{}{}
+	for _, hunk := range hunks {
+		segments := []interface{}{}
+		sourceSpan, destinationSpan := 0, 0
+
+		for i, segmentLines := range hunk.getLines() {
+			segment := hunk.Segments[i]
+
+			lines := []interface{}{}
+			for _, line := range segmentLines {
+				encodedLine := map[string]interface{}{
+					"source":      line.source,
+					"destination": line.destination,
+					"line":        line.text,
+					"truncated":   false,
+				}
+
+				ids := []int64{}
+				for _, comment := range comments {
+					anchor := comment.Anchor
+					if anchor.LineType != segment.Type ||
+						anchor.Line != line.getNumber(segment.Type) {
+						continue
+					}
+
+					ids = append(ids, comment.Id)
+					lineComments = append(lineComments,
+						encodeComment(comment),
+					)
+				}
+
+				if len(ids) > 0 {
+					encodedLine["commentIds"] = ids
+				}
+
+				lines = append(lines, encodedLine)
+			}
+
+			if segment.Type != godiff.SegmentTypeAdded {
+				sourceSpan += len(lines)
+			}
+
+			if segment.Type != godiff.SegmentTypeRemoved {
+				destinationSpan += len(lines)
+			}
+
+			segments = append(segments, map[string]interface{}{
+				"type":      segment.Type,
+				"lines":     lines,
+				"truncated": false,
+			})
+		}
+
+		encodedHunks = append(encodedHunks, map[string]interface{}{
+			"sourceLine":      hunk.SourceLine,
+			"sourceSpan":      sourceSpan,
+			"destinationLine": hunk.DestinationLine,
+			"destinationSpan": destinationSpan,
+			"segments":        segments,
+			"truncated":       false,
+		})
+	}
+
+	return map[string]interface{}{
+		"source":       encodePath(file.getSourcePath()),
+		"destination":  encodePath(file.getDestinationPath()),
+		"hunks":        encodedHunks,
+		"truncated":    false,
+		"lineComments": lineComments,
+		"fileComments": fileComments,
+	}
+}
+
+// encodeActivities returns activities of pull request, newest go first:
+// comments, which are not replies, and opening of pull request. Activity
+// of line comment includes hunk of diff, which line is in.
+func encodeActivities(
+	pr *PullRequest, request *http.Request,
+) map[string]interface{} {
+	values := []interface{}{}
+
+	for i := len(pr.Comments) - 1; i >= 0; i-- {
+		comment := pr.Comments[i]
+
+		activity := map[string]interface{}{
+			"id":            comment.Id,
+			"createdDate":   comment.CreatedDate,
+			"user":          encodeUser(comment.Author),
+			"action":        "COMMENTED",
+			"commentAction": "ADDED",
+			"comment":       encodeComment(comment),
+		}
+
+		if anchor := comment.Anchor; anchor != nil {
+			activity["commentAnchor"] = encodeAnchor(pr, anchor)
+
+			file := pr.findFile(anchor.getPath())
+			if file != nil && anchor.LineType != "" {
+				if hunk := file.findHunk(anchor); hunk != nil {
+					activity["diff"] = encodeDiff(file, []*Hunk{hunk}, nil)
+				}
+			}
+		}
+
+		values = append(values, activity)
+	}
+
+	values = append(values, map[string]interface{}{
+		"id":          0,
+		"createdDate": pr.CreatedDate,
+		"user":        encodeUser(pr.Author),
+		"action":      "OPENED",
+	})
+
+	return encodePage(values, request)
+}
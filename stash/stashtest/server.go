@@ -0,0 +1,662 @@
+// Package stashtest provides fake Stash server for integration tests of ash
+// and of other clients of the stash package. Server implements endpoints of
+// pull requests, which are used for reviews: pull requests themselves,
+// their changes, diffs, activities, comments, watching, approvals and
+// declining. State of pull
+// requests is kept in memory, it is canned by test and changed by requests,
+// so it can be checked after review is applied.
+package stashtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiPrefix is prefix of REST API paths of pull requests.
+const apiPrefix = "/rest/api/1.0/"
+
+// Server is fake Stash server. Its URL is used as URL of stash.Api.
+type Server struct {
+	*httptest.Server
+
+	// User is user, who is authenticated by requests and is author of
+	// comments added by them. If Password is set, requests without valid
+	// credentials are rejected.
+	User     User
+	Password string
+
+	// Version is version of Stash reported by application properties;
+	// participants API is served only if it is 4.2 or newer.
+	Version string
+
+	mutex        sync.Mutex
+	pullRequests []*PullRequest
+	lastId       int64
+	requests     []string
+}
+
+// statusError is error response of Stash.
+type statusError struct {
+	status  int
+	message string
+}
+
+func (err statusError) Error() string {
+	return err.message
+}
+
+// NewServer starts server without pull requests, which are added by
+// AddPullRequest. Server should be closed by Close.
+func NewServer() *Server {
+	server := &Server{
+		User: User{
+			Name:         "admin",
+			DisplayName:  "Administrator",
+			EmailAddress: "admin@example.com",
+		},
+		Version: "7.21.0",
+	}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+
+	return server
+}
+
+// AddPullRequest adds pull request to server. Missing id of pull request
+// and ids of its comments are assigned, as well as dates.
+func (server *Server) AddPullRequest(pr *PullRequest) *PullRequest {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if pr.Id == 0 {
+		for _, another := range server.pullRequests {
+			if another.Project == pr.Project && another.Repo == pr.Repo &&
+				another.Id > pr.Id {
+				pr.Id = another.Id
+			}
+		}
+
+		pr.Id++
+	}
+
+	if pr.State == "" {
+		pr.State = "OPEN"
+	}
+
+	if pr.CreatedDate == 0 {
+		pr.CreatedDate = now()
+		pr.UpdatedDate = pr.CreatedDate
+	}
+
+	server.initComments(pr.Comments)
+
+	server.pullRequests = append(server.pullRequests, pr)
+
+	return pr
+}
+
+// AddComment adds comment to pull request, as if it is made by another
+// user; comment is added as reply if parent is given.
+func (server *Server) AddComment(
+	pr *PullRequest, parent *Comment, comment *Comment,
+) *Comment {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.initComments([]*Comment{comment})
+
+	if parent != nil {
+		parent.Replies = append(parent.Replies, comment)
+	} else {
+		pr.Comments = append(pr.Comments, comment)
+	}
+
+	return comment
+}
+
+func (server *Server) initComments(comments []*Comment) {
+	for _, comment := range comments {
+		if comment.Id == 0 {
+			server.lastId++
+			comment.Id = server.lastId
+		} else if comment.Id > server.lastId {
+			server.lastId = comment.Id
+		}
+
+		if comment.Author.Name == "" {
+			comment.Author = server.User
+		}
+
+		if comment.CreatedDate == 0 {
+			comment.CreatedDate = now()
+			comment.UpdatedDate = comment.CreatedDate
+		}
+
+		server.initComments(comment.Replies)
+	}
+}
+
+// GetPullRequest returns pull request of repo, nil if it is not found.
+func (server *Server) GetPullRequest(
+	project string, repo string, id int64,
+) *PullRequest {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.findPullRequest(project, repo, id)
+}
+
+func (server *Server) findPullRequest(
+	project string, repo string, id int64,
+) *PullRequest {
+	for _, pr := range server.pullRequests {
+		if pr.Project == project && pr.Repo == repo && pr.Id == id {
+			return pr
+		}
+	}
+
+	return nil
+}
+
+// GetComment returns comment of pull request with given id, nil if it is
+// not found.
+func (server *Server) GetComment(pr *PullRequest, id int64) *Comment {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	comment, _ := pr.findComment(id)
+
+	return comment
+}
+
+// Requests returns requests received by server as method and path, e.g.
+// "POST /rest/api/1.0/projects/proj/repos/repo/pull-requests/1/comments".
+func (server *Server) Requests() []string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]string{}, server.requests...)
+}
+
+func (server *Server) serve(
+	writer http.ResponseWriter, request *http.Request,
+) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.requests = append(server.requests,
+		request.Method+" "+request.URL.EscapedPath(),
+	)
+
+	if server.Password != "" {
+		user, password, _ := request.BasicAuth()
+		if user != server.User.Name || password != server.Password {
+			writeError(writer, statusError{
+				http.StatusUnauthorized, "Authentication failed.",
+			})
+			return
+		}
+	}
+
+	result, err := server.route(request)
+	if err != nil {
+		switch err := err.(type) {
+		case statusError:
+			writeError(writer, err)
+		default:
+			writeError(writer, statusError{http.StatusBadRequest, err.Error()})
+		}
+
+		return
+	}
+
+	switch {
+	case result == nil:
+		writer.WriteHeader(http.StatusNoContent)
+	case request.Method == "POST":
+		writeJSON(writer, http.StatusCreated, result)
+	default:
+		writeJSON(writer, http.StatusOK, result)
+	}
+}
+
+// route dispatches request by its path, which is, e.g.
+// /rest/api/1.0/projects/<key>/repos/<repo>/pull-requests/<id>/comments.
+func (server *Server) route(request *http.Request) (interface{}, error) {
+	path := strings.TrimPrefix(request.URL.Path, apiPrefix)
+	parts := strings.Split(path, "/")
+
+	if path == "application-properties" && request.Method == "GET" {
+		return map[string]interface{}{
+			"version":     server.Version,
+			"displayName": "Stash",
+		}, nil
+	}
+
+	if path == request.URL.Path || len(parts) < 5 ||
+		parts[2] != "repos" || parts[4] != "pull-requests" {
+		return nil, errNotFound(request.URL.Path)
+	}
+
+	project := parts[1]
+	switch parts[0] {
+	case "users":
+		project = "~" + project
+	case "projects":
+	default:
+		return nil, errNotFound(request.URL.Path)
+	}
+
+	repo := parts[3]
+	parts = parts[5:]
+
+	if len(parts) == 0 || parts[0] == "" {
+		if request.Method != "GET" {
+			return nil, errNotAllowed(request)
+		}
+
+		return server.listPullRequests(project, repo, request), nil
+	}
+
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errNotFound(request.URL.Path)
+	}
+
+	pr := server.findPullRequest(project, repo, id)
+	if pr == nil {
+		return nil, statusError{
+			http.StatusNotFound,
+			fmt.Sprintf("Pull request %d does not exist in %s/%s.",
+				id, project, repo),
+		}
+	}
+
+	resource := ""
+	if len(parts) > 1 {
+		resource = parts[1]
+	}
+
+	switch {
+	case resource == "" && request.Method == "GET":
+		return server.encodePullRequest(pr), nil
+	case resource == "" && request.Method == "PUT":
+		return server.updatePullRequest(pr, request)
+	case resource == "changes" && request.Method == "GET":
+		return encodeChanges(pr, request), nil
+	case resource == "diff" && request.Method == "GET":
+		return encodeFileDiff(pr, strings.Join(parts[2:], "/")), nil
+	case resource == "activities" && request.Method == "GET":
+		return encodeActivities(pr, request), nil
+	case resource == "comments" && len(parts) == 2:
+		if request.Method != "POST" {
+			return nil, errNotAllowed(request)
+		}
+
+		return server.addComment(pr, request)
+	case resource == "comments" && len(parts) == 3:
+		return server.changeComment(pr, parts[2], request)
+	case resource == "watch" && request.Method == "POST":
+		pr.setWatching(server.User.Name, true)
+		return nil, nil
+	case resource == "watch" && request.Method == "DELETE":
+		pr.setWatching(server.User.Name, false)
+		return nil, nil
+	case resource == "decline" && request.Method == "POST":
+		return server.declinePullRequest(pr, request)
+	case resource == "approve" && request.Method == "POST":
+		return server.setStatus(pr, "APPROVED"), nil
+	case resource == "approve" && request.Method == "DELETE":
+		return server.setStatus(pr, "UNAPPROVED"), nil
+	case resource == "participants" && len(parts) == 3 &&
+		request.Method == "PUT" && server.hasParticipantsAPI():
+		return server.updateParticipant(pr, parts[2], request)
+	case resource == "":
+		return nil, errNotAllowed(request)
+	}
+
+	return nil, errNotFound(request.URL.Path)
+}
+
+func (server *Server) listPullRequests(
+	project string, repo string, request *http.Request,
+) interface{} {
+	state := request.URL.Query().Get("state")
+	if state == "" {
+		state = "OPEN"
+	}
+
+	values := []interface{}{}
+	for _, pr := range server.pullRequests {
+		if pr.Project != project || pr.Repo != repo {
+			continue
+		}
+
+		if state != "ALL" && pr.State != state {
+			continue
+		}
+
+		values = append(values, server.encodePullRequest(pr))
+	}
+
+	return encodePage(values, request)
+}
+
+func (server *Server) updatePullRequest(
+	pr *PullRequest, request *http.Request,
+) (interface{}, error) {
+	payload := struct {
+		Version     *int64
+		Title       *string
+		Description *string
+	}{}
+
+	err := json.NewDecoder(request.Body).Decode(&payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.Version == nil || *payload.Version != pr.Version {
+		return nil, statusError{
+			http.StatusConflict,
+			"You are attempting to modify a pull request based on " +
+				"out-of-date information.",
+		}
+	}
+
+	if payload.Title != nil {
+		pr.Title = *payload.Title
+	}
+
+	if payload.Description != nil {
+		pr.Description = *payload.Description
+	}
+
+	pr.Version++
+	pr.UpdatedDate = now()
+
+	return server.encodePullRequest(pr), nil
+}
+
+// declinePullRequest declines open pull request of version given in query.
+func (server *Server) declinePullRequest(
+	pr *PullRequest, request *http.Request,
+) (interface{}, error) {
+	if request.URL.Query().Get("version") != fmt.Sprint(pr.Version) {
+		return nil, statusError{
+			http.StatusConflict,
+			"You are attempting to modify a pull request based on " +
+				"out-of-date information.",
+		}
+	}
+
+	if pr.State != "OPEN" {
+		return nil, statusError{
+			http.StatusConflict,
+			fmt.Sprintf("Pull request %d is already closed.", pr.Id),
+		}
+	}
+
+	pr.State = "DECLINED"
+	pr.Version++
+	pr.UpdatedDate = now()
+
+	return server.encodePullRequest(pr), nil
+}
+
+// hasParticipantsAPI reports whether version of server is 4.2 or newer.
+func (server *Server) hasParticipantsAPI() bool {
+	major, minor := 0, 0
+	fmt.Sscanf(server.Version, "%d.%d", &major, &minor)
+
+	return major > 4 || major == 4 && minor >= 2
+}
+
+// updateParticipant sets review status of the user; statuses of other users
+// can not be changed.
+func (server *Server) updateParticipant(
+	pr *PullRequest, user string, request *http.Request,
+) (interface{}, error) {
+	payload := struct {
+		Status string
+	}{}
+
+	err := json.NewDecoder(request.Body).Decode(&payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if user != server.User.Name {
+		return nil, statusError{
+			http.StatusBadRequest,
+			"Status of other users can not be changed.",
+		}
+	}
+
+	return server.setStatus(pr, payload.Status), nil
+}
+
+func (server *Server) setStatus(pr *PullRequest, status string) interface{} {
+	if pr.Statuses == nil {
+		pr.Statuses = map[string]string{}
+	}
+
+	pr.Statuses[server.User.Name] = status
+
+	return map[string]interface{}{
+		"user":     encodeUser(server.User),
+		"role":     "PARTICIPANT",
+		"approved": status == "APPROVED",
+		"status":   status,
+	}
+}
+
+// addComment adds comment of the user, which is anchored either to line or
+// file, or is reply to another comment.
+func (server *Server) addComment(
+	pr *PullRequest, request *http.Request,
+) (interface{}, error) {
+	payload := struct {
+		Text   string
+		Anchor *Anchor
+		Parent *struct {
+			Id int64
+		}
+	}{}
+
+	err := json.NewDecoder(request.Body).Decode(&payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(payload.Text) == "" {
+		return nil, statusError{
+			http.StatusBadRequest, "Text of comment should not be empty.",
+		}
+	}
+
+	comment := &Comment{Text: payload.Text, Author: server.User}
+
+	var parent *Comment
+	switch {
+	case payload.Parent != nil:
+		parent, _ = pr.findComment(payload.Parent.Id)
+		if parent == nil {
+			return nil, errNoComment(payload.Parent.Id)
+		}
+	case payload.Anchor != nil:
+		err := validateAnchor(pr, payload.Anchor)
+		if err != nil {
+			return nil, err
+		}
+
+		comment.Anchor = payload.Anchor
+	}
+
+	server.initComments([]*Comment{comment})
+
+	if parent != nil {
+		parent.Replies = append(parent.Replies, comment)
+	} else {
+		pr.Comments = append(pr.Comments, comment)
+	}
+
+	return encodeComment(comment), nil
+}
+
+// validateAnchor checks that file of comment is changed in pull request
+// and that commented line is in its diff, as Stash does.
+func validateAnchor(pr *PullRequest, anchor *Anchor) error {
+	file := pr.findFile(anchor.getPath())
+	if file == nil {
+		return statusError{
+			http.StatusNotFound,
+			fmt.Sprintf("The path \"%s\" is not changed in pull request.",
+				anchor.getPath()),
+		}
+	}
+
+	if anchor.Line == 0 && anchor.LineType == "" {
+		return nil
+	}
+
+	if file.findHunk(anchor) == nil {
+		return statusError{
+			http.StatusConflict,
+			fmt.Sprintf("Line %d of type %s is not in the diff of \"%s\".",
+				anchor.Line, anchor.LineType, anchor.getPath()),
+		}
+	}
+
+	return nil
+}
+
+// changeComment modifies or deletes comment of the user. Version of
+// comment should match the given one.
+func (server *Server) changeComment(
+	pr *PullRequest, id string, request *http.Request,
+) (interface{}, error) {
+	commentId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errNotFound(request.URL.Path)
+	}
+
+	comment, parent := pr.findComment(commentId)
+	if comment == nil {
+		return nil, errNoComment(commentId)
+	}
+
+	if request.Method == "GET" {
+		return encodeComment(comment), nil
+	}
+
+	if comment.Author.Name != server.User.Name {
+		return nil, statusError{
+			http.StatusForbidden,
+			"You are not permitted to change comments of other users.",
+		}
+	}
+
+	version := request.URL.Query().Get("version")
+
+	switch request.Method {
+	case "PUT":
+		payload := struct {
+			Text    string
+			Version *int
+		}{}
+
+		err := json.NewDecoder(request.Body).Decode(&payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if payload.Version != nil {
+			version = fmt.Sprint(*payload.Version)
+		}
+
+		if version != fmt.Sprint(comment.Version) {
+			return nil, errOutdatedComment()
+		}
+
+		comment.Text = payload.Text
+		comment.Version++
+		comment.UpdatedDate = now()
+
+		return encodeComment(comment), nil
+	case "DELETE":
+		if version != fmt.Sprint(comment.Version) {
+			return nil, errOutdatedComment()
+		}
+
+		if len(comment.Replies) > 0 {
+			return nil, statusError{
+				http.StatusConflict,
+				"This comment has replies which must be deleted first.",
+			}
+		}
+
+		pr.removeComment(comment, parent)
+
+		return nil, nil
+	}
+
+	return nil, errNotAllowed(request)
+}
+
+func errNotFound(path string) error {
+	return statusError{
+		http.StatusNotFound,
+		fmt.Sprintf("Resource %s is not found.", path),
+	}
+}
+
+func errNotAllowed(request *http.Request) error {
+	return statusError{
+		http.StatusMethodNotAllowed,
+		fmt.Sprintf("Method %s is not supported by %s.",
+			request.Method, request.URL.Path),
+	}
+}
+
+func errNoComment(id int64) error {
+	return statusError{
+		http.StatusNotFound,
+		fmt.Sprintf("Comment %d does not exist.", id),
+	}
+}
+
+func errOutdatedComment() error {
+	return statusError{
+		http.StatusConflict,
+		"You are attempting to modify a comment based on out-of-date " +
+			"information.",
+	}
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+
+	json.NewEncoder(writer).Encode(value)
+}
+
+// writeError writes error in the same form as Stash does.
+func writeError(writer http.ResponseWriter, err statusError) {
+	writeJSON(writer, err.status, map[string]interface{}{
+		"errors": []map[string]interface{}{
+			{"message": err.message},
+		},
+	})
+}
+
+// now returns current time in milliseconds, as Stash returns dates.
+func now() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,345 @@
+package stashtest
+
+import (
+	"github.com/seletskiy/godiff"
+)
+
+// User is user of Stash, who authors pull requests and comments.
+type User struct {
+	Name         string
+	DisplayName  string
+	EmailAddress string
+}
+
+// PullRequest is state of pull request served by Server. It can be changed
+// by test between requests, e.g. to add commits or comments, which are
+// made by other users.
+type PullRequest struct {
+	// key of project, personal projects are given as '~user'
+	Project string
+	Repo    string
+
+	Id          int64
+	Version     int64
+	Title       string
+	Description string
+	State       string
+	Author      User
+
+	FromBranch string
+	ToBranch   string
+
+	// LatestCommit is head of source branch, BaseCommit is commit of
+	// target branch, which pull request is diffed against.
+	LatestCommit string
+	BaseCommit   string
+
+	Files []*File
+
+	// comments to pull request, its files and lines, replies are nested
+	Comments []*Comment
+
+	// names of users, who watch pull request
+	Watchers []string
+
+	// review statuses of users by their names: APPROVED, UNAPPROVED or
+	// NEEDS_WORK
+	Statuses map[string]string
+
+	CreatedDate int64
+	UpdatedDate int64
+}
+
+// File is file changed in pull request along with its diff.
+type File struct {
+	// Path is path of file in pull request, which is the path of deleted
+	// file for deleted ones. SrcPath is set only for moved and copied
+	// files.
+	Path    string
+	SrcPath string
+
+	// ADD, MODIFY, DELETE, MOVE or COPY, MODIFY if empty
+	ChangeType string
+
+	Hunks []*Hunk
+}
+
+// Hunk is part of diff starting at given lines of source and destination.
+// Numbers of every line are counted by Server, context lines are served as
+// is regardless of requested amount.
+type Hunk struct {
+	SourceLine      int64
+	DestinationLine int64
+	Segments        []*Segment
+}
+
+// Segment is sequence of lines of the same godiff segment type.
+type Segment struct {
+	Type  string
+	Lines []string
+}
+
+// Comment is comment of pull request.
+type Comment struct {
+	Id      int64
+	Version int
+	Text    string
+	Author  User
+
+	// Anchor is nil for comments to pull request and for replies, which
+	// are anchored to their parents.
+	Anchor *Anchor
+
+	Replies []*Comment
+
+	CreatedDate int64
+	UpdatedDate int64
+}
+
+// Anchor is location of comment in pull request. Line is number of line in
+// destination file, or in source file for removed lines. Comments to file
+// have neither line nor line type.
+type Anchor struct {
+	Path     string
+	SrcPath  string
+	Line     int64
+	LineType string
+}
+
+// getPath returns path of file comment is anchored to, which is source
+// path for deleted files.
+func (anchor *Anchor) getPath() string {
+	if anchor.Path == "" {
+		return anchor.SrcPath
+	}
+
+	return anchor.Path
+}
+
+// line is line of diff with its numbers in source and destination files.
+type line struct {
+	source      int64
+	destination int64
+	text        string
+}
+
+// CannedPullRequest returns open pull request proj/repo/1 by John Doe with
+// single modified file main.go and without comments.
+func CannedPullRequest() *PullRequest {
+	return &PullRequest{
+		Project:     "proj",
+		Repo:        "repo",
+		Id:          1,
+		Title:       "Greet the world",
+		Description: "Hello is said to the world instead of nobody.",
+		State:       "OPEN",
+		Author: User{
+			Name:         "john",
+			DisplayName:  "John Doe",
+			EmailAddress: "john@example.com",
+		},
+		FromBranch:   "feature",
+		ToBranch:     "master",
+		LatestCommit: "a8f5f167f44f4964e6c998dee827110c6f5a4f3e",
+		BaseCommit:   "c3499c2729730a7f807efb8676a92dcb6f8a3f8f",
+		Files: []*File{
+			{
+				Path: "main.go",
+				Hunks: []*Hunk{
+					{
+						SourceLine:      1,
+						DestinationLine: 1,
+						Segments: []*Segment{
+							{godiff.SegmentTypeContext, []string{
+								"package main",
+								"",
+								"func main() {",
+							}},
+							{godiff.SegmentTypeRemoved, []string{
+								"\tprintln()",
+							}},
+							{godiff.SegmentTypeAdded, []string{
+								"\tprintln(\"hello\")",
+								"\tprintln(\"world\")",
+							}},
+							{godiff.SegmentTypeContext, []string{
+								"}",
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// getSourcePath returns path of file before change, which is empty for
+// added files.
+func (file *File) getSourcePath() string {
+	switch {
+	case file.ChangeType == "ADD":
+		return ""
+	case file.SrcPath != "":
+		return file.SrcPath
+	default:
+		return file.Path
+	}
+}
+
+// getDestinationPath returns path of file after change, which is empty for
+// deleted files.
+func (file *File) getDestinationPath() string {
+	if file.ChangeType == "DELETE" {
+		return ""
+	}
+
+	return file.Path
+}
+
+func (file *File) getChangeType() string {
+	if file.ChangeType == "" {
+		return "MODIFY"
+	}
+
+	return file.ChangeType
+}
+
+// getLines returns lines of every segment of hunk with their numbers.
+func (hunk *Hunk) getLines() [][]line {
+	source, destination := hunk.SourceLine, hunk.DestinationLine
+
+	result := [][]line{}
+	for _, segment := range hunk.Segments {
+		lines := []line{}
+		for _, text := range segment.Lines {
+			lines = append(lines, line{source, destination, text})
+
+			if segment.Type != godiff.SegmentTypeAdded {
+				source++
+			}
+
+			if segment.Type != godiff.SegmentTypeRemoved {
+				destination++
+			}
+		}
+
+		result = append(result, lines)
+	}
+
+	return result
+}
+
+// hasLine returns whether line of given type and number is in hunk.
+func (hunk *Hunk) hasLine(lineType string, number int64) bool {
+	for i, lines := range hunk.getLines() {
+		if hunk.Segments[i].Type != lineType {
+			continue
+		}
+
+		for _, line := range lines {
+			if line.getNumber(lineType) == number {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// getNumber returns number of line which comments are anchored to.
+func (line line) getNumber(lineType string) int64 {
+	if lineType == godiff.SegmentTypeRemoved {
+		return line.source
+	}
+
+	return line.destination
+}
+
+// findHunk returns hunk of file containing line which comment is anchored
+// to.
+func (file *File) findHunk(anchor *Anchor) *Hunk {
+	for _, hunk := range file.Hunks {
+		if hunk.hasLine(anchor.LineType, anchor.Line) {
+			return hunk
+		}
+	}
+
+	return nil
+}
+
+func (pr *PullRequest) findFile(path string) *File {
+	for _, file := range pr.Files {
+		if file.Path == path {
+			return file
+		}
+	}
+
+	return nil
+}
+
+// findComment returns comment with given id and its parent, which is nil
+// for top level comments.
+func (pr *PullRequest) findComment(id int64) (*Comment, *Comment) {
+	var find func(comments []*Comment, parent *Comment) (*Comment, *Comment)
+
+	find = func(comments []*Comment, parent *Comment) (*Comment, *Comment) {
+		for _, comment := range comments {
+			if comment.Id == id {
+				return comment, parent
+			}
+
+			found, foundParent := find(comment.Replies, comment)
+			if found != nil {
+				return found, foundParent
+			}
+		}
+
+		return nil, nil
+	}
+
+	return find(pr.Comments, nil)
+}
+
+// removeComment removes comment from pull request or from replies of its
+// parent.
+func (pr *PullRequest) removeComment(comment *Comment, parent *Comment) {
+	comments := &pr.Comments
+	if parent != nil {
+		comments = &parent.Replies
+	}
+
+	for i, found := range *comments {
+		if found == comment {
+			*comments = append((*comments)[:i], (*comments)[i+1:]...)
+			return
+		}
+	}
+}
+
+// setWatching adds user to watchers of pull request or removes user from
+// them.
+func (pr *PullRequest) setWatching(user string, watching bool) {
+	for i, watcher := range pr.Watchers {
+		if watcher == user {
+			if !watching {
+				pr.Watchers = append(pr.Watchers[:i], pr.Watchers[i+1:]...)
+			}
+
+			return
+		}
+	}
+
+	if watching {
+		pr.Watchers = append(pr.Watchers, user)
+	}
+}
+
+// countComments returns number of comments including replies.
+func countComments(comments []*Comment) int {
+	count := 0
+	for _, comment := range comments {
+		count += 1 + countComments(comment.Replies)
+	}
+
+	return count
+}
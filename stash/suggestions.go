@@ -0,0 +1,274 @@
+package stash
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/seletskiy/godiff"
+)
+
+// patchContext is number of unchanged lines around suggested lines in patch.
+const patchContext = 3
+
+var (
+	reSuggestionStart = regexp.MustCompile("^\\s*(```|~~~)\\s*suggestion\\s*$")
+	reSuggestionEnd   = regexp.MustCompile("^\\s*(```|~~~)\\s*$")
+)
+
+// Suggestion is replacement of the commented line, which is proposed by
+// the ```suggestion block in the line comment.
+type Suggestion struct {
+	Comment *godiff.Comment
+
+	Path     string
+	Line     int64
+	Original string
+	Lines    []string
+}
+
+func (suggested Suggestion) String() string {
+	replacement := "(line is removed)"
+	if len(suggested.Lines) > 0 {
+		replacement = Indent(strings.Join(suggested.Lines, "\n"), " + ")
+	}
+
+	return fmt.Sprintf(
+		"Suggestion <%d> by %s to %s:%d:\n%s\n%s",
+		suggested.Comment.Id, suggested.Comment.Author.DisplayName,
+		suggested.Path, suggested.Line,
+		Indent(suggested.Original, " - "), replacement,
+	)
+}
+
+// IsActual returns true if suggested line is not changed since suggestion
+// was made.
+func (suggested Suggestion) IsActual(content []string) bool {
+	return suggested.Line >= 1 && suggested.Line <= int64(len(content)) &&
+		content[suggested.Line-1] == suggested.Original
+}
+
+// getSuggestionLines returns lines of the first suggestion block in the
+// comment text. Empty suggestion means that line should be removed.
+func getSuggestionLines(text string) ([]string, bool) {
+	var lines []string
+
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case lines == nil && reSuggestionStart.MatchString(line):
+			lines = []string{}
+		case lines == nil:
+			continue
+		case reSuggestionEnd.MatchString(line):
+			return lines, true
+		default:
+			lines = append(lines, line)
+		}
+	}
+
+	// unclosed block is just a text
+	return nil, false
+}
+
+// formatSuggestions writes suggestion blocks of the comment with fences,
+// which are understood by Stash and by apply-suggestions command.
+func formatSuggestions(text string) string {
+	lines := strings.Split(text, "\n")
+
+	inSuggestion := false
+	for i, line := range lines {
+		switch {
+		case !inSuggestion && reSuggestionStart.MatchString(line):
+			lines[i] = "```suggestion"
+			inSuggestion = true
+		case inSuggestion && reSuggestionEnd.MatchString(line):
+			lines[i] = "```"
+			inSuggestion = false
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// GetSuggestions returns suggestions made in line comments of review.
+// Suggestions to removed lines are skipped, because there is nothing to
+// replace.
+func (review *Review) GetSuggestions() []Suggestion {
+	suggestions := []Suggestion{}
+
+	review.Changeset.ForEachLine(
+		func(
+			diff *godiff.Diff, _ *godiff.Hunk,
+			segment *godiff.Segment, line *godiff.Line,
+		) error {
+			if segment.Type == godiff.SegmentTypeRemoved {
+				return nil
+			}
+
+			for _, comment := range line.Comments {
+				lines, ok := getSuggestionLines(comment.Text)
+				if !ok {
+					continue
+				}
+
+				suggestions = append(suggestions, Suggestion{
+					Comment:  comment,
+					Path:     diff.Destination.ToString,
+					Line:     line.Destination,
+					Original: line.Line,
+					Lines:    lines,
+				})
+			}
+
+			return nil
+		})
+
+	return suggestions
+}
+
+// ReplaceSuggestedLines returns content of file with suggested lines
+// replaced. Suggestions should be sorted by line and should not share lines.
+func ReplaceSuggestedLines(
+	content []string, suggestions []Suggestion,
+) []string {
+	result := []string{}
+
+	next := int64(1)
+	for _, suggested := range suggestions {
+		result = append(result, content[next-1:suggested.Line-1]...)
+		result = append(result, suggested.Lines...)
+		next = suggested.Line + 1
+	}
+
+	return append(result, content[next-1:]...)
+}
+
+// JoinFileLines returns content of file consisting of given lines, which
+// uses the same line endings as the original content and ends with line
+// break only if the original one does.
+func JoinFileLines(lines []string, original []byte) string {
+	ending := "\n"
+	if bytes.Contains(original, []byte("\r\n")) {
+		ending = "\r\n"
+	}
+
+	joined := []string{}
+	for _, line := range lines {
+		joined = append(joined, strings.TrimSuffix(line, "\r"))
+	}
+
+	content := strings.Join(joined, ending)
+	if len(original) == 0 || bytes.HasSuffix(original, []byte("\n")) {
+		content += ending
+	}
+
+	return content
+}
+
+// FormatSuggestionsPatch returns unified diff of file, which applies given
+// suggestions. Suggestions should be sorted by line and should not share
+// lines.
+func FormatSuggestionsPatch(
+	path string, content []string, suggestions []Suggestion,
+) string {
+	buffer := &bytes.Buffer{}
+
+	fmt.Fprintf(buffer, "--- a/%s\n+++ b/%s\n", path, path)
+
+	// difference between line numbers of new and old files
+	offset := int64(0)
+
+	for i := 0; i < len(suggestions); {
+		// suggestions with overlapping context are put in the same hunk
+		end := i + 1
+		for end < len(suggestions) &&
+			suggestions[end].Line-suggestions[end-1].Line <= 2*patchContext+1 {
+			end++
+		}
+
+		group := suggestions[i:end]
+
+		first := group[0].Line - patchContext
+		if first < 1 {
+			first = 1
+		}
+
+		last := group[len(group)-1].Line + patchContext
+		if last > int64(len(content)) {
+			last = int64(len(content))
+		}
+
+		hunk := []string{}
+		removed, added := int64(0), int64(0)
+
+		next := 0
+		for number := first; number <= last; number++ {
+			if next < len(group) && group[next].Line == number {
+				hunk = append(hunk, "-"+content[number-1])
+				for _, line := range group[next].Lines {
+					hunk = append(hunk, "+"+line)
+				}
+
+				removed++
+				added += int64(len(group[next].Lines))
+				next++
+
+				continue
+			}
+
+			hunk = append(hunk, " "+content[number-1])
+			removed++
+			added++
+		}
+
+		fmt.Fprintf(buffer, "@@ -%s +%s @@\n",
+			formatHunkRange(first, removed),
+			formatHunkRange(first+offset, added),
+		)
+
+		for _, line := range hunk {
+			fmt.Fprintln(buffer, line)
+		}
+
+		offset += added - removed
+		i = end
+	}
+
+	return buffer.String()
+}
+
+func formatHunkRange(start int64, count int64) string {
+	// empty range points to the line after which lines are added
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// GroupSuggestions returns suggestions by path, sorted by line. Only first
+// Suggestion to the line is kept, because they can not be applied both.
+func GroupSuggestions(suggestions []Suggestion) map[string][]Suggestion {
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Line < suggestions[j].Line
+	})
+
+	files := map[string][]Suggestion{}
+	for _, suggested := range suggestions {
+		previous := files[suggested.Path]
+		if len(previous) > 0 &&
+			previous[len(previous)-1].Line == suggested.Line {
+			logger.Warning(
+				"skipping suggestion <%d>: line %s:%d is already suggested",
+				suggested.Comment.Id, suggested.Path, suggested.Line,
+			)
+			continue
+		}
+
+		files[suggested.Path] = append(previous, suggested)
+	}
+
+	return files
+}
@@ -0,0 +1,88 @@
+package stash
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetSuggestionLines(t *testing.T) {
+	lines, ok := getSuggestionLines(
+		"better name:\n``` suggestion\nfoo := bar\n```\nwhat do you think?",
+	)
+	if !ok || !reflect.DeepEqual(lines, []string{"foo := bar"}) {
+		t.Fatalf("unexpected suggestion: %q %v", lines, ok)
+	}
+
+	_, ok = getSuggestionLines("```suggestion\nunclosed")
+	if ok {
+		t.Fatalf("unclosed block is treated as suggestion")
+	}
+
+	lines, ok = getSuggestionLines("remove it\n```suggestion\n```")
+	if !ok || len(lines) != 0 {
+		t.Fatalf("unexpected empty suggestion: %q %v", lines, ok)
+	}
+}
+
+func TestFormatSuggestionsPatch(t *testing.T) {
+	content := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+
+	suggestions := []Suggestion{
+		{Line: 2, Original: "2", Lines: []string{"two", "2.5"}},
+		{Line: 9, Original: "9", Lines: []string{}},
+	}
+
+	expected := strings.Join([]string{
+		"--- a/file",
+		"+++ b/file",
+		"@@ -1,10 +1,10 @@",
+		" 1",
+		"-2",
+		"+two",
+		"+2.5",
+		" 3",
+		" 4",
+		" 5",
+		" 6",
+		" 7",
+		" 8",
+		"-9",
+		" 10",
+		"",
+	}, "\n")
+
+	patch := FormatSuggestionsPatch("file", content, suggestions)
+	if patch != expected {
+		t.Fatalf("unexpected patch:\n%s", patch)
+	}
+
+	replaced := ReplaceSuggestedLines(content, suggestions)
+	if !reflect.DeepEqual(replaced, []string{
+		"1", "two", "2.5", "3", "4", "5", "6", "7", "8", "10",
+	}) {
+		t.Fatalf("unexpected content: %q", replaced)
+	}
+}
+
+func TestJoinFileLines(t *testing.T) {
+	lines := []string{"first", "second"}
+
+	tests := []struct {
+		original string
+		expected string
+	}{
+		{"a\nb\n", "first\nsecond\n"},
+		{"a\nb", "first\nsecond"},
+		{"a\r\nb\r\n", "first\r\nsecond\r\n"},
+		{"a\r\nb", "first\r\nsecond"},
+		{"", "first\nsecond\n"},
+	}
+
+	for _, test := range tests {
+		actual := JoinFileLines(lines, []byte(test.original))
+		if actual != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.original, test.expected, actual)
+		}
+	}
+}
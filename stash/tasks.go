@@ -0,0 +1,224 @@
+package stash
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/seletskiy/godiff"
+)
+
+const (
+	TaskOpen     = "OPEN"
+	TaskResolved = "RESOLVED"
+)
+
+// Matches both rendered tasks like '[x] TASK: text' and new tasks, which
+// can be added just by writing 'TASK: text' in the comment.
+var reTaskLine = regexp.MustCompile(`^(?:\[([ xX])\] )?TASK: (.*)$`)
+
+type Task struct {
+	Id     int64
+	Text   string
+	State  string
+	Anchor struct {
+		Id int64
+	}
+}
+
+func (task Task) String() string {
+	marker := " "
+	if task.State == TaskResolved {
+		marker = "x"
+	}
+
+	return fmt.Sprintf("[%s] TASK: %s", marker, task.Text)
+}
+
+type TaskAdded struct {
+	Comment *godiff.Comment
+	Text    string
+}
+
+func (added TaskAdded) String() string {
+	return fmt.Sprintf(
+		"Task added:\n%s\n%s",
+		Indent(added.Comment.Text, " | "),
+		Indent(added.Text, "    > "),
+	)
+}
+
+func (c TaskAdded) GetPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"text": c.Text,
+		"anchor": map[string]interface{}{
+			"id":   c.Comment.Id,
+			"type": "COMMENT",
+		},
+	}
+}
+
+type TaskStateChanged struct {
+	Task  *Task
+	State string
+}
+
+func (changed TaskStateChanged) String() string {
+	return fmt.Sprintf(
+		"Task state changed to %s:\n%s",
+		changed.State,
+		Indent(changed.Task.Text, " > "),
+	)
+}
+
+func (c TaskStateChanged) GetPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"id":    c.Task.Id,
+		"state": c.State,
+	}
+}
+
+// AddTasks renders tasks in the text of comments they are attached to, so
+// they can be resolved right from the review file.
+func (review *Review) AddTasks(tasks []*Task) {
+	review.tasks = make(map[int64][]*Task)
+	for _, task := range tasks {
+		review.tasks[task.Anchor.Id] = append(
+			review.tasks[task.Anchor.Id], task,
+		)
+	}
+
+	review.Changeset.ForEachComment(
+		func(_ *godiff.Diff, comment, _ *godiff.Comment) {
+			for _, task := range review.tasks[comment.Id] {
+				comment.Text += "\n" + task.String()
+			}
+		})
+}
+
+func (review *Review) matchTaskChanges(
+	comment *godiff.Comment, tasks []*Task,
+) []ReviewChange {
+	changes := make([]ReviewChange, 0)
+
+	for _, task := range tasks {
+		existTask := findTask(review.tasks[comment.Id], task.Text)
+		switch {
+		case existTask == nil:
+			changes = append(changes, TaskAdded{comment, task.Text})
+		case existTask.State != task.State:
+			changes = append(changes, TaskStateChanged{existTask, task.State})
+		}
+	}
+
+	return changes
+}
+
+func findTask(tasks []*Task, text string) *Task {
+	for _, task := range tasks {
+		if strings.TrimSpace(task.Text) == text {
+			return task
+		}
+	}
+
+	return nil
+}
+
+// extractTasks splits comment text onto the comment itself and tasks that
+// are written in it.
+func extractTasks(text string) (string, []*Task) {
+	lines := []string{}
+	tasks := []*Task{}
+
+	for _, line := range strings.Split(text, "\n") {
+		matches := reTaskLine.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			lines = append(lines, line)
+			continue
+		}
+
+		state := TaskOpen
+		if strings.ToLower(matches[1]) == "x" {
+			state = TaskResolved
+		}
+
+		tasks = append(tasks, &Task{
+			Text:  strings.TrimSpace(matches[2]),
+			State: state,
+		})
+	}
+
+	if len(tasks) == 0 {
+		return text, tasks
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")), tasks
+}
+
+func (pr *PullRequest) GetTasks() ([]*Task, error) {
+	err := pr.RequireCapability(capabilityTasks)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*Task{}
+
+	err = pr.DoGetPaged(pr.Resource, "tasks", nil, 1000, true,
+		func(values json.RawMessage) error {
+			page := []*Task{}
+			err := json.Unmarshal(values, &page)
+			if err != nil {
+				return err
+			}
+
+			result = append(result, page...)
+
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("successfully got tasks from Stash")
+
+	return result, nil
+}
+
+func (pr *PullRequest) addTask(change TaskAdded) error {
+	err := pr.RequireCapability(capabilityTasks)
+	if err != nil {
+		return err
+	}
+
+	result := Task{}
+
+	err = pr.DoPost(
+		pr.GetResource().Res("api/1.0").Res("tasks", &result),
+		change.GetPayload(),
+	)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("task added: <%d>", result.Id)
+
+	return nil
+}
+
+func (pr *PullRequest) changeTaskState(change TaskStateChanged) error {
+	result := Task{}
+
+	err := pr.DoPut(
+		pr.GetResource().Res("api/1.0").Res("tasks").
+			Id(fmt.Sprint(change.Task.Id), &result),
+		change.GetPayload(),
+	)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("task state changed: <%d>, %s", result.Id, result.State)
+
+	return nil
+}
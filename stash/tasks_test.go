@@ -0,0 +1,47 @@
+package stash
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractTasks(t *testing.T) {
+	tests := []struct {
+		text          string
+		expectedText  string
+		expectedTasks []*Task
+	}{
+		{
+			"just a comment",
+			"just a comment",
+			[]*Task{},
+		},
+		{
+			"comment\n[ ] TASK: open one\n[x] TASK: resolved one",
+			"comment",
+			[]*Task{
+				{Text: "open one", State: TaskOpen},
+				{Text: "resolved one", State: TaskResolved},
+			},
+		},
+		{
+			"TASK: new one",
+			"",
+			[]*Task{
+				{Text: "new one", State: TaskOpen},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		text, tasks := extractTasks(test.text)
+		if text != test.expectedText {
+			t.Fatalf("unexpected comment text: %q instead of %q",
+				text, test.expectedText)
+		}
+
+		if !reflect.DeepEqual(tasks, test.expectedTasks) {
+			t.Fatalf("unexpected tasks\n%#v\n%#v", tasks, test.expectedTasks)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package stash
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+// bodies are truncated in trace, because diffs can be huge
+const maxTracedBodySize = 4096
+
+// requests are traced by separate logger, so they are not mixed with debug
+// messages when --trace is used without --debug
+var traceLogger = logging.MustGetLogger("trace")
+
+// TracingTransport logs every request and response with their headers and
+// bodies; secrets are redacted.
+type TracingTransport struct {
+	Next http.RoundTripper
+}
+
+func (transport TracingTransport) RoundTrip(
+	request *http.Request,
+) (*http.Response, error) {
+	body, err := readTracedBody(&request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	traceLogger.Info(
+		"--> %s %s\n%s%s", request.Method, request.URL,
+		formatTracedHeaders(request.Header), formatTracedBody(body),
+	)
+
+	started := time.Now()
+
+	response, err := transport.Next.RoundTrip(request)
+	if err != nil {
+		traceLogger.Info(
+			"<-- %s %s: %s (%s)", request.Method, request.URL, err.Error(),
+			time.Since(started),
+		)
+
+		return nil, err
+	}
+
+	latency := time.Since(started)
+
+	body, err = readTracedBody(&response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	traceLogger.Info(
+		"<-- %s %s: %s (%s)\n%s%s", request.Method, request.URL,
+		response.Status, latency,
+		formatTracedHeaders(response.Header), formatTracedBody(body),
+	)
+
+	return response, nil
+}
+
+// readTracedBody reads body and replaces it with the copy, so it can be
+// read again by the client.
+func readTracedBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+
+	return data, nil
+}
+
+func formatTracedHeaders(headers http.Header) string {
+	keys := []string{}
+	for key := range headers {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	result := ""
+	for _, key := range keys {
+		for _, value := range headers[key] {
+			result += RedactSecrets(key+": "+value) + "\n"
+		}
+	}
+
+	return result
+}
+
+func formatTracedBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	if len(body) > maxTracedBodySize {
+		return fmt.Sprintf(
+			"%s... (%d bytes total)\n",
+			RedactSecrets(string(body[:maxTracedBodySize])), len(body),
+		)
+	}
+
+	return RedactSecrets(string(body)) + "\n"
+}
+
+var reSecrets = []*regexp.Regexp{
+	// values of -p, --pass and --token flags
+	regexp.MustCompile(`((?:^|[\s\[])(?:-p|--pass|--token)(?:=|\s+))([^\s\]]+)`),
+
+	// Authorization header, e.g. 'Authorization: Basic ...'
+	regexp.MustCompile(`((?i:authorization)"?[:=]\s*"?(?:\[)?(?:\w+ )?)([^\s"\]]+)`),
+
+	// password fields of web login form and JSON payloads
+	regexp.MustCompile(`((?i:j_password=|"password"\s*:\s*"))([^"&\s]+)`),
+
+	// session cookies, e.g. 'JSESSIONID=...'
+	regexp.MustCompile(`((?i:jsessionid|seraph\.[\w.]+|crowd\.token_key)=)([^\s;,"\]]+)`),
+}
+
+// RedactSecrets replaces passwords, tokens and session cookies in the given
+// text, so it can be safely written to the logs.
+func RedactSecrets(text string) string {
+	for _, re := range reSecrets {
+		text = re.ReplaceAllStringFunc(text, func(match string) string {
+			matches := re.FindStringSubmatch(match)
+			return matches[1] + logging.Redact(matches[2])
+		})
+	}
+
+	return text
+}
@@ -0,0 +1,40 @@
+package stash
+
+import (
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{
+			"[--pass secret --user john -p=other repo/1 review]",
+			"[--pass ****** --user john -p=***** repo/1 review]",
+		},
+		{
+			"[--token=abc --pass-cmd pass]",
+			"[--token=*** --pass-cmd pass]",
+		},
+		{
+			"map[Authorization:[Basic am9objpzZWNyZXQ=]]",
+			"map[Authorization:[Basic ****************]]",
+		},
+		{
+			`j_username=john&j_password=secret {"password": "other"}`,
+			`j_username=john&j_password=****** {"password": "*****"}`,
+		},
+		{
+			"Cookie: JSESSIONID=0123; seraph.rememberme.cookie=abc",
+			"Cookie: JSESSIONID=****; seraph.rememberme.cookie=***",
+		},
+	}
+
+	for _, test := range tests {
+		actual := RedactSecrets(test.text)
+		if actual != test.expected {
+			t.Fatalf("unexpected redaction\n%s\n%s", test.expected, actual)
+		}
+	}
+}
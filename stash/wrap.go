@@ -0,0 +1,258 @@
+package stash
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/seletskiy/godiff"
+)
+
+// Line is not continued by words which start new markdown block or task,
+// because such continuation will not be joined back.
+var reBlockStart = regexp.MustCompile("^([-*+>#\\[]|\\d+[.)]|```|TASK:)")
+
+var reCodeFence = regexp.MustCompile("^\\s*```")
+
+const quotePrefix = "> "
+
+// wrapping is comment wrapped by WrapComments: its text before and after
+// wrapping and line breaks, which are made by wrapping, as pairs of lines
+// around them.
+type wrapping struct {
+	original string
+	wrapped  string
+	breaks   map[string]bool
+}
+
+// WrapComments wraps long lines of comments to fit given width, so they are
+// readable in editor. Wrapped lines are joined back by Compare.
+func (review *Review) WrapComments(width int) {
+	review.WrapWidth = width
+	review.wrappings = map[int64]*wrapping{}
+
+	wrapped := map[*godiff.Comment]bool{}
+
+	review.Changeset.ForEachComment(
+		func(_ *godiff.Diff, comment, _ *godiff.Comment) {
+			if wrapped[comment] {
+				return
+			}
+
+			wrapped[comment] = true
+
+			text, breaks := wrapTextBreaks(comment.Text, width)
+			if len(breaks) > 0 {
+				review.wrappings[comment.Id] = &wrapping{
+					original: comment.Text,
+					wrapped:  text,
+					breaks:   breaks,
+				}
+			}
+
+			comment.Text = text
+		})
+}
+
+// unwrapComments joins lines of comments, which are wrapped in the original
+// review. Only lines wrapped by WrapComments are joined, so line breaks
+// made by user are kept, and new comments are never changed. If original
+// review is read from file, it is unknown which lines are wrapped, and lines
+// are joined if they look wrapped.
+func (review *Review) unwrapComments(original *Review) {
+	unwrapped := map[*godiff.Comment]bool{}
+
+	review.Changeset.ForEachComment(
+		func(_ *godiff.Diff, comment, _ *godiff.Comment) {
+			if unwrapped[comment] {
+				return
+			}
+
+			unwrapped[comment] = true
+
+			if original.wrappings == nil {
+				comment.Text = unwrapText(comment.Text, original.WrapWidth)
+				return
+			}
+
+			wrapping := original.wrappings[comment.Id]
+			switch {
+			case comment.Id == 0 || wrapping == nil:
+				return
+			case TrimCommentSpaces(comment.Text) ==
+				TrimCommentSpaces(wrapping.wrapped):
+				comment.Text = wrapping.original
+			default:
+				comment.Text = joinLines(comment.Text, wrapping.breaks)
+			}
+		})
+}
+
+// wrapText wraps lines longer than given width on spaces. Code blocks and
+// tasks are not wrapped.
+func wrapText(text string, width int) string {
+	text, _ = wrapTextBreaks(text, width)
+	return text
+}
+
+// wrapTextBreaks wraps text like wrapText and returns made line breaks as
+// pairs of lines around them.
+func wrapTextBreaks(text string, width int) (string, map[string]bool) {
+	breaks := map[string]bool{}
+
+	if width <= 0 {
+		return text, breaks
+	}
+
+	lines := []string{}
+	inCode := false
+
+	for _, line := range strings.Split(text, "\n") {
+		if reCodeFence.MatchString(line) {
+			inCode = !inCode
+			lines = append(lines, line)
+			continue
+		}
+
+		if inCode || getTextWidth(line) <= width || isTaskLine(line) {
+			lines = append(lines, line)
+			continue
+		}
+
+		prefix, content := splitQuotePrefix(line)
+
+		for i, wrapped := range wrapLine(content, width-len(prefix)) {
+			if i > 0 {
+				breaks[getBreakKey(lines[len(lines)-1], prefix+wrapped)] = true
+			}
+
+			lines = append(lines, prefix+wrapped)
+		}
+	}
+
+	return strings.Join(lines, "\n"), breaks
+}
+
+// joinLines joins lines of text, which are separated by given breaks.
+func joinLines(text string, breaks map[string]bool) string {
+	lines := []string{}
+
+	// previous is line as it is written in text, before joining
+	previous := ""
+
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 && breaks[getBreakKey(previous, line)] {
+			_, content := splitQuotePrefix(line)
+			lines[len(lines)-1] += " " + content
+			previous = line
+			continue
+		}
+
+		previous = line
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func getBreakKey(line string, next string) string {
+	return strings.TrimRight(line, " ") + "\n" + strings.TrimRight(next, " ")
+}
+
+// getTextWidth returns number of characters in text, so non-ASCII text is
+// wrapped at the same width as ASCII one.
+func getTextWidth(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// wrapLine splits line on single spaces, so joining wrapped lines with
+// space gives original line back.
+func wrapLine(line string, width int) []string {
+	lines := []string{}
+	current := ""
+
+	for i, word := range strings.Split(line, " ") {
+		if i > 0 && canBreakBefore(current, word, width) {
+			lines = append(lines, current)
+			current = word
+			continue
+		}
+
+		if i > 0 {
+			current += " "
+		}
+
+		current += word
+	}
+
+	return append(lines, current)
+}
+
+func canBreakBefore(current string, word string, width int) bool {
+	return getTextWidth(current)+1+getTextWidth(word) > width &&
+		word != "" &&
+		strings.TrimSpace(current) != "" &&
+		!strings.HasSuffix(current, " ") &&
+		!reBlockStart.MatchString(word)
+}
+
+// unwrapText joins lines which were wrapped by wrapText. Line is considered
+// wrapped if the first word of the next line does not fit in it.
+func unwrapText(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+
+	lines := []string{}
+	inCode := false
+	joinable := false
+
+	// previous is line as it is written in text, before joining
+	previous := ""
+
+	for _, line := range strings.Split(text, "\n") {
+		if reCodeFence.MatchString(line) {
+			inCode = !inCode
+			joinable = false
+			lines = append(lines, line)
+			continue
+		}
+
+		if inCode || strings.TrimSpace(line) == "" || isTaskLine(line) {
+			joinable = false
+			lines = append(lines, line)
+			continue
+		}
+
+		if joinable {
+			previousPrefix, previousContent := splitQuotePrefix(previous)
+			prefix, content := splitQuotePrefix(line)
+			word := strings.SplitN(content, " ", 2)[0]
+
+			if prefix == previousPrefix &&
+				canBreakBefore(previousContent, word, width-len(prefix)) {
+				lines[len(lines)-1] += " " + content
+				previous = line
+				continue
+			}
+		}
+
+		joinable = true
+		previous = line
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func splitQuotePrefix(line string) (string, string) {
+	if !strings.HasPrefix(line, ">") {
+		return "", line
+	}
+
+	return quotePrefix, strings.TrimPrefix(line[1:], " ")
+}
+
+func isTaskLine(line string) bool {
+	return reTaskLine.MatchString(strings.TrimSpace(line))
+}
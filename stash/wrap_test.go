@@ -0,0 +1,64 @@
+package stash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrapText(t *testing.T) {
+	text := "This comment is long enough to be wrapped, " +
+		"but - list marker is not moved to the next line.\n" +
+		"\n" +
+		"> quoted text is wrapped too and quote prefix is kept on every line\n" +
+		"```\n" +
+		"code is never wrapped, even if it is very very very long\n" +
+		"```\n" +
+		"[ ] TASK: tasks are not wrapped too, because they are single line\n" +
+		"short line"
+
+	wrapped := wrapText(text, 20)
+
+	for _, line := range strings.Split(wrapped, "\n") {
+		if strings.HasPrefix(line, "- ") || line == ">" {
+			t.Fatalf("unexpected line %q in wrapped text:\n%s", line, wrapped)
+		}
+	}
+
+	if wrapped == text {
+		t.Fatalf("text is not wrapped")
+	}
+
+	unwrapped := unwrapText(wrapped, 20)
+	if unwrapped != text {
+		t.Fatalf("unexpected unwrapped text\n%q\n%q", text, unwrapped)
+	}
+}
+
+func TestWrapTextCountsCharacters(t *testing.T) {
+	text := "Привет мир, этот комментарий написан по-русски"
+
+	expected := "Привет мир, этот\nкомментарий написан\nпо-русски"
+
+	wrapped := wrapText(text, 20)
+	if wrapped != expected {
+		t.Fatalf("unexpected wrapped text\n%q\n%q", expected, wrapped)
+	}
+}
+
+func TestJoinLinesKeepsUserBreaks(t *testing.T) {
+	text := "This comment is long enough to be wrapped by ash.\n" +
+		"This line is\n" +
+		"broken by user."
+
+	wrapped, breaks := wrapTextBreaks(text, 20)
+
+	// user edits comment, so it is not restored as a whole
+	edited := wrapped + "\nAnd a new line is added."
+
+	expected := text + "\nAnd a new line is added."
+
+	actual := joinLines(edited, breaks)
+	if actual != expected {
+		t.Fatalf("unexpected joined text\n%q\n%q", expected, actual)
+	}
+}